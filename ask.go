@@ -0,0 +1,24 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// statelessFooter - пометка под ответом на вопрос вне контекста
+const statelessFooter = "🔒 вне контекста"
+
+// ask обрабатывает команду /ask <вопрос>: разовый ответ только по системному промпту, без истории,
+// фактов из памяти и базы знаний. Вопрос и ответ не сохраняются в разговор, но учитываются в лимитах.
+func (b *Bot) ask(message *tgbotapi.Message) error {
+	prompt := strings.TrimSpace(message.CommandArguments())
+	if prompt == "" {
+		return b.reply(message, "Использование: /ask <вопрос>\n\n"+
+			"Отвечу без учёта нашего разговора и ничего из него не запомню.")
+	}
+	in := chatInputFrom(message, prompt)
+	in.Stateless = true
+	return b.answerPrompt(context.Background(), in, message.MessageID)
+}
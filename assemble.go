@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// contextTokenBudget - сколько токенов (примерно) может занять весь запрос без ответа модели
+const contextTokenBudget = 6000
+
+// systemPromptParts - части системного промпта одного ответа
+type systemPromptParts struct {
+	Prefix string   // Общая основа всех персон (/prompt_prefix или SYSTEM_PROMPT_PREFIX)
+	Pinned string   // Промпт, закреплённый за разговором (/system)
+	Style  string   // Промпт стиля общения
+	Lines  []string // Короткие указания: язык, простой текст, имя, дата, город
+	Blocks []string // Крупные блоки: память, база знаний, похожие разговоры, цитата
+}
+
+// buildSystemPrompt собирает системный промпт. Порядок частей задаётся только здесь:
+//
+//  1. общий префикс - кто такой бот и чего он не делает, одинаково для всех;
+//  2. промпт, закреплённый за разговором;
+//  3. промпт стиля;
+//  4. короткие указания - каждое с новой строки;
+//  5. крупные блоки - каждый через пустую строку.
+//
+// Пустые части пропускаются.
+func buildSystemPrompt(p systemPromptParts) string {
+	var head []string
+	for _, part := range []string{p.Prefix, p.Pinned, p.Style} {
+		if part != "" {
+			head = append(head, part)
+		}
+	}
+	prompt := strings.Join(head, "\n\n")
+	for _, line := range p.Lines {
+		if line != "" {
+			prompt += "\n" + line
+		}
+	}
+	for _, block := range p.Blocks {
+		if block != "" {
+			prompt += "\n\n" + block
+		}
+	}
+	return prompt
+}
+
+// contextParts - всё, что может попасть в запрос к модели, по группам приоритета
+type contextParts struct {
+	System    systemPromptParts // Обязательно: системный промпт (цитата тоже здесь, в Blocks)
+	Prompt    string            // Обязательно: новое сообщение пользователя
+	History   []ChatMessage     // Прошлые пары вопрос-ответ, старые первыми
+	Memory    string            // Блок фактов из /remember
+	Retrieved []string          // Найденные фрагменты: база знаний, похожие разговоры
+}
+
+// contextReport - что осталось за бортом при сборке запроса (для /debug)
+type contextReport struct {
+	Budget           int
+	Tokens           int  // Оценка итогового запроса
+	DroppedRetrieved int  // Сколько найденных блоков не вошло
+	DroppedMemory    bool // Не вошёл блок фактов
+	DroppedPairs     int  // Сколько старых пар истории не вошло
+	KeptPairs        int
+	OverBudget       bool // Даже обязательные части не уложились в бюджет
+}
+
+// String - краткое описание для отладочного вывода
+func (r contextReport) String() string {
+	text := fmt.Sprintf("~%d из %d токенов, пар истории: %d", r.Tokens, r.Budget, r.KeptPairs)
+	var dropped []string
+	if r.DroppedPairs > 0 {
+		dropped = append(dropped, fmt.Sprintf("старых пар: %d", r.DroppedPairs))
+	}
+	if r.DroppedMemory {
+		dropped = append(dropped, "факты из памяти")
+	}
+	if r.DroppedRetrieved > 0 {
+		dropped = append(dropped, fmt.Sprintf("найденных блоков: %d", r.DroppedRetrieved))
+	}
+	if len(dropped) > 0 {
+		text += "; отброшено: " + strings.Join(dropped, ", ")
+	}
+	if r.OverBudget {
+		text += "; обязательные части больше бюджета"
+	}
+	return text
+}
+
+// assembleContext собирает сообщения запроса так, чтобы они уложились в budget токенов.
+// Приоритет частей, от обязательных к самым лёгким на выброс:
+//
+//	системный промпт > новое сообщение > свежие пары истории > факты из памяти > найденные фрагменты.
+//
+// Лишнее отбрасывается снизу вверх: сначала найденные фрагменты (последние первыми), затем факты,
+// затем пары истории от самых старых. Пара вопрос-ответ отбрасывается только целиком.
+// Системный промпт и новое сообщение остаются всегда, даже если сами не помещаются.
+func assembleContext(p contextParts, budget int) ([]ChatMessage, contextReport) {
+	report := contextReport{Budget: budget}
+	pairs := historyPairs(p.History)
+	retrieved := nonEmpty(p.Retrieved)
+	memory := p.Memory
+
+	pairTokens := make([]int, len(pairs))
+	historyTotal := 0
+	for i, pair := range pairs {
+		for _, msg := range pair {
+			pairTokens[i] += estimateTokens(msg.Content)
+		}
+		historyTotal += pairTokens[i]
+	}
+	required := estimateTokens(buildSystemPrompt(p.System)) + estimateTokens(p.Prompt)
+	total := func() int {
+		n := required + historyTotal
+		if memory != "" {
+			n += estimateTokens(memory)
+		}
+		for _, block := range retrieved {
+			n += estimateTokens(block)
+		}
+		return n
+	}
+
+	for total() > budget && len(retrieved) > 0 {
+		retrieved = retrieved[:len(retrieved)-1]
+		report.DroppedRetrieved++
+	}
+	if total() > budget && memory != "" {
+		memory, report.DroppedMemory = "", true
+	}
+	for total() > budget && len(pairs) > 0 {
+		historyTotal -= pairTokens[0]
+		pairs, pairTokens = pairs[1:], pairTokens[1:]
+		report.DroppedPairs++
+	}
+	report.Tokens, report.KeptPairs = total(), len(pairs)
+	report.OverBudget = report.Tokens > budget
+
+	system := p.System
+	system.Blocks = append(append([]string{memory}, retrieved...), p.System.Blocks...)
+	messages := []ChatMessage{{Role: "system", Content: buildSystemPrompt(system)}}
+	for _, pair := range pairs {
+		messages = append(messages, pair...)
+	}
+	messages = append(messages, ChatMessage{Role: "user", Content: p.Prompt})
+	return messages, report
+}
+
+// historyPairs делит историю на пары: вопрос пользователя и следующие за ним ответы.
+// Ответы без вопроса в начале (вопрос уже вытеснен из окна) не берутся вовсе.
+func historyPairs(history []ChatMessage) [][]ChatMessage {
+	var pairs [][]ChatMessage
+	for _, msg := range history {
+		if msg.Role == "user" || len(pairs) == 0 {
+			if msg.Role != "user" {
+				continue
+			}
+			pairs = append(pairs, []ChatMessage{msg})
+			continue
+		}
+		pairs[len(pairs)-1] = append(pairs[len(pairs)-1], msg)
+	}
+	return pairs
+}
+
+// nonEmpty возвращает непустые строки
+func nonEmpty(items []string) []string {
+	var out []string
+	for _, item := range items {
+		if item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildSystemPromptOrder(t *testing.T) {
+	parts := systemPromptParts{
+		Prefix: "ПРЕФИКС",
+		Pinned: "ЗАКРЕПЛЁННЫЙ",
+		Style:  "СТИЛЬ",
+		Lines:  []string{"ЯЗЫК", "", "ДАТА"},
+		Blocks: []string{"ПАМЯТЬ", "", "ЦИТАТА"},
+	}
+	want := "ПРЕФИКС\n\nЗАКРЕПЛЁННЫЙ\n\nСТИЛЬ\nЯЗЫК\nДАТА\n\nПАМЯТЬ\n\nЦИТАТА"
+	if got := buildSystemPrompt(parts); got != want {
+		t.Errorf("buildSystemPrompt:\n получено: %q\n ожидалось: %q", got, want)
+	}
+}
+
+func TestBuildSystemPromptSkipsEmptyParts(t *testing.T) {
+	tests := []struct {
+		name  string
+		parts systemPromptParts
+		want  string
+	}{
+		{"только стиль", systemPromptParts{Style: "СТИЛЬ"}, "СТИЛЬ"},
+		{"без префикса", systemPromptParts{Pinned: "ЗАКРЕПЛЁННЫЙ", Style: "СТИЛЬ"}, "ЗАКРЕПЛЁННЫЙ\n\nСТИЛЬ"},
+		{"без закреплённого", systemPromptParts{Prefix: "ПРЕФИКС", Style: "СТИЛЬ", Lines: []string{"ЯЗЫК"}}, "ПРЕФИКС\n\nСТИЛЬ\nЯЗЫК"},
+		{"пусто", systemPromptParts{}, ""},
+	}
+	for _, tt := range tests {
+		if got := buildSystemPrompt(tt.parts); got != tt.want {
+			t.Errorf("%s: получено %q, ожидалось %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// Память и найденные фрагменты assembleContext ставит после указаний, но перед собственными блоками промпта
+func TestAssembleContextSystemOrder(t *testing.T) {
+	messages, _ := assembleContext(contextParts{
+		System: systemPromptParts{
+			Prefix: "ПРЕФИКС",
+			Pinned: "ЗАКРЕПЛЁННЫЙ",
+			Style:  "СТИЛЬ",
+			Lines:  []string{"ЯЗЫК"},
+			Blocks: []string{"ЦИТАТА"},
+		},
+		Prompt:    "вопрос",
+		Memory:    "ПАМЯТЬ",
+		Retrieved: []string{"БАЗА ЗНАНИЙ", "ПОХОЖИЙ РАЗГОВОР"},
+	}, contextTokenBudget)
+
+	if len(messages) != 2 || messages[0].Role != "system" || messages[1].Content != "вопрос" {
+		t.Fatalf("неожиданные сообщения: %+v", messages)
+	}
+	system := messages[0].Content
+	order := []string{"ПРЕФИКС", "ЗАКРЕПЛЁННЫЙ", "СТИЛЬ", "ЯЗЫК", "ПАМЯТЬ", "БАЗА ЗНАНИЙ", "ПОХОЖИЙ РАЗГОВОР", "ЦИТАТА"}
+	last := -1
+	for _, part := range order {
+		i := strings.Index(system, part)
+		if i < 0 {
+			t.Fatalf("в системном промпте нет %q:\n%s", part, system)
+		}
+		if i < last {
+			t.Fatalf("%q стоит не на своём месте, порядок должен быть %v:\n%s", part, order, system)
+		}
+		last = i
+	}
+}
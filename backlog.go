@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// skipPendingUpdates отбрасывает накопившиеся за время простоя обновления (SKIP_PENDING_UPDATES).
+// getUpdates с offset -1 возвращает только последнее обновление; опрос продолжается со следующего.
+// Возвращает offset, с которого начинать получать обновления.
+func skipPendingUpdates(api *tgbotapi.BotAPI) (int, error) {
+	info, err := api.GetWebhookInfo()
+	if err != nil {
+		return 0, fmt.Errorf("ошибка получения числа ожидающих обновлений: %w", err)
+	}
+	if info.PendingUpdateCount == 0 {
+		return 0, nil
+	}
+
+	updates, err := api.GetUpdates(tgbotapi.UpdateConfig{Offset: -1, Limit: 1})
+	if err != nil {
+		return 0, fmt.Errorf("ошибка пропуска ожидающих обновлений: %w", err)
+	}
+	if len(updates) == 0 {
+		return 0, nil
+	}
+	log.Printf("Пропущено накопившихся обновлений: %d", info.PendingUpdateCount)
+	return updates[len(updates)-1].UpdateID + 1, nil
+}
+
+// staleUpdateMiddleware пропускает сообщения старше MAX_UPDATE_AGE, чтобы не отвечать на давно устаревшие вопросы
+func (b *Bot) staleUpdateMiddleware(next UpdateHandler) UpdateHandler {
+	return func(ctx context.Context, update tgbotapi.Update) error {
+		if b.cfg().MaxUpdateAge <= 0 {
+			return next(ctx, update)
+		}
+		message := update.Message
+		if message == nil {
+			message = update.ChannelPost
+		}
+		if message != nil && time.Since(message.Time()) > b.cfg().MaxUpdateAge {
+			updateInfoFrom(ctx).Handler = "stale"
+			return nil
+		}
+		return next(ctx, update)
+	}
+}
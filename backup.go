@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// backupMu не даёт двум копиям базы сниматься одновременно: база одна на все боты процесса
+var backupMu sync.Mutex
+
+// errBackupRunning - предыдущая копия ещё снимается
+var errBackupRunning = errors.New("предыдущая резервная копия ещё не готова")
+
+// snapshotDB делает согласованную копию базы во временный файл через VACUUM INTO.
+// В отличие от копирования файла, в копию попадает и содержимое WAL. Файл удаляет вызывающий.
+func (b *Bot) snapshotDB() (string, error) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("tgbot-backup-%s.db", time.Now().Format("20060102-150405")))
+	os.Remove(path) // VACUUM INTO не перезаписывает существующий файл
+	if _, err := b.db.Exec("VACUUM INTO ?", path); err != nil {
+		return "", fmt.Errorf("ошибка создания копии базы: %w", err)
+	}
+	return path, nil
+}
+
+// sendBackup снимает копию базы и отправляет её документом в чат chatID
+func (b *Bot) sendBackup(chatID int64) error {
+	if !backupMu.TryLock() {
+		return errBackupRunning
+	}
+	path, err := b.snapshotDB()
+	backupMu.Unlock()
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+	return b.sendBackupFile(chatID, path)
+}
+
+// sendBackupFile отправляет готовую копию базы документом в чат chatID
+func (b *Bot) sendBackupFile(chatID int64, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения копии базы: %w", err)
+	}
+	if info.Size() > exportFileLimit {
+		return fmt.Errorf("копия базы весит %d МБ, а Telegram принимает не больше %d МБ; уменьшите HISTORY_RETENTION_DAYS и запустите /maintenance",
+			info.Size()>>20, exportFileLimit>>20)
+	}
+
+	doc := tgbotapi.NewDocument(chatID, tgbotapi.FilePath(path))
+	doc.Caption = fmt.Sprintf("🗄 Резервная копия базы, %s, %d КБ", time.Now().Format("2006-01-02 15:04"), info.Size()>>10)
+	if _, err := b.api.Send(doc); err != nil {
+		return fmt.Errorf("ошибка отправки копии базы: %w", err)
+	}
+	return nil
+}
+
+// backup обрабатывает команду /backup: копия уходит в админский чат, а если он не задан - в текущий
+func (b *Bot) backup(message *tgbotapi.Message) error {
+	chatID := b.cfg().AdminChatID
+	if chatID == 0 {
+		chatID = message.Chat.ID
+	}
+	if err := b.sendBackup(chatID); err != nil {
+		b.reply(message, "❌ "+err.Error())
+		return err
+	}
+	if chatID != message.Chat.ID {
+		return b.reply(message, "✅ Копия базы отправлена в админский чат.")
+	}
+	return nil
+}
+
+// backupLoop раз в сутки в BACKUP_HOUR отправляет копию базы в админский чат
+func (b *Bot) backupLoop() {
+	for {
+		time.Sleep(time.Until(nextDailyRun(time.Now(), b.cfg().BackupHour)))
+
+		if err := b.sendBackup(b.cfg().AdminChatID); err != nil {
+			slog.Error("ошибка автоматического бэкапа", "error", err)
+			b.notifyAdmin("⚠️ Автоматический бэкап не удался: " + err.Error())
+			continue
+		}
+		slog.Info("автоматический бэкап отправлен")
+	}
+}
+
+// scheduledBackupLoop раз в BACKUP_INTERVAL сохраняет копию базы в BACKUP_DIR,
+// оставляя BACKUP_RETAIN последних, и при BACKUP_TO_TELEGRAM отправляет её в админский чат
+func (b *Bot) scheduledBackupLoop() {
+	ticker := time.NewTicker(b.cfg().BackupInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		path, err := b.saveBackup()
+		if err != nil {
+			slog.Error("ошибка плановой резервной копии", "error", err)
+			b.notifyAdmin("⚠️ Плановая резервная копия не удалась: " + err.Error())
+			continue
+		}
+		slog.Info("плановая резервная копия сохранена", "path", path)
+
+		if b.cfg().BackupToTelegram {
+			if err := b.sendBackupFile(b.cfg().AdminChatID, path); err != nil {
+				slog.Error("ошибка отправки плановой резервной копии", "error", err)
+				b.notifyAdmin("⚠️ Копия сохранена в " + path + ", но не отправлена: " + err.Error())
+			}
+		}
+	}
+}
+
+// saveBackup снимает копию базы в BACKUP_DIR под именем с временем и удаляет лишние старые копии
+func (b *Bot) saveBackup() (string, error) {
+	if !backupMu.TryLock() {
+		return "", errBackupRunning
+	}
+	defer backupMu.Unlock()
+
+	if err := os.MkdirAll(b.cfg().BackupDir, 0o700); err != nil {
+		return "", fmt.Errorf("ошибка создания каталога резервных копий: %w", err)
+	}
+	path := filepath.Join(b.cfg().BackupDir, fmt.Sprintf("tgbot-%s.db", time.Now().Format("20060102-150405")))
+	os.Remove(path) // VACUUM INTO не перезаписывает существующий файл
+	if _, err := b.db.Exec("VACUUM INTO ?", path); err != nil {
+		os.Remove(path)
+		return "", fmt.Errorf("ошибка создания копии базы: %w", err)
+	}
+	return path, pruneBackups(b.cfg().BackupDir, b.cfg().BackupRetain)
+}
+
+// pruneBackups оставляет в каталоге retain самых свежих копий; имена с временем сортируются хронологически
+func pruneBackups(dir string, retain int) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "tgbot-*.db"))
+	if err != nil {
+		return fmt.Errorf("ошибка поиска старых резервных копий: %w", err)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(paths)))
+	for _, path := range paths[min(retain, len(paths)):] {
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("ошибка удаления старой резервной копии: %w", err)
+		}
+	}
+	return nil
+}
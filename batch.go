@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	batchMinQuestions = 3  // Со скольких пронумерованных вопросов обычное сообщение считается пакетом
+	batchMaxQuestions = 10 // Больше вопросов за раз не отвечаем: каждый - отдельный запрос к модели
+)
+
+// numberedLinePattern - строка вида "1. вопрос" или "2) вопрос"
+var numberedLinePattern = regexp.MustCompile(`^\s*(\d{1,2})[.)]\s+(.+)$`)
+
+// numberedQuestions достаёт вопросы из пронумерованного списка. Нумерация должна идти подряд с единицы;
+// строки без номера после первого пункта дописываются к предыдущему вопросу, текст до списка отбрасывается.
+func numberedQuestions(text string) []string {
+	var questions []string
+	for _, line := range strings.Split(text, "\n") {
+		if match := numberedLinePattern.FindStringSubmatch(line); match != nil && match[1] == fmt.Sprint(len(questions)+1) {
+			questions = append(questions, strings.TrimSpace(match[2]))
+			continue
+		}
+		if line = strings.TrimSpace(line); line != "" && len(questions) > 0 {
+			questions[len(questions)-1] += "\n" + line
+		}
+	}
+	return questions
+}
+
+// batchQuestions разбирает аргумент /batch: пронумерованный список или по вопросу на строку
+func batchQuestions(text string) []string {
+	if questions := numberedQuestions(text); len(questions) >= 2 {
+		return questions
+	}
+	var questions []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			questions = append(questions, line)
+		}
+	}
+	return questions
+}
+
+// batch обрабатывает команду /batch: каждый вопрос из списка получает отдельный ответ
+func (b *Bot) batch(message *tgbotapi.Message) error {
+	text := message.CommandArguments()
+	if text == "" && message.ReplyToMessage != nil {
+		text = message.ReplyToMessage.Text
+	}
+	questions := batchQuestions(text)
+	if len(questions) == 0 {
+		return b.reply(message, "Пришли вопросы после /batch - пронумерованным списком или по одному на строку, "+
+			"и я отвечу на каждый отдельно. Можно и ответом на сообщение со списком.")
+	}
+	return b.answerBatch(context.Background(), message, questions)
+}
+
+// batchAnswer - результат одного вопроса из пакета
+type batchAnswer struct {
+	question string
+	answer   string
+	err      error
+}
+
+// answerBatch отвечает на вопросы по очереди, каждый отдельным запросом к модели.
+// Короткие ответы собираются в одно сообщение, длинные уходят отдельными сообщениями.
+// Ошибка на одном вопросе не прерывает остальные: он просто помечается как неотвеченный.
+func (b *Bot) answerBatch(ctx context.Context, message *tgbotapi.Message, questions []string) error {
+	if len(questions) > batchMaxQuestions {
+		return b.reply(message, fmt.Sprintf("За раз я отвечаю максимум на %d вопросов, а тут %d. Раздели список, пожалуйста.",
+			batchMaxQuestions, len(questions)))
+	}
+
+	placeholder := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("⌛ Отвечаю на %d вопросов...", len(questions)))
+	placeholder.ReplyToMessageID = message.MessageID
+	sent, err := b.api.Send(placeholder)
+	if err != nil {
+		return fmt.Errorf("ошибка отправки сообщения: %w", err)
+	}
+
+	answers := make([]batchAnswer, len(questions))
+	failed := 0
+	for i, question := range questions {
+		answers[i].question = question
+		in := chatInputFrom(message, question)
+		in.RequestID = updateInfoFrom(ctx).RequestID
+		turn := b.prepareChat(ctx, in)
+		if err := b.checkLimits(in, turn); err != nil {
+			answers[i].err = err
+			failed++
+			continue
+		}
+		aiResponse, err := b.completeChat(ctx, in, turn)
+		if err != nil {
+			answers[i].err = err
+			failed++
+			continue
+		}
+		answers[i].answer = aiResponse.Content
+		b.saveChat(in, turn, aiResponse)
+
+		if i < len(questions)-1 {
+			progress := tgbotapi.NewEditMessageText(message.Chat.ID, sent.MessageID,
+				fmt.Sprintf("⌛ Отвечаю на %d вопросов... готово %d", len(questions), i+1))
+			b.api.Send(progress) // Прогресс необязателен, ошибку можно не проверять
+		}
+	}
+
+	sections := formatBatchSections(answers)
+	combined := strings.Join(sections, "\n\n")
+	if len([]rune(combined)) <= messageTextLimit {
+		if _, err := b.deliverAnswer(message.Chat.ID, sent.MessageID, message.MessageID, combined); err != nil {
+			return fmt.Errorf("ошибка отправки ответов: %w", err)
+		}
+	} else {
+		b.deleteMessage(message.Chat.ID, sent.MessageID)
+		for _, section := range sections {
+			if err := b.sendAnswerParts(message.Chat.ID, message.MessageID, section); err != nil {
+				return err
+			}
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("не удалось ответить на %d из %d вопросов: %w", failed, len(questions), firstBatchError(answers))
+	}
+	return nil
+}
+
+// formatBatchSections собирает разделы "1) вопрос — ответ"; неотвеченные вопросы помечаются
+func formatBatchSections(answers []batchAnswer) []string {
+	sections := make([]string, len(answers))
+	for i, a := range answers {
+		question := truncateRunes(strings.ReplaceAll(a.question, "\n", " "), 200)
+		var limitErr *limitError
+		if errors.As(a.err, &limitErr) {
+			sections[i] = fmt.Sprintf("%d) %s\n%s", i+1, question, limitErr.text)
+			continue
+		}
+		if a.err != nil {
+			sections[i] = fmt.Sprintf("%d) %s\n❌ Не удалось ответить, спроси этот вопрос отдельно.", i+1, question)
+			continue
+		}
+		sections[i] = fmt.Sprintf("%d) %s\n\n%s", i+1, question, a.answer)
+	}
+	return sections
+}
+
+// firstBatchError возвращает первую ошибку пакета (для лога)
+func firstBatchError(answers []batchAnswer) error {
+	for _, a := range answers {
+		if a.err != nil {
+			return a.err
+		}
+	}
+	return nil
+}
+
+// sendAnswerParts отправляет текст новым сообщением (частями, если он длинный) ответом на replyTo
+func (b *Bot) sendAnswerParts(chatID int64, replyTo int, text string) error {
+	for _, part := range splitMessage(renderTables(text), messageTextLimit) {
+		_, err := b.sendFormatted(part, func(text, parseMode string) tgbotapi.Chattable {
+			msg := tgbotapi.NewMessage(chatID, text)
+			msg.ParseMode = parseMode
+			msg.ReplyToMessageID = replyTo
+			return msg
+		})
+		if err != nil {
+			return fmt.Errorf("ошибка отправки ответа: %w", err)
+		}
+	}
+	return nil
+}
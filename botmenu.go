@@ -0,0 +1,123 @@
+package main
+
+import (
+	"log/slog"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// commandTranslations - описания команд для меню "/" на других языках.
+// Русское описание берётся из реестра; если перевода нет, используется оно.
+var commandTranslations = map[string]map[string]string{
+	"en": {
+		"start":            "Welcome and short help",
+		"style":            "Choose the answer style",
+		"settings":         "My settings",
+		"context":          "How many history messages to use (0..30)",
+		"replylang":        "Pin the answer language (code or auto)",
+		"remember":         "Remember a fact about me",
+		"memory":           "What the bot remembers about me",
+		"whoami":           "What the bot stores about me",
+		"stats":            "My usage statistics",
+		"new":              "Start a new conversation",
+		"chats":            "My conversations",
+		"rename":           "Rename the current conversation",
+		"system":           "Pin a prompt to the current conversation",
+		"undo":             "Forget the last exchange (/undo N for several)",
+		"history":          "What I remember from the current conversation",
+		"reset":            "Clear the current conversation",
+		"save":             "Save a prompt (as a reply to my message)",
+		"saved":            "Saved prompts",
+		"kbd":              "Favorite prompts as keyboard buttons (on/off)",
+		"batch":            "Answer a list of questions one by one",
+		"recall":           "Recall similar past conversations (on/off)",
+		"kb":               "Knowledge base from your documents",
+		"random":           "Random question idea",
+		"templates":        "Ready-made prompt templates",
+		"search":           "Search my history",
+		"export":           "Export history (md/json)",
+		"import":           "Import history (file captioned /import)",
+		"privacy":          "Privacy mode (strict/normal)",
+		"forgetme":         "Delete all my data",
+		"name":             "Address me by name (on/off)",
+		"latency":          "Show answer latency (on/off)",
+		"pages":            "Long answers as pages (on/off)",
+		"plain":            "Plain text answers without emoji or formatting (on/off)",
+		"combine":          "Merge messages sent in quick succession (on/off)",
+		"location":         "Timezone and city from a location pin (on/off/clear)",
+		"quiet":            "Quiet hours for bot-initiated messages (/quiet 23:00-08:00)",
+		"ask":              "Question outside the context: no history or memory",
+		"ephemeral":        "Self-deleting answer (/ephemeral 10m <question>)",
+		"json":             "Generate valid JSON",
+		"later":            "Answer a question at a set time",
+		"digest_subscribe": "Daily recap of our conversations",
+		"digest_off":       "Turn off the daily recap",
+		"subscribe":        "Daily or weekly posts on a topic",
+		"subscriptions":    "Topic subscriptions and unsubscribing",
+		"edit":             "Rework the last answer in place",
+		"quiz":             "Quiz on a topic as Telegram polls",
+		"seed":             "Pin a seed for reproducible answers",
+		"tldr":             "Summarize a post (as a reply to it)",
+		"reactions":        "Reactions in this chat (on/off)",
+		"cooldown":         "Pause between answers in this group, seconds",
+		"status":           "Is the bot working: database, model, queue",
+		"version":          "Bot version",
+		"about":            "About the bot",
+		"users":            "List users",
+		"top":              "Most active users",
+		"setuser":          "Change a user's settings",
+		"gencode":          "Mint invite codes",
+		"codes":            "Outstanding invite codes",
+		"inspirations":     "Ideas for /random: stats, add, remove",
+		"prompt_prefix":    "Shared system prompt prefix",
+		"params":           "Personal sampling parameters",
+		"errors":           "Recent errors (or details: /errors <id>)",
+		"deadletters":      "Failed model requests and re-drive",
+		"flagged":          "Answers blocked by moderation",
+		"maintenance":      "Clean up the database now",
+		"dbstats":          "Database statistics",
+		"backup":           "Send a database backup",
+		"debug":            "Debug model requests (on/off)",
+	},
+}
+
+// menuCommands собирает команды для меню на языке lang ("" - русский по умолчанию)
+func (b *Bot) menuCommands(lang string, withAdmin bool) []tgbotapi.BotCommand {
+	var commands []tgbotapi.BotCommand
+	for _, cmd := range b.commandList {
+		if cmd.AdminOnly && !withAdmin {
+			continue
+		}
+		description := cmd.Description
+		if translated, ok := commandTranslations[lang][cmd.Name]; ok {
+			description = translated
+		}
+		commands = append(commands, tgbotapi.BotCommand{Command: cmd.Name, Description: description})
+	}
+	return commands
+}
+
+// publishCommands регистрирует меню команд в Telegram: общее для всех и расширенное
+// (с админскими командами) в личных чатах администраторов. setMyCommands заменяет список целиком,
+// поэтому повторный вызов безопасен. Ошибки только пишутся в лог - без меню бот работает.
+func (b *Bot) publishCommands() {
+	languages := []string{""}
+	for lang := range commandTranslations {
+		languages = append(languages, lang)
+	}
+
+	for _, lang := range languages {
+		b.setMyCommands(tgbotapi.NewBotCommandScopeDefault(), lang, b.menuCommands(lang, false))
+		for _, adminID := range b.cfg().AdminIDs {
+			b.setMyCommands(tgbotapi.NewBotCommandScopeChat(adminID), lang, b.menuCommands(lang, true))
+		}
+	}
+}
+
+// setMyCommands отправляет один список команд для области scope и языка lang
+func (b *Bot) setMyCommands(scope tgbotapi.BotCommandScope, lang string, commands []tgbotapi.BotCommand) {
+	config := tgbotapi.NewSetMyCommandsWithScopeAndLanguage(scope, lang, commands...)
+	if _, err := b.api.Request(config); err != nil {
+		slog.Warn("не удалось зарегистрировать меню команд", "scope", scope.Type, "chat_id", scope.ChatID, "lang", lang, "error", err)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	breakerThreshold = 5                // Столько сбоев подряд размыкают цепь
+	breakerCooldown  = 60 * time.Second // Сколько цепь остаётся разомкнутой до пробного запроса
+)
+
+// errAIUnavailable - цепь разомкнута, запрос к модели даже не отправлялся
+var errAIUnavailable = errors.New("ИИ временно недоступен")
+
+// circuitBreaker перестаёт обращаться к модели после серии сбоев подряд, чтобы пользователи
+// не ждали таймаута на каждом сообщении. После паузы пропускает один пробный запрос:
+// успех замыкает цепь, сбой размыкает её снова.
+type circuitBreaker struct {
+	mu          sync.Mutex
+	failures    int
+	openedUntil time.Time
+	lastSuccess time.Time // Последний успешный запрос к модели (для /status)
+}
+
+// allow сообщает, можно ли сейчас обращаться к модели
+func (c *circuitBreaker) allow(now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.failures < breakerThreshold || !now.Before(c.openedUntil)
+}
+
+// open сообщает, разомкнута ли цепь (для проверки без запроса, например перед кнопкой "Повторить")
+func (c *circuitBreaker) open(now time.Time) bool {
+	return !c.allow(now)
+}
+
+// record учитывает результат запроса к модели; ошибки, не связанные с доступностью, не считаются сбоем
+func (c *circuitBreaker) record(err error, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err == nil {
+		c.failures = 0
+		c.lastSuccess = now
+		return
+	}
+	if !isBackendFailure(err) {
+		return
+	}
+	c.failures++
+	if c.failures >= breakerThreshold {
+		c.openedUntil = now.Add(breakerCooldown)
+	}
+}
+
+// describe описывает состояние цепи для админской статистики
+func (c *circuitBreaker) describe(now time.Time) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch {
+	case c.failures >= breakerThreshold && now.Before(c.openedUntil):
+		return "разомкнута до " + c.openedUntil.Format("15:04:05")
+	case c.failures > 0:
+		return fmt.Sprintf("замкнута, сбоев подряд: %d", c.failures)
+	}
+	return "замкнута"
+}
+
+// lastSuccessAt возвращает время последнего успешного запроса (нулевое, если их не было)
+func (c *circuitBreaker) lastSuccessAt() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastSuccess
+}
+
+// isBackendFailure отличает недоступность модели (сеть, 5xx, 429) от ошибок самого запроса (400 и т.п.)
+func isBackendFailure(err error) bool {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= 500 || apiErr.StatusCode == http.StatusTooManyRequests
+	}
+	return true
+}
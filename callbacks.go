@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// CallbackRoute описывает обработчик inline-кнопок в реестре. Данные кнопки имеют вид "действие:параметр".
+// Обработчик возвращает текст всплывающего уведомления (может быть пустым); на нажатие отвечает сам маршрутизатор.
+type CallbackRoute struct {
+	Action    string // Действие до двоеточия
+	AdminOnly bool   // Кнопку может нажать только администратор
+	OwnerOnly bool   // Кнопку может нажать только тот, чьё сообщение породило клавиатуру
+	Handler   func(query *tgbotapi.CallbackQuery, payload string) (string, error)
+}
+
+// registerCallbacks заполняет реестр обработчиков inline-кнопок
+func (b *Bot) registerCallbacks() {
+	routes := []*CallbackRoute{
+		{Action: "mem_del", OwnerOnly: true, Handler: b.handleMemoryDelete},
+		{Action: "mem_save", Handler: b.memorySuggestionHandler(true)},
+		{Action: "mem_skip", Handler: b.memorySuggestionHandler(false)},
+		{Action: "conv_use", OwnerOnly: true, Handler: b.conversationHandler(false)},
+		{Action: "conv_del", OwnerOnly: true, Handler: b.conversationHandler(true)},
+		{Action: "users", AdminOnly: true, Handler: b.handleUsersCallback},
+		{Action: "forget", OwnerOnly: true, Handler: b.handleForgetCallback},
+		{Action: "retry", OwnerOnly: true, Handler: b.handleRetry},
+		{Action: "prompt_run", OwnerOnly: true, Handler: b.handlePromptRun},
+		{Action: "prompt_del", OwnerOnly: true, Handler: b.handlePromptDelete},
+		{Action: "tpl", OwnerOnly: true, Handler: b.handleTemplateChoice},
+		{Action: "hist_page", OwnerOnly: true, Handler: b.handleHistoryPage},
+		{Action: "hist_undo", OwnerOnly: true, Handler: b.handleHistoryUndo},
+		{Action: "hist_reset", OwnerOnly: true, Handler: b.handleHistoryReset},
+		{Action: "page", Handler: b.handleAnswerPage},
+		{Action: "pin", Handler: b.handlePin},
+		{Action: "share", OwnerOnly: true, Handler: b.handleShare},
+		{Action: "share_ok", Handler: b.shareConfirmHandler(true)},
+		{Action: "share_no", Handler: b.shareConfirmHandler(false)},
+		{Action: "style_set", OwnerOnly: true, Handler: b.handleStyleSet},
+		{Action: "style_preview", Handler: b.handleStylePreview},
+		{Action: "rnd_ask", OwnerOnly: true, Handler: b.handleRandomAsk},
+		{Action: "rnd_next", OwnerOnly: true, Handler: b.handleRandomNext},
+		{Action: "sub_del", OwnerOnly: true, Handler: b.handleSubscriptionDelete},
+	}
+
+	b.callbacks = make(map[string]*CallbackRoute, len(routes))
+	for _, route := range routes {
+		b.callbacks[route.Action] = route
+	}
+}
+
+// handleCallback находит обработчик нажатия по действию, проверяет права и всегда отвечает на нажатие,
+// чтобы у клиента пропали "часики". Нажатия проходят ту же цепочку middleware, что и сообщения.
+func (b *Bot) handleCallback(ctx context.Context, query *tgbotapi.CallbackQuery) error {
+	action, payload, _ := strings.Cut(query.Data, ":")
+	route, ok := b.callbacks[action]
+	if !ok || query.Message == nil {
+		// Кнопка из старой версии бота или из inline-режима, где исходного сообщения нет
+		return b.answerCallback(query, "Кнопка больше не работает")
+	}
+	updateInfoFrom(ctx).Handler = "callback:" + action
+
+	if route.AdminOnly && !b.isAdmin(query.From.ID) {
+		return b.answerCallback(query, "Только для администраторов")
+	}
+	if route.OwnerOnly && !callbackOwner(query) {
+		return b.answerCallback(query, "Эта кнопка не для тебя")
+	}
+
+	notice, err := route.Handler(query, payload)
+	if err != nil && notice == "" {
+		notice = "Не удалось, попробуй позже. Код ошибки: " + updateInfoFrom(ctx).RequestID
+	}
+	if answerErr := b.answerCallback(query, notice); err == nil {
+		err = answerErr
+	}
+	return err
+}
+
+// callbackOwner проверяет, что кнопку нажал автор сообщения, в ответ на которое бот прислал клавиатуру.
+// Если сообщение не было ответом (личка, удалённый оригинал), нажатие разрешено - права проверит обработчик.
+func callbackOwner(query *tgbotapi.CallbackQuery) bool {
+	original := query.Message.ReplyToMessage
+	if original == nil || original.From == nil {
+		return true
+	}
+	return original.From.ID == query.From.ID
+}
+
+// answerCallback отвечает на нажатие кнопки (с всплывающим текстом или без), чтобы у клиента пропали "часики"
+func (b *Bot) answerCallback(query *tgbotapi.CallbackQuery, text string) error {
+	if _, err := b.api.Request(tgbotapi.NewCallback(query.ID, text)); err != nil {
+		return fmt.Errorf("ошибка ответа на нажатие кнопки: %w", err)
+	}
+	return nil
+}
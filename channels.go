@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const summaryPrompt = "Ты кратко пересказываешь посты. Передай суть в 2-4 предложениях на языке поста, без вступлений и оценок."
+
+// senderID возвращает ключ, по которому хранятся настройки отправителя.
+// В каналах message.From пустой, а анонимные админы групп пишут от имени чата,
+// поэтому для них используется ID чата-отправителя или самого чата.
+func senderID(message *tgbotapi.Message) int64 {
+	if message.SenderChat != nil {
+		return message.SenderChat.ID
+	}
+	if message.From != nil {
+		return message.From.ID
+	}
+	return message.Chat.ID
+}
+
+// messageContent возвращает текст сообщения или подпись к медиа
+func messageContent(message *tgbotapi.Message) string {
+	if message.Text != "" {
+		return message.Text
+	}
+	return message.Caption
+}
+
+// tldr обрабатывает /tldr в ответ на пост (в канале или в группе обсуждения) и отвечает кратким пересказом
+func (b *Bot) tldr(message *tgbotapi.Message) error {
+	if message.ReplyToMessage == nil {
+		return b.reply(message, "Отправь /tldr ответом на пост, который нужно пересказать.")
+	}
+
+	text := strings.TrimSpace(messageContent(message.ReplyToMessage))
+	if text == "" {
+		return b.reply(message, "В этом сообщении нет текста для пересказа.")
+	}
+
+	return b.replySummary(message.ReplyToMessage, text)
+}
+
+// autoSummary комментирует новый пост канала кратким пересказом.
+// Пост приходит в связанную группу обсуждения как автоматическая пересылка;
+// ответ на неё становится комментарием под постом. Для этого бот должен быть
+// участником группы обсуждения с выключенным privacy mode или администратором.
+func (b *Bot) autoSummary(message *tgbotapi.Message) error {
+	text := strings.TrimSpace(messageContent(message))
+	if len([]rune(text)) < 200 {
+		return nil // Короткие посты пересказывать незачем
+	}
+	return b.replySummary(message, text)
+}
+
+// replySummary отправляет пересказ text ответом на message
+func (b *Bot) replySummary(message *tgbotapi.Message, text string) error {
+	summary, err := b.makeAIRequest(summaryPrompt, text)
+	if err != nil {
+		return fmt.Errorf("ошибка пересказа поста: %w", err)
+	}
+
+	_, err = b.sendFormatted("📝 Кратко: "+summary.Content, func(text, parseMode string) tgbotapi.Chattable {
+		msg := tgbotapi.NewMessage(message.Chat.ID, text)
+		msg.ParseMode = parseMode
+		msg.ReplyToMessageID = message.MessageID
+		return msg
+	})
+	if err != nil {
+		return fmt.Errorf("ошибка отправки пересказа: %w", err)
+	}
+	return nil
+}
+
+// isAutoSummaryChannel проверяет, включены ли автокомментарии для канала
+func (b *Bot) isAutoSummaryChannel(chatID int64) bool {
+	for _, id := range b.cfg().AutoSummaryChannels {
+		if id == chatID {
+			return true
+		}
+	}
+	return false
+}
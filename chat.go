@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// stylePrompts - системные промпты стилей общения
+var stylePrompts = map[string]string{
+	"friendly": "Ты дружелюбный и теплый ассистент, отвечаешь с использованием эмодзи.",
+	"official": "Ты официальный, строгий и вежливый ассистент. Отвечай без эмодзи.",
+	"meme":     "Ты ассистент, любящий юмор и мемы. Отвечай с забавными фразами и мемами.",
+}
+
+// chatInput - сообщение пользователя без привязки к транспорту: его собирают из Telegram-сообщения или из REPL
+type chatInput struct {
+	UserID    int64
+	ChatID    int64
+	FirstName string // Имя для обращения; пустое - не обращаться по имени
+	Prompt    string
+	RequestID string // Код запроса для логов и сообщений об ошибках (пустой в REPL и фоновых ответах)
+
+	UseKnowledge bool          // Искать в базе знаний /kb, даже если /kb auto выключен
+	Stateless    bool          // Вопрос вне контекста (/ask): без истории и памяти, в историю не сохраняется
+	Ephemeral    time.Duration // Через сколько удалить ответ и вопрос (/ephemeral), 0 - не удалять
+	Reply        string        // Строка промпта о цитате или сообщении, на которое отвечает пользователь
+
+	QueuedAt  time.Time     // Когда сообщение попало в очередь (нулевое - время обработки не считается)
+	QueueWait time.Duration // Ожидание в очереди до начала обработки
+}
+
+// chatInputFrom собирает chatInput из сообщения Telegram
+func chatInputFrom(message *tgbotapi.Message, prompt string) chatInput {
+	in := chatInput{UserID: senderID(message), ChatID: message.Chat.ID, Prompt: prompt}
+	// Сообщение от имени канала или группы - обращаться не к кому
+	if message.From != nil && message.SenderChat == nil {
+		in.FirstName = message.From.FirstName
+	}
+	return in
+}
+
+// chatTurn - собранный запрос к модели по одному сообщению пользователя
+type chatTurn struct {
+	Style    string
+	Privacy  string
+	Messages []ChatMessage
+	Params   SamplingParams
+	Context  contextReport // Что не вошло в запрос из-за бюджета токенов
+}
+
+// prepareChat собирает системный промпт (стиль, закреплённый промпт, язык, имя, факты) и историю.
+// Что из этого попадёт в запрос при нехватке места, решает assembleContext.
+// Ошибки чтения настроек не прерывают ответ: используются значения по умолчанию.
+func (b *Bot) prepareChat(ctx context.Context, in chatInput) *chatTurn {
+	ctx, span := tracer.Start(ctx, "prepare_chat")
+	defer span.End()
+
+	// Получаем стиль пользователя из БД
+	style, err := b.getUserStyle(in.UserID)
+	if err != nil {
+		log.Printf("Ошибка получения стиля пользователя: %v", err)
+		style = "friendly" // Возвращаемся к дружелюбному стилю по умолчанию
+	}
+	var parts systemPromptParts
+	parts.Style = stylePrompts[style]
+	if parts.Style == "" {
+		parts.Style = stylePrompts["friendly"] // По умолчанию дружелюбный
+	}
+	parts.Prefix = b.systemPromptPrefix()
+
+	// Закреплённый за разговором промпт идёт перед стилем. Вопрос вне контекста от разговора не зависит.
+	if !in.Stateless {
+		pinnedPrompt, err := b.activeSystemPrompt(in.UserID)
+		if err != nil {
+			log.Printf("Ошибка получения промпта разговора: %v", err)
+		}
+		parts.Pinned = pinnedPrompt
+	}
+
+	// Язык ответа: закреплённый пользователем или определённый по вопросу
+	replyLang, err := b.getUserReplyLang(in.UserID)
+	if err != nil {
+		log.Printf("Ошибка получения языка ответа: %v", err)
+	}
+	parts.Lines = append(parts.Lines, languageInstruction(replyLang, in.Prompt))
+
+	// Простой текст для экранного диктора (/plain) - поверх любого стиля
+	plain, err := b.getUserPlain(in.UserID)
+	if err != nil {
+		log.Printf("Ошибка получения режима простого текста: %v", err)
+	}
+	if plain {
+		parts.Lines = append(parts.Lines, plainInstruction)
+	}
+
+	// Обращение по имени, если пользователь не отключил его через /name off
+	useName, err := b.getUserUseName(in.UserID)
+	if err != nil {
+		log.Printf("Ошибка получения настройки имени: %v", err)
+	}
+	if useName {
+		parts.Lines = append(parts.Lines, nameInstruction(in.FirstName))
+	}
+
+	// Текущие дата и время в часовой зоне пользователя
+	if b.cfg().TimeInPrompt {
+		loc, err := b.userLocation(in.UserID)
+		if err != nil {
+			log.Printf("Ошибка получения часовой зоны: %v", err)
+		}
+		parts.Lines = append(parts.Lines, nowInstruction(time.Now(), loc))
+	}
+	parts.Lines = append(parts.Lines, b.locationInstruction(in.UserID))
+
+	// Режим приватности нужен и вопросу вне контекста: от него зависит, сохранится ли ответ, заблокированный модерацией
+	privacy, err := b.getUserPrivacy(in.UserID)
+	if err != nil {
+		log.Printf("Ошибка получения режима приватности: %v", err)
+		privacy = privacyStrict // При сомнениях ничего не пишем на диск
+	}
+	var (
+		memory    string
+		history   []ChatMessage
+		retrieved []string
+	)
+	if !in.Stateless {
+		memory, history, retrieved = b.loadContext(ctx, in, privacy)
+	}
+	// Цитата, на которую отвечает пользователь, обязательна: без неё вопрос непонятен
+	parts.Blocks = append(parts.Blocks, in.Reply)
+
+	messages, report := assembleContext(contextParts{
+		System:    parts,
+		Prompt:    in.Prompt,
+		History:   history,
+		Memory:    memory,
+		Retrieved: retrieved,
+	}, contextTokenBudget)
+	if report.OverBudget {
+		log.Printf("Запрос пользователя %d больше бюджета контекста: %s", in.UserID, report)
+	}
+	span.SetAttributes(attribute.String("style", style), attribute.Int("messages", len(messages)),
+		attribute.Int("context_tokens", report.Tokens), attribute.Int("dropped_pairs", report.DroppedPairs))
+	return &chatTurn{
+		Style:    style,
+		Privacy:  privacy,
+		Messages: messages,
+		Params:   b.samplingParams(in.UserID, style),
+		Context:  report,
+	}
+}
+
+// loadContext загружает то, что связывает вопрос с прошлым: факты из /remember, историю разговора
+// и найденные фрагменты (база знаний, похожие старые разговоры)
+func (b *Bot) loadContext(ctx context.Context, in chatInput, privacy string) (memory string, history []ChatMessage, retrieved []string) {
+	// Долговременные факты о пользователе из /remember
+	memories, err := b.getMemories(in.UserID)
+	if err != nil {
+		log.Printf("Ошибка получения фактов о пользователе: %v", err)
+	}
+	memory = memoryInstruction(memories)
+
+	// Подходящие фрагменты документов из /kb
+	retrieved = []string{b.knowledgeInstruction(ctx, in)}
+
+	// История разговора: из базы или, в строгом режиме приватности, из памяти
+	turns, err := b.getUserContextTurns(in.UserID)
+	if err != nil {
+		log.Printf("Ошибка получения окна контекста: %v", err)
+	}
+	_, historySpan := tracer.Start(ctx, "db.load_history", trace.WithAttributes(attribute.Int("turns", turns)))
+	history, err = b.loadHistory(in.UserID, privacy, turns)
+	if err != nil {
+		log.Printf("Ошибка получения истории: %v", err)
+	}
+	recordSpanError(historySpan, err)
+	historySpan.End()
+
+	// Похожие обмены из старых разговоров, которые в окно контекста уже не попали
+	retrieved = append(retrieved, b.recallInstruction(ctx, in, privacy, turns))
+	return memory, history, retrieved
+}
+
+// completeChat отправляет запрос к модели и проверяет ответ модерацией.
+// Заблокированный ответ заменяется отказом, исходный текст остаётся только в /flagged.
+func (b *Bot) completeChat(ctx context.Context, in chatInput, turn *chatTurn) (*AIResponse, error) {
+	aiResponse, err := b.makeChatRequest(ctx, turn.Messages, turn.Params)
+	if err != nil {
+		return nil, err
+	}
+	if b.moderationEnabled() {
+		if verdict := b.moderate(aiResponse.Content); verdict.Flagged {
+			b.recordFlagged(in.UserID, in.ChatID, turn.Privacy, verdict.Category, in.Prompt, aiResponse.Content)
+			aiResponse.Content = moderationRefusal
+		}
+	}
+	return aiResponse, nil
+}
+
+// saveChat сохраняет пару вопрос-ответ в историю и при необходимости придумывает название разговору.
+// Счётчики использования пишутся и в строгом режиме приватности: в них нет текста.
+func (b *Bot) saveChat(in chatInput, turn *chatTurn, aiResponse *AIResponse) {
+	if err := b.recordUsage(in, turn, aiResponse); err != nil {
+		log.Printf("Ошибка записи статистики использования: %v", err)
+	}
+	if in.Stateless {
+		return // Вопрос вне контекста учитывается в лимитах, но в историю не попадает
+	}
+	if err := b.saveExchange(in.UserID, turn.Privacy, in.Prompt, aiResponse); err != nil {
+		log.Printf("Ошибка сохранения истории: %v", err)
+		b.reportError(&updateInfo{Handler: "aiChat", RequestID: in.RequestID, ChatID: in.ChatID, UserID: in.UserID}, err)
+	} else if turn.Privacy != privacyStrict {
+		b.maybeTitleConversation(in.UserID)
+	}
+}
+
+// answerPrompt отвечает на промпт, который пришёл не текстом сообщения (сохранённый промпт, кнопка и т.п.).
+// Ответ прикрепляется к сообщению replyTo; при ошибке плейсхолдер превращается в сообщение о ней.
+func (b *Bot) answerPrompt(ctx context.Context, in chatInput, replyTo int) error {
+	turn := b.prepareChat(ctx, in)
+	if err := b.checkLimits(in, turn); err != nil {
+		refusal := tgbotapi.NewMessage(in.ChatID, err.Error())
+		refusal.ReplyToMessageID = replyTo
+		_, sendErr := b.api.Send(refusal)
+		return sendErr
+	}
+
+	placeholder := tgbotapi.NewMessage(in.ChatID, "⌛ Думаю...")
+	placeholder.ReplyToMessageID = replyTo
+	sent, err := b.api.Send(placeholder)
+	if err != nil {
+		return fmt.Errorf("ошибка отправки сообщения: %w", err)
+	}
+
+	aiResponse, err := b.completeChat(ctx, in, turn)
+	if err != nil {
+		errorText := "😔 Не получилось ответить, попробуй ещё раз чуть позже."
+		if isBackendFailure(err) {
+			errorText = "😴 ИИ сейчас недоступен, попробуй через пару минут."
+		}
+		if _, sendErr := b.api.Send(tgbotapi.NewEditMessageText(in.ChatID, sent.MessageID, errorText)); sendErr != nil {
+			log.Printf("Ошибка отправки сообщения об ошибке: %v", sendErr)
+		}
+		return fmt.Errorf("ошибка запроса к AI: %w", err)
+	}
+	answerText := aiResponse.Content
+	if in.Stateless {
+		answerText += "\n\n" + statelessFooter
+	}
+	if in.Ephemeral > 0 {
+		answerText += "\n\n" + ephemeralFooter(in.Ephemeral)
+	}
+	delivered, err := b.deliverUserAnswer(in.UserID, in.ChatID, sent.MessageID, replyTo, answerText)
+	if err != nil {
+		return fmt.Errorf("ошибка отправки ответа AI: %w", err)
+	}
+	if in.Ephemeral > 0 {
+		b.scheduleAnswerDeletion(in, replyTo, sent.MessageID, delivered)
+	} else if len(delivered) > 0 {
+		b.offerAnswerButtons(in.ChatID, delivered[0].MessageID)
+	}
+	b.saveChat(in, turn, aiResponse)
+	return nil
+}
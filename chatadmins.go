@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const chatAdminsTTL = 10 * time.Minute // Сколько держать в кэше список администраторов чата
+
+// chatAdminCache кэширует администраторов групп, чтобы не спрашивать Telegram на каждую команду
+type chatAdminCache struct {
+	mu      sync.Mutex
+	entries map[int64]chatAdminEntry
+}
+
+type chatAdminEntry struct {
+	admins    map[int64]bool
+	canPin    bool // Может ли сам бот закреплять сообщения
+	fetchedAt time.Time
+}
+
+func newChatAdminCache() *chatAdminCache {
+	return &chatAdminCache{entries: make(map[int64]chatAdminEntry)}
+}
+
+// chatAdmins возвращает администраторов чата из кэша или запрашивает их у Telegram
+func (b *Bot) chatAdmins(chatID int64) (map[int64]bool, error) {
+	entry, err := b.chatAdminEntry(chatID)
+	if err != nil {
+		return nil, err
+	}
+	return entry.admins, nil
+}
+
+// botCanPin проверяет, может ли бот закреплять сообщения в группе. Права бота приходят
+// в том же списке администраторов, поэтому отдельного запроса не нужно.
+func (b *Bot) botCanPin(chatID int64) (bool, error) {
+	entry, err := b.chatAdminEntry(chatID)
+	if err != nil {
+		return false, err
+	}
+	return entry.canPin, nil
+}
+
+// chatAdminEntry возвращает запись кэша по чату, при необходимости запрашивая список у Telegram
+func (b *Bot) chatAdminEntry(chatID int64) (chatAdminEntry, error) {
+	b.chatAdminCache.mu.Lock()
+	entry, ok := b.chatAdminCache.entries[chatID]
+	b.chatAdminCache.mu.Unlock()
+	if ok && time.Since(entry.fetchedAt) < chatAdminsTTL {
+		return entry, nil
+	}
+
+	members, err := b.api.GetChatAdministrators(tgbotapi.ChatAdministratorsConfig{
+		ChatConfig: tgbotapi.ChatConfig{ChatID: chatID},
+	})
+	if err != nil {
+		return chatAdminEntry{}, fmt.Errorf("ошибка получения администраторов чата: %w", err)
+	}
+	entry = chatAdminEntry{admins: make(map[int64]bool, len(members)), fetchedAt: time.Now()}
+	for _, member := range members {
+		if member.User != nil {
+			entry.admins[member.User.ID] = true
+			if member.User.ID == b.api.Self.ID {
+				entry.canPin = member.CanPinMessages
+			}
+		}
+	}
+
+	b.chatAdminCache.mu.Lock()
+	b.chatAdminCache.entries[chatID] = entry
+	b.chatAdminCache.mu.Unlock()
+	return entry, nil
+}
+
+// canConfigureChat проверяет, может ли автор сообщения менять настройки чата.
+// В личке можно всегда; в группе - администраторам чата (в том числе анонимным,
+// которые пишут от имени самой группы) и администраторам бота.
+func (b *Bot) canConfigureChat(message *tgbotapi.Message) (bool, error) {
+	if message.Chat.IsPrivate() {
+		return true, nil
+	}
+	if message.SenderChat != nil {
+		return message.SenderChat.ID == message.Chat.ID, nil
+	}
+	if message.From == nil {
+		return false, nil
+	}
+	if b.isAdmin(message.From.ID) {
+		return true, nil
+	}
+	if message.Chat.IsChannel() {
+		return false, nil
+	}
+	admins, err := b.chatAdmins(message.Chat.ID)
+	if err != nil {
+		return false, err
+	}
+	return admins[message.From.ID], nil
+}
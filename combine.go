@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// inputBuffer - сообщения пользователя, которые ждут, не допишет ли он ещё что-нибудь
+type inputBuffer struct {
+	messages  []*tgbotapi.Message
+	startedAt time.Time
+	timer     *time.Timer
+}
+
+// inputCombiner собирает быстрые сообщения подряд в один вопрос (/combine on).
+// Каждое новое сообщение продлевает окно; по истечении окна, перед командой или при остановке
+// накопленное уходит модели одним запросом с ответом на последнее сообщение.
+type inputCombiner struct {
+	mu      sync.Mutex
+	buffers map[int64]*inputBuffer
+	window  time.Duration
+}
+
+func newInputCombiner(window time.Duration) *inputCombiner {
+	return &inputCombiner{buffers: make(map[int64]*inputBuffer), window: window}
+}
+
+// add дописывает сообщение в буфер пользователя и перезапускает окно; expire вызывается по его истечении
+func (c *inputCombiner) add(userID int64, message *tgbotapi.Message, expire func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	buffer, ok := c.buffers[userID]
+	if !ok {
+		buffer = &inputBuffer{startedAt: time.Now()}
+		c.buffers[userID] = buffer
+	}
+	buffer.messages = append(buffer.messages, message)
+	if buffer.timer != nil {
+		buffer.timer.Stop()
+	}
+	buffer.timer = time.AfterFunc(c.window, expire)
+}
+
+// take забирает буфер пользователя; nil - ничего не накоплено
+func (c *inputCombiner) take(userID int64) *inputBuffer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	buffer, ok := c.buffers[userID]
+	if !ok {
+		return nil
+	}
+	buffer.timer.Stop()
+	delete(c.buffers, userID)
+	return buffer
+}
+
+// takeAll забирает все буферы (при остановке бота)
+func (c *inputCombiner) takeAll() []*inputBuffer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var buffers []*inputBuffer
+	for userID, buffer := range c.buffers {
+		buffer.timer.Stop()
+		buffers = append(buffers, buffer)
+		delete(c.buffers, userID)
+	}
+	return buffers
+}
+
+// combined склеивает тексты буфера в одно сообщение, которое выглядит как последнее из них
+func (buffer *inputBuffer) combined() *tgbotapi.Message {
+	texts := make([]string, len(buffer.messages))
+	for i, m := range buffer.messages {
+		texts[i] = strings.TrimSpace(m.Text)
+	}
+	message := *buffer.messages[len(buffer.messages)-1]
+	message.Text = strings.Join(texts, "\n")
+	message.Entities = nil // Разметка последнего сообщения к склеенному тексту не относится
+	return &message
+}
+
+// bufferInput откладывает текст из личного чата, если пользователь включил /combine.
+// false - сообщение нужно обработать сразу.
+func (b *Bot) bufferInput(message *tgbotapi.Message) bool {
+	if !message.Chat.IsPrivate() {
+		return false
+	}
+	userID := senderID(message)
+	combine, err := b.getUserCombineInput(userID)
+	if err != nil {
+		slog.Error("ошибка получения настройки склейки сообщений", "user_id", userID, "error", err)
+	}
+	if !combine {
+		return false
+	}
+	// По истечении окна ответ встаёт в очередь пользователя, чтобы не обогнать его следующие сообщения
+	b.combiner.add(userID, message, func() {
+		b.queues.Run(userID, func() { b.flushInput(userID) })
+	})
+	return true
+}
+
+// flushInput отвечает на накопленные сообщения пользователя, если они есть
+func (b *Bot) flushInput(userID int64) {
+	if buffer := b.combiner.take(userID); buffer != nil {
+		b.answerBuffered(buffer)
+	}
+}
+
+// flushAllInput отвечает на все накопленные сообщения; вызывается при остановке бота
+func (b *Bot) flushAllInput() {
+	var wg sync.WaitGroup
+	for _, buffer := range b.combiner.takeAll() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.answerBuffered(buffer)
+		}()
+	}
+	wg.Wait()
+}
+
+// answerBuffered отправляет модели склеенные сообщения как один вопрос. Ответ идёт мимо цепочки
+// middleware, поэтому панику перехватывает recoveryMiddleware, подключённый здесь отдельно.
+func (b *Bot) answerBuffered(buffer *inputBuffer) {
+	message := buffer.combined()
+	update := tgbotapi.Update{Message: message}
+	info := newUpdateInfo(update)
+	info.Handler = "aiChat"
+	info.QueuedAt, info.QueueWait = buffer.startedAt, 0
+	ctx := withUpdateInfo(context.Background(), info)
+
+	answer := b.recoveryMiddleware(func(ctx context.Context, _ tgbotapi.Update) error {
+		return b.aiChat(ctx, message)
+	})
+	if err := answer(ctx, update); err != nil {
+		slog.Error("ошибка ответа на склеенные сообщения", "request_id", info.RequestID,
+			"user_id", info.UserID, "messages", len(buffer.messages), "error", err)
+		if !info.Reported {
+			b.reportError(info, err)
+		}
+	}
+}
+
+// setCombineInput обрабатывает команду /combine on|off
+func (b *Bot) setCombineInput(message *tgbotapi.Message) error {
+	combine, ok := parseToggle(message.CommandArguments())
+	if !ok {
+		return b.reply(message, "Использование: /combine on или /combine off\n\n"+
+			"Когда включено, несколько сообщений, отправленных подряд в течение пары секунд, "+
+			"я считаю одним вопросом и отвечаю один раз.")
+	}
+	if err := b.setUserCombineInput(senderID(message), combine); err != nil {
+		b.reply(message, "Не удалось сохранить настройку, попробуй позже.")
+		return err
+	}
+	if combine {
+		return b.reply(message, fmt.Sprintf("🧩 Буду ждать %s после каждого сообщения и отвечать сразу на всё, что ты успел написать. "+
+			"Работает в личном чате.", b.cfg().CombineWindow))
+	}
+	return b.reply(message, "Отвечаю на каждое сообщение сразу.")
+}
+
+// setUserCombineInput сохраняет настройку склейки сообщений
+func (b *Bot) setUserCombineInput(userID int64, combine bool) error {
+	if _, err := b.db.Exec("INSERT OR IGNORE INTO users (user_id) VALUES (?)", userID); err != nil {
+		return fmt.Errorf("ошибка при вставке пользователя: %w", err)
+	}
+	if _, err := b.db.Exec("UPDATE users SET combine_input = ? WHERE user_id = ?", combine, userID); err != nil {
+		return fmt.Errorf("ошибка при обновлении настройки склейки: %w", err)
+	}
+	return nil
+}
+
+// getUserCombineInput возвращает, склеивать ли быстрые сообщения пользователя
+func (b *Bot) getUserCombineInput(userID int64) (bool, error) {
+	var combine bool
+	err := b.db.QueryRow("SELECT COALESCE(combine_input, 0) FROM users WHERE user_id = ?", userID).Scan(&combine)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("ошибка при получении настройки склейки: %w", err)
+	}
+	return combine, nil
+}
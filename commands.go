@@ -0,0 +1,129 @@
+package main
+
+import (
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Command описывает команду бота в реестре
+type Command struct {
+	Name        string // Имя команды без слеша
+	Description string // Короткое описание для подсказок
+	AdminOnly   bool   // Команда доступна только администраторам
+	ChatConfig  bool   // Команда меняет настройки группы: в группах доступна только её администраторам
+	Handler     func(message *tgbotapi.Message) error
+}
+
+// registerCommands заполняет реестр команд бота
+func (b *Bot) registerCommands() {
+	b.commandList = []*Command{
+		{Name: "start", Description: "Приветствие и краткая справка", Handler: b.start},
+		{Name: "style", Description: "Выбрать стиль общения", Handler: b.chooseStyle},
+		{Name: "settings", Description: "Мои настройки", Handler: b.settings},
+		{Name: "context", Description: "Сколько сообщений истории учитывать (0..30)", Handler: b.setContextTurns},
+		{Name: "replylang", Description: "Закрепить язык ответов (код или auto)", Handler: b.setReplyLang},
+		{Name: "remember", Description: "Запомнить факт о себе", Handler: b.remember},
+		{Name: "memory", Description: "Что бот о тебе помнит", Handler: b.showMemory},
+		{Name: "whoami", Description: "Что бот о тебе хранит", Handler: b.whoami},
+		{Name: "stats", Description: "Моя статистика", Handler: b.stats},
+		{Name: "new", Description: "Начать новый разговор", Handler: b.newConversation},
+		{Name: "chats", Description: "Мои разговоры", Handler: b.listConversations},
+		{Name: "rename", Description: "Переименовать текущий разговор", Handler: b.renameConversation},
+		{Name: "system", Description: "Закрепить промпт за текущим разговором", Handler: b.setSystemPrompt},
+		{Name: "undo", Description: "Забыть последний вопрос с ответом (/undo N - несколько)", Handler: b.undo},
+		{Name: "history", Description: "Что я помню из текущего разговора", Handler: b.showHistory},
+		{Name: "reset", Description: "Очистить текущий разговор", Handler: b.resetConversation},
+		{Name: "save", Description: "Сохранить промпт (ответом на своё сообщение)", Handler: b.save},
+		{Name: "saved", Description: "Сохранённые промпты", Handler: b.saved},
+		{Name: "kbd", Description: "Кнопки с любимыми промптами под полем ввода (on/off)", Handler: b.kbd},
+		{Name: "batch", Description: "Ответить на список вопросов по отдельности", Handler: b.batch},
+		{Name: "recall", Description: "Вспоминать похожие прошлые разговоры (on/off)", Handler: b.setRecall},
+		{Name: "kb", Description: "База знаний из твоих документов", Handler: b.kb},
+		{Name: "random", Description: "Случайная идея для вопроса", Handler: b.random},
+		{Name: "templates", Description: "Готовые шаблоны запросов", Handler: b.showTemplates},
+		{Name: "search", Description: "Поиск по своей истории", Handler: b.search},
+		{Name: "export", Description: "Выгрузить историю (md/json)", Handler: b.export},
+		{Name: "import", Description: "Загрузить историю из выгрузки (файлом с подписью /import)", Handler: b.importHistory},
+		{Name: "privacy", Description: "Режим приватности (strict/normal)", Handler: b.setPrivacy},
+		{Name: "forgetme", Description: "Удалить все мои данные", Handler: b.forgetMe},
+		{Name: "name", Description: "Обращаться по имени (on/off)", Handler: b.setUseName},
+		{Name: "latency", Description: "Показывать время ответа (on/off)", Handler: b.setLatency},
+		{Name: "pages", Description: "Длинные ответы страницами (on/off)", Handler: b.setPagedAnswers},
+		{Name: "plain", Description: "Ответы простым текстом без эмодзи и разметки (on/off)", Handler: b.setPlain},
+		{Name: "combine", Description: "Склеивать сообщения, отправленные подряд (on/off)", Handler: b.setCombineInput},
+		{Name: "location", Description: "Часовой пояс и город по геопозиции (on/off/clear)", Handler: b.location},
+		{Name: "quiet", Description: "Тихие часы для сообщений от бота (/quiet 23:00-08:00)", Handler: b.quiet},
+		{Name: "ask", Description: "Вопрос вне контекста: без истории и памяти", Handler: b.ask},
+		{Name: "ephemeral", Description: "Исчезающий ответ (/ephemeral 10m <вопрос>)", Handler: b.ephemeral},
+		{Name: "json", Description: "Сгенерировать валидный JSON", Handler: b.jsonMode},
+		{Name: "later", Description: "Ответить на вопрос в указанное время", Handler: b.later},
+		{Name: "digest_subscribe", Description: "Сводка переписки за день в указанное время", Handler: b.digestSubscribe},
+		{Name: "digest_off", Description: "Отключить сводку за день", Handler: b.digestOff},
+		{Name: "subscribe", Description: "Посты на тему каждый день или неделю", Handler: b.subscribe},
+		{Name: "subscriptions", Description: "Подписки на темы и отписка", Handler: b.subscriptions},
+		{Name: "edit", Description: "Переделать последний ответ на месте", Handler: b.editAnswer},
+		{Name: "quiz", Description: "Викторина по теме опросами Telegram", Handler: b.quiz},
+		{Name: "seed", Description: "Закрепить seed для воспроизводимых ответов", Handler: b.setSeed},
+		{Name: "tldr", Description: "Кратко пересказать пост (ответом на него)", Handler: b.tldr},
+		{Name: "reactions", Description: "Реакции на сообщения в этом чате (on/off)", ChatConfig: true, Handler: b.setReactions},
+		{Name: "cooldown", Description: "Пауза между ответами в этой группе, секунд", ChatConfig: true, Handler: b.setCooldown},
+		{Name: "status", Description: "Работает ли бот: база, модель, очередь", Handler: b.status},
+		{Name: "version", Description: "Версия бота", Handler: b.versionInfo},
+		{Name: "about", Description: "О боте", Handler: b.about},
+		{Name: "users", Description: "Список пользователей", AdminOnly: true, Handler: b.users},
+		{Name: "top", Description: "Самые активные пользователи (/top 7d, /top 30d)", AdminOnly: true, Handler: b.top},
+		{Name: "setuser", Description: "Поменять настройки пользователя", AdminOnly: true, Handler: b.setUser},
+		{Name: "gencode", Description: "Выпустить коды приглашения", AdminOnly: true, Handler: b.genCode},
+		{Name: "codes", Description: "Действующие коды приглашения", AdminOnly: true, Handler: b.codes},
+		{Name: "inspirations", Description: "Идеи для /random: статистика, добавление, удаление", AdminOnly: true, Handler: b.inspirationsAdmin},
+		{Name: "prompt_prefix", Description: "Общий префикс системного промпта", AdminOnly: true, Handler: b.promptPrefix},
+		{Name: "params", Description: "Личные параметры генерации (top_p, penalties, stop)", AdminOnly: true, Handler: b.setParams},
+		{Name: "errors", Description: "Последние ошибки (или подробности: /errors <id>)", AdminOnly: true, Handler: b.showErrors},
+		{Name: "deadletters", Description: "Упавшие запросы к модели и их повтор", AdminOnly: true, Handler: b.deadLetters},
+		{Name: "flagged", Description: "Ответы, заблокированные модерацией", AdminOnly: true, Handler: b.flagged},
+		{Name: "maintenance", Description: "Почистить базу прямо сейчас", AdminOnly: true, Handler: b.maintenance},
+		{Name: "dbstats", Description: "Статистика базы", AdminOnly: true, Handler: b.dbStats},
+		{Name: "backup", Description: "Прислать копию базы", AdminOnly: true, Handler: b.backup},
+		{Name: "debug", Description: "Отладка запросов к модели (on/off)", AdminOnly: true, Handler: b.setDebug},
+	}
+
+	b.commands = make(map[string]*Command, len(b.commandList))
+	for _, cmd := range b.commandList {
+		b.commands[cmd.Name] = cmd
+	}
+}
+
+// lookupCommand ищет команду в реестре с учётом прав пользователя
+func (b *Bot) lookupCommand(name string, userID int64) (*Command, bool) {
+	cmd, ok := b.commands[name]
+	if !ok || (cmd.AdminOnly && !b.isAdmin(userID)) {
+		return nil, false
+	}
+	return cmd, true
+}
+
+// unknownCommandText формирует подсказку со списком доступных команд
+func (b *Bot) unknownCommandText() string {
+	var names []string
+	for _, cmd := range b.commandList {
+		if !cmd.AdminOnly {
+			names = append(names, "/"+cmd.Name)
+		}
+	}
+	return "Неизвестная команда. Используйте " + strings.Join(names, ", ") + "."
+}
+
+// runCommand выполняет команду, проверив права на настройки группы
+func (b *Bot) runCommand(cmd *Command, message *tgbotapi.Message) error {
+	if cmd.ChatConfig {
+		allowed, err := b.canConfigureChat(message)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			return b.reply(message, "Только администраторы чата могут менять настройки.")
+		}
+	}
+	return cmd.Handler(message)
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	maxConversations    = 20 // Сколько разговоров показывает /chats
+	maxConversationName = 64
+	maxSystemPrompt     = 1000 // Предел длины закреплённого промпта в символах
+
+	primaryBotID int64 = 0 // bot_id основного бота и всех разговоров, созданных до появления нескольких ботов
+)
+
+// Conversation - отдельная ветка истории пользователя
+type Conversation struct {
+	ID           int64
+	Title        string
+	Active       bool
+	SystemPrompt string // Закреплённый через /system промпт
+}
+
+// displayTitle возвращает название разговора или заглушку для безымянного
+func (c Conversation) displayTitle() string {
+	if c.Title != "" {
+		return c.Title
+	}
+	return fmt.Sprintf("Разговор %d", c.ID)
+}
+
+// migrateHistoryToConversations переносит историю без разговора в разговор по умолчанию.
+// Нужна для баз, созданных до появления разговоров; повторный запуск ничего не делает.
+func migrateHistoryToConversations(db *sql.DB) error {
+	rows, err := db.Query("SELECT DISTINCT user_id FROM history WHERE conversation_id = 0")
+	if err != nil {
+		return fmt.Errorf("ошибка поиска истории без разговора: %w", err)
+	}
+	var users []int64
+	for rows.Next() {
+		var userID int64
+		if err := rows.Scan(&userID); err != nil {
+			rows.Close()
+			return fmt.Errorf("ошибка чтения истории без разговора: %w", err)
+		}
+		users = append(users, userID)
+	}
+	rows.Close()
+
+	for _, userID := range users {
+		id, err := activeConversationID(db, primaryBotID, userID)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("UPDATE history SET conversation_id = ? WHERE user_id = ? AND conversation_id = 0", id, userID)
+		if err != nil {
+			return fmt.Errorf("ошибка переноса истории в разговор: %w", err)
+		}
+	}
+	return nil
+}
+
+// activeConversationID возвращает активный разговор пользователя с ботом botID, создавая его при необходимости
+func activeConversationID(db *sql.DB, botID, userID int64) (int64, error) {
+	var id int64
+	err := db.QueryRow("SELECT id FROM conversations WHERE bot_id = ? AND user_id = ? AND active = 1", botID, userID).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, fmt.Errorf("ошибка получения активного разговора: %w", err)
+	}
+	return createConversation(db, botID, userID, "")
+}
+
+// createConversation создаёт разговор с ботом botID и делает его активным
+func createConversation(db *sql.DB, botID, userID int64, title string) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE conversations SET active = 0 WHERE bot_id = ? AND user_id = ?", botID, userID); err != nil {
+		return 0, fmt.Errorf("ошибка сброса активного разговора: %w", err)
+	}
+	res, err := tx.Exec("INSERT INTO conversations (bot_id, user_id, title, active) VALUES (?, ?, ?, 1)", botID, userID, title)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка создания разговора: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("ошибка создания разговора: %w", err)
+	}
+	return id, tx.Commit()
+}
+
+// activeConversation возвращает активный разговор пользователя
+func (b *Bot) activeConversation(userID int64) (int64, error) {
+	return activeConversationID(b.db, b.botID, userID)
+}
+
+// switchConversation делает разговор активным; false - разговор не найден или чужой
+func (b *Bot) switchConversation(userID, id int64) (bool, error) {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE conversations SET active = 0 WHERE bot_id = ? AND user_id = ?", b.botID, userID); err != nil {
+		return false, fmt.Errorf("ошибка сброса активного разговора: %w", err)
+	}
+	res, err := tx.Exec("UPDATE conversations SET active = 1 WHERE id = ? AND bot_id = ? AND user_id = ?", id, b.botID, userID)
+	if err != nil {
+		return false, fmt.Errorf("ошибка переключения разговора: %w", err)
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return false, nil
+	}
+	return true, tx.Commit()
+}
+
+// deleteConversation удаляет разговор вместе с его историей; false - разговор не найден или чужой
+func (b *Bot) deleteConversation(userID, id int64) (bool, error) {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("DELETE FROM conversations WHERE id = ? AND bot_id = ? AND user_id = ?", id, b.botID, userID)
+	if err != nil {
+		return false, fmt.Errorf("ошибка удаления разговора: %w", err)
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return false, nil
+	}
+	if _, err := tx.Exec("DELETE FROM history WHERE conversation_id = ? AND user_id = ?", id, userID); err != nil {
+		return false, fmt.Errorf("ошибка удаления истории разговора: %w", err)
+	}
+	return true, tx.Commit()
+}
+
+// getConversations возвращает последние разговоры пользователя, новые сверху
+func (b *Bot) getConversations(userID int64) ([]Conversation, error) {
+	rows, err := b.db.Query("SELECT id, title, active, system_prompt FROM conversations WHERE bot_id = ? AND user_id = ? ORDER BY id DESC LIMIT ?",
+		b.botID, userID, maxConversations)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения разговоров: %w", err)
+	}
+	defer rows.Close()
+
+	var conversations []Conversation
+	for rows.Next() {
+		var c Conversation
+		if err := rows.Scan(&c.ID, &c.Title, &c.Active, &c.SystemPrompt); err != nil {
+			return nil, fmt.Errorf("ошибка чтения разговоров: %w", err)
+		}
+		conversations = append(conversations, c)
+	}
+	return conversations, rows.Err()
+}
+
+// newConversation обрабатывает команду /new [название]
+func (b *Bot) newConversation(message *tgbotapi.Message) error {
+	userID := senderID(message)
+	title := strings.TrimSpace(message.CommandArguments())
+	if utf8.RuneCountInString(title) > maxConversationName {
+		return b.reply(message, fmt.Sprintf("Название слишком длинное (максимум %d символов).", maxConversationName))
+	}
+
+	id, err := createConversation(b.db, b.botID, userID, title)
+	if err != nil {
+		b.reply(message, "Не удалось начать разговор, попробуй позже.")
+		return err
+	}
+	b.session.clear(userID)
+
+	return b.reply(message, fmt.Sprintf("🆕 Начат новый разговор «%s». Предыдущие доступны в /chats.",
+		Conversation{ID: id, Title: title}.displayTitle()))
+}
+
+// resetConversation обрабатывает команду /reset: очищает историю только активного разговора
+func (b *Bot) resetConversation(message *tgbotapi.Message) error {
+	if err := b.clearActiveConversation(senderID(message)); err != nil {
+		b.reply(message, "Не удалось очистить историю, попробуй позже.")
+		return err
+	}
+	return b.reply(message, "🧹 История текущего разговора очищена. Остальные разговоры не тронуты.")
+}
+
+// clearActiveConversation удаляет историю активного разговора пользователя (и в базе, и в памяти)
+func (b *Bot) clearActiveConversation(userID int64) error {
+	id, err := b.activeConversation(userID)
+	if err != nil {
+		return err
+	}
+	if _, err := b.db.Exec("DELETE FROM history WHERE user_id = ? AND conversation_id = ?", userID, id); err != nil {
+		return fmt.Errorf("ошибка очистки разговора: %w", err)
+	}
+	b.session.clear(userID)
+	return nil
+}
+
+// listConversations обрабатывает команду /chats
+func (b *Bot) listConversations(message *tgbotapi.Message) error {
+	conversations, err := b.getConversations(senderID(message))
+	if err != nil {
+		return err
+	}
+	text, keyboard := renderConversations(conversations)
+	msg := tgbotapi.NewMessage(message.Chat.ID, text)
+	msg.ReplyToMessageID = message.MessageID
+	if keyboard != nil {
+		msg.ReplyMarkup = *keyboard
+	}
+	if _, err := b.api.Send(msg); err != nil {
+		return fmt.Errorf("ошибка отправки списка разговоров: %w", err)
+	}
+	return nil
+}
+
+// renderConversations собирает список разговоров с кнопками переключения и удаления
+func renderConversations(conversations []Conversation) (string, *tgbotapi.InlineKeyboardMarkup) {
+	if len(conversations) == 0 {
+		return "Разговоров пока нет. Просто напиши мне или начни новый через /new.", nil
+	}
+
+	text := "💬 Твои разговоры (✅ - текущий):"
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, c := range conversations {
+		title := c.displayTitle()
+		if c.Active {
+			title = "✅ " + title
+			if c.SystemPrompt != "" {
+				text = fmt.Sprintf("📌 Промпт текущего разговора: %s\n\n", truncateRunes(c.SystemPrompt, 300)) + text
+			}
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(title, fmt.Sprintf("conv_use:%d", c.ID)),
+			tgbotapi.NewInlineKeyboardButtonData("🗑", fmt.Sprintf("conv_del:%d", c.ID)),
+		))
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return text, &keyboard
+}
+
+// conversationHandler возвращает обработчик кнопок списка /chats: переключение или удаление разговора
+func (b *Bot) conversationHandler(remove bool) func(*tgbotapi.CallbackQuery, string) (string, error) {
+	return func(query *tgbotapi.CallbackQuery, payload string) (string, error) {
+		id, err := strconv.ParseInt(payload, 10, 64)
+		if err != nil {
+			return "Некорректная кнопка", nil
+		}
+		userID := query.From.ID
+
+		var ok bool
+		notice := "Переключено"
+		if remove {
+			ok, err = b.deleteConversation(userID, id)
+			notice = "Разговор удалён"
+		} else {
+			ok, err = b.switchConversation(userID, id)
+		}
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return "Этот разговор уже удалён или принадлежит другому пользователю", nil
+		}
+		b.session.clear(userID)
+
+		conversations, err := b.getConversations(userID)
+		if err != nil {
+			return "", err
+		}
+		text, keyboard := renderConversations(conversations)
+		edit := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, text)
+		edit.ReplyMarkup = keyboard
+		if _, err := b.api.Send(edit); err != nil {
+			return "", fmt.Errorf("ошибка обновления списка разговоров: %w", err)
+		}
+		return notice, nil
+	}
+}
+
+// activeSystemPrompt возвращает закреплённый промпт активного разговора (пустой, если разговора ещё нет)
+func (b *Bot) activeSystemPrompt(userID int64) (string, error) {
+	var prompt string
+	err := b.db.QueryRow("SELECT system_prompt FROM conversations WHERE bot_id = ? AND user_id = ? AND active = 1", b.botID, userID).Scan(&prompt)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("ошибка получения промпта разговора: %w", err)
+	}
+	return prompt, nil
+}
+
+// setSystemPrompt обрабатывает команду /system <текст>|clear: закрепляет промпт за активным разговором
+func (b *Bot) setSystemPrompt(message *tgbotapi.Message) error {
+	userID := senderID(message)
+	prompt := strings.TrimSpace(message.CommandArguments())
+	if prompt == "" {
+		current, err := b.activeSystemPrompt(userID)
+		if err != nil {
+			return err
+		}
+		if current == "" {
+			return b.reply(message, "Использование: /system <текст> - закрепить инструкцию за текущим разговором, /system clear - убрать.")
+		}
+		return b.reply(message, "📌 Промпт текущего разговора:\n"+current+"\n\n/system clear - убрать.")
+	}
+	if prompt == "clear" {
+		prompt = ""
+	}
+	if utf8.RuneCountInString(prompt) > maxSystemPrompt {
+		return b.reply(message, fmt.Sprintf("Слишком длинный промпт (максимум %d символов).", maxSystemPrompt))
+	}
+
+	id, err := b.activeConversation(userID)
+	if err != nil {
+		return err
+	}
+	if _, err := b.db.Exec("UPDATE conversations SET system_prompt = ? WHERE id = ? AND user_id = ?", prompt, id, userID); err != nil {
+		b.reply(message, "Не удалось сохранить промпт, попробуй позже.")
+		return fmt.Errorf("ошибка сохранения промпта разговора: %w", err)
+	}
+	if prompt == "" {
+		return b.reply(message, "Промпт текущего разговора убран.")
+	}
+	return b.reply(message, "📌 Промпт закреплён за текущим разговором. В других разговорах он не действует.")
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	maxChatCooldown = 3600 // Верхняя граница /cooldown, секунд
+	cooldownEmoji   = "🕐"
+
+	cooldownNoticeReaction = "reaction" // Отмечать сообщение реакцией 🕐
+	cooldownNoticeReply    = "reply"    // Отвечать, сколько секунд осталось
+)
+
+// chatCooldowns - когда бот последний раз начинал отвечать в группе. Хранится только в памяти:
+// после перезапуска пауза начинается заново с первого ответа.
+type chatCooldowns struct {
+	mu   sync.Mutex
+	last map[int64]time.Time
+}
+
+func newChatCooldowns() *chatCooldowns {
+	return &chatCooldowns{last: make(map[int64]time.Time)}
+}
+
+// allow разрешает ответ в чате, если с прошлого прошло не меньше window; иначе возвращает, сколько ждать
+func (c *chatCooldowns) allow(chatID int64, window time.Duration, now time.Time) (bool, time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if last, ok := c.last[chatID]; ok && now.Sub(last) < window {
+		return false, window - now.Sub(last)
+	}
+	// Записи старше самой длинной паузы уже ничего не ограничивают
+	for id, last := range c.last {
+		if now.Sub(last) >= maxChatCooldown*time.Second {
+			delete(c.last, id)
+		}
+	}
+	c.last[chatID] = now
+	return true, 0
+}
+
+// chatCoolingDown проверяет паузу между ответами в группе. Если пауза не истекла, бот отмечает
+// сообщение реакцией или отвечает, сколько ждать, и возвращает true - отвечать не нужно.
+// Личные чаты паузой не ограничиваются, лимиты пользователя действуют отдельно.
+func (b *Bot) chatCoolingDown(message *tgbotapi.Message) bool {
+	if message.Chat.IsPrivate() {
+		return false
+	}
+	seconds, err := b.getChatCooldown(message.Chat.ID)
+	if err != nil {
+		log.Printf("Ошибка получения паузы чата: %v", err)
+		return false
+	}
+	if seconds == 0 {
+		return false
+	}
+	ok, wait := b.chatCooldowns.allow(message.Chat.ID, time.Duration(seconds)*time.Second, time.Now())
+	if ok {
+		return false
+	}
+	b.cooldownNotice(message, wait)
+	return true
+}
+
+// cooldownNotice сообщает о паузе так, как задано в CHAT_COOLDOWN_NOTICE. Если реакцию поставить
+// не удалось (например, Telegram не принимает этот эмодзи в чате), бот отвечает текстом.
+func (b *Bot) cooldownNotice(message *tgbotapi.Message, wait time.Duration) {
+	if b.cfg().CooldownNotice == cooldownNoticeReaction {
+		params, err := reactionParams{ChatID: message.Chat.ID, MessageID: message.MessageID, Emoji: cooldownEmoji}.params()
+		if err == nil {
+			if _, err = b.api.MakeRequest("setMessageReaction", params); err == nil {
+				return
+			}
+		}
+		log.Printf("Ошибка установки реакции паузы: %v", err)
+	}
+	if err := b.reply(message, fmt.Sprintf("%s Отвечу через %d с.", cooldownEmoji, int(wait.Seconds())+1)); err != nil {
+		log.Printf("Ошибка отправки сообщения о паузе: %v", err)
+	}
+}
+
+// setCooldown обрабатывает команду /cooldown N: пауза в секундах между ответами бота в этой группе
+func (b *Bot) setCooldown(message *tgbotapi.Message) error {
+	if message.Chat.IsPrivate() {
+		return b.reply(message, "Пауза между ответами настраивается только в группах.")
+	}
+	arg := strings.TrimSpace(message.CommandArguments())
+	if arg == "" {
+		seconds, err := b.getChatCooldown(message.Chat.ID)
+		if err != nil {
+			return err
+		}
+		if seconds == 0 {
+			return b.reply(message, "Паузы между ответами нет.\n\nИспользование: /cooldown <секунды>, /cooldown 0 - без паузы")
+		}
+		return b.reply(message, fmt.Sprintf("Пауза между ответами: %d с.\n\nИспользование: /cooldown <секунды>, /cooldown 0 - без паузы", seconds))
+	}
+	if arg == "off" {
+		arg = "0"
+	}
+	seconds, err := strconv.Atoi(arg)
+	if err != nil || seconds < 0 || seconds > maxChatCooldown {
+		return b.reply(message, fmt.Sprintf("Укажи паузу в секундах от 0 до %d, например: /cooldown 30", maxChatCooldown))
+	}
+	if err := b.setChatCooldown(message.Chat.ID, seconds); err != nil {
+		b.reply(message, "Не удалось сохранить настройку, попробуй позже.")
+		return err
+	}
+	if seconds == 0 {
+		return b.reply(message, "Пауза между ответами выключена.")
+	}
+	return b.reply(message, fmt.Sprintf("Готово: в этом чате отвечаю не чаще раза в %d с.", seconds))
+}
+
+// setChatCooldown сохраняет паузу между ответами для чата
+func (b *Bot) setChatCooldown(chatID int64, seconds int) error {
+	_, err := b.db.Exec("INSERT OR IGNORE INTO chats (chat_id) VALUES (?)", chatID)
+	if err != nil {
+		return fmt.Errorf("ошибка при вставке чата: %w", err)
+	}
+	_, err = b.db.Exec("UPDATE chats SET cooldown = ? WHERE chat_id = ?", seconds, chatID)
+	if err != nil {
+		return fmt.Errorf("ошибка при обновлении паузы чата: %w", err)
+	}
+	return nil
+}
+
+// getChatCooldown возвращает паузу между ответами в чате в секундах (по умолчанию без паузы)
+func (b *Bot) getChatCooldown(chatID int64) (int, error) {
+	var seconds int
+	err := b.db.QueryRow("SELECT COALESCE(cooldown, 0) FROM chats WHERE chat_id = ?", chatID).Scan(&seconds)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("ошибка при получении паузы чата: %w", err)
+	}
+	return seconds, nil
+}
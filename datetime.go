@@ -0,0 +1,39 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+	_ "time/tzdata" // Часовые зоны внутри бинарника: в минимальных образах нет /usr/share/zoneinfo
+)
+
+var (
+	russianWeekdays = [...]string{"воскресенье", "понедельник", "вторник", "среда", "четверг", "пятница", "суббота"}
+	russianMonths   = [...]string{"января", "февраля", "марта", "апреля", "мая", "июня",
+		"июля", "августа", "сентября", "октября", "ноября", "декабря"}
+)
+
+// nowInstruction - строка системного промпта с текущими датой и временем:
+// без неё модель уверенно называет дату из своих обучающих данных
+func nowInstruction(now time.Time, loc *time.Location) string {
+	now = now.In(loc)
+	return fmt.Sprintf("Сейчас: %s, %d %s %d, %02d:%02d (%s)", russianWeekdays[now.Weekday()], now.Day(),
+		russianMonths[now.Month()-1], now.Year(), now.Hour(), now.Minute(), loc)
+}
+
+// userLocation возвращает часовую зону пользователя, а если она не задана или некорректна - зону из DEFAULT_TIMEZONE
+func (b *Bot) userLocation(userID int64) (*time.Location, error) {
+	var name string
+	err := b.db.QueryRow("SELECT COALESCE(timezone, '') FROM users WHERE user_id = ?", userID).Scan(&name)
+	if err != nil && err != sql.ErrNoRows {
+		return b.cfg().DefaultLocation, fmt.Errorf("ошибка получения часовой зоны: %w", err)
+	}
+	if name == "" {
+		return b.cfg().DefaultLocation, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return b.cfg().DefaultLocation, fmt.Errorf("некорректная часовая зона пользователя %q: %w", name, err)
+	}
+	return loc, nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// DBStats - сводка по содержимому базы для /dbstats
+type DBStats struct {
+	Tables        []TableCount
+	FileSize      int64
+	WALSize       int64
+	OldestHistory string
+	NewestHistory string
+	TopUsers      []UserRows
+}
+
+// TableCount - число строк в таблице
+type TableCount struct {
+	Name string
+	Rows int64
+}
+
+// UserRows - сколько строк хранится у пользователя во всех его таблицах
+type UserRows struct {
+	UserID int64
+	Rows   int64
+}
+
+// tableExists проверяет, создана ли таблица
+func tableExists(db *sql.DB, table string) (bool, error) {
+	var exists int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("ошибка проверки таблицы %s: %w", table, err)
+	}
+	return exists > 0, nil
+}
+
+// collectDBStats собирает статистику несколькими агрегирующими запросами.
+// Даты истории берутся по минимальному и максимальному id, чтобы не сканировать таблицу.
+func collectDBStats(db *sql.DB, path string) (*DBStats, error) {
+	stats := &DBStats{}
+
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения списка таблиц: %w", err)
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("ошибка чтения списка таблиц: %w", err)
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+
+	for _, name := range names {
+		var count int64
+		if err := db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %q", name)).Scan(&count); err != nil {
+			return nil, fmt.Errorf("ошибка подсчёта строк в %s: %w", name, err)
+		}
+		stats.Tables = append(stats.Tables, TableCount{Name: name, Rows: count})
+	}
+
+	if info, err := os.Stat(path); err == nil {
+		stats.FileSize = info.Size()
+	}
+	if info, err := os.Stat(path + "-wal"); err == nil {
+		stats.WALSize = info.Size()
+	}
+
+	err = db.QueryRow(`
+		SELECT
+			COALESCE((SELECT created_at FROM history WHERE id = (SELECT MIN(id) FROM history)), ''),
+			COALESCE((SELECT created_at FROM history WHERE id = (SELECT MAX(id) FROM history)), '')`).
+		Scan(&stats.OldestHistory, &stats.NewestHistory)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения дат истории: %w", err)
+	}
+
+	// Пользовательские таблицы, кроме самой users, складываются в один подсчёт
+	var parts []string
+	for _, table := range userDataTables {
+		if table == "users" {
+			continue
+		}
+		exists, err := tableExists(db, table)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			parts = append(parts, "SELECT user_id FROM "+table)
+		}
+	}
+	rows, err = db.Query("SELECT user_id, COUNT(*) AS n FROM (" + strings.Join(parts, " UNION ALL ") + ") GROUP BY user_id ORDER BY n DESC LIMIT 5")
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения топа пользователей: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var user UserRows
+		if err := rows.Scan(&user.UserID, &user.Rows); err != nil {
+			return nil, fmt.Errorf("ошибка чтения топа пользователей: %w", err)
+		}
+		stats.TopUsers = append(stats.TopUsers, user)
+	}
+	return stats, rows.Err()
+}
+
+// formatDBStats собирает моноширинную таблицу со статистикой
+func formatDBStats(stats *DBStats) string {
+	var sb strings.Builder
+	w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Таблица\tСтрок")
+	for _, table := range stats.Tables {
+		fmt.Fprintf(w, "%s\t%d\n", table.Name, table.Rows)
+	}
+	w.Flush()
+
+	fmt.Fprintf(&sb, "\nФайл: %.1f МБ, WAL: %.1f МБ\n", float64(stats.FileSize)/(1<<20), float64(stats.WALSize)/(1<<20))
+	if stats.OldestHistory != "" {
+		fmt.Fprintf(&sb, "История: %s … %s\n", stats.OldestHistory, stats.NewestHistory)
+	}
+
+	if len(stats.TopUsers) > 0 {
+		sb.WriteString("\n")
+		w = tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "Пользователь\tСтрок")
+		for _, user := range stats.TopUsers {
+			fmt.Fprintf(w, "%d\t%d\n", user.UserID, user.Rows)
+		}
+		w.Flush()
+	}
+	return sb.String()
+}
+
+// dbStats обрабатывает команду /dbstats
+func (b *Bot) dbStats(message *tgbotapi.Message) error {
+	stats, err := collectDBStats(b.db, DBPATH)
+	if err != nil {
+		b.reply(message, "❌ "+err.Error())
+		return err
+	}
+	return b.replyMonospace(message, formatDBStats(stats))
+}
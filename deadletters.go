@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// deadLetterRequest - всё, что нужно, чтобы повторить запрос к модели после исправления кода
+type deadLetterRequest struct {
+	Messages []ChatMessage  `json:"messages"`
+	Params   SamplingParams `json:"params"`
+}
+
+// recordDeadLetter сохраняет запрос, который упал не из-за недоступности модели (422, слишком длинный
+// контекст, ошибка разбора ответа): повтор такого запроса без исправления кода ничего не даст.
+// В строгом режиме приватности текст запроса не сохраняется - остаётся только ошибка.
+func (b *Bot) recordDeadLetter(in chatInput, messageID int, turn *chatTurn, requestErr error) {
+	b.metrics.inc("dead_letters")
+
+	request := []byte("{}")
+	if turn.Privacy != privacyStrict {
+		var err error
+		if request, err = json.Marshal(deadLetterRequest{Messages: turn.Messages, Params: turn.Params}); err != nil {
+			slog.Error("не удалось сериализовать запрос для dead_letters", "error", err)
+			request = []byte("{}")
+		}
+	}
+	_, err := b.db.Exec(`INSERT INTO dead_letters (bot_id, user_id, chat_id, message_id, request, error)
+		VALUES (?, ?, ?, ?, ?, ?)`, b.botID, in.UserID, in.ChatID, messageID, string(request), requestErr.Error())
+	if err != nil {
+		slog.Error("не удалось сохранить запрос в dead_letters", "error", err)
+	}
+}
+
+// deadLetters обрабатывает команду /deadletters [<id>|redrive <id>]
+func (b *Bot) deadLetters(message *tgbotapi.Message) error {
+	args := strings.Fields(message.CommandArguments())
+	switch {
+	case len(args) == 0:
+		return b.listDeadLetters(message)
+	case len(args) == 2 && args[0] == "redrive":
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			break
+		}
+		return b.redriveDeadLetter(message, id)
+	case len(args) == 1:
+		id, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			break
+		}
+		return b.showDeadLetter(message, id)
+	}
+	return b.reply(message, "Использование: /deadletters, /deadletters <id> или /deadletters redrive <id>")
+}
+
+// listDeadLetters показывает последние нерешённые запросы
+func (b *Bot) listDeadLetters(message *tgbotapi.Message) error {
+	var unresolved int
+	if err := b.db.QueryRow("SELECT COUNT(*) FROM dead_letters WHERE resolved_at IS NULL").Scan(&unresolved); err != nil {
+		return fmt.Errorf("ошибка подсчёта dead_letters: %w", err)
+	}
+
+	rows, err := b.db.Query(`SELECT id, user_id, error, created_at FROM dead_letters
+		WHERE resolved_at IS NULL ORDER BY id DESC LIMIT 10`)
+	if err != nil {
+		return fmt.Errorf("ошибка получения dead_letters: %w", err)
+	}
+	defer rows.Close()
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "☠️ Нерешённых запросов: %d (с запуска: %d)\n", unresolved, b.metrics.get("dead_letters"))
+	for rows.Next() {
+		var id, userID int64
+		var text string
+		var createdAt time.Time
+		if err := rows.Scan(&id, &userID, &text, &createdAt); err != nil {
+			return fmt.Errorf("ошибка чтения dead_letters: %w", err)
+		}
+		fmt.Fprintf(&sb, "\n#%d · %s · user %d\n%s\n", id, createdAt.Format("02.01 15:04"), userID, truncateRunes(text, 150))
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("ошибка чтения dead_letters: %w", err)
+	}
+	if unresolved > 0 {
+		sb.WriteString("\nПодробности: /deadletters <id>, повтор: /deadletters redrive <id>")
+	}
+	return b.reply(message, truncateRunes(sb.String(), messageTextLimit))
+}
+
+// showDeadLetter показывает ошибку и запрос целиком
+func (b *Bot) showDeadLetter(message *tgbotapi.Message, id int64) error {
+	var userID int64
+	var request, text string
+	var createdAt time.Time
+	var resolvedAt sql.NullTime
+	err := b.db.QueryRow("SELECT user_id, request, error, created_at, resolved_at FROM dead_letters WHERE id = ?", id).
+		Scan(&userID, &request, &text, &createdAt, &resolvedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return b.reply(message, "Запрос с таким id не найден.")
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка получения dead_letters: %w", err)
+	}
+
+	status := "не решён"
+	if resolvedAt.Valid {
+		status = "решён " + resolvedAt.Time.Format("02.01.2006 15:04")
+	}
+	return b.replyMonospace(message, truncateRunes(fmt.Sprintf("#%d · %s · user %d · %s\n\n%s\n\n%s",
+		id, createdAt.Format("02.01.2006 15:04"), userID, status, text, request), 3000)) // С запасом на HTML-экранирование
+}
+
+// redriveDeadLetter повторяет сохранённый запрос и, если он прошёл, отправляет ответ пользователю
+// в ответ на исходное сообщение. Успешный повтор помечает запись решённой, а не удаляет её.
+func (b *Bot) redriveDeadLetter(message *tgbotapi.Message, id int64) error {
+	var userID, chatID int64
+	var messageID int
+	var requestJSON string
+	var resolvedAt sql.NullTime
+	err := b.db.QueryRow("SELECT user_id, chat_id, message_id, request, resolved_at FROM dead_letters WHERE id = ? AND bot_id = ?",
+		id, b.botID).Scan(&userID, &chatID, &messageID, &requestJSON, &resolvedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return b.reply(message, "Запрос с таким id не найден.")
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка получения dead_letters: %w", err)
+	}
+	if resolvedAt.Valid {
+		return b.reply(message, "Этот запрос уже решён.")
+	}
+
+	var request deadLetterRequest
+	if err := json.Unmarshal([]byte(requestJSON), &request); err != nil || len(request.Messages) == 0 {
+		return b.reply(message, "Текст запроса не сохранён (строгий режим приватности) - повторить нельзя.")
+	}
+
+	aiResponse, err := b.makeChatRequest(context.Background(), request.Messages, request.Params)
+	if err != nil {
+		if _, dbErr := b.db.Exec("UPDATE dead_letters SET error = ?, attempts = attempts + 1 WHERE id = ?", err.Error(), id); dbErr != nil {
+			return fmt.Errorf("ошибка обновления dead_letters: %w", dbErr)
+		}
+		return b.reply(message, "Повтор снова не удался: "+err.Error())
+	}
+
+	answer := tgbotapi.NewMessage(chatID, "⌛ Думаю...")
+	answer.ReplyToMessageID = messageID
+	answer.AllowSendingWithoutReply = true
+	sent, err := b.api.Send(answer)
+	if err != nil {
+		return fmt.Errorf("ошибка отправки ответа пользователю: %w", err)
+	}
+	if _, err := b.deliverAnswer(chatID, sent.MessageID, messageID, aiResponse.Content); err != nil {
+		return fmt.Errorf("ошибка отправки ответа пользователю: %w", err)
+	}
+	if _, err := b.db.Exec("UPDATE dead_letters SET resolved_at = CURRENT_TIMESTAMP, attempts = attempts + 1 WHERE id = ?", id); err != nil {
+		return fmt.Errorf("ошибка обновления dead_letters: %w", err)
+	}
+	return b.reply(message, fmt.Sprintf("✅ Запрос #%d повторён, ответ отправлен пользователю %d.", id, userID))
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// startPayloadHandler обрабатывает значение из ссылки t.me/<бот>?start=<префикс>_<значение>.
+// handled=false - показать обычное приветствие (например, значение не распознано).
+type startPayloadHandler func(message *tgbotapi.Message, value string) (handled bool, err error)
+
+// startPayloadHandlers - обработчики deep link по префиксу; новый префикс - новая строка
+func (b *Bot) startPayloadHandlers() map[string]startPayloadHandler {
+	return map[string]startPayloadHandler{
+		"ref":   b.startReferral,
+		"style": b.startStyle,
+		"tpl":   b.startTemplateLink,
+	}
+}
+
+// parseStartPayload делит payload из /start на префикс и значение по первому "_"
+func parseStartPayload(payload string) (prefix, value string, ok bool) {
+	prefix, value, ok = strings.Cut(strings.TrimSpace(payload), "_")
+	if !ok || prefix == "" || value == "" {
+		return "", "", false
+	}
+	return prefix, value, true
+}
+
+// start обрабатывает команду /start: deep link с известным префиксом уходит своему обработчику,
+// всё остальное (в том числе /start без payload) получает обычное приветствие
+func (b *Bot) start(message *tgbotapi.Message) error {
+	if prefix, value, ok := parseStartPayload(message.CommandArguments()); ok {
+		if handler, exists := b.startPayloadHandlers()[prefix]; exists {
+			handled, err := handler(message, value)
+			if handled || err != nil {
+				return err
+			}
+		}
+	}
+	return b.sendWelcome(message)
+}
+
+// startReferral запоминает, кто пригласил пользователя (ref_<id>), и показывает приветствие.
+// Пригласивший записывается один раз и только если он сам уже пользовался ботом.
+func (b *Bot) startReferral(message *tgbotapi.Message, value string) (bool, error) {
+	referrerID, err := strconv.ParseInt(value, 10, 64)
+	userID := senderID(message)
+	if err != nil || referrerID == userID {
+		return false, nil
+	}
+	if _, err := b.db.Exec("INSERT OR IGNORE INTO users (user_id) VALUES (?)", userID); err != nil {
+		return false, fmt.Errorf("ошибка при вставке пользователя: %w", err)
+	}
+	_, err = b.db.Exec(`UPDATE users SET referred_by = ?
+		WHERE user_id = ? AND COALESCE(referred_by, 0) = 0 AND EXISTS (SELECT 1 FROM users WHERE user_id = ?)`,
+		referrerID, userID, referrerID)
+	if err != nil {
+		return false, fmt.Errorf("ошибка сохранения пригласившего: %w", err)
+	}
+	return false, nil
+}
+
+// startStyle сразу включает стиль из ссылки style_<ключ>; неизвестный стиль - обычное приветствие
+func (b *Bot) startStyle(message *tgbotapi.Message, value string) (bool, error) {
+	if _, ok := stylePrompts[value]; !ok {
+		return false, nil
+	}
+	if err := b.setUserStyle(senderID(message), value); err != nil {
+		return true, fmt.Errorf("ошибка сохранения стиля: %w", err)
+	}
+	return true, b.reply(message, fmt.Sprintf("👋 Привет! Стиль общения установлен: %s. Просто напиши мне что-нибудь.\n\n"+
+		"Поменять стиль можно командой /style", styleTitle(value)))
+}
+
+// startTemplateLink открывает шаблон из ссылки tpl_<id>; неизвестный шаблон - обычное приветствие
+func (b *Bot) startTemplateLink(message *tgbotapi.Message, value string) (bool, error) {
+	template := b.findTemplate(value)
+	if template == nil {
+		return false, nil
+	}
+	return true, b.startTemplate(context.Background(), chatInputFrom(message, ""), template, message.MessageID)
+}
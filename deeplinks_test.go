@@ -0,0 +1,102 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// commandMessage - сообщение с командой: без сущности bot_command CommandArguments вернёт пустую строку
+func commandMessage(userID int64, text string) *tgbotapi.Message {
+	message := textUpdate(1, userID, text).Message
+	command, _, _ := strings.Cut(text, " ")
+	message.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(command)}}
+	return message
+}
+
+func TestParseStartPayload(t *testing.T) {
+	tests := []struct {
+		payload       string
+		prefix, value string
+		ok            bool
+	}{
+		{"ref_42", "ref", "42", true},
+		{"  style_meme ", "style", "meme", true},
+		{"tpl_letter_short", "tpl", "letter_short", true}, // Делится по первому "_"
+		{"", "", "", false},
+		{"ref", "", "", false},
+		{"ref_", "", "", false},
+		{"_42", "", "", false},
+		{"ABCDEFGH", "", "", false}, // Код приглашения без префикса
+	}
+	for _, tt := range tests {
+		prefix, value, ok := parseStartPayload(tt.payload)
+		if prefix != tt.prefix || value != tt.value || ok != tt.ok {
+			t.Errorf("parseStartPayload(%q) = %q, %q, %v, ожидалось %q, %q, %v",
+				tt.payload, prefix, value, ok, tt.prefix, tt.value, tt.ok)
+		}
+	}
+}
+
+func TestStartDispatchesPayload(t *testing.T) {
+	const welcome = "👋 Привет! Я бот"
+	tests := []struct {
+		name      string
+		text      string
+		wantReply string
+		wantStyle string
+	}{
+		{"без payload", "/start", welcome, "friendly"},
+		{"стиль из ссылки", "/start style_meme", "Стиль общения установлен: " + styleTitle("meme"), "meme"},
+		{"неизвестный стиль", "/start style_pirate", welcome, "friendly"},
+		{"неизвестный префикс", "/start promo_2026", welcome, "friendly"},
+		{"неизвестный шаблон", "/start tpl_nonexistent", welcome, "friendly"},
+		{"приглашение", "/start ref_100", welcome, "friendly"},
+	}
+	for _, tt := range tests {
+		b, fake := newTestBot(t)
+		if err := b.start(commandMessage(1, tt.text)); err != nil {
+			t.Fatalf("%s: start: %v", tt.name, err)
+		}
+		if got := fake.lastText(); !strings.Contains(got, tt.wantReply) {
+			t.Errorf("%s: ответ %q, ожидалось %q", tt.name, got, tt.wantReply)
+		}
+		if style, err := b.getUserStyle(1); err != nil || style != tt.wantStyle {
+			t.Errorf("%s: стиль %q (ошибка %v), ожидался %q", tt.name, style, err, tt.wantStyle)
+		}
+	}
+}
+
+func TestStartReferral(t *testing.T) {
+	b, _ := newTestBot(t)
+	if _, err := b.db.Exec("INSERT INTO users (user_id) VALUES (100)"); err != nil {
+		t.Fatal(err)
+	}
+	referredBy := func(userID int64) int64 {
+		var id int64
+		if err := b.db.QueryRow("SELECT COALESCE((SELECT referred_by FROM users WHERE user_id = ?), 0)", userID).Scan(&id); err != nil {
+			t.Fatalf("чтение referred_by: %v", err)
+		}
+		return id
+	}
+
+	for _, text := range []string{"/start ref_100", "/start ref_200"} { // Второе приглашение не перезаписывает первое
+		if err := b.start(commandMessage(1, text)); err != nil {
+			t.Fatalf("start: %v", err)
+		}
+	}
+	if got := referredBy(1); got != 100 {
+		t.Errorf("пригласивший %d, ожидался 100", got)
+	}
+
+	// Пригласивший должен сам пользоваться ботом, а пригласить себя нельзя
+	for userID, text := range map[int64]string{2: "/start ref_999", 3: "/start ref_3"} {
+		if err := b.start(commandMessage(userID, text)); err != nil {
+			t.Fatalf("start: %v", err)
+		}
+		if got := referredBy(userID); got != 0 {
+			t.Errorf("%s: записан пригласивший %d", text, got)
+		}
+	}
+}
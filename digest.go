@@ -0,0 +1,213 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	digestCostRate     = 0.25  // Доля токенов сводки, которая идёт в дневной бюджет пользователя
+	digestMessageRunes = 600   // До скольких символов сокращается каждое сообщение дня
+	digestInputRunes   = 12000 // Сколько символов переписки попадает в запрос; при избытке берутся последние
+	digestPrompt       = "Ниже - переписка пользователя с тобой за сегодня. Составь короткую сводку дня: " +
+		"о чём шла речь, несколькими пунктами. Затем отдельным списком - открытые вопросы и то, что ты обещал " +
+		"или о чём договорились. Если таких нет, так и напиши одной строкой. Пиши на языке переписки, без вступлений."
+)
+
+// setUserDigestTime сохраняет время ежедневной сводки ("21:00"); пустая строка - подписки нет
+func (b *Bot) setUserDigestTime(userID int64, clock string) error {
+	if _, err := b.db.Exec("INSERT OR IGNORE INTO users (user_id) VALUES (?)", userID); err != nil {
+		return fmt.Errorf("ошибка при вставке пользователя: %w", err)
+	}
+	if _, err := b.db.Exec("UPDATE users SET digest_time = ? WHERE user_id = ?", clock, userID); err != nil {
+		return fmt.Errorf("ошибка при обновлении подписки на сводку: %w", err)
+	}
+	return nil
+}
+
+// getUserDigestTime возвращает время ежедневной сводки или пустую строку, если подписки нет
+func (b *Bot) getUserDigestTime(userID int64) (string, error) {
+	var clock string
+	err := b.db.QueryRow("SELECT COALESCE(digest_time, '') FROM users WHERE user_id = ?", userID).Scan(&clock)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("ошибка при получении подписки на сводку: %w", err)
+	}
+	return clock, nil
+}
+
+// nextDigestRun возвращает ближайший момент после now, когда на часах clock ("ЧЧ:ММ")
+func nextDigestRun(now time.Time, clock time.Time) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// scheduleDigest ставит следующую сводку пользователя, снимая остальные его невыполненные сводки.
+// keepID - выполняемое сейчас задание, его не трогаем.
+func (b *Bot) scheduleDigest(userID, chatID int64, clock string, keepID int64) (time.Time, error) {
+	at, err := time.Parse("15:04", clock)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("некорректное время сводки %q: %w", clock, err)
+	}
+	loc, err := b.userLocation(userID)
+	if err != nil {
+		log.Printf("Ошибка получения часовой зоны: %v", err)
+	}
+	if _, err := b.db.Exec("DELETE FROM reminders WHERE user_id = ? AND kind = ? AND delivered_at IS NULL AND id != ?",
+		userID, jobDigest, keepID); err != nil {
+		return time.Time{}, fmt.Errorf("ошибка отмены сводок: %w", err)
+	}
+	next := nextDigestRun(time.Now().In(loc), at)
+	if _, err := b.scheduleJob(userID, chatID, jobDigest, clock, next); err != nil {
+		return time.Time{}, err
+	}
+	return next, nil
+}
+
+// digestSubscribe обрабатывает команду /digest_subscribe ЧЧ:ММ: каждый вечер присылает сводку переписки за день
+func (b *Bot) digestSubscribe(message *tgbotapi.Message) error {
+	if !message.Chat.IsPrivate() {
+		return b.reply(message, "Сводка пересказывает личную переписку, поэтому подписаться можно только в личке с ботом.")
+	}
+	arg := strings.TrimSpace(message.CommandArguments())
+	if arg == "" {
+		arg = "21:00"
+	}
+	at, err := time.Parse("15:04", arg)
+	if err != nil {
+		return b.reply(message, "Использование: /digest_subscribe ЧЧ:ММ, например: /digest_subscribe 21:00")
+	}
+	clock := at.Format("15:04")
+
+	userID := senderID(message)
+	if err := b.setUserDigestTime(userID, clock); err != nil {
+		return err
+	}
+	next, err := b.scheduleDigest(userID, message.Chat.ID, clock, 0)
+	if err != nil {
+		return err
+	}
+	return b.reply(message, fmt.Sprintf("📬 Готово: каждый день в %s (%s) пришлю сводку наших разговоров за день, "+
+		"если они были. Ближайшая - %s. Отписаться: /digest_off", clock, next.Location(), formatJobTime(next, next.Location())))
+}
+
+// digestOff обрабатывает команду /digest_off: отписывает от ежедневной сводки
+func (b *Bot) digestOff(message *tgbotapi.Message) error {
+	userID := senderID(message)
+	if err := b.setUserDigestTime(userID, ""); err != nil {
+		return err
+	}
+	if _, err := b.db.Exec("DELETE FROM reminders WHERE user_id = ? AND kind = ? AND delivered_at IS NULL", userID, jobDigest); err != nil {
+		return fmt.Errorf("ошибка отмены сводок: %w", err)
+	}
+	return b.reply(message, "Сводка за день отключена. Включить снова: /digest_subscribe 21:00")
+}
+
+// dayTranscript собирает переписку пользователя за [from, to) в текст для сводки; пустая строка - переписки не было
+func (b *Bot) dayTranscript(userID int64, from, to time.Time) (string, error) {
+	rows, err := b.db.Query(`SELECT role, content FROM history
+		WHERE user_id = ? AND created_at >= ? AND created_at < ? ORDER BY id`,
+		userID, from.UTC().Format(sqliteTimeLayout), to.UTC().Format(sqliteTimeLayout))
+	if err != nil {
+		return "", fmt.Errorf("ошибка чтения истории за день: %w", err)
+	}
+	defer rows.Close()
+
+	var lines []string
+	for rows.Next() {
+		var role, content string
+		if err := rows.Scan(&role, &content); err != nil {
+			return "", fmt.Errorf("ошибка чтения истории за день: %w", err)
+		}
+		who := "Пользователь"
+		if role == "assistant" {
+			who = "Ты"
+		}
+		lines = append(lines, who+": "+truncateRunes(content, digestMessageRunes))
+	}
+	if err := rows.Err(); err != nil {
+		return "", fmt.Errorf("ошибка чтения истории за день: %w", err)
+	}
+
+	// Если переписки много, важнее конец дня: обещания и открытые вопросы обычно там
+	size, start := 0, len(lines)
+	for start > 0 && size+utf8.RuneCountInString(lines[start-1]) <= digestInputRunes {
+		start--
+		size += utf8.RuneCountInString(lines[start])
+	}
+	return strings.Join(lines[start:], "\n\n"), nil
+}
+
+// runDigestJob присылает сводку за день и сразу ставит следующую.
+// Дни без переписки пропускаются; в бюджет идёт только digestCostRate токенов.
+func (b *Bot) runDigestJob(job scheduledJob) error {
+	clock, err := b.getUserDigestTime(job.UserID)
+	if err != nil || clock == "" {
+		return err // Пользователь отписался - задание просто снимается
+	}
+	// Следующая сводка ставится до запроса к модели: если сегодняшняя не получится, подписка не прервётся
+	if _, err := b.scheduleDigest(job.UserID, job.ChatID, clock, job.ID); err != nil {
+		return err
+	}
+
+	loc, err := b.userLocation(job.UserID)
+	if err != nil {
+		log.Printf("Ошибка получения часовой зоны: %v", err)
+	}
+	due := job.DueAt.In(loc)
+	dayStart := time.Date(due.Year(), due.Month(), due.Day(), 0, 0, 0, 0, loc)
+	transcript, err := b.dayTranscript(job.UserID, dayStart, due)
+	if err != nil || transcript == "" {
+		return err
+	}
+
+	estimate := float64(estimateTokens(digestPrompt+transcript) + completionReserve)
+	if err := b.checkBudget(job.UserID, int64(estimate*digestCostRate)); err != nil {
+		slog.Info("сводка пропущена: исчерпан дневной лимит", "user_id", job.UserID)
+		return nil
+	}
+	aiResponse, err := b.makeAIRequest(digestPrompt, transcript)
+	if err != nil {
+		return err
+	}
+
+	text := truncateRunes("📬 Сводка за день\n\n"+aiResponse.Content, messageTextLimit)
+	_, err = b.sendFormatted(text, func(text, parseMode string) tgbotapi.Chattable {
+		msg := tgbotapi.NewMessage(job.ChatID, text)
+		msg.ParseMode = parseMode
+		msg.DisableNotification = job.Silent
+		return msg
+	})
+	if err != nil {
+		return fmt.Errorf("ошибка отправки сводки: %w", err)
+	}
+	if err := b.recordDigestUsage(job, aiResponse); err != nil {
+		log.Printf("Ошибка записи статистики использования: %v", err)
+	}
+	return nil
+}
+
+// recordDigestUsage записывает расход сводки со скидкой digestCostRate
+func (b *Bot) recordDigestUsage(job scheduledJob, aiResponse *AIResponse) error {
+	_, err := b.db.Exec(`INSERT INTO usage (bot_id, user_id, chat_id, model, style, prompt_tokens, completion_tokens, queue_ms, ai_ms, total_ms)
+		VALUES (?, ?, ?, ?, '', ?, ?, 0, ?, 0)`,
+		b.botID, job.UserID, job.ChatID, aiResponse.Model,
+		int64(float64(aiResponse.Usage.PromptTokens)*digestCostRate), int64(float64(aiResponse.Usage.CompletionTokens)*digestCostRate),
+		aiResponse.Duration.Milliseconds())
+	if err != nil {
+		return fmt.Errorf("ошибка записи статистики сводки: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+)
+
+const embeddingsBatchSize = 16 // Сколько текстов отправляется в одном запросе к эндпоинту эмбеддингов
+
+// errEmbeddingsDisabled - EMBEDDINGS_URL не задан
+var errEmbeddingsDisabled = errors.New("эндпоинт эмбеддингов не настроен")
+
+// embeddingsEnabled сообщает, настроен ли эндпоинт эмбеддингов
+func (b *Bot) embeddingsEnabled() bool {
+	return b.cfg().EmbeddingsURL != ""
+}
+
+// embed получает векторы для текстов у OpenAI-совместимого эндпоинта /embeddings, порциями по embeddingsBatchSize
+func (b *Bot) embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if !b.embeddingsEnabled() {
+		return nil, errEmbeddingsDisabled
+	}
+	vectors := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += embeddingsBatchSize {
+		batch, err := b.embeddingsRequest(ctx, texts[start:min(start+embeddingsBatchSize, len(texts))])
+		if err != nil {
+			return nil, err
+		}
+		vectors = append(vectors, batch...)
+	}
+	return vectors, nil
+}
+
+// embeddingsRequest отправляет одну порцию текстов
+func (b *Bot) embeddingsRequest(ctx context.Context, texts []string) ([][]float32, error) {
+	body, err := json.Marshal(map[string]any{"model": b.cfg().EmbeddingsModel, "input": texts})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка маршалинга запроса эмбеддингов: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.cfg().EmbeddingsURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания запроса эмбеддингов: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+b.cfg().HuggingFaceAPIToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := b.aiClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса эмбеддингов: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("сервис эмбеддингов вернул %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("ошибка разбора ответа эмбеддингов: %w", err)
+	}
+	if len(result.Data) != len(texts) {
+		return nil, fmt.Errorf("сервис эмбеддингов вернул %d векторов на %d текстов", len(result.Data), len(texts))
+	}
+	vectors := make([][]float32, len(texts))
+	for _, d := range result.Data {
+		if d.Index < 0 || d.Index >= len(texts) {
+			return nil, fmt.Errorf("сервис эмбеддингов вернул некорректный индекс %d", d.Index)
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	return vectors, nil
+}
+
+// encodeVector упаковывает вектор для хранения в BLOB (float32, little-endian)
+func encodeVector(v []float32) []byte {
+	buf := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(x))
+	}
+	return buf
+}
+
+// decodeVector распаковывает вектор из BLOB
+func decodeVector(buf []byte) []float32 {
+	v := make([]float32, len(buf)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+	}
+	return v
+}
+
+// cosineSimilarity - косинусная близость векторов; векторы разной длины (другая модель) считаются непохожими
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	ephemeralMinTTL = time.Minute
+	ephemeralMaxTTL = 24 * time.Hour // Telegram даёт удалять сообщения только первые 48 часов
+)
+
+const ephemeralUsage = "Использование:\n" +
+	"/ephemeral 10m <вопрос> - ответ исчезнет через 10 минут вместе с вопросом\n" +
+	"/ephemeral default 30m - так отвечать на все вопросы\n" +
+	"/ephemeral default off - отвечать как обычно\n\n" +
+	"Срок: от 1m до 24h, например 90s, 10m, 2h."
+
+// parseEphemeralTTL разбирает срок жизни ответа вида 10m или 2h
+func parseEphemeralTTL(arg string) (time.Duration, error) {
+	ttl, err := time.ParseDuration(arg)
+	if err != nil {
+		return 0, fmt.Errorf("некорректный срок %q, нужно например 10m или 2h", arg)
+	}
+	if ttl < ephemeralMinTTL || ttl > ephemeralMaxTTL {
+		return 0, fmt.Errorf("срок должен быть от %s до %s", formatTTL(ephemeralMinTTL), formatTTL(ephemeralMaxTTL))
+	}
+	return ttl.Round(time.Second), nil
+}
+
+// formatTTL - срок жизни ответа по-человечески: «10 мин», «2 ч»
+func formatTTL(ttl time.Duration) string {
+	switch {
+	case ttl >= time.Hour && ttl%time.Hour == 0:
+		return fmt.Sprintf("%d ч", int(ttl.Hours()))
+	case ttl >= time.Minute:
+		return fmt.Sprintf("%d мин", int((ttl + time.Minute/2).Minutes()))
+	}
+	return fmt.Sprintf("%d с", int(ttl.Seconds()))
+}
+
+// ephemeralFooter - пометка под исчезающим ответом
+func ephemeralFooter(ttl time.Duration) string {
+	return "🔥 исчезнет через " + formatTTL(ttl)
+}
+
+// ephemeral обрабатывает команду /ephemeral: исчезающий ответ на вопрос или настройка по умолчанию
+func (b *Bot) ephemeral(message *tgbotapi.Message) error {
+	fields := strings.Fields(message.CommandArguments())
+	if len(fields) == 0 {
+		return b.reply(message, ephemeralUsage)
+	}
+	if strings.ToLower(fields[0]) == "default" {
+		return b.setEphemeralDefault(message, fields[1:])
+	}
+	ttl, err := parseEphemeralTTL(fields[0])
+	if err != nil {
+		return b.reply(message, err.Error()+"\n\n"+ephemeralUsage)
+	}
+	prompt := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(message.CommandArguments()), fields[0]))
+	if prompt == "" {
+		return b.reply(message, "Напиши вопрос после срока, например: /ephemeral 10m <вопрос>")
+	}
+	in := chatInputFrom(message, prompt)
+	in.Ephemeral = ttl
+	return b.answerPrompt(context.Background(), in, message.MessageID)
+}
+
+// setEphemeralDefault обрабатывает /ephemeral default <срок|off>
+func (b *Bot) setEphemeralDefault(message *tgbotapi.Message, args []string) error {
+	if len(args) != 1 {
+		return b.reply(message, ephemeralUsage)
+	}
+	var ttl time.Duration
+	if enabled, ok := parseToggle(args[0]); !ok || enabled {
+		var err error
+		if ttl, err = parseEphemeralTTL(args[0]); err != nil {
+			return b.reply(message, err.Error()+"\n\n"+ephemeralUsage)
+		}
+	}
+	if err := b.setUserEphemeral(senderID(message), ttl); err != nil {
+		b.reply(message, "Не удалось сохранить настройку, попробуй позже.")
+		return err
+	}
+	if ttl == 0 {
+		return b.reply(message, "Готово: ответы больше не исчезают.")
+	}
+	return b.reply(message, fmt.Sprintf("Готово: каждый ответ исчезнет через %s вместе с вопросом.", formatTTL(ttl)))
+}
+
+// setUserEphemeral сохраняет срок жизни ответов по умолчанию (0 - не удалять)
+func (b *Bot) setUserEphemeral(userID int64, ttl time.Duration) error {
+	if _, err := b.db.Exec("INSERT OR IGNORE INTO users (user_id) VALUES (?)", userID); err != nil {
+		return fmt.Errorf("ошибка при вставке пользователя: %w", err)
+	}
+	if _, err := b.db.Exec("UPDATE users SET ephemeral_ttl = ? WHERE user_id = ?", int(ttl.Seconds()), userID); err != nil {
+		return fmt.Errorf("ошибка при обновлении срока жизни ответов: %w", err)
+	}
+	return nil
+}
+
+// getUserEphemeral возвращает срок жизни ответов по умолчанию (0 - ответы не удаляются)
+func (b *Bot) getUserEphemeral(userID int64) (time.Duration, error) {
+	var seconds int
+	err := b.db.QueryRow("SELECT COALESCE(ephemeral_ttl, 0) FROM users WHERE user_id = ?", userID).Scan(&seconds)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("ошибка при получении срока жизни ответов: %w", err)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// scheduleDeletion ставит удаление сообщений через ttl. Задание хранится в базе,
+// поэтому перезапуск бота не оставляет сообщения висеть навсегда.
+func (b *Bot) scheduleDeletion(userID, chatID int64, messageIDs []int, ttl time.Duration) {
+	seen := make(map[int]bool)
+	var ids []string
+	for _, id := range messageIDs {
+		if id != 0 && !seen[id] {
+			seen[id] = true
+			ids = append(ids, strconv.Itoa(id))
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+	if _, err := b.scheduleJob(userID, chatID, jobDelete, strings.Join(ids, ","), time.Now().Add(ttl)); err != nil {
+		log.Printf("Ошибка планирования удаления ответа: %v", err)
+	}
+}
+
+// scheduleAnswerDeletion ставит удаление исчезающего ответа: всех его сообщений, плейсхолдера
+// (в нём ответ или его первая страница) и вопроса пользователя, если бот вправе его удалить
+func (b *Bot) scheduleAnswerDeletion(in chatInput, questionID, placeholderID int, delivered []tgbotapi.Message) {
+	ids := []int{questionID, placeholderID}
+	for _, msg := range delivered {
+		ids = append(ids, msg.MessageID)
+	}
+	b.scheduleDeletion(in.UserID, in.ChatID, ids, in.Ephemeral)
+}
+
+// runDeleteJob удаляет сообщения исчезающего ответа. Неудачи (сообщение старше 48 часов, нет прав
+// в группе, уже удалено) только пишутся в лог: повтор ничего бы не изменил.
+func (b *Bot) runDeleteJob(job scheduledJob) error {
+	for _, field := range strings.Split(job.Payload, ",") {
+		id, err := strconv.Atoi(field)
+		if err != nil {
+			slog.Warn("некорректный ID сообщения в задании удаления", "id", job.ID, "payload", job.Payload)
+			continue
+		}
+		if _, err := b.api.Request(tgbotapi.NewDeleteMessage(job.ChatID, id)); err != nil {
+			slog.Warn("не удалось удалить исчезающее сообщение", "chat_id", job.ChatID, "message_id", id, "error", err)
+		}
+	}
+	return nil
+}
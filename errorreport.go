@@ -0,0 +1,146 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// errorReportWindow - не чаще одного уведомления об ошибке с одинаковой сигнатурой за этот период
+const errorReportWindow = 10 * time.Minute
+
+// errorReporter ограничивает поток уведомлений об ошибках в админский чат
+type errorReporter struct {
+	mu       sync.Mutex
+	lastSent map[string]time.Time
+}
+
+func newErrorReporter() *errorReporter {
+	return &errorReporter{lastSent: make(map[string]time.Time)}
+}
+
+// allow решает, пора ли снова сообщать об ошибке с этой сигнатурой, и запоминает время отправки
+func (r *errorReporter) allow(signature string, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if sent, ok := r.lastSent[signature]; ok && now.Sub(sent) < errorReportWindow {
+		return false
+	}
+	// Заодно выбрасываем устаревшие записи, чтобы карта не росла бесконечно
+	for sig, sent := range r.lastSent {
+		if now.Sub(sent) >= errorReportWindow {
+			delete(r.lastSent, sig)
+		}
+	}
+	r.lastSent[signature] = now
+	return true
+}
+
+var signatureDigits = regexp.MustCompile(`\d+`)
+
+// errorSignature сводит похожие ошибки к одной сигнатуре: числа (ID, порты, коды) заменяются на #
+func errorSignature(err error) string {
+	return truncateRunes(signatureDigits.ReplaceAllString(err.Error(), "#"), 200)
+}
+
+// reportError записывает ошибку обработки в таблицу errors и сообщает о ней в админский чат
+// не чаще раза в 10 минут на сигнатуру. Отправка идёт через notifyAdmin, который при сбое
+// только пишет в лог, поэтому рекурсии не возникает.
+func (b *Bot) reportError(info *updateInfo, err error) {
+	if err == nil {
+		return
+	}
+	signature := errorSignature(err)
+	if dbErr := b.recordError(signature, info, err); dbErr != nil {
+		slog.Error("не удалось сохранить ошибку", "error", dbErr)
+	}
+
+	if b.cfg().AdminChatID == 0 || !b.errorReporter.allow(signature, time.Now()) {
+		return
+	}
+	b.notifyAdmin(fmt.Sprintf("🚨 Ошибка в обработчике %s, код %s\nupdate_id: %d, chat: %d, user: %d\n\n%s",
+		info.Handler, info.RequestID, info.UpdateID, info.ChatID, info.UserID, truncateRunes(err.Error(), 3000)))
+}
+
+// recordError сохраняет ошибку: повтор той же сигнатуры увеличивает счётчик и обновляет последнее появление
+func (b *Bot) recordError(signature string, info *updateInfo, err error) error {
+	_, dbErr := b.db.Exec(`
+		INSERT INTO errors (signature, message, handler, user_id, chat_id, update_id, request_id) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(signature) DO UPDATE SET
+			message = excluded.message, handler = excluded.handler, user_id = excluded.user_id,
+			chat_id = excluded.chat_id, update_id = excluded.update_id, request_id = excluded.request_id,
+			count = count + 1, last_seen = CURRENT_TIMESTAMP`,
+		signature, err.Error(), info.Handler, info.UserID, info.ChatID, info.UpdateID, info.RequestID)
+	if dbErr != nil {
+		return fmt.Errorf("ошибка сохранения ошибки: %w", dbErr)
+	}
+	return nil
+}
+
+// showErrors обрабатывает команду /errors: последние сигнатуры ошибок или подробности одной из них
+func (b *Bot) showErrors(message *tgbotapi.Message) error {
+	arg := strings.TrimSpace(message.CommandArguments())
+	if arg == "" {
+		return b.listErrors(message)
+	}
+	id, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return b.reply(message, "Использование: /errors или /errors <id>")
+	}
+
+	var signature, text, handler, requestID string
+	var userID, chatID int64
+	var updateID, count int
+	var firstSeen, lastSeen time.Time
+	err = b.db.QueryRow(`SELECT signature, message, handler, user_id, chat_id, update_id, request_id, count, first_seen, last_seen
+		FROM errors WHERE id = ?`, id).
+		Scan(&signature, &text, &handler, &userID, &chatID, &updateID, &requestID, &count, &firstSeen, &lastSeen)
+	if err == sql.ErrNoRows {
+		return b.reply(message, "Ошибка с таким id не найдена.")
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка получения ошибки: %w", err)
+	}
+
+	details := fmt.Sprintf("🚨 Ошибка #%d (%d раз)\nПервое появление: %s\nПоследнее: %s\n"+
+		"Обработчик: %s, код: %s\nupdate_id: %d, chat: %d, user: %d\n\n%s",
+		id, count, firstSeen.Format("02.01.2006 15:04"), lastSeen.Format("02.01.2006 15:04"),
+		handler, requestID, updateID, chatID, userID, text)
+	return b.reply(message, truncateRunes(details, messageTextLimit))
+}
+
+// listErrors показывает недавние сигнатуры ошибок со счётчиками
+func (b *Bot) listErrors(message *tgbotapi.Message) error {
+	rows, err := b.db.Query("SELECT id, signature, count, last_seen FROM errors ORDER BY last_seen DESC LIMIT 15")
+	if err != nil {
+		return fmt.Errorf("ошибка получения ошибок: %w", err)
+	}
+	defer rows.Close()
+
+	var sb strings.Builder
+	for rows.Next() {
+		var id int64
+		var count int
+		var signature string
+		var lastSeen time.Time
+		if err := rows.Scan(&id, &signature, &count, &lastSeen); err != nil {
+			return fmt.Errorf("ошибка чтения ошибок: %w", err)
+		}
+		fmt.Fprintf(&sb, "\n#%d · ×%d · %s\n%s\n", id, count, lastSeen.Format("02.01 15:04"), truncateRunes(signature, 150))
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("ошибка чтения ошибок: %w", err)
+	}
+	if sb.Len() == 0 {
+		return b.reply(message, "Ошибок не было 🎉")
+	}
+	return b.reply(message, truncateRunes("🚨 Последние ошибки (подробности: /errors <id>)\n"+sb.String(), messageTextLimit))
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const exportFileLimit = 50 << 20 // Telegram не принимает от ботов файлы больше 50 МБ
+
+// HistoryRecord - одно сообщение истории в формате экспорта
+type HistoryRecord struct {
+	Role      string    `json:"role"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"ts"`
+	Model     string    `json:"model,omitempty"`
+}
+
+// HistoryStore - источник истории для экспорта
+type HistoryStore interface {
+	HistoryRecords(userID int64) ([]HistoryRecord, error)
+}
+
+// HistoryRecords читает всю историю пользователя с этим ботом в хронологическом порядке.
+// В общей базе нескольких ботов разговоры с другими ботами в выгрузку не попадают.
+func (b *Bot) HistoryRecords(userID int64) ([]HistoryRecord, error) {
+	rows, err := b.db.Query(`SELECT h.role, h.content, h.created_at, COALESCE(h.model, '') FROM history h
+		LEFT JOIN conversations c ON c.id = h.conversation_id
+		WHERE h.user_id = ? AND COALESCE(c.bot_id, 0) = ?
+		ORDER BY h.id`, userID, b.botID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении истории: %w", err)
+	}
+	defer rows.Close()
+
+	var records []HistoryRecord
+	for rows.Next() {
+		var record HistoryRecord
+		if err := rows.Scan(&record.Role, &record.Content, &record.CreatedAt, &record.Model); err != nil {
+			return nil, fmt.Errorf("ошибка при чтении истории: %w", err)
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// exportHistory выгружает историю пользователя в формате format ("md" или "json").
+// Результат разбит на части не больше limit байт; каждая часть - самостоятельный файл.
+// Пустая история даёт пустой список частей.
+func exportHistory(store HistoryStore, userID int64, format, style string, limit int) ([][]byte, error) {
+	records, err := store.HistoryRecords(userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	var header string
+	var chunks []string
+	wrap := 0 // Сколько байт части занимает обёртка вокруг кусков
+	switch format {
+	case "md":
+		header = fmt.Sprintf("# История переписки\n\nСтиль: %s\n", styleTitle(style))
+		for _, record := range records {
+			chunks = append(chunks, markdownRecord(record))
+		}
+	case "json":
+		wrap = len("[\n") + len("\n]\n")
+		for _, record := range records {
+			data, err := json.MarshalIndent(record, "  ", "  ")
+			if err != nil {
+				return nil, fmt.Errorf("ошибка сериализации истории: %w", err)
+			}
+			chunks = append(chunks, "  "+string(data))
+		}
+	default:
+		return nil, fmt.Errorf("неизвестный формат экспорта: %s", format)
+	}
+
+	var parts [][]byte
+	for _, group := range groupChunks(chunks, limit-len(header)-wrap) {
+		if format == "json" {
+			parts = append(parts, []byte("[\n"+strings.Join(group, ",\n")+"\n]\n"))
+		} else {
+			parts = append(parts, []byte(header+strings.Join(group, "")))
+		}
+	}
+	return parts, nil
+}
+
+// markdownRecord оформляет одно сообщение как раздел Markdown
+func markdownRecord(record HistoryRecord) string {
+	title := "Вопрос"
+	if record.Role == "assistant" {
+		title = "Ответ"
+	}
+	meta := record.CreatedAt.Format("2006-01-02 15:04")
+	if record.Model != "" {
+		meta += " · " + shortModelName(record.Model)
+	}
+	return fmt.Sprintf("\n### %s\n_%s_\n\n%s\n", title, meta, record.Content)
+}
+
+// groupChunks раскладывает куски по группам, суммарный размер которых не превышает limit.
+// Кусок больше limit попадает в отдельную группу целиком.
+func groupChunks(chunks []string, limit int) [][]string {
+	var groups [][]string
+	var current []string
+	size := 0
+	for _, chunk := range chunks {
+		if len(current) > 0 && size+len(chunk) > limit {
+			groups = append(groups, current)
+			current, size = nil, 0
+		}
+		current = append(current, chunk)
+		size += len(chunk) + 2 // Разделитель между кусками
+	}
+	if len(current) > 0 {
+		groups = append(groups, current)
+	}
+	return groups
+}
+
+// export обрабатывает команду /export md|json
+func (b *Bot) export(message *tgbotapi.Message) error {
+	userID := senderID(message)
+	format := message.CommandArguments()
+	if format != "md" && format != "json" {
+		return b.reply(message, "Использование: /export md или /export json")
+	}
+
+	privacy, err := b.getUserPrivacy(userID)
+	if err != nil {
+		return err
+	}
+	if privacy == privacyStrict {
+		return b.reply(message, "🔒 В строгом режиме приватности история не сохраняется, выгружать нечего.")
+	}
+
+	style, err := b.getUserStyle(userID)
+	if err != nil {
+		return err
+	}
+	parts, err := exportHistory(b, userID, format, style, exportFileLimit)
+	if err != nil {
+		b.reply(message, "Не удалось выгрузить историю, попробуй позже.")
+		return err
+	}
+	if len(parts) == 0 {
+		return b.reply(message, "История пуста.")
+	}
+
+	stamp := time.Now().Format("2006-01-02")
+	for i, part := range parts {
+		name := fmt.Sprintf("history-%s.%s", stamp, format)
+		if len(parts) > 1 {
+			name = fmt.Sprintf("history-%s-part%d.%s", stamp, i+1, format)
+		}
+		doc := tgbotapi.NewDocument(message.Chat.ID, tgbotapi.FileBytes{Name: name, Bytes: part})
+		if _, err := b.api.Send(doc); err != nil {
+			return fmt.Errorf("ошибка отправки выгрузки: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// seedHistory заполняет историю пользователя чередующимися вопросами и ответами
+func seedHistory(t *testing.T, b *Bot, userID int64, n int) []HistoryRecord {
+	t.Helper()
+	start := time.Date(2026, 3, 1, 9, 30, 0, 0, time.UTC)
+	var records []HistoryRecord
+	for i := 0; i < n; i++ {
+		record := HistoryRecord{Role: "user", Content: strings.Repeat("вопрос ", i+1), CreatedAt: start.Add(time.Duration(i) * time.Minute)}
+		if i%2 == 1 {
+			record.Role, record.Model = "assistant", "openai/gpt-4o-mini"
+			record.Content = "ответ с `кодом` и \"кавычками\"\nвторая строка"
+		}
+		_, err := b.db.Exec("INSERT INTO history (user_id, role, content, created_at, model) VALUES (?, ?, ?, ?, ?)",
+			userID, record.Role, record.Content, record.CreatedAt, record.Model)
+		if err != nil {
+			t.Fatalf("заполнение истории: %v", err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// decodeJSONParts разбирает части JSON-выгрузки и склеивает записи
+func decodeJSONParts(t *testing.T, parts [][]byte) []HistoryRecord {
+	t.Helper()
+	var all []HistoryRecord
+	for i, part := range parts {
+		var records []HistoryRecord
+		if err := json.Unmarshal(part, &records); err != nil {
+			t.Fatalf("часть %d не является JSON-массивом: %v\n%s", i+1, err, part)
+		}
+		all = append(all, records...)
+	}
+	return all
+}
+
+func TestExportHistoryMarkdown(t *testing.T) {
+	b, _ := newTestBot(t)
+	seedHistory(t, b, 1, 4)
+	seedHistory(t, b, 2, 1) // Чужая история в выгрузку не попадает
+
+	parts, err := exportHistory(b, 1, "md", "short", exportFileLimit)
+	if err != nil {
+		t.Fatalf("exportHistory: %v", err)
+	}
+	if len(parts) != 1 {
+		t.Fatalf("частей %d, ожидалась одна", len(parts))
+	}
+	md := string(parts[0])
+	if !strings.HasPrefix(md, "# История переписки\n\nСтиль: "+styleTitle("short")+"\n") {
+		t.Errorf("нет заголовка:\n%s", md)
+	}
+	for _, want := range []string{
+		"\n### Вопрос\n_2026-03-01 09:30_\n\nвопрос \n",
+		"\n### Ответ\n_2026-03-01 09:31 · " + shortModelName("openai/gpt-4o-mini") + "_\n\nответ с `кодом`",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("в выгрузке нет %q:\n%s", want, md)
+		}
+	}
+	if n := strings.Count(md, "\n### "); n != 4 {
+		t.Errorf("разделов %d, ожидалось 4", n)
+	}
+}
+
+func TestExportHistoryJSON(t *testing.T) {
+	b, _ := newTestBot(t)
+	want := seedHistory(t, b, 1, 3)
+
+	parts, err := exportHistory(b, 1, "json", "", exportFileLimit)
+	if err != nil {
+		t.Fatalf("exportHistory: %v", err)
+	}
+	if len(parts) != 1 {
+		t.Fatalf("частей %d, ожидалась одна", len(parts))
+	}
+	got := decodeJSONParts(t, parts)
+	if len(got) != len(want) {
+		t.Fatalf("записей %d, ожидалось %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Role != want[i].Role || got[i].Content != want[i].Content || got[i].Model != want[i].Model ||
+			!got[i].CreatedAt.Equal(want[i].CreatedAt) {
+			t.Errorf("запись %d: %+v, ожидалась %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestExportHistorySplitsParts(t *testing.T) {
+	b, _ := newTestBot(t)
+	want := seedHistory(t, b, 1, 20)
+
+	// Перебор лимитов ловит ошибки на единицу в учёте скобок и разделителей
+	for limit := 400; limit <= 1200; limit++ {
+		for _, format := range []string{"md", "json"} {
+			parts, err := exportHistory(b, 1, format, "short", limit)
+			if err != nil {
+				t.Fatalf("exportHistory(%s, %d): %v", format, limit, err)
+			}
+			if len(parts) < 2 {
+				t.Fatalf("%s, лимит %d: история не разбита на части", format, limit)
+			}
+			for i, part := range parts {
+				if len(part) > limit {
+					t.Fatalf("%s, лимит %d: часть %d занимает %d байт", format, limit, i+1, len(part))
+				}
+				if format == "md" && !strings.HasPrefix(string(part), "# История переписки\n") {
+					t.Fatalf("md, лимит %d: у части %d нет заголовка", limit, i+1)
+				}
+			}
+			if format == "json" {
+				if got := decodeJSONParts(t, parts); len(got) != len(want) {
+					t.Fatalf("json, лимит %d: в частях %d записей из %d", limit, len(got), len(want))
+				}
+			} else {
+				total := 0
+				for _, part := range parts {
+					total += strings.Count(string(part), "\n### ")
+				}
+				if total != len(want) {
+					t.Fatalf("md, лимит %d: в частях %d разделов из %d", limit, total, len(want))
+				}
+			}
+		}
+	}
+}
+
+func TestExportHistoryOnlyThisBot(t *testing.T) {
+	b, _ := newTestBot(t)
+	const userID, otherBotID = 1, 777
+	seedHistory(t, b, userID, 2) // Разговор с основным ботом (bot_id = 0)
+
+	// Тот же пользователь в той же базе говорил и с другим ботом
+	conversationID, err := createConversation(b.db, otherBotID, userID, "другой бот")
+	if err != nil {
+		t.Fatalf("createConversation: %v", err)
+	}
+	_, err = b.db.Exec("INSERT INTO history (user_id, conversation_id, role, content) VALUES (?, ?, 'user', 'секрет другого бота')",
+		userID, conversationID)
+	if err != nil {
+		t.Fatalf("заполнение истории: %v", err)
+	}
+
+	parts, err := exportHistory(b, userID, "json", "", exportFileLimit)
+	if err != nil {
+		t.Fatalf("exportHistory: %v", err)
+	}
+	if got := decodeJSONParts(t, parts); len(got) != 2 {
+		t.Errorf("основной бот выгрузил %d записей, ожидалось 2: %+v", len(got), got)
+	}
+
+	b.botID = otherBotID // Тот же бот как второй в общей базе
+	parts, err = exportHistory(b, userID, "json", "", exportFileLimit)
+	if err != nil {
+		t.Fatalf("exportHistory: %v", err)
+	}
+	if got := decodeJSONParts(t, parts); len(got) != 1 || got[0].Content != "секрет другого бота" {
+		t.Errorf("второй бот выгрузил %+v, ожидалась только его запись", got)
+	}
+}
+
+func TestExportHistoryEmptyAndUnknownFormat(t *testing.T) {
+	b, _ := newTestBot(t)
+	parts, err := exportHistory(b, 1, "md", "", exportFileLimit)
+	if err != nil || len(parts) != 0 {
+		t.Errorf("пустая история: %d частей, ошибка %v", len(parts), err)
+	}
+
+	seedHistory(t, b, 1, 1)
+	if _, err := exportHistory(b, 1, "csv", "", exportFileLimit); err == nil {
+		t.Error("неизвестный формат принят")
+	}
+}
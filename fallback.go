@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// cannedReplies - простые вопросы, на которые бот отвечает сам, пока модель недоступна
+var cannedReplies = []struct {
+	pattern *regexp.Regexp
+	reply   string
+}{
+	{
+		regexp.MustCompile(`(?i)как (у тебя |твои )?дела|как ты\??$|how are you`),
+		"У меня всё хорошо, спасибо! 🙂 Правда, мой ИИ сейчас отдыхает, так что на сложные вопросы отвечу чуть позже.",
+	},
+	{
+		regexp.MustCompile(`(?i)^(привет|здравствуй|здравствуйте|добрый (день|вечер)|доброе утро|хай|hi|hello|hey)([\s!.,)]|$)`),
+		"Привет! 👋 Я на месте, но ИИ сейчас недоступен. Простые вещи подскажу, а на остальное отвечу, когда он вернётся.",
+	},
+	{
+		regexp.MustCompile(`(?i)^(помощь|помоги|help|что ты умеешь|какие (есть )?команды)[\s?!.]*$`),
+		"Я отвечаю на вопросы с помощью ИИ и помню контекст разговора.\n\n" +
+			"/style - стиль общения\n/new - новый разговор\n/chats - мои разговоры\n" +
+			"/remember - запомнить факт\n/settings - настройки\n\nСейчас ИИ недоступен, но команды работают.",
+	},
+}
+
+// cannedReply подбирает готовый ответ на простой вопрос; пустая строка - готового ответа нет
+func cannedReply(prompt string) string {
+	prompt = strings.TrimSpace(prompt)
+	for _, canned := range cannedReplies {
+		if canned.pattern.MatchString(prompt) {
+			return canned.reply
+		}
+	}
+	return ""
+}
+
+// sendFallback заменяет плейсхолдер, когда модель недоступна: готовым ответом на простой вопрос
+// или извинением. Остальные вопросы встают в очередь и получат ответ, когда модель вернётся;
+// кнопка "Повторить" позволяет не ждать. В строгом режиме приватности вопрос на диск не пишется.
+func (b *Bot) sendFallback(message *tgbotapi.Message, placeholderID int, in chatInput, turn *chatTurn) error {
+	text := cannedReply(in.Prompt)
+	queued := false
+	if text == "" {
+		text = "😴 ИИ сейчас недоступен. Попробуй чуть позже."
+		if turn.Privacy != privacyStrict {
+			count, err := b.countPending(in.UserID)
+			if err != nil {
+				return err
+			}
+			if count < maxPendingPerUser {
+				text = "😴 ИИ сейчас недоступен. Я сохранил вопрос и отвечу, когда он вернётся, - или нажми «Повторить»."
+				queued = true
+			} else {
+				text = "😴 ИИ сейчас недоступен, а в очереди уже есть твои вопросы. Этот задай, пожалуйста, позже."
+			}
+		}
+	}
+
+	var keyboard *tgbotapi.InlineKeyboardMarkup
+	var id int64
+	if queued {
+		var err error
+		if id, err = b.savePending(in, message.MessageID); err != nil {
+			return err
+		}
+		markup := retryKeyboard(id)
+		keyboard = &markup
+	}
+
+	noticeID := placeholderID
+	edit := tgbotapi.NewEditMessageText(message.Chat.ID, placeholderID, text)
+	edit.ReplyMarkup = keyboard
+	if _, err := b.api.Send(edit); err != nil {
+		// Плейсхолдер могли удалить - отправляем новым сообщением
+		b.deleteMessage(message.Chat.ID, placeholderID)
+		msg := tgbotapi.NewMessage(message.Chat.ID, text)
+		msg.ReplyToMessageID = message.MessageID
+		if keyboard != nil {
+			msg.ReplyMarkup = *keyboard
+		}
+		sent, err := b.api.Send(msg)
+		if err != nil {
+			return fmt.Errorf("ошибка отправки сообщения о недоступности ИИ: %w", err)
+		}
+		noticeID = sent.MessageID
+	}
+
+	if queued {
+		if _, err := b.db.Exec("UPDATE pending_requests SET notice_id = ? WHERE id = ?", noticeID, id); err != nil {
+			return fmt.Errorf("ошибка сохранения вопроса в очередь: %w", err)
+		}
+	}
+	return nil
+}
+
+// retryKeyboard - кнопка "Повторить" для вопроса из очереди
+func retryKeyboard(id int64) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🔁 Повторить", fmt.Sprintf("retry:%d", id)),
+	))
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Официальный Bot API отдаёт ботам файлы не больше 20 МБ.
+// Локальный сервер telegram-bot-api такого ограничения не имеет.
+const cloudFileSizeLimit = 20 << 20
+
+// apiEndpointFormat превращает TELEGRAM_API_ENDPOINT в формат для tgbotapi ("<base>/bot%s/%s").
+// Пустое значение - официальный сервер api.telegram.org.
+func apiEndpointFormat(base string) string {
+	if base == "" {
+		return tgbotapi.APIEndpoint
+	}
+	return strings.TrimRight(base, "/") + "/bot%s/%s"
+}
+
+// downloadFile скачивает файл Telegram по file_id.
+// С официальным сервером файл качается по HTTPS, с локальным сервером (запущенным с --local)
+// file_path - это абсолютный путь на диске, и файл читается напрямую.
+func (b *Bot) downloadFile(fileID string, maxSize int) ([]byte, error) {
+	file, err := b.api.GetFile(tgbotapi.FileConfig{FileID: fileID})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения информации о файле: %w", err)
+	}
+
+	limit := maxSize
+	if b.cfg().TelegramAPIEndpoint == "" && (limit <= 0 || limit > cloudFileSizeLimit) {
+		limit = cloudFileSizeLimit
+	}
+	if limit > 0 && file.FileSize > limit {
+		return nil, fmt.Errorf("файл слишком большой: %d МБ (максимум %d МБ)", file.FileSize>>20, limit>>20)
+	}
+
+	if b.cfg().TelegramAPIEndpoint != "" && filepath.IsAbs(file.FilePath) {
+		data, err := os.ReadFile(file.FilePath)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения локального файла: %w", err)
+		}
+		return data, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, b.fileURL(file), nil)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания запроса на скачивание: %w", err)
+	}
+	resp, err := b.api.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка скачивания файла: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("сервер Telegram вернул %d при скачивании файла", resp.StatusCode)
+	}
+
+	reader := io.Reader(resp.Body)
+	if limit > 0 {
+		reader = io.LimitReader(resp.Body, int64(limit)+1)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения файла: %w", err)
+	}
+	if limit > 0 && len(data) > limit {
+		return nil, fmt.Errorf("файл слишком большой (максимум %d МБ)", limit>>20)
+	}
+	return data, nil
+}
+
+// fileURL возвращает ссылку для скачивания файла с учётом TELEGRAM_API_ENDPOINT
+func (b *Bot) fileURL(file tgbotapi.File) string {
+	if b.cfg().TelegramAPIEndpoint == "" {
+		return file.Link(b.api.Token)
+	}
+	base := strings.TrimRight(b.cfg().TelegramAPIEndpoint, "/")
+	return fmt.Sprintf("%s/file/bot%s/%s", base, b.api.Token, strings.TrimLeft(file.FilePath, "/"))
+}
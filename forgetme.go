@@ -0,0 +1,159 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// userDataTables - таблицы с данными пользователя (колонка user_id), которые чистит /forgetme.
+// Баны сюда не входят: они должны переживать удаление данных. Строка users удаляется
+// вместе со всем остальным, но колонки из keptUserColumns переносятся в новую.
+var userDataTables = []string{
+	"users",
+	"memories",
+	"history",
+	"conversations",
+	"usage",
+	"ratings",
+	"reminders",
+	"pending_requests",
+	"dead_letters",
+	"saved_prompts",
+	"answer_pages",
+	"kb_chunks",
+	"history_vectors",
+	"feedback",
+	"flagged",
+	"shared_pages",
+	"subscriptions",
+}
+
+// anonymizedTables - таблицы, где строки общие для многих пользователей (журнал ошибок сгруппирован
+// по сигнатуре), поэтому /forgetme не удаляет их, а стирает в них ссылки на пользователя
+var anonymizedTables = map[string]string{
+	"errors": "UPDATE errors SET user_id = 0, chat_id = 0 WHERE user_id = ?",
+}
+
+// keptUserColumns - колонки users, которые переживают /forgetme: это не сведения о человеке,
+// а учёт доступа к боту. Иначе /forgetme обнулял бы потраченный пробный период, а приглашённый
+// пользователь или пользователь с платным тарифом терял бы доступ.
+var keptUserColumns = []string{"trial_used", "approved", "tier"}
+
+// forgetMe обрабатывает команду /forgetme: просит подтвердить удаление всех данных
+func (b *Bot) forgetMe(message *tgbotapi.Message) error {
+	msg := tgbotapi.NewMessage(message.Chat.ID,
+		"⚠️ Удалить всё, что я о тебе храню: настройки, историю, факты из памяти и статистику? Это действие нельзя отменить.\n\n"+
+			"Доступ к боту сохранится: приглашение, тариф и потраченные пробные сообщения не сбрасываются.")
+	msg.ReplyToMessageID = message.MessageID
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("Да, удалить всё", fmt.Sprintf("forget:%d", senderID(message))),
+		tgbotapi.NewInlineKeyboardButtonData("Отмена", "forget:cancel"),
+	))
+	if _, err := b.api.Send(msg); err != nil {
+		return fmt.Errorf("ошибка отправки сообщения: %w", err)
+	}
+	return nil
+}
+
+// handleForgetCallback выполняет удаление после подтверждения кнопкой
+func (b *Bot) handleForgetCallback(query *tgbotapi.CallbackQuery, payload string) (string, error) {
+	text := "Хорошо, ничего не удаляю."
+	if payload != "cancel" {
+		// Кнопку может нажать только тот, кто вызвал /forgetme
+		if payload != fmt.Sprint(query.From.ID) {
+			return "Эта кнопка не для тебя", nil
+		}
+		if err := b.deleteUserData(query.From.ID); err != nil {
+			return "Не удалось удалить данные, попробуй позже", err
+		}
+		text = "🗑 Готово: все твои данные удалены. Доступ к боту и тариф остались прежними."
+	}
+
+	edit := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, text)
+	if _, err := b.api.Send(edit); err != nil {
+		return "", fmt.Errorf("ошибка обновления сообщения: %w", err)
+	}
+	return "", nil
+}
+
+// deleteUserData удаляет строки пользователя из всех таблиц в одной транзакции
+// и сбрасывает его состояние в памяти
+func (b *Bot) deleteUserData(userID int64) error {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, table := range userDataTables {
+		var exists int
+		err := tx.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("ошибка проверки таблицы %s: %w", table, err)
+		}
+		if exists == 0 {
+			continue // Таблица появится вместе с соответствующей функцией
+		}
+		if table == "users" {
+			if err := forgetUserRow(tx, userID); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE user_id = ?", table), userID); err != nil {
+			return fmt.Errorf("ошибка удаления данных из %s: %w", table, err)
+		}
+	}
+
+	for table, query := range anonymizedTables {
+		if _, err := tx.Exec(query, userID); err != nil {
+			return fmt.Errorf("ошибка обезличивания данных в %s: %w", table, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка подтверждения транзакции: %w", err)
+	}
+
+	b.debugMu.Lock()
+	delete(b.debugUsers, userID)
+	b.debugMu.Unlock()
+	b.session.clear(userID)
+	b.forgetActivity(userID)
+	b.pendingMemories.forget(userID)
+	b.templateDialogs.forget(userID)
+	b.kbUploads.stop(userID)
+	b.lastAnswers.forget(userID)
+	b.combiner.take(userID) // Несклеенные сообщения выбрасываются без ответа
+	return nil
+}
+
+// forgetUserRow заменяет строку пользователя новой, в которой остаются только keptUserColumns.
+// Так сбрасываются и колонки, добавленные позже, без отдельного списка того, что удалять.
+func forgetUserRow(tx *sql.Tx, userID int64) error {
+	columns := strings.Join(keptUserColumns, ", ")
+	kept := make([]any, len(keptUserColumns))
+	ptrs := make([]any, len(kept))
+	for i := range kept {
+		ptrs[i] = &kept[i]
+	}
+	err := tx.QueryRow(fmt.Sprintf("SELECT %s FROM users WHERE user_id = ?", columns), userID).Scan(ptrs...)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка чтения пользователя: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM users WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("ошибка удаления данных из users: %w", err)
+	}
+	placeholders := strings.Repeat(", ?", len(kept))
+	if _, err := tx.Exec(fmt.Sprintf("INSERT INTO users (user_id, %s) VALUES (?%s)", columns, placeholders),
+		append([]any{userID}, kept...)...); err != nil {
+		return fmt.Errorf("ошибка сохранения доступа пользователя: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// seedUserRow вставляет в таблицу строку пользователя, заполняя обязательные колонки без значения по умолчанию
+func seedUserRow(t *testing.T, b *Bot, table string, userID int64) {
+	t.Helper()
+	rows, err := b.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		t.Fatalf("PRAGMA table_info(%s): %v", table, err)
+	}
+	columns := []string{"user_id"}
+	values := []any{userID}
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, typ string
+		var dflt any
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err != nil {
+			rows.Close()
+			t.Fatalf("чтение схемы %s: %v", table, err)
+		}
+		if name == "user_id" || notNull == 0 || dflt != nil || pk != 0 {
+			continue
+		}
+		columns = append(columns, name)
+		if typ = strings.ToUpper(typ); strings.Contains(typ, "INT") || strings.Contains(typ, "REAL") {
+			values = append(values, userID)
+		} else {
+			values = append(values, fmt.Sprintf("%s-%d", name, userID)) // Уникально для каждого пользователя
+		}
+	}
+	rows.Close()
+
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (?%s)", table, strings.Join(columns, ", "), strings.Repeat(", ?", len(columns)-1))
+	if _, err := b.db.Exec(query, values...); err != nil {
+		t.Fatalf("заполнение %s: %v", table, err)
+	}
+}
+
+// existingUserTables - таблицы из userDataTables (кроме users), уже созданные схемой
+func existingUserTables(t *testing.T, b *Bot) []string {
+	t.Helper()
+	var tables []string
+	for _, table := range userDataTables[1:] {
+		var exists int
+		err := b.db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&exists)
+		if err != nil {
+			t.Fatalf("проверка таблицы %s: %v", table, err)
+		}
+		if exists > 0 {
+			tables = append(tables, table)
+		}
+	}
+	return tables
+}
+
+// countUserRows считает строки пользователя в таблице
+func countUserRows(t *testing.T, b *Bot, table string, userID int64) int {
+	t.Helper()
+	var n int
+	if err := b.db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE user_id = ?", table), userID).Scan(&n); err != nil {
+		t.Fatalf("подсчёт строк %s: %v", table, err)
+	}
+	return n
+}
+
+func TestDeleteUserDataRemovesEverything(t *testing.T) {
+	b, _ := newTestBot(t)
+	const userID, otherID = 1, 2
+	tables := existingUserTables(t, b)
+
+	for _, id := range []int64{userID, otherID} {
+		_, err := b.db.Exec(`INSERT INTO users (user_id, username, first_name, style, trial_used, approved, tier)
+			VALUES (?, 'alice', 'Алиса', 'short', 7, 1, 'pro')`, id)
+		if err != nil {
+			t.Fatalf("заполнение users: %v", err)
+		}
+		for _, table := range tables {
+			seedUserRow(t, b, table, id)
+		}
+	}
+
+	for _, id := range []int64{userID, otherID} {
+		_, err := b.db.Exec("INSERT INTO errors (signature, message, user_id, chat_id) VALUES (?, 'сбой', ?, ?)",
+			fmt.Sprintf("sig-%d", id), id, id)
+		if err != nil {
+			t.Fatalf("заполнение errors: %v", err)
+		}
+	}
+
+	b.activity.users[userID] = &userActivity{username: "alice", pending: 3}
+	b.pendingMemories.add(userID, "любит кофе")
+	b.session.append(userID, ChatMessage{Role: "user", Content: "привет"})
+	b.lastAnswers.set(userID, lastAnswer{ChatID: userID, MessageID: 10, At: time.Now()})
+	b.templateDialogs.start(userID, &PromptTemplate{ID: "t", Prompt: "Письмо для {кому}"})
+
+	if err := b.deleteUserData(userID); err != nil {
+		t.Fatalf("deleteUserData: %v", err)
+	}
+
+	for _, table := range tables {
+		if n := countUserRows(t, b, table, userID); n != 0 {
+			t.Errorf("%s: осталось %d строк пользователя", table, n)
+		}
+		if n := countUserRows(t, b, table, otherID); n != 1 {
+			t.Errorf("%s: у другого пользователя %d строк вместо 1", table, n)
+		}
+	}
+
+	// Журнал ошибок общий: строка остаётся, но без ссылки на пользователя
+	var errorsUser, errorsChat, errorsOther int64
+	err := b.db.QueryRow("SELECT user_id, chat_id FROM errors WHERE signature = 'sig-1'").Scan(&errorsUser, &errorsChat)
+	if err != nil {
+		t.Fatalf("чтение errors: %v", err)
+	}
+	if errorsUser != 0 || errorsChat != 0 {
+		t.Errorf("errors: остались user_id=%d chat_id=%d", errorsUser, errorsChat)
+	}
+	if err := b.db.QueryRow("SELECT user_id FROM errors WHERE signature = 'sig-2'").Scan(&errorsOther); err != nil || errorsOther != otherID {
+		t.Errorf("errors: у другого пользователя user_id=%d (ошибка %v)", errorsOther, err)
+	}
+
+	// Строка users остаётся, но только с колонками доступа
+	var username, style, tier string
+	var trialUsed int
+	var approved bool
+	err = b.db.QueryRow(`SELECT COALESCE(username, ''), COALESCE(style, ''), trial_used, approved, tier
+		FROM users WHERE user_id = ?`, userID).Scan(&username, &style, &trialUsed, &approved, &tier)
+	if err != nil {
+		t.Fatalf("чтение users: %v", err)
+	}
+	if username != "" || style == "short" {
+		t.Errorf("users не очищена: username=%q style=%q", username, style)
+	}
+	if trialUsed != 7 || !approved || tier != "pro" {
+		t.Errorf("доступ сброшен: trial_used=%d approved=%v tier=%q", trialUsed, approved, tier)
+	}
+
+	if _, ok := b.activity.users[userID]; ok {
+		t.Error("накопленная активность не удалена")
+	}
+	for _, pending := range b.pendingMemories.facts {
+		if pending.userID == userID {
+			t.Error("неподтверждённый факт не удалён")
+		}
+	}
+	if history := b.session.last(userID, 10); len(history) != 0 {
+		t.Errorf("история сессии не удалена: %v", history)
+	}
+	if _, ok := b.lastAnswers.get(userID, userID); ok {
+		t.Error("последний ответ не удалён")
+	}
+	if _, ok := b.templateDialogs.dialogs[userID]; ok {
+		t.Error("заполнение шаблона не удалено")
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"sync"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	defaultContextTurns = 10 // Сколько последних пар вопрос-ответ попадает в контекст по умолчанию
+	maxContextTurns     = 30 // Верхняя граница для /context
+
+	privacyNormal = "normal" // История хранится в SQLite
+	privacyStrict = "strict" // История только в памяти до перезапуска, в SQLite - ничего
+)
+
+// sessionHistory - история пользователей в строгом режиме приватности.
+// Для каждого пользователя хранится кольцо из последних сообщений; после перезапуска оно теряется.
+type sessionHistory struct {
+	mu       sync.Mutex
+	messages map[int64][]ChatMessage
+	limit    int
+}
+
+func newSessionHistory(limit int) *sessionHistory {
+	return &sessionHistory{messages: make(map[int64][]ChatMessage), limit: limit}
+}
+
+// append добавляет сообщения, вытесняя самые старые сверх лимита
+func (s *sessionHistory) append(userID int64, messages ...ChatMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	history := append(s.messages[userID], messages...)
+	if len(history) > s.limit {
+		history = append([]ChatMessage(nil), history[len(history)-s.limit:]...)
+	}
+	s.messages[userID] = history
+}
+
+// last возвращает последние n сообщений пользователя
+func (s *sessionHistory) last(userID int64, n int) []ChatMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	history := s.messages[userID]
+	if len(history) > n {
+		history = history[len(history)-n:]
+	}
+	return append([]ChatMessage(nil), history...)
+}
+
+// dropLast убирает последние n вопросов пользователя вместе со всем, что после них, и возвращает
+// убранные вопросы от новых к старым
+func (s *sessionHistory) dropLast(userID int64, n int) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	history := s.messages[userID]
+	var removed []string
+	cut := len(history)
+	for i := len(history) - 1; i >= 0 && len(removed) < n; i-- {
+		if history[i].Role == "user" {
+			removed = append(removed, history[i].Content)
+			cut = i
+		}
+	}
+	s.messages[userID] = history[:cut]
+	return removed
+}
+
+// dropAt убирает k-й с конца вопрос вместе с ответом на него; false - такого вопроса нет
+func (s *sessionHistory) dropAt(userID int64, k int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	history := s.messages[userID]
+	end := len(history)
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Role != "user" {
+			continue
+		}
+		if k--; k == 0 {
+			s.messages[userID] = append(history[:i:i], history[end:]...)
+			return true
+		}
+		end = i
+	}
+	return false
+}
+
+// replaceLastAnswer заменяет последний ответ пользователю новой версией
+func (s *sessionHistory) replaceLastAnswer(userID int64, content string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	history := s.messages[userID]
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Role == "assistant" {
+			history[i].Content = content
+			return
+		}
+	}
+}
+
+// clear забывает историю пользователя
+func (s *sessionHistory) clear(userID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.messages, userID)
+}
+
+// saveExchange сохраняет пару вопрос-ответ в активный разговор: в SQLite или, в строгом режиме, только в памяти
+func (b *Bot) saveExchange(userID int64, privacy, question string, answer *AIResponse) error {
+	if privacy == privacyStrict {
+		b.session.append(userID,
+			ChatMessage{Role: "user", Content: question},
+			ChatMessage{Role: "assistant", Content: answer.Content},
+		)
+		return nil
+	}
+
+	conversationID, err := b.activeConversation(userID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := b.db.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("INSERT INTO history (user_id, conversation_id, role, content) VALUES (?, ?, 'user', ?)",
+		userID, conversationID, question)
+	if err != nil {
+		return fmt.Errorf("ошибка при сохранении истории: %w", err)
+	}
+	_, err = tx.Exec("INSERT INTO history (user_id, conversation_id, role, content, model) VALUES (?, ?, 'assistant', ?, ?)",
+		userID, conversationID, answer.Content, answer.Model)
+	if err != nil {
+		return fmt.Errorf("ошибка при сохранении истории: %w", err)
+	}
+	return tx.Commit()
+}
+
+// loadHistory возвращает последние turns пар сообщений активного разговора в хронологическом порядке
+func (b *Bot) loadHistory(userID int64, privacy string, turns int) ([]ChatMessage, error) {
+	if turns <= 0 {
+		return nil, nil
+	}
+	if privacy == privacyStrict {
+		return b.session.last(userID, turns*2), nil
+	}
+
+	conversationID, err := b.activeConversation(userID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := b.stmts.historyTail.Query(userID, conversationID, turns*2)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении истории: %w", err)
+	}
+	defer rows.Close()
+
+	var history []ChatMessage
+	for rows.Next() {
+		var msg ChatMessage
+		if err := rows.Scan(&msg.Role, &msg.Content); err != nil {
+			return nil, fmt.Errorf("ошибка при чтении истории: %w", err)
+		}
+		history = append(history, msg)
+	}
+	return history, rows.Err()
+}
+
+// estimateTokens грубо оценивает число токенов: около четырёх символов на токен
+func estimateTokens(text string) int {
+	return utf8.RuneCountInString(text)/4 + 1
+}
+
+// clearStoredHistory удаляет историю пользователя из SQLite
+func (b *Bot) clearStoredHistory(userID int64) error {
+	_, err := b.db.Exec("DELETE FROM history WHERE user_id = ?", userID)
+	if err != nil {
+		return fmt.Errorf("ошибка при удалении истории: %w", err)
+	}
+	return nil
+}
+
+// setPrivacy обрабатывает команду /privacy strict|normal
+func (b *Bot) setPrivacy(message *tgbotapi.Message) error {
+	userID := senderID(message)
+	mode := message.CommandArguments()
+	if mode != privacyStrict && mode != privacyNormal {
+		return b.reply(message, "Использование: /privacy strict или /privacy normal\n\n"+
+			"strict - история разговора живёт только в памяти до перезапуска бота, на диск пишутся лишь обезличенные счётчики.\n"+
+			"normal - история хранится в базе, и я помню контекст даже после перезапуска.")
+	}
+
+	if err := b.setUserPrivacy(userID, mode); err != nil {
+		b.reply(message, "Не удалось сохранить настройку, попробуй позже.")
+		return fmt.Errorf("ошибка сохранения режима приватности: %w", err)
+	}
+
+	if mode == privacyStrict {
+		// Уже сохранённая история тоже не должна оставаться на диске
+		if err := b.clearStoredHistory(userID); err != nil {
+			return err
+		}
+		return b.reply(message, "🔒 Строгий режим приватности включён. Сохранённая история удалена; дальше контекст разговора "+
+			"живёт только в памяти и пропадёт при перезапуске бота.")
+	}
+
+	b.session.clear(userID)
+	return b.reply(message, "Обычный режим: история снова сохраняется в базе, и я буду помнить контекст после перезапуска. "+
+		"Контекст из строгого режима не переносится.")
+}
+
+// setContextTurns обрабатывает команду /context 0..30
+func (b *Bot) setContextTurns(message *tgbotapi.Message) error {
+	userID := senderID(message)
+	arg := message.CommandArguments()
+	if arg == "" {
+		turns, err := b.getUserContextTurns(userID)
+		if err != nil {
+			return err
+		}
+		return b.reply(message, fmt.Sprintf("Сейчас в контекст попадает последних пар сообщений: %d.\n"+
+			"Использование: /context 0..%d (0 - отвечать без учёта истории)", turns, maxContextTurns))
+	}
+
+	turns, err := strconv.Atoi(arg)
+	if err != nil || turns < 0 || turns > maxContextTurns {
+		return b.reply(message, fmt.Sprintf("Укажи число от 0 до %d, например: /context 5", maxContextTurns))
+	}
+
+	if err := b.setUserContextTurns(userID, turns); err != nil {
+		b.reply(message, "Не удалось сохранить настройку, попробуй позже.")
+		return fmt.Errorf("ошибка сохранения окна контекста: %w", err)
+	}
+
+	if turns == 0 {
+		return b.reply(message, "Теперь я отвечаю на каждое сообщение без учёта предыдущих.")
+	}
+	return b.reply(message, fmt.Sprintf("Теперь я учитываю последние %d пар сообщений. "+
+		"Если они слишком длинные, старые будут отброшены, чтобы уложиться в лимит токенов.", turns))
+}
+
+// setUserContextTurns сохраняет размер окна контекста пользователя
+func (b *Bot) setUserContextTurns(userID int64, turns int) error {
+	_, err := b.db.Exec("INSERT OR IGNORE INTO users (user_id) VALUES (?)", userID)
+	if err != nil {
+		return fmt.Errorf("ошибка при вставке пользователя: %w", err)
+	}
+	_, err = b.db.Exec("UPDATE users SET context_turns = ? WHERE user_id = ?", turns, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка при обновлении окна контекста: %w", err)
+	}
+	return nil
+}
+
+// getUserContextTurns возвращает размер окна контекста пользователя
+func (b *Bot) getUserContextTurns(userID int64) (int, error) {
+	var turns int
+	err := b.db.QueryRow("SELECT context_turns FROM users WHERE user_id = ?", userID).Scan(&turns)
+	if err == sql.ErrNoRows {
+		return defaultContextTurns, nil
+	}
+	if err != nil {
+		return defaultContextTurns, fmt.Errorf("ошибка при получении окна контекста: %w", err)
+	}
+	return turns, nil
+}
+
+// setUserPrivacy сохраняет режим приватности пользователя
+func (b *Bot) setUserPrivacy(userID int64, mode string) error {
+	_, err := b.db.Exec("INSERT OR IGNORE INTO users (user_id) VALUES (?)", userID)
+	if err != nil {
+		return fmt.Errorf("ошибка при вставке пользователя: %w", err)
+	}
+	_, err = b.db.Exec("UPDATE users SET privacy = ? WHERE user_id = ?", mode, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка при обновлении режима приватности: %w", err)
+	}
+	return nil
+}
+
+// getUserPrivacy возвращает режим приватности пользователя (по умолчанию обычный)
+func (b *Bot) getUserPrivacy(userID int64) (string, error) {
+	var mode string
+	err := b.db.QueryRow("SELECT privacy FROM users WHERE user_id = ?", userID).Scan(&mode)
+	if err == sql.ErrNoRows {
+		return privacyNormal, nil
+	}
+	if err != nil {
+		return privacyNormal, fmt.Errorf("ошибка при получении режима приватности: %w", err)
+	}
+	return mode, nil
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	historyPageSize     = 10  // Обменов на одной странице /history
+	historyPreviewRunes = 100 // До скольких символов сокращаются вопрос и ответ
+)
+
+// exchange - вопрос пользователя и ответ на него
+type exchange struct {
+	Question string
+	Answer   string
+}
+
+// pairExchanges собирает сообщения истории в обмены; ответ без вопроса пропускается
+func pairExchanges(messages []ChatMessage) []exchange {
+	var exchanges []exchange
+	for _, msg := range messages {
+		switch {
+		case msg.Role == "user":
+			exchanges = append(exchanges, exchange{Question: msg.Content})
+		case len(exchanges) > 0 && exchanges[len(exchanges)-1].Answer == "":
+			exchanges[len(exchanges)-1].Answer = msg.Content
+		}
+	}
+	return exchanges
+}
+
+// oneLine сокращает текст до одной строки из limit символов
+func oneLine(text string, limit int) string {
+	return truncateRunes(strings.Join(strings.Fields(text), " "), limit)
+}
+
+// renderHistory собирает страницу /history: обмены пронумерованы от старых к новым,
+// а кнопки ↩️ передают номер обмена с конца, как и /undo
+func renderHistory(exchanges []exchange, page int, systemPrompt string, strict bool) (string, *tgbotapi.InlineKeyboardMarkup) {
+	if len(exchanges) == 0 {
+		return "В текущем разговоре пока ничего нет - я отвечу на следующее сообщение с чистого листа.", nil
+	}
+	pages := (len(exchanges) + historyPageSize - 1) / historyPageSize
+	page = max(0, min(page, pages-1))
+	from := page * historyPageSize
+	to := min(from+historyPageSize, len(exchanges))
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "🧠 Что я сейчас помню (%d обменов", len(exchanges))
+	if pages > 1 {
+		fmt.Fprintf(&sb, ", стр. %d/%d", page+1, pages)
+	}
+	sb.WriteString(")")
+	if strict {
+		sb.WriteString("\n🔒 Строгий режим: история только в памяти до перезапуска")
+	}
+	if systemPrompt != "" {
+		fmt.Fprintf(&sb, "\n📌 Промпт разговора: %s", oneLine(systemPrompt, historyPreviewRunes))
+	}
+	for i := from; i < to; i++ {
+		e := exchanges[i]
+		fmt.Fprintf(&sb, "\n\n%d. 👤 %s", i+1, oneLine(e.Question, historyPreviewRunes))
+		if e.Answer != "" {
+			fmt.Fprintf(&sb, "\n🤖 %s", oneLine(e.Answer, historyPreviewRunes))
+		}
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	var row []tgbotapi.InlineKeyboardButton
+	for i := from; i < to; i++ {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("↩️ %d", i+1), fmt.Sprintf("hist_undo:%d:%d", len(exchanges)-i, page)))
+		if len(row) == 5 {
+			rows, row = append(rows, row), nil
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+	var nav []tgbotapi.InlineKeyboardButton
+	if page > 0 {
+		nav = append(nav, tgbotapi.NewInlineKeyboardButtonData("◀️", fmt.Sprintf("hist_page:%d", page-1)))
+	}
+	nav = append(nav, tgbotapi.NewInlineKeyboardButtonData("🧹 Сбросить всё", "hist_reset"))
+	if page < pages-1 {
+		nav = append(nav, tgbotapi.NewInlineKeyboardButtonData("▶️", fmt.Sprintf("hist_page:%d", page+1)))
+	}
+	rows = append(rows, nav)
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return sb.String(), &keyboard
+}
+
+// historyView загружает то, что попадёт в контекст следующего ответа, и рисует страницу
+func (b *Bot) historyView(userID int64, page int) (string, *tgbotapi.InlineKeyboardMarkup, error) {
+	settings, err := b.getUserSettings(userID)
+	if err != nil {
+		return "", nil, err
+	}
+	messages, err := b.loadHistory(userID, settings.Privacy, settings.ContextTurns)
+	if err != nil {
+		return "", nil, err
+	}
+	systemPrompt, err := b.activeSystemPrompt(userID)
+	if err != nil {
+		return "", nil, err
+	}
+	text, keyboard := renderHistory(pairExchanges(messages), page, systemPrompt, settings.Privacy == privacyStrict)
+	return text, keyboard, nil
+}
+
+// showHistory обрабатывает команду /history: последние обмены текущего разговора
+func (b *Bot) showHistory(message *tgbotapi.Message) error {
+	text, keyboard, err := b.historyView(senderID(message), 0)
+	if err != nil {
+		b.reply(message, "Не удалось загрузить историю, попробуй позже.")
+		return err
+	}
+	msg := tgbotapi.NewMessage(message.Chat.ID, text)
+	msg.ReplyToMessageID = message.MessageID
+	if keyboard != nil {
+		msg.ReplyMarkup = *keyboard
+	}
+	if _, err := b.api.Send(msg); err != nil {
+		return fmt.Errorf("ошибка отправки истории: %w", err)
+	}
+	return nil
+}
+
+// refreshHistory перерисовывает сообщение /history после нажатия кнопки
+func (b *Bot) refreshHistory(query *tgbotapi.CallbackQuery, page int) error {
+	text, keyboard, err := b.historyView(query.From.ID, page)
+	if err != nil {
+		return err
+	}
+	edit := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, text)
+	edit.ReplyMarkup = keyboard
+	if _, err := b.api.Send(edit); err != nil && !isNotModified(err) {
+		return fmt.Errorf("ошибка обновления истории: %w", err)
+	}
+	return nil
+}
+
+// isNotModified - Telegram отказался редактировать сообщение, потому что текст и кнопки не изменились
+func isNotModified(err error) bool {
+	return strings.Contains(err.Error(), "message is not modified")
+}
+
+// handleHistoryPage листает /history
+func (b *Bot) handleHistoryPage(query *tgbotapi.CallbackQuery, payload string) (string, error) {
+	page, err := strconv.Atoi(payload)
+	if err != nil || page < 0 {
+		return "Некорректная кнопка", nil
+	}
+	return "", b.refreshHistory(query, page)
+}
+
+// handleHistoryUndo убирает выбранный обмен; payload - "номер с конца:страница"
+func (b *Bot) handleHistoryUndo(query *tgbotapi.CallbackQuery, payload string) (string, error) {
+	kText, pageText, _ := strings.Cut(payload, ":")
+	k, err := strconv.Atoi(kText)
+	page, pageErr := strconv.Atoi(pageText)
+	if err != nil || pageErr != nil || k < 1 {
+		return "Некорректная кнопка", nil
+	}
+
+	privacy, err := b.getUserPrivacy(query.From.ID)
+	if err != nil {
+		return "", err
+	}
+	removed, err := b.undoExchangeAt(query.From.ID, privacy, k)
+	if err != nil {
+		return "", err
+	}
+	if err := b.refreshHistory(query, page); err != nil {
+		return "", err
+	}
+	if !removed {
+		return "Этого обмена уже нет", nil
+	}
+	return "Забыл", nil
+}
+
+// handleHistoryReset очищает текущий разговор, как /reset
+func (b *Bot) handleHistoryReset(query *tgbotapi.CallbackQuery, _ string) (string, error) {
+	if err := b.clearActiveConversation(query.From.ID); err != nil {
+		return "", err
+	}
+	if err := b.refreshHistory(query, 0); err != nil {
+		return "", err
+	}
+	return "История текущего разговора очищена", nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	maxImportMessages = 200     // Сколько последних сообщений из файла попадёт в историю
+	maxImportFileSize = 5 << 20 // Выгрузки больше этого явно не из нашего бота
+)
+
+// importHistory обрабатывает документ с подписью /import: загружает историю из JSON-выгрузки
+func (b *Bot) importHistory(message *tgbotapi.Message) error {
+	if message.Document == nil {
+		return b.reply(message, "Пришли JSON-файл, полученный через /export json, с подписью /import.")
+	}
+	userID := senderID(message)
+
+	privacy, err := b.getUserPrivacy(userID)
+	if err != nil {
+		return err
+	}
+	if privacy == privacyStrict {
+		return b.reply(message, "🔒 В строгом режиме приватности история не сохраняется. Переключись на /privacy normal, чтобы импортировать.")
+	}
+
+	data, err := b.downloadFile(message.Document.FileID, maxImportFileSize)
+	if err != nil {
+		b.reply(message, "Не удалось скачать файл: "+err.Error())
+		return err
+	}
+
+	records, err := parseHistoryExport(data)
+	if err != nil {
+		return b.reply(message, "❌ Файл не похож на выгрузку истории: "+err.Error())
+	}
+
+	skipped := 0
+	if len(records) > maxImportMessages {
+		skipped = len(records) - maxImportMessages
+		records = records[skipped:]
+	}
+
+	if err := b.insertImportedHistory(userID, records); err != nil {
+		b.reply(message, "Не удалось сохранить историю, попробуй позже.")
+		return err
+	}
+
+	text := fmt.Sprintf("✅ Импортировано сообщений: %d.", len(records))
+	if skipped > 0 {
+		text += fmt.Sprintf(" Самые старые (%d) пропущены: больше %d за раз не загружается.", skipped, maxImportMessages)
+	}
+	return b.reply(message, text)
+}
+
+// parseHistoryExport разбирает JSON-выгрузку истории и проверяет каждую запись.
+// Ошибка указывает на первую неверную запись.
+func parseHistoryExport(data []byte) ([]HistoryRecord, error) {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("ожидается JSON-массив записей (%v)", err)
+	}
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("в файле нет ни одной записи")
+	}
+
+	records := make([]HistoryRecord, 0, len(raw))
+	for i, item := range raw {
+		var record HistoryRecord
+		decoder := json.NewDecoder(bytes.NewReader(item))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&record); err != nil {
+			return nil, fmt.Errorf("запись №%d: %v", i+1, err)
+		}
+		switch {
+		case record.Role != "user" && record.Role != "assistant":
+			return nil, fmt.Errorf("запись №%d: role должен быть user или assistant, а не %q", i+1, record.Role)
+		case strings.TrimSpace(record.Content) == "":
+			return nil, fmt.Errorf("запись №%d: пустой content", i+1)
+		case record.CreatedAt.IsZero():
+			return nil, fmt.Errorf("запись №%d: нет времени ts", i+1)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// insertImportedHistory добавляет записи в активный разговор пользователя с пометкой imported
+func (b *Bot) insertImportedHistory(userID int64, records []HistoryRecord) error {
+	conversationID, err := b.activeConversation(userID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := b.db.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, record := range records {
+		_, err := tx.Exec("INSERT INTO history (user_id, conversation_id, role, content, model, created_at, imported) VALUES (?, ?, ?, ?, ?, ?, 1)",
+			userID, conversationID, record.Role, record.Content, record.Model, record.CreatedAt.UTC())
+		if err != nil {
+			return fmt.Errorf("ошибка при импорте истории: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// captionCommand возвращает команду из подписи к файлу ("/import" -> "import") или пустую строку
+func captionCommand(message *tgbotapi.Message) string {
+	for _, entity := range message.CaptionEntities {
+		if entity.Type != "bot_command" || entity.Offset != 0 {
+			continue
+		}
+		caption := []rune(message.Caption)
+		if entity.Length > len(caption) {
+			continue
+		}
+		command := string(caption[1:entity.Length]) // Смещения в UTF-16, но команда - ASCII
+		if i := strings.Index(command, "@"); i >= 0 {
+			command = command[:i]
+		}
+		return command
+	}
+	return ""
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	maxGeneratedCodes = 50 // Сколько кодов можно выпустить одной командой /gencode
+
+	inviteRequiredText = "🔑 Я работаю по приглашениям. Пришли код приглашения сообщением " +
+		"или открой ссылку, которую тебе дали."
+	trialExhaustedText = "🔑 Пробные сообщения закончились. Чтобы продолжить, пришли код приглашения сообщением " +
+		"или открой ссылку с кодом, подключи платный тариф или напиши администратору."
+)
+
+// inviteCodePattern - так выглядит код приглашения (base32 без паддинга)
+var inviteCodePattern = regexp.MustCompile(`^[A-Z2-7]{8}$`)
+
+// errInviteInvalid - кода нет, он истёк или все его использования исчерпаны
+var errInviteInvalid = errors.New("код приглашения недействителен")
+
+// InviteCode - строка таблицы invite_codes
+type InviteCode struct {
+	Code      string
+	MaxUses   int
+	Uses      int
+	ExpiresAt sql.NullTime
+	CreatedAt time.Time
+}
+
+// inviteMiddleware при INVITE_ONLY=true пропускает к боту только одобренных пользователей.
+// Неодобренные проходят, пока у них остались пробные сообщения (списывает их checkTrial - только
+// за настоящие запросы к модели), затем бот просит прислать код (текстом или через /start <код>)
+// и погашает его. Администраторы и пользователи с платным тарифом проходят без кода.
+func (b *Bot) inviteMiddleware(next UpdateHandler) UpdateHandler {
+	return func(ctx context.Context, update tgbotapi.Update) error {
+		message := update.Message
+		if !b.cfg().InviteOnly || message == nil || message.From == nil || message.SenderChat != nil {
+			return next(ctx, update)
+		}
+		userID := message.From.ID
+		if b.isAdmin(userID) {
+			return next(ctx, update)
+		}
+		approved, err := b.isApproved(userID)
+		if err != nil {
+			return err
+		}
+		if approved {
+			return next(ctx, update)
+		}
+
+		// В группах не просим код публично: сообщения неодобренных пользователей просто не обрабатываются
+		if !message.Chat.IsPrivate() {
+			updateInfoFrom(ctx).Handler = "invite"
+			return nil
+		}
+
+		code, isCode := inviteCodeFrom(message)
+		if !isCode {
+			left, err := b.hasTrial(userID)
+			if err != nil {
+				return err
+			}
+			if left {
+				return next(ctx, update)
+			}
+		}
+
+		updateInfoFrom(ctx).Handler = "invite"
+		if !isCode {
+			if b.cfg().TrialMessages > 0 {
+				return b.reply(message, trialExhaustedText)
+			}
+			return b.reply(message, inviteRequiredText)
+		}
+		return b.redeemInviteMessage(message, code)
+	}
+}
+
+// inviteCodeFrom достаёт код приглашения из /start <код> или из текста сообщения.
+// Регистр исправляется только в ссылке /start: обычный текст считается кодом, лишь если уже
+// набран заглавными, иначе любое слово из восьми латинских букв ("whatever") сошло бы за попытку кода.
+func inviteCodeFrom(message *tgbotapi.Message) (string, bool) {
+	code := strings.TrimSpace(message.Text)
+	if message.IsCommand() {
+		if message.Command() != "start" {
+			return "", false
+		}
+		code = strings.ToUpper(strings.TrimSpace(message.CommandArguments()))
+	}
+	return code, inviteCodePattern.MatchString(code)
+}
+
+// checkTrial пропускает запрос к модели от пользователя без приглашения, списывая одно пробное сообщение.
+// Вызывается из checkLimits, поэтому пробный период тратят только настоящие запросы к модели,
+// откуда бы они ни пришли: сообщение, кнопка "Повторить", шаблон. Команды его не тратят.
+func (b *Bot) checkTrial(userID int64) error {
+	if !b.cfg().InviteOnly || b.isAdmin(userID) {
+		return nil
+	}
+	approved, err := b.isApproved(userID)
+	if err != nil || approved {
+		return err
+	}
+	allowed, err := b.consumeTrial(userID)
+	if err != nil || allowed {
+		return err
+	}
+	if b.cfg().TrialMessages > 0 {
+		return &limitError{trialExhaustedText}
+	}
+	return &limitError{inviteRequiredText}
+}
+
+// hasTrial сообщает, остались ли у пользователя пробные сообщения, ничего не списывая
+func (b *Bot) hasTrial(userID int64) (bool, error) {
+	if b.cfg().TrialMessages == 0 {
+		return false, nil
+	}
+	var used int
+	err := b.db.QueryRow("SELECT COALESCE(trial_used, 0) FROM users WHERE user_id = ?", userID).Scan(&used)
+	if err != nil && err != sql.ErrNoRows {
+		return false, fmt.Errorf("ошибка проверки пробного периода: %w", err)
+	}
+	return used < b.cfg().TrialMessages, nil
+}
+
+// consumeTrial списывает одно пробное сообщение; false - пробные сообщения закончились
+func (b *Bot) consumeTrial(userID int64) (bool, error) {
+	if b.cfg().TrialMessages == 0 {
+		return false, nil
+	}
+	_, err := b.db.Exec("INSERT OR IGNORE INTO users (user_id) VALUES (?)", userID)
+	if err != nil {
+		return false, fmt.Errorf("ошибка при вставке пользователя: %w", err)
+	}
+	res, err := b.db.Exec("UPDATE users SET trial_used = COALESCE(trial_used, 0) + 1 WHERE user_id = ? AND COALESCE(trial_used, 0) < ?",
+		userID, b.cfg().TrialMessages)
+	if err != nil {
+		return false, fmt.Errorf("ошибка списания пробного сообщения: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n == 1, nil
+}
+
+// setUserTrialUsed задаёт число потраченных пробных сообщений (для /setuser, 0 - начать пробный период заново)
+func (b *Bot) setUserTrialUsed(userID int64, used int) error {
+	_, err := b.db.Exec("INSERT OR IGNORE INTO users (user_id) VALUES (?)", userID)
+	if err != nil {
+		return fmt.Errorf("ошибка при вставке пользователя: %w", err)
+	}
+	_, err = b.db.Exec("UPDATE users SET trial_used = ? WHERE user_id = ?", used, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка при обновлении пробного периода: %w", err)
+	}
+	return nil
+}
+
+// redeemInviteMessage погашает код из сообщения и сообщает пользователю результат
+func (b *Bot) redeemInviteMessage(message *tgbotapi.Message, code string) error {
+	err := b.redeemInvite(message.From.ID, code)
+	if err == errInviteInvalid {
+		return b.reply(message, "Этот код недействителен: он истёк или уже использован. Попроси новый у того, кто тебя пригласил.")
+	}
+	if err != nil {
+		b.reply(message, "Не удалось проверить код, попробуй позже.")
+		return err
+	}
+	if err := b.reply(message, "✅ Код принят, добро пожаловать!"); err != nil {
+		return err
+	}
+	return b.sendWelcome(message)
+}
+
+// isApproved сообщает, есть ли у пользователя доступ к боту по приглашению или тарифу
+func (b *Bot) isApproved(userID int64) (bool, error) {
+	var approved bool
+	err := b.db.QueryRow("SELECT COALESCE(approved, 0) OR COALESCE(tier, 'free') != 'free' FROM users WHERE user_id = ?", userID).
+		Scan(&approved)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("ошибка проверки доступа пользователя: %w", err)
+	}
+	return approved, nil
+}
+
+// redeemInvite погашает одно использование кода и одобряет пользователя.
+// Проверка и списание идут в одной транзакции, чтобы код на одно использование не сработал дважды.
+func (b *Bot) redeemInvite(userID int64, code string) error {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		UPDATE invite_codes SET uses = uses + 1
+		WHERE code = ? AND uses < max_uses AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)`, code)
+	if err != nil {
+		return fmt.Errorf("ошибка погашения кода приглашения: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errInviteInvalid
+	}
+
+	if _, err := tx.Exec("INSERT OR IGNORE INTO users (user_id) VALUES (?)", userID); err != nil {
+		return fmt.Errorf("ошибка при вставке пользователя: %w", err)
+	}
+	if _, err := tx.Exec("UPDATE users SET approved = 1, invite_code = ? WHERE user_id = ?", code, userID); err != nil {
+		return fmt.Errorf("ошибка одобрения пользователя: %w", err)
+	}
+	return tx.Commit()
+}
+
+// setUserApproved выдаёт или отзывает доступ пользователя (для /setuser)
+func (b *Bot) setUserApproved(userID int64, approved bool) error {
+	_, err := b.db.Exec("INSERT OR IGNORE INTO users (user_id) VALUES (?)", userID)
+	if err != nil {
+		return fmt.Errorf("ошибка при вставке пользователя: %w", err)
+	}
+	_, err = b.db.Exec("UPDATE users SET approved = ? WHERE user_id = ?", approved, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка при обновлении доступа пользователя: %w", err)
+	}
+	return nil
+}
+
+// newInviteCode генерирует код из 8 символов base32 (например, K3QF7ZXA)
+func newInviteCode() string {
+	buf := make([]byte, 5)
+	rand.Read(buf)
+	return base32.StdEncoding.EncodeToString(buf)
+}
+
+// parseGenCodeArgs разбирает аргументы /gencode: количество и необязательные uses=N, days=N
+func parseGenCodeArgs(args string) (count, uses, days int, err error) {
+	count, uses = 1, 1
+	for i, arg := range strings.Fields(args) {
+		key, value, hasKey := strings.Cut(arg, "=")
+		if !hasKey {
+			if i > 0 {
+				return 0, 0, 0, fmt.Errorf("количество указывается первым")
+			}
+			value, key = arg, "count"
+		}
+		n, convErr := strconv.Atoi(value)
+		if convErr != nil || n < 1 {
+			return 0, 0, 0, fmt.Errorf("%s: ожидается положительное число, получено %q", key, value)
+		}
+		switch key {
+		case "count":
+			count = n
+		case "uses":
+			uses = n
+		case "days":
+			days = n
+		default:
+			return 0, 0, 0, fmt.Errorf("неизвестный параметр %q", key)
+		}
+	}
+	if count > maxGeneratedCodes {
+		return 0, 0, 0, fmt.Errorf("за раз можно выпустить не больше %d кодов", maxGeneratedCodes)
+	}
+	return count, uses, days, nil
+}
+
+// genCode обрабатывает команду /gencode [N] [uses=N] [days=N] (только для администраторов)
+func (b *Bot) genCode(message *tgbotapi.Message) error {
+	count, uses, days, err := parseGenCodeArgs(message.CommandArguments())
+	if err != nil {
+		return b.reply(message, fmt.Sprintf("%v\n\nИспользование: /gencode 5 uses=1 days=7 "+
+			"(количество кодов, сколько раз можно использовать каждый, через сколько дней истекает; по умолчанию - один код на одно использование без срока)", err))
+	}
+
+	var expiresAt any // NULL - без срока
+	if days > 0 {
+		expiresAt = time.Now().UTC().AddDate(0, 0, days).Format(time.DateTime)
+	}
+
+	codes := make([]string, 0, count)
+	for len(codes) < count {
+		code := newInviteCode()
+		res, err := b.db.Exec(`INSERT OR IGNORE INTO invite_codes (code, max_uses, expires_at, created_by) VALUES (?, ?, ?, ?)`,
+			code, uses, expiresAt, senderID(message))
+		if err != nil {
+			return fmt.Errorf("ошибка сохранения кода приглашения: %w", err)
+		}
+		// Совпадение с существующим кодом маловероятно, но тогда просто генерируем другой
+		if n, _ := res.RowsAffected(); n == 1 {
+			codes = append(codes, code)
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "🎟 Новые коды (%s):\n\n", describeInviteLimits(uses, days))
+	for _, code := range codes {
+		fmt.Fprintf(&sb, "%s  https://t.me/%s?start=%s\n", code, b.name, code)
+	}
+	return b.reply(message, sb.String())
+}
+
+// describeInviteLimits описывает ограничения выпущенных кодов
+func describeInviteLimits(uses, days int) string {
+	text := fmt.Sprintf("использований: %d", uses)
+	if days > 0 {
+		return text + fmt.Sprintf(", действуют %d дн.", days)
+	}
+	return text + ", без срока"
+}
+
+// listInviteCodes возвращает коды, которые ещё можно использовать, новые - первыми
+func (b *Bot) listInviteCodes() ([]InviteCode, error) {
+	rows, err := b.db.Query(`
+		SELECT code, max_uses, uses, expires_at, created_at FROM invite_codes
+		WHERE uses < max_uses AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)
+		ORDER BY created_at DESC LIMIT 50`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения кодов приглашения: %w", err)
+	}
+	defer rows.Close()
+
+	var codes []InviteCode
+	for rows.Next() {
+		var c InviteCode
+		if err := rows.Scan(&c.Code, &c.MaxUses, &c.Uses, &c.ExpiresAt, &c.CreatedAt); err != nil {
+			return nil, fmt.Errorf("ошибка чтения кодов приглашения: %w", err)
+		}
+		codes = append(codes, c)
+	}
+	return codes, rows.Err()
+}
+
+// codes обрабатывает команду /codes: список действующих кодов (только для администраторов)
+func (b *Bot) codes(message *tgbotapi.Message) error {
+	codes, err := b.listInviteCodes()
+	if err != nil {
+		b.reply(message, "❌ "+err.Error())
+		return err
+	}
+	if len(codes) == 0 {
+		return b.reply(message, "Действующих кодов нет. Выпустить новые: /gencode 5")
+	}
+
+	var sb strings.Builder
+	sb.WriteString("🎟 Действующие коды:\n\n")
+	for _, c := range codes {
+		fmt.Fprintf(&sb, "%s  %d/%d", c.Code, c.Uses, c.MaxUses)
+		if c.ExpiresAt.Valid {
+			fmt.Fprintf(&sb, ", до %s", c.ExpiresAt.Time.Local().Format("02.01.2006 15:04"))
+		}
+		sb.WriteString("\n")
+	}
+	return b.reply(message, sb.String())
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// newInviteOnlyBot - бот с INVITE_ONLY=true и двумя пробными сообщениями
+func newInviteOnlyBot(t *testing.T) (*Bot, *fakeTelegram) {
+	t.Helper()
+	b, fake := newTestBot(t)
+	config := *b.cfg()
+	config.InviteOnly, config.TrialMessages = true, 2
+	b.config.Store(&config)
+	return b, fake
+}
+
+// trialUsed возвращает число потраченных пробных сообщений
+func trialUsed(t *testing.T, b *Bot, userID int64) int {
+	t.Helper()
+	var used int
+	err := b.db.QueryRow("SELECT COALESCE((SELECT trial_used FROM users WHERE user_id = ?), 0)", userID).Scan(&used)
+	if err != nil {
+		t.Fatalf("чтение trial_used: %v", err)
+	}
+	return used
+}
+
+func TestTrialSpentOnlyByModelRequests(t *testing.T) {
+	b, _ := newInviteOnlyBot(t)
+	const userID = 1
+	passed := 0
+	handler := b.inviteMiddleware(func(context.Context, tgbotapi.Update) error {
+		passed++
+		return nil
+	})
+	send := func(text string) {
+		t.Helper()
+		update := tgbotapi.Update{Message: commandMessage(userID, text)}
+		if text[0] != '/' {
+			update = textUpdate(1, userID, text)
+		}
+		if err := handler(withUpdateInfo(context.Background(), newUpdateInfo(update)), update); err != nil {
+			t.Fatalf("inviteMiddleware(%q): %v", text, err)
+		}
+	}
+
+	// Команды проходят, но пробный период не тратят
+	for _, command := range []string{"/start", "/help", "/style"} {
+		send(command)
+	}
+	if passed != 3 || trialUsed(t, b, userID) != 0 {
+		t.Fatalf("после команд: пропущено %d, потрачено %d пробных", passed, trialUsed(t, b, userID))
+	}
+
+	// Тратит только запрос к модели, с какого бы входа он ни пришёл
+	in := chatInput{UserID: userID, ChatID: userID, Prompt: "вопрос"}
+	for i := 0; i < 2; i++ {
+		if err := b.checkLimits(in, &chatTurn{}); err != nil {
+			t.Fatalf("запрос %d: %v", i+1, err)
+		}
+	}
+	var limitErr *limitError
+	if err := b.checkLimits(in, &chatTurn{}); !errors.As(err, &limitErr) || limitErr.text != trialExhaustedText {
+		t.Fatalf("третий запрос: ошибка %v, ожидался отказ по пробному периоду", err)
+	}
+	if used := trialUsed(t, b, userID); used != 2 {
+		t.Errorf("потрачено %d пробных, ожидалось 2", used)
+	}
+
+	// Когда пробный период исчерпан, обычные сообщения до обработчиков не доходят
+	send("ещё вопрос")
+	if passed != 3 {
+		t.Error("сообщение пропущено после конца пробного периода")
+	}
+}
+
+func TestTrialNotSpentByApprovedUsers(t *testing.T) {
+	b, _ := newInviteOnlyBot(t)
+	if err := b.setUserApproved(1, true); err != nil {
+		t.Fatalf("setUserApproved: %v", err)
+	}
+	config := *b.cfg()
+	config.AdminIDs = []int64{2}
+	b.config.Store(&config)
+
+	for _, userID := range []int64{1, 2} {
+		for i := 0; i < 3; i++ {
+			if err := b.checkLimits(chatInput{UserID: userID}, &chatTurn{}); err != nil {
+				t.Fatalf("пользователь %d: %v", userID, err)
+			}
+		}
+		if used := trialUsed(t, b, userID); used != 0 {
+			t.Errorf("пользователь %d: потрачено %d пробных", userID, used)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const jsonModePrompt = "Ты генератор JSON. Отвечай строго одним валидным JSON-объектом: без пояснений, " +
+	"без Markdown и без текста до или после JSON."
+
+// ResponseFormat - поле response_format запроса (структурированный вывод)
+type ResponseFormat struct {
+	Type string `json:"type"`
+}
+
+// apiError - ответ API с кодом ошибки
+type apiError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("API вернул ошибку %d: %s", e.StatusCode, e.Body)
+}
+
+// rejectsResponseFormat проверяет, что провайдер отверг сам запрос (например, не знает response_format)
+func rejectsResponseFormat(err error) bool {
+	var apiErr *apiError
+	return errors.As(err, &apiErr) &&
+		(apiErr.StatusCode == http.StatusBadRequest || apiErr.StatusCode == http.StatusUnprocessableEntity)
+}
+
+// requestJSON просит модель вернуть JSON. Сначала с response_format=json_object, а если провайдер
+// его не поддерживает - только с системной инструкцией. Невалидный ответ переспрашивается один раз.
+func (b *Bot) requestJSON(prompt string) (string, error) {
+	reqBody := OpenAIRequest{
+		Model: MODEL,
+		Messages: []ChatMessage{
+			{Role: "system", Content: jsonModePrompt},
+			{Role: "user", Content: prompt},
+		},
+		MaxTokens:      1024,
+		ResponseFormat: &ResponseFormat{Type: "json_object"},
+	}
+
+	resp, err := b.doChatRequest(context.Background(), reqBody)
+	if err != nil && rejectsResponseFormat(err) {
+		reqBody.ResponseFormat = nil
+		resp, err = b.doChatRequest(context.Background(), reqBody)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	content := stripCodeFence(resp.Content)
+	if json.Valid([]byte(content)) {
+		return content, nil
+	}
+
+	// Один повтор: показываем модели её ответ и просим исправить
+	reqBody.Messages = append(reqBody.Messages,
+		ChatMessage{Role: "assistant", Content: resp.Content},
+		ChatMessage{Role: "system", Content: "Предыдущий ответ не является валидным JSON. " +
+			"Верни тот же ответ исправленным: только JSON, без пояснений."},
+	)
+	resp, err = b.doChatRequest(context.Background(), reqBody)
+	if err != nil {
+		return "", err
+	}
+	content = stripCodeFence(resp.Content)
+	if !json.Valid([]byte(content)) {
+		return "", fmt.Errorf("модель дважды вернула невалидный JSON")
+	}
+	return content, nil
+}
+
+// stripCodeFence убирает обрамление ```json ... ```, которое модели добавляют по привычке
+func stripCodeFence(text string) string {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "```") {
+		return text
+	}
+	text = strings.TrimPrefix(text, "```")
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		text = text[i+1:] // Пропускаем язык после ```
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(text), "```"))
+}
+
+// jsonMode обрабатывает команду /json <запрос>
+func (b *Bot) jsonMode(message *tgbotapi.Message) error {
+	prompt := strings.TrimSpace(message.CommandArguments())
+	if prompt == "" {
+		return b.reply(message, "Использование: /json <что сгенерировать>, например: /json три города России с населением")
+	}
+
+	content, err := b.requestJSON(prompt)
+	if err != nil {
+		b.reply(message, "❌ Не удалось получить JSON: "+err.Error())
+		return fmt.Errorf("ошибка режима JSON: %w", err)
+	}
+
+	var pretty bytes.Buffer
+	if err := json.Indent(&pretty, []byte(content), "", "  "); err == nil {
+		content = pretty.String()
+	}
+
+	block := "```json\n" + content + "\n```"
+	if len([]rune(block)) > messageTextLimit {
+		doc := tgbotapi.NewDocument(message.Chat.ID, tgbotapi.FileBytes{
+			Name:  fmt.Sprintf("answer-%d.json", time.Now().Unix()),
+			Bytes: []byte(content),
+		})
+		doc.ReplyToMessageID = message.MessageID
+		if _, err := b.api.Send(doc); err != nil {
+			return fmt.Errorf("ошибка отправки JSON: %w", err)
+		}
+		return nil
+	}
+
+	_, err = b.sendFormatted(block, func(text, parseMode string) tgbotapi.Chattable {
+		msg := tgbotapi.NewMessage(message.Chat.ID, text)
+		msg.ReplyToMessageID = message.MessageID
+		msg.ParseMode = parseMode
+		return msg
+	})
+	if err != nil {
+		return fmt.Errorf("ошибка отправки JSON: %w", err)
+	}
+	return nil
+}
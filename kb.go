@@ -0,0 +1,371 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	kbChunkRunes    = 3200             // ~800 токенов на фрагмент
+	kbOverlapRunes  = 400              // Перекрытие соседних фрагментов, чтобы мысль на границе не терялась
+	kbMaxChunks     = 200              // Сколько фрагментов может хранить один пользователь
+	kbMaxFileSize   = 1 << 20          // Текстовые файлы больше мегабайта - скорее всего не заметки
+	kbTopK          = 4                // Сколько фрагментов попадает в промпт
+	kbMinSimilarity = 0.25             // Менее похожие фрагменты не подставляются вовсе
+	kbUploadTTL     = 10 * time.Minute // Сколько после /kb add ждём файлы
+)
+
+// kbTextExtensions - файлы, которые можно добавить в базу знаний как текст
+var kbTextExtensions = map[string]bool{".txt": true, ".md": true, ".markdown": true, ".csv": true, ".json": true, ".log": true}
+
+// kbUploads - пользователи, которые после /kb add присылают файлы
+type kbUploads struct {
+	mu      sync.Mutex
+	waiting map[int64]time.Time // Пользователь -> до какого момента ждём файлы
+}
+
+func newKBUploads() *kbUploads {
+	return &kbUploads{waiting: make(map[int64]time.Time)}
+}
+
+// start начинает ожидание файлов от пользователя
+func (u *kbUploads) start(userID int64) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.waiting[userID] = time.Now().Add(kbUploadTTL)
+}
+
+// active проверяет, ждём ли файлы от пользователя, и продлевает ожидание после каждого файла
+func (u *kbUploads) active(userID int64) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	deadline, ok := u.waiting[userID]
+	if !ok || time.Now().After(deadline) {
+		delete(u.waiting, userID)
+		return false
+	}
+	u.waiting[userID] = time.Now().Add(kbUploadTTL)
+	return true
+}
+
+// stop перестаёт ждать файлы от пользователя
+func (u *kbUploads) stop(userID int64) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	delete(u.waiting, userID)
+}
+
+// kbChunk - фрагмент документа из базы знаний
+type kbChunk struct {
+	Source  string
+	Index   int
+	Content string
+	Score   float64
+}
+
+// chunkText режет текст на фрагменты по size символов с перекрытием overlap.
+// Граница фрагмента сдвигается назад к ближайшему переносу строки или пробелу.
+func chunkText(text string, size, overlap int) []string {
+	runes := []rune(strings.TrimSpace(text))
+	var chunks []string
+	for start := 0; start < len(runes); {
+		end := min(start+size, len(runes))
+		if end < len(runes) {
+			end = cutBefore(runes, start+size/2, end)
+		}
+		if chunk := strings.TrimSpace(string(runes[start:end])); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		if end == len(runes) {
+			break
+		}
+		next := end - overlap
+		for next > start && next < end && !unicode.IsSpace(runes[next]) {
+			next++
+		}
+		if next <= start {
+			next = end
+		}
+		start = next
+	}
+	return chunks
+}
+
+// cutBefore ищет в runes[from:to] последний перенос строки, а если его нет - последний пробел
+func cutBefore(runes []rune, from, to int) int {
+	for _, isCut := range []func(rune) bool{func(r rune) bool { return r == '\n' }, unicode.IsSpace} {
+		for cut := to; cut > from; cut-- {
+			if isCut(runes[cut]) {
+				return cut
+			}
+		}
+	}
+	return to
+}
+
+// kb обрабатывает команду /kb: add, list, clear, auto on|off или вопрос к своей базе знаний
+func (b *Bot) kb(message *tgbotapi.Message) error {
+	if !b.embeddingsEnabled() {
+		return b.reply(message, "База знаний не настроена: администратору нужно задать EMBEDDINGS_URL.")
+	}
+	userID := senderID(message)
+	args := strings.TrimSpace(message.CommandArguments())
+	if args == "" {
+		args = strings.TrimSpace(strings.TrimPrefix(message.Caption, "/kb")) // Файл с подписью "/kb add"
+	}
+	sub, rest, _ := strings.Cut(args, " ")
+
+	switch strings.ToLower(sub) {
+	case "":
+		return b.reply(message, "📚 База знаний из твоих документов:\n"+
+			"/kb add - добавить текстовые файлы (.txt, .md)\n"+
+			"/kb <вопрос> - ответить с опорой на документы\n"+
+			"/kb auto on|off - искать в документах при каждом вопросе\n"+
+			"/kb list - что уже загружено\n"+
+			"/kb clear - удалить всё")
+	case "add":
+		if message.Document != nil {
+			return b.kbAddDocument(context.Background(), message)
+		}
+		b.kbUploads.start(userID)
+		return b.reply(message, fmt.Sprintf("📥 Присылай текстовые файлы (.txt, .md) - жду %d минут после последнего. "+
+			"Файл с тем же именем заменит прежний.", int(kbUploadTTL.Minutes())))
+	case "list":
+		return b.kbList(message)
+	case "clear":
+		if _, err := b.db.Exec("DELETE FROM kb_chunks WHERE user_id = ?", userID); err != nil {
+			b.reply(message, "Не удалось очистить базу знаний, попробуй позже.")
+			return fmt.Errorf("ошибка очистки базы знаний: %w", err)
+		}
+		return b.reply(message, "🗑 База знаний очищена.")
+	case "auto":
+		auto, ok := parseToggle(rest)
+		if !ok {
+			return b.reply(message, "Использование: /kb auto on или /kb auto off")
+		}
+		if err := b.setUserKBAuto(userID, auto); err != nil {
+			b.reply(message, "Не удалось сохранить настройку, попробуй позже.")
+			return err
+		}
+		if auto {
+			return b.reply(message, "📚 Теперь при каждом вопросе ищу подходящие фрагменты в твоих документах.")
+		}
+		return b.reply(message, "Документы подключаются только через /kb <вопрос>.")
+	}
+
+	in := chatInputFrom(message, args)
+	in.UseKnowledge = true
+	return b.answerPrompt(context.Background(), in, message.MessageID)
+}
+
+// kbAddDocument разбивает присланный текстовый файл на фрагменты и сохраняет их с векторами
+func (b *Bot) kbAddDocument(ctx context.Context, message *tgbotapi.Message) error {
+	userID := senderID(message)
+	doc := message.Document
+	name := doc.FileName
+	if name == "" {
+		name = "документ"
+	}
+	if !kbTextExtensions[strings.ToLower(filepath.Ext(name))] && !strings.HasPrefix(doc.MimeType, "text/") {
+		return b.reply(message, "Пока понимаю только текстовые файлы: .txt, .md, .csv, .json.")
+	}
+	if doc.FileSize > kbMaxFileSize {
+		return b.reply(message, fmt.Sprintf("Файл больше %d КБ - раздели его на части.", kbMaxFileSize>>10))
+	}
+
+	data, err := b.downloadFile(doc.FileID, kbMaxFileSize)
+	if err != nil {
+		b.reply(message, "Не удалось скачать файл: "+err.Error())
+		return err
+	}
+	if !utf8.Valid(data) {
+		return b.reply(message, "Файл не в UTF-8 - пересохрани его в этой кодировке.")
+	}
+	chunks := chunkText(string(data), kbChunkRunes, kbOverlapRunes)
+	if len(chunks) == 0 {
+		return b.reply(message, "В файле нет текста.")
+	}
+
+	var stored int
+	err = b.db.QueryRow("SELECT COUNT(*) FROM kb_chunks WHERE user_id = ? AND source != ?", userID, name).Scan(&stored)
+	if err != nil {
+		return fmt.Errorf("ошибка подсчёта фрагментов базы знаний: %w", err)
+	}
+	if stored+len(chunks) > kbMaxChunks {
+		return b.reply(message, fmt.Sprintf("В базе уже %d фрагментов из %d, а этот файл даст ещё %d. "+
+			"Удали лишнее через /kb clear или пришли файл поменьше.", stored, kbMaxChunks, len(chunks)))
+	}
+
+	vectors, err := b.embed(ctx, chunks)
+	if err != nil {
+		b.reply(message, "Не удалось обработать файл: сервис эмбеддингов недоступен, попробуй позже.")
+		return err
+	}
+	if err := b.storeKBChunks(userID, name, chunks, vectors); err != nil {
+		b.reply(message, "Не удалось сохранить файл, попробуй позже.")
+		return err
+	}
+	return b.reply(message, fmt.Sprintf("✅ %s: %d фрагментов. В базе %d/%d. Спрашивай: /kb <вопрос>",
+		name, len(chunks), stored+len(chunks), kbMaxChunks))
+}
+
+// storeKBChunks заменяет фрагменты документа source новыми
+func (b *Bot) storeKBChunks(userID int64, source string, chunks []string, vectors [][]float32) error {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM kb_chunks WHERE user_id = ? AND source = ?", userID, source); err != nil {
+		return fmt.Errorf("ошибка удаления старых фрагментов: %w", err)
+	}
+	for i, chunk := range chunks {
+		_, err := tx.Exec("INSERT INTO kb_chunks (user_id, source, chunk_index, content, embedding) VALUES (?, ?, ?, ?, ?)",
+			userID, source, i, chunk, encodeVector(vectors[i]))
+		if err != nil {
+			return fmt.Errorf("ошибка сохранения фрагмента: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// kbList показывает загруженные документы
+func (b *Bot) kbList(message *tgbotapi.Message) error {
+	userID := senderID(message)
+	rows, err := b.db.Query(`SELECT source, COUNT(*), date(MAX(created_at), 'localtime') FROM kb_chunks WHERE user_id = ?
+		GROUP BY source ORDER BY MAX(created_at) DESC`, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка получения списка документов: %w", err)
+	}
+	var lines []string
+	total := 0
+	for rows.Next() {
+		var source string
+		var count int
+		var added string
+		if err := rows.Scan(&source, &count, &added); err != nil {
+			rows.Close()
+			return fmt.Errorf("ошибка чтения списка документов: %w", err)
+		}
+		total += count
+		lines = append(lines, fmt.Sprintf("• %s - %d фрагм., %s", source, count, added))
+	}
+	rows.Close()
+	if len(lines) == 0 {
+		return b.reply(message, "База знаний пуста. Добавь файлы через /kb add.")
+	}
+
+	auto, err := b.getUserKBAuto(userID)
+	if err != nil {
+		log.Printf("Ошибка получения настройки базы знаний: %v", err)
+	}
+	return b.reply(message, fmt.Sprintf("📚 База знаний (%d/%d фрагментов, авто: %s):\n%s",
+		total, kbMaxChunks, onOff(auto), strings.Join(lines, "\n")))
+}
+
+// searchKB возвращает до kbTopK фрагментов, ближайших к вопросу
+func (b *Bot) searchKB(ctx context.Context, userID int64, question string) ([]kbChunk, error) {
+	rows, err := b.db.Query("SELECT source, chunk_index, content, embedding FROM kb_chunks WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения базы знаний: %w", err)
+	}
+	var chunks []kbChunk
+	var vectors [][]float32
+	for rows.Next() {
+		var c kbChunk
+		var blob []byte
+		if err := rows.Scan(&c.Source, &c.Index, &c.Content, &blob); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("ошибка чтения базы знаний: %w", err)
+		}
+		chunks = append(chunks, c)
+		vectors = append(vectors, decodeVector(blob))
+	}
+	rows.Close()
+	if len(chunks) == 0 {
+		return nil, nil
+	}
+
+	query, err := b.embed(ctx, []string{question})
+	if err != nil {
+		return nil, err
+	}
+	var found []kbChunk
+	for i := range chunks {
+		if chunks[i].Score = cosineSimilarity(query[0], vectors[i]); chunks[i].Score >= kbMinSimilarity {
+			found = append(found, chunks[i])
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Score > found[j].Score })
+	return found[:min(kbTopK, len(found))], nil
+}
+
+// knowledgeInstruction - блок системного промпта с фрагментами документов пользователя.
+// Пустой, если база знаний не запрошена (/kb <вопрос> или /kb auto on) или ничего не нашлось.
+func (b *Bot) knowledgeInstruction(ctx context.Context, in chatInput) string {
+	if !b.embeddingsEnabled() {
+		return ""
+	}
+	if !in.UseKnowledge {
+		auto, err := b.getUserKBAuto(in.UserID)
+		if err != nil {
+			log.Printf("Ошибка получения настройки базы знаний: %v", err)
+		}
+		if !auto {
+			return ""
+		}
+	}
+	chunks, err := b.searchKB(ctx, in.UserID, in.Prompt)
+	if err != nil {
+		log.Printf("Ошибка поиска в базе знаний: %v", err)
+		return ""
+	}
+	if len(chunks) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("Фрагменты из документов пользователя. Опирайся на них, если они относятся к вопросу, " +
+		"и указывай источник в квадратных скобках, например [" + chunks[0].Source + "]. " +
+		"Если ответа во фрагментах нет, так и скажи.")
+	for _, c := range chunks {
+		fmt.Fprintf(&sb, "\n\n[%s, фрагмент %d]\n%s", c.Source, c.Index+1, c.Content)
+	}
+	return sb.String()
+}
+
+// setUserKBAuto включает поиск по базе знаний при каждом вопросе
+func (b *Bot) setUserKBAuto(userID int64, auto bool) error {
+	if _, err := b.db.Exec("INSERT OR IGNORE INTO users (user_id) VALUES (?)", userID); err != nil {
+		return fmt.Errorf("ошибка при вставке пользователя: %w", err)
+	}
+	if _, err := b.db.Exec("UPDATE users SET kb_auto = ? WHERE user_id = ?", auto, userID); err != nil {
+		return fmt.Errorf("ошибка при обновлении настройки базы знаний: %w", err)
+	}
+	return nil
+}
+
+// getUserKBAuto возвращает, искать ли в базе знаний при каждом вопросе
+func (b *Bot) getUserKBAuto(userID int64) (bool, error) {
+	var auto bool
+	err := b.db.QueryRow("SELECT COALESCE(kb_auto, 0) FROM users WHERE user_id = ?", userID).Scan(&auto)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("ошибка при получении настройки базы знаний: %w", err)
+	}
+	return auto, nil
+}
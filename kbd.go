@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	kbdButtons     = 4  // Сколько промптов на клавиатуре
+	kbdLabelRunes  = 24 // Длиннее имя на кнопке обрезается
+	kbdLabelPrefix = "⭐ "
+	// kbdMarker - невидимый разделитель в начале текста кнопки. С клавиатуры его не набрать, поэтому
+	// обычное сообщение, совпавшее с подписью кнопки, не примется за нажатие.
+	kbdMarker = "\u2063"
+)
+
+// kbdLabel - текст кнопки для сохранённого промпта
+func kbdLabel(name string) string {
+	return kbdMarker + kbdLabelPrefix + truncateRunes(name, kbdLabelRunes)
+}
+
+// topSavedPrompts возвращает самые используемые промпты пользователя
+func (b *Bot) topSavedPrompts(userID int64, limit int) ([]SavedPrompt, error) {
+	rows, err := b.db.Query(`SELECT id, name, prompt FROM saved_prompts WHERE user_id = ?
+		ORDER BY COALESCE(uses, 0) DESC, name COLLATE NOCASE LIMIT ?`, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения сохранённых промптов: %w", err)
+	}
+	defer rows.Close()
+
+	var prompts []SavedPrompt
+	for rows.Next() {
+		var p SavedPrompt
+		if err := rows.Scan(&p.ID, &p.Name, &p.Prompt); err != nil {
+			return nil, fmt.Errorf("ошибка чтения сохранённых промптов: %w", err)
+		}
+		prompts = append(prompts, p)
+	}
+	return prompts, rows.Err()
+}
+
+// countPromptUse учитывает запуск сохранённого промпта: по этому счётчику выбираются кнопки /kbd
+func (b *Bot) countPromptUse(id int64) {
+	if _, err := b.db.Exec("UPDATE saved_prompts SET uses = COALESCE(uses, 0) + 1 WHERE id = ?", id); err != nil {
+		log.Printf("Ошибка учёта запуска промпта: %v", err)
+	}
+}
+
+// promptKeyboard собирает клавиатуру из промптов по два в ряд
+func promptKeyboard(prompts []SavedPrompt) tgbotapi.ReplyKeyboardMarkup {
+	var rows [][]tgbotapi.KeyboardButton
+	for i, p := range prompts {
+		if i%2 == 0 {
+			rows = append(rows, nil)
+		}
+		rows[len(rows)-1] = append(rows[len(rows)-1], tgbotapi.NewKeyboardButton(kbdLabel(p.Name)))
+	}
+	keyboard := tgbotapi.NewReplyKeyboard(rows...)
+	keyboard.InputFieldPlaceholder = "Свой вопрос или промпт с кнопки"
+	return keyboard
+}
+
+// kbd обрабатывает команду /kbd on|off: постоянная клавиатура с самыми используемыми сохранёнными промптами
+func (b *Bot) kbd(message *tgbotapi.Message) error {
+	enabled, ok := parseToggle(message.CommandArguments())
+	if !ok {
+		return b.reply(message, fmt.Sprintf("Использование: /kbd on или /kbd off\n\n"+
+			"Когда включено, под полем ввода появляются кнопки с %d самыми используемыми промптами из /saved: "+
+			"нажатие отправляет промпт целиком. Повторный /kbd on обновит кнопки.", kbdButtons))
+	}
+	if !message.Chat.IsPrivate() {
+		return b.reply(message, "Клавиатура с промптами работает только в личке с ботом.")
+	}
+	userID := senderID(message)
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, "⌨️ Клавиатура с промптами убрана.")
+	msg.ReplyMarkup = tgbotapi.NewRemoveKeyboard(false)
+	if enabled {
+		prompts, err := b.topSavedPrompts(userID, kbdButtons)
+		if err != nil {
+			return err
+		}
+		if len(prompts) == 0 {
+			return b.reply(message, "Сохранённых промптов нет. Ответь командой /save <имя> на своё сообщение, чтобы сохранить его.")
+		}
+		msg.Text = "⌨️ Клавиатура с промптами включена. Убрать - /kbd off."
+		msg.ReplyMarkup = promptKeyboard(prompts)
+	}
+	if err := b.setUserPromptKeyboard(userID, enabled); err != nil {
+		b.reply(message, "Не удалось сохранить настройку, попробуй позже.")
+		return err
+	}
+	msg.ReplyToMessageID = message.MessageID
+	if _, err := b.api.Send(msg); err != nil {
+		return fmt.Errorf("ошибка отправки клавиатуры: %w", err)
+	}
+	return nil
+}
+
+// expandKeyboardPrompt разворачивает нажатие кнопки /kbd в полный текст сохранённого промпта.
+// ok=false - это не кнопка. Пустой prompt при ok=true - промпта с такой подписью уже нет.
+func (b *Bot) expandKeyboardPrompt(userID int64, text string) (prompt string, ok bool, err error) {
+	if !strings.HasPrefix(text, kbdMarker) {
+		return "", false, nil
+	}
+	prompts, err := b.getSavedPrompts(userID)
+	if err != nil {
+		return "", true, err
+	}
+	for _, p := range prompts {
+		if kbdLabel(p.Name) == text {
+			b.countPromptUse(p.ID)
+			return p.Prompt, true, nil
+		}
+	}
+	return "", true, nil
+}
+
+// setUserPromptKeyboard запоминает, включена ли клавиатура с промптами
+func (b *Bot) setUserPromptKeyboard(userID int64, enabled bool) error {
+	if _, err := b.db.Exec("INSERT OR IGNORE INTO users (user_id) VALUES (?)", userID); err != nil {
+		return fmt.Errorf("ошибка при вставке пользователя: %w", err)
+	}
+	if _, err := b.db.Exec("UPDATE users SET prompt_keyboard = ? WHERE user_id = ?", enabled, userID); err != nil {
+		return fmt.Errorf("ошибка при обновлении клавиатуры промптов: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// languageNames - языки, которые можно закрепить через /replylang
+var languageNames = map[string]string{
+	"ru": "Russian",
+	"uk": "Ukrainian",
+	"en": "English",
+	"de": "German",
+	"fr": "French",
+	"es": "Spanish",
+	"it": "Italian",
+}
+
+// trigramProfiles - самые частые триграммы латинских языков (пробел обозначает границу слова)
+var trigramProfiles = map[string][]string{
+	"en": {" th", "the", "he ", "and", " an", "nd ", " of", "of ", " to", "to ", "ing", "ng ", " in", "in ", "is ", " is", "ion", "er ", "hat", " wh", "you", " yo", "ou ", "re ", "at ", "for", " fo", "ed ", "it ", "how"},
+	"de": {"en ", "er ", " de", "der", "ie ", "ich", "ein", " di", "die", "sch", "che", "und", " un", "den", " ei", "ch ", "ine", "ung", "te ", "gen", " ge", "ist", " is", "st ", "das", " da", "nic", "cht", "wie", " wi"},
+	"fr": {"es ", " de", "de ", "ent", " le", "le ", "que", " qu", "ue ", "les", "nt ", " la", "la ", "re ", "on ", " pa", "ion", " et", "et ", "ne ", " un", "est", "ous", "pas", "des", " en", "ai ", "ait", "omm", "eux"},
+	"es": {" de", "de ", "os ", " la", "la ", "el ", " el", "que", " qu", "ue ", "es ", "en ", " en", "as ", "ión", "ado", " lo", "los", " co", "con", "est", " un", "por", " po", "ent", "ar ", "nte", "aci", "cóm", "qué"},
+	"it": {" di", "di ", "che", " ch", "he ", " il", "il ", "la ", " la", "to ", "re ", "ne ", "per", " pe", "ell", "del", " de", "lla", "ent", "ion", "zio", "one", "no ", " co", "con", "non", " no", "son", "ere", "are"},
+}
+
+// detectLanguage определяет язык текста: кириллицу по алфавиту, латиницу по триграммам.
+// Пустая строка означает, что язык определить не удалось.
+func detectLanguage(text string) string {
+	var cyrillic, latin, ukrainian int
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case strings.ContainsRune("іїєґ", r):
+			ukrainian++
+			cyrillic++
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		}
+	}
+
+	if cyrillic == 0 && latin == 0 {
+		return ""
+	}
+	if cyrillic >= latin {
+		if ukrainian > 0 {
+			return "uk"
+		}
+		return "ru"
+	}
+	return detectLatinLanguage(text)
+}
+
+// detectLatinLanguage выбирает латинский язык с наибольшим числом совпавших триграмм
+func detectLatinLanguage(text string) string {
+	normalized := " " + strings.Join(strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	}), " ") + " "
+
+	type score struct {
+		lang  string
+		count int
+	}
+	var scores []score
+	for lang, trigrams := range trigramProfiles {
+		count := 0
+		for _, trigram := range trigrams {
+			count += strings.Count(normalized, trigram)
+		}
+		scores = append(scores, score{lang, count})
+	}
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].count != scores[j].count {
+			return scores[i].count > scores[j].count
+		}
+		return scores[i].lang < scores[j].lang
+	})
+
+	// Слишком мало совпадений или ничья - язык не определён
+	if scores[0].count < 2 || scores[0].count == scores[1].count {
+		return ""
+	}
+	return scores[0].lang
+}
+
+// languageInstruction возвращает строку системного промпта о языке ответа.
+// Закреплённый через /replylang язык важнее автоопределения.
+func languageInstruction(pinned, prompt string) string {
+	lang := pinned
+	if lang == "" {
+		lang = detectLanguage(prompt)
+	}
+
+	switch lang {
+	case "":
+		return "Отвечай на языке вопроса пользователя."
+	case "ru":
+		return "Отвечай на русском языке."
+	}
+	return fmt.Sprintf("Respond in %s.", languageNames[lang])
+}
+
+// setReplyLang обрабатывает команду /replylang <код>|auto
+func (b *Bot) setReplyLang(message *tgbotapi.Message) error {
+	code := strings.ToLower(strings.TrimSpace(message.CommandArguments()))
+	if code == "" {
+		return b.reply(message, "Использование: /replylang <код> (например, en или ru) или /replylang auto для автоопределения.\nДоступные языки: "+strings.Join(sortedLanguageCodes(), ", "))
+	}
+	if code == "auto" {
+		code = ""
+	} else if _, ok := languageNames[code]; !ok {
+		return b.reply(message, "Неизвестный код языка. Доступные: "+strings.Join(sortedLanguageCodes(), ", "))
+	}
+
+	if err := b.setUserReplyLang(senderID(message), code); err != nil {
+		b.reply(message, "Не удалось сохранить настройку, попробуй позже.")
+		return fmt.Errorf("ошибка сохранения языка ответа: %w", err)
+	}
+
+	if code == "" {
+		return b.reply(message, "Буду отвечать на языке вопроса.")
+	}
+	return b.reply(message, fmt.Sprintf("Язык ответов закреплён: %s (%s).", code, languageNames[code]))
+}
+
+// sortedLanguageCodes возвращает коды языков по алфавиту
+func sortedLanguageCodes() []string {
+	codes := make([]string, 0, len(languageNames))
+	for code := range languageNames {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// setUserReplyLang сохраняет закреплённый язык ответа (пустая строка - автоопределение)
+func (b *Bot) setUserReplyLang(userID int64, code string) error {
+	_, err := b.db.Exec("INSERT OR IGNORE INTO users (user_id) VALUES (?)", userID)
+	if err != nil {
+		return fmt.Errorf("ошибка при вставке пользователя: %w", err)
+	}
+	_, err = b.db.Exec("UPDATE users SET reply_lang = ? WHERE user_id = ?", code, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка при обновлении языка ответа: %w", err)
+	}
+	return nil
+}
+
+// getUserReplyLang возвращает закреплённый язык ответа или пустую строку
+func (b *Bot) getUserReplyLang(userID int64) (string, error) {
+	var code string
+	err := b.db.QueryRow("SELECT reply_lang FROM users WHERE user_id = ?", userID).Scan(&code)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("ошибка при получении языка ответа: %w", err)
+	}
+	return code, nil
+}
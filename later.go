@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	laterMaxPerUser = 10                  // Сколько отложенных вопросов может ждать у одного пользователя
+	laterMaxAhead   = 30 * 24 * time.Hour // Дальше этого срока отложить вопрос нельзя
+	laterListRunes  = 80                  // До скольких символов сокращается вопрос в списке
+)
+
+const laterUsage = "Использование:\n" +
+	"/later 08:00 <вопрос> - ответить в ближайшие 08:00\n" +
+	"/later завтра 08:00 <вопрос> или /later 20.10 08:00 <вопрос> - в конкретный день\n" +
+	"/later list - отложенные вопросы\n" +
+	"/later cancel <номер> - отменить"
+
+// parseLaterTime разбирает начало аргументов /later: "[завтра|ДД.ММ] ЧЧ:ММ" во времени now.
+// Без дня берётся ближайшее такое время; возвращается время и остаток строки - вопрос.
+func parseLaterTime(args string, now time.Time) (time.Time, string, error) {
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		return time.Time{}, "", errors.New("не указано время")
+	}
+
+	day, explicitDay := now, false
+	switch first := strings.ToLower(fields[0]); {
+	case first == "завтра":
+		day, explicitDay, fields = now.AddDate(0, 0, 1), true, fields[1:]
+	case strings.Contains(first, "."):
+		d, err := time.ParseInLocation("02.01", first, now.Location())
+		if err != nil {
+			return time.Time{}, "", fmt.Errorf("некорректная дата %q, нужно ДД.ММ", fields[0])
+		}
+		day = time.Date(now.Year(), d.Month(), d.Day(), 0, 0, 0, 0, now.Location())
+		if day.Before(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())) {
+			day = day.AddDate(1, 0, 0) // Прошедшая дата - значит, следующий год
+		}
+		explicitDay, fields = true, fields[1:]
+	}
+	if len(fields) == 0 {
+		return time.Time{}, "", errors.New("не указано время")
+	}
+
+	clock, err := time.Parse("15:04", fields[0])
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("некорректное время %q, нужно ЧЧ:ММ", fields[0])
+	}
+	due := time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location())
+	if !due.After(now) {
+		if explicitDay {
+			return time.Time{}, "", errors.New("это время уже прошло")
+		}
+		due = due.AddDate(0, 0, 1)
+	}
+	return due, strings.Join(fields[1:], " "), nil
+}
+
+// formatJobTime показывает время задания в часовой зоне пользователя: "16 октября в 08:00"
+func formatJobTime(t time.Time, loc *time.Location) string {
+	t = t.In(loc)
+	return fmt.Sprintf("%d %s в %02d:%02d", t.Day(), russianMonths[t.Month()-1], t.Hour(), t.Minute())
+}
+
+// later обрабатывает команду /later: откладывает вопрос до указанного времени, показывает и отменяет отложенные
+func (b *Bot) later(message *tgbotapi.Message) error {
+	userID := senderID(message)
+	args := strings.TrimSpace(message.CommandArguments())
+	loc, err := b.userLocation(userID)
+	if err != nil {
+		log.Printf("Ошибка получения часовой зоны: %v", err)
+	}
+
+	switch fields := strings.Fields(args); {
+	case len(fields) == 0:
+		return b.reply(message, laterUsage)
+	case fields[0] == "list":
+		return b.listLater(message, loc)
+	case fields[0] == "cancel":
+		if len(fields) != 2 {
+			return b.reply(message, "Использование: /later cancel <номер из /later list>")
+		}
+		id, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return b.reply(message, "Номер должен быть числом из /later list")
+		}
+		ok, err := b.cancelJob(userID, jobLater, id)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return b.reply(message, "Такого отложенного вопроса нет: он уже отвечен или отменён.")
+		}
+		return b.reply(message, "🗑 Отложенный вопрос отменён.")
+	}
+
+	now := time.Now().In(loc)
+	due, prompt, err := parseLaterTime(args, now)
+	if err != nil {
+		return b.reply(message, fmt.Sprintf("❌ %s.\n\n%s", err, laterUsage))
+	}
+	if strings.TrimSpace(prompt) == "" {
+		return b.reply(message, "Напиши вопрос после времени, например: /later 08:00 составь план на день по моим заметкам")
+	}
+	if due.Sub(now) > laterMaxAhead {
+		return b.reply(message, "Отложить вопрос можно не больше чем на 30 дней.")
+	}
+
+	jobs, err := b.userJobs(userID, jobLater)
+	if err != nil {
+		return err
+	}
+	if len(jobs) >= laterMaxPerUser {
+		return b.reply(message, fmt.Sprintf("У тебя уже %d отложенных вопросов - это максимум. Отмени лишние: /later list", len(jobs)))
+	}
+	id, err := b.scheduleJob(userID, message.Chat.ID, jobLater, prompt, due)
+	if err != nil {
+		return err
+	}
+	return b.reply(message, fmt.Sprintf("⏰ Хорошо, отвечу %s (%s). Номер: %d, отменить - /later cancel %d",
+		formatJobTime(due, loc), loc, id, id))
+}
+
+// listLater показывает отложенные вопросы пользователя
+func (b *Bot) listLater(message *tgbotapi.Message, loc *time.Location) error {
+	jobs, err := b.userJobs(senderID(message), jobLater)
+	if err != nil {
+		return err
+	}
+	if len(jobs) == 0 {
+		return b.reply(message, "Отложенных вопросов нет. Отложить: /later 08:00 <вопрос>")
+	}
+	var sb strings.Builder
+	sb.WriteString("⏰ Отложенные вопросы:\n\n")
+	for _, job := range jobs {
+		fmt.Fprintf(&sb, "%d. %s - %s\n", job.ID, formatJobTime(job.DueAt, loc), truncateRunes(job.Payload, laterListRunes))
+	}
+	sb.WriteString("\nОтменить: /later cancel <номер>")
+	return b.reply(message, sb.String())
+}
+
+// runLaterJob отвечает на отложенный вопрос в очереди пользователя: ответ читает и пишет историю
+// разговора, поэтому не должен идти одновременно с его живыми сообщениями. Переполненная очередь -
+// временная ошибка, задание останется до следующего прохода планировщика.
+func (b *Bot) runLaterJob(job scheduledJob) error {
+	return b.queues.RunWait(job.UserID, func() error { return b.answerLaterJob(job) })
+}
+
+// answerLaterJob отвечает на отложенный вопрос. Контекст и память берутся на момент ответа,
+// а не на момент, когда вопрос отложили.
+func (b *Bot) answerLaterJob(job scheduledJob) error {
+	ctx := context.Background()
+	in := chatInput{UserID: job.UserID, ChatID: job.ChatID, Prompt: job.Payload}
+	turn := b.prepareChat(ctx, in)
+	if err := b.checkLimits(in, turn); err != nil {
+		msg := tgbotapi.NewMessage(job.ChatID, "⏰ Отложенный вопрос не выполнен: "+err.Error())
+		msg.DisableNotification = job.Silent
+		_, sendErr := b.api.Send(msg)
+		return sendErr
+	}
+	aiResponse, err := b.completeChat(ctx, in, turn)
+	if err != nil {
+		return err
+	}
+
+	header := fmt.Sprintf("⏰ Отложенный вопрос: «%s»\n\n", truncateRunes(job.Payload, laterListRunes))
+	thinking := tgbotapi.NewMessage(job.ChatID, "⌛ Думаю...")
+	thinking.DisableNotification = job.Silent // Ответ приходит правкой этого сообщения, поэтому звук решает оно
+	sent, err := b.api.Send(thinking)
+	if err != nil {
+		return fmt.Errorf("ошибка отправки отложенного ответа: %w", err)
+	}
+	if _, err := b.deliverUserAnswer(job.UserID, job.ChatID, sent.MessageID, 0, header+aiResponse.Content); err != nil {
+		return fmt.Errorf("ошибка отправки отложенного ответа: %w", err)
+	}
+	b.saveChat(in, turn, aiResponse)
+	return nil
+}
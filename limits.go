@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// completionReserve - сколько токенов ответа закладывается в оценку запроса до обращения к модели
+const completionReserve = 512
+
+// limitError - запрос отклонён дневным лимитом тарифа; текст ошибки готов для пользователя
+type limitError struct {
+	text string
+}
+
+func (e *limitError) Error() string {
+	return e.text
+}
+
+// tierLimitsEnv читает лимиты по тарифам вида "free=50,plus=300" из переменной окружения.
+// Тариф без лимита (или с 0) ничем не ограничен.
+func tierLimitsEnv(name string) (map[string]int, error) {
+	limits := make(map[string]int)
+	for _, item := range strings.Split(os.Getenv(name), ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		tier, value, ok := strings.Cut(item, "=")
+		tier = strings.TrimSpace(tier)
+		if !ok || !isValidTier(tier) {
+			return nil, fmt.Errorf("%s: ожидается тариф=число через запятую (тарифы: %s), получено %q",
+				name, strings.Join(validTiers, ", "), item)
+		}
+		limit, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || limit < 0 {
+			return nil, fmt.Errorf("%s: лимит тарифа %s должен быть неотрицательным числом, получено %q", name, tier, value)
+		}
+		limits[tier] = limit
+	}
+	return limits, nil
+}
+
+// dailyUsage возвращает тариф пользователя, число ответов и потраченные токены за сегодня.
+// Сутки считаются по времени сервера, как в /stats.
+func (b *Bot) dailyUsage(userID int64) (tier string, answers int, tokens int64, err error) {
+	err = b.db.QueryRow(`
+		SELECT
+			COALESCE((SELECT tier FROM users WHERE user_id = ?), 'free'),
+			COUNT(*),
+			COALESCE(SUM(prompt_tokens + completion_tokens), 0)
+		FROM usage WHERE user_id = ? AND created_at >= datetime('now', 'localtime', 'start of day', 'utc')`,
+		userID, userID).Scan(&tier, &answers, &tokens)
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("ошибка подсчёта расхода за сегодня: %w", err)
+	}
+	return tier, answers, tokens, nil
+}
+
+// checkLimits проверяет перед запросом к модели дневные лимиты тарифа (число ответов и бюджет токенов)
+// и пробный период пользователя без приглашения. Срабатывает тот лимит, что исчерпан первым;
+// пробное сообщение списывается последним, чтобы отказ по лимиту тарифа его не тратил. Токены запроса оцениваются заранее, а после ответа
+// в usage записывается реальный расход, и следующая проверка считает уже по нему.
+// Сообщения одного пользователя обрабатываются по очереди, поэтому резервировать оценку не нужно.
+func (b *Bot) checkLimits(in chatInput, turn *chatTurn) error {
+	estimate := int64(completionReserve)
+	for _, msg := range turn.Messages {
+		estimate += int64(estimateTokens(msg.Content))
+	}
+	if err := b.checkBudget(in.UserID, estimate); err != nil {
+		return err
+	}
+	return b.checkTrial(in.UserID)
+}
+
+// checkBudget проверяет лимиты тарифа для запроса, который по оценке потратит estimate токенов
+func (b *Bot) checkBudget(userID int64, estimate int64) error {
+	if len(b.cfg().DailyMessageLimits) == 0 && len(b.cfg().DailyTokenLimits) == 0 || b.isAdmin(userID) {
+		return nil
+	}
+	tier, answers, tokens, err := b.dailyUsage(userID)
+	if err != nil {
+		// Из-за сбоя базы не отказываем: лимит защищает от злоупотреблений, а не от случайных запросов
+		log.Printf("Ошибка проверки лимитов: %v", err)
+		return nil
+	}
+
+	loc, err := b.userLocation(userID)
+	if err != nil {
+		log.Printf("Ошибка получения часовой зоны: %v", err)
+	}
+	resetAt := nextDailyRun(time.Now(), 0).In(loc).Format("15:04")
+
+	if limit := b.cfg().DailyMessageLimits[tier]; limit > 0 && answers >= limit {
+		return &limitError{fmt.Sprintf("⛔ На тарифе %s доступно %d ответов в день, сегодняшние закончились. "+
+			"Лимит обновится в %s.", tier, limit, resetAt)}
+	}
+
+	if limit := int64(b.cfg().DailyTokenLimits[tier]); limit > 0 && tokens+estimate > limit {
+		return &limitError{fmt.Sprintf("⛔ Этот запрос не уложится в дневной бюджет тарифа %s: осталось %d из %d токенов, "+
+			"а нужно около %d. Бюджет обновится в %s.", tier, max(limit-tokens, 0), limit, estimate, resetAt)}
+	}
+	return nil
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	cityMaxDistanceKm     = 300 // Дальше от ближайшего города название не подставляется
+	timezoneMaxDistanceKm = 800 // Дальше часовая зона считается по долготе
+)
+
+// knownCity - город из встроенного справочника: по ближайшему к точке определяются название и часовая зона
+type knownCity struct {
+	Name     string
+	Lat, Lon float64
+	Timezone string
+}
+
+// knownCities - крупные города во всех часовых зонах России, СНГ и популярных направлениях.
+// Справочник грубый, но для часовой зоны и "примерно где" его достаточно.
+var knownCities = []knownCity{
+	{"Калининград", 54.71, 20.51, "Europe/Kaliningrad"},
+	{"Москва", 55.76, 37.62, "Europe/Moscow"},
+	{"Санкт-Петербург", 59.94, 30.31, "Europe/Moscow"},
+	{"Нижний Новгород", 56.33, 44.00, "Europe/Moscow"},
+	{"Казань", 55.79, 49.12, "Europe/Moscow"},
+	{"Воронеж", 51.67, 39.18, "Europe/Moscow"},
+	{"Ростов-на-Дону", 47.22, 39.72, "Europe/Moscow"},
+	{"Краснодар", 45.04, 38.98, "Europe/Moscow"},
+	{"Сочи", 43.60, 39.73, "Europe/Moscow"},
+	{"Архангельск", 64.54, 40.54, "Europe/Moscow"},
+	{"Мурманск", 68.97, 33.08, "Europe/Moscow"},
+	{"Волгоград", 48.71, 44.51, "Europe/Volgograd"},
+	{"Самара", 53.20, 50.15, "Europe/Samara"},
+	{"Ижевск", 56.85, 53.20, "Europe/Samara"},
+	{"Саратов", 51.53, 46.03, "Europe/Saratov"},
+	{"Ульяновск", 54.32, 48.40, "Europe/Ulyanovsk"},
+	{"Астрахань", 46.35, 48.04, "Europe/Astrakhan"},
+	{"Екатеринбург", 56.84, 60.61, "Asia/Yekaterinburg"},
+	{"Челябинск", 55.16, 61.40, "Asia/Yekaterinburg"},
+	{"Уфа", 54.74, 55.97, "Asia/Yekaterinburg"},
+	{"Пермь", 58.01, 56.25, "Asia/Yekaterinburg"},
+	{"Тюмень", 57.15, 65.53, "Asia/Yekaterinburg"},
+	{"Оренбург", 51.77, 55.10, "Asia/Yekaterinburg"},
+	{"Сургут", 61.25, 73.40, "Asia/Yekaterinburg"},
+	{"Омск", 54.99, 73.37, "Asia/Omsk"},
+	{"Новосибирск", 55.03, 82.92, "Asia/Novosibirsk"},
+	{"Барнаул", 53.35, 83.78, "Asia/Barnaul"},
+	{"Томск", 56.48, 84.95, "Asia/Tomsk"},
+	{"Кемерово", 55.35, 86.09, "Asia/Novokuznetsk"},
+	{"Новокузнецк", 53.76, 87.12, "Asia/Novokuznetsk"},
+	{"Красноярск", 56.01, 92.87, "Asia/Krasnoyarsk"},
+	{"Норильск", 69.35, 88.20, "Asia/Krasnoyarsk"},
+	{"Иркутск", 52.29, 104.28, "Asia/Irkutsk"},
+	{"Улан-Удэ", 51.83, 107.58, "Asia/Irkutsk"},
+	{"Чита", 52.03, 113.50, "Asia/Chita"},
+	{"Якутск", 62.03, 129.73, "Asia/Yakutsk"},
+	{"Благовещенск", 50.27, 127.54, "Asia/Yakutsk"},
+	{"Хабаровск", 48.48, 135.08, "Asia/Vladivostok"},
+	{"Владивосток", 43.12, 131.89, "Asia/Vladivostok"},
+	{"Южно-Сахалинск", 46.96, 142.74, "Asia/Sakhalin"},
+	{"Магадан", 59.56, 150.80, "Asia/Magadan"},
+	{"Петропавловск-Камчатский", 53.02, 158.65, "Asia/Kamchatka"},
+	{"Анадырь", 64.73, 177.51, "Asia/Anadyr"},
+
+	{"Минск", 53.90, 27.56, "Europe/Minsk"},
+	{"Киев", 50.45, 30.52, "Europe/Kyiv"},
+	{"Кишинёв", 47.01, 28.86, "Europe/Chisinau"},
+	{"Рига", 56.95, 24.11, "Europe/Riga"},
+	{"Вильнюс", 54.69, 25.28, "Europe/Vilnius"},
+	{"Таллин", 59.44, 24.75, "Europe/Tallinn"},
+	{"Тбилиси", 41.72, 44.79, "Asia/Tbilisi"},
+	{"Ереван", 40.18, 44.51, "Asia/Yerevan"},
+	{"Баку", 40.41, 49.87, "Asia/Baku"},
+	{"Астана", 51.17, 71.45, "Asia/Almaty"},
+	{"Алматы", 43.24, 76.89, "Asia/Almaty"},
+	{"Ташкент", 41.30, 69.24, "Asia/Tashkent"},
+	{"Бишкек", 42.87, 74.59, "Asia/Bishkek"},
+	{"Душанбе", 38.56, 68.79, "Asia/Dushanbe"},
+
+	{"Хельсинки", 60.17, 24.94, "Europe/Helsinki"},
+	{"Варшава", 52.23, 21.01, "Europe/Warsaw"},
+	{"Берлин", 52.52, 13.40, "Europe/Berlin"},
+	{"Прага", 50.08, 14.44, "Europe/Prague"},
+	{"Вена", 48.21, 16.37, "Europe/Vienna"},
+	{"Белград", 44.79, 20.45, "Europe/Belgrade"},
+	{"Амстердам", 52.37, 4.90, "Europe/Amsterdam"},
+	{"Стокгольм", 59.33, 18.07, "Europe/Stockholm"},
+	{"Париж", 48.86, 2.35, "Europe/Paris"},
+	{"Лондон", 51.51, -0.13, "Europe/London"},
+	{"Мадрид", 40.42, -3.70, "Europe/Madrid"},
+	{"Лиссабон", 38.72, -9.14, "Europe/Lisbon"},
+	{"Рим", 41.90, 12.50, "Europe/Rome"},
+	{"Афины", 37.98, 23.73, "Europe/Athens"},
+	{"Стамбул", 41.01, 28.98, "Europe/Istanbul"},
+	{"Анталья", 36.90, 30.70, "Europe/Istanbul"},
+	{"Тель-Авив", 32.08, 34.78, "Asia/Jerusalem"},
+	{"Каир", 30.04, 31.24, "Africa/Cairo"},
+	{"Дубай", 25.20, 55.27, "Asia/Dubai"},
+	{"Дели", 28.61, 77.21, "Asia/Kolkata"},
+	{"Гоа", 15.50, 73.83, "Asia/Kolkata"},
+	{"Бангкок", 13.76, 100.50, "Asia/Bangkok"},
+	{"Пхукет", 7.88, 98.39, "Asia/Bangkok"},
+	{"Бали", -8.65, 115.22, "Asia/Makassar"},
+	{"Пекин", 39.90, 116.40, "Asia/Shanghai"},
+	{"Сеул", 37.57, 126.98, "Asia/Seoul"},
+	{"Токио", 35.68, 139.69, "Asia/Tokyo"},
+	{"Сидней", -33.87, 151.21, "Australia/Sydney"},
+
+	{"Нью-Йорк", 40.71, -74.01, "America/New_York"},
+	{"Майами", 25.76, -80.19, "America/New_York"},
+	{"Торонто", 43.65, -79.38, "America/Toronto"},
+	{"Чикаго", 41.88, -87.63, "America/Chicago"},
+	{"Денвер", 39.74, -104.99, "America/Denver"},
+	{"Лос-Анджелес", 34.05, -118.24, "America/Los_Angeles"},
+	{"Мехико", 19.43, -99.13, "America/Mexico_City"},
+	{"Сан-Паулу", -23.55, -46.63, "America/Sao_Paulo"},
+	{"Буэнос-Айрес", -34.60, -58.38, "America/Argentina/Buenos_Aires"},
+}
+
+// distanceKm - расстояние по большому кругу между двумя точками
+func distanceKm(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadiusKm = 6371
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat, dLon := toRad(lat2-lat1), toRad(lon2-lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
+
+// placeFor определяет по координатам часовую зону и ближайший город (пусто, если рядом нет известного).
+// Вдали от справочника зона считается по долготе: Etc/GMT со знаком наоборот, как принято в tzdata.
+func placeFor(lat, lon float64) (timezone, city string) {
+	nearest, best := -1, math.Inf(1)
+	for i, c := range knownCities {
+		if d := distanceKm(lat, lon, c.Lat, c.Lon); d < best {
+			nearest, best = i, d
+		}
+	}
+	if best <= cityMaxDistanceKm {
+		city = knownCities[nearest].Name
+	}
+	if best <= timezoneMaxDistanceKm {
+		return knownCities[nearest].Timezone, city
+	}
+	offset := int(math.Round(lon / 15))
+	if offset == 0 {
+		return "Etc/GMT", city
+	}
+	return fmt.Sprintf("Etc/GMT%+d", -offset), city
+}
+
+// setLocation обрабатывает присланную геопозицию: сохраняет часовую зону и город.
+// Сами координаты никуда не записываются.
+func (b *Bot) setLocation(message *tgbotapi.Message) error {
+	timezone, city := placeFor(message.Location.Latitude, message.Location.Longitude)
+	if err := b.setUserPlace(senderID(message), timezone, city); err != nil {
+		b.reply(message, "Не удалось сохранить часовой пояс, попробуй позже.")
+		return err
+	}
+
+	text := "🕒 Часовой пояс установлен: " + timezone
+	if city != "" {
+		text += " (рядом с городом " + city + ")"
+		if useCity, _, err := b.getUserLocationContext(senderID(message)); err == nil && !useCity {
+			text += "\n\nЧтобы я учитывал город в ответах (например, про закат или погоду), включи /location on."
+		}
+	}
+	return b.reply(message, text)
+}
+
+// location обрабатывает команду /location on|off|clear
+func (b *Bot) location(message *tgbotapi.Message) error {
+	userID := senderID(message)
+	arg := strings.ToLower(strings.TrimSpace(message.CommandArguments()))
+	if arg == "clear" {
+		if err := b.setUserPlace(userID, "", ""); err != nil {
+			b.reply(message, "Не удалось сбросить настройку, попробуй позже.")
+			return err
+		}
+		return b.reply(message, "Часовой пояс и город забыты. Время снова считается по умолчанию.")
+	}
+
+	enabled, ok := parseToggle(arg)
+	if !ok {
+		return b.reply(message, "Пришли геопозицию (📎 → Геопозиция), и я определю часовой пояс и ближайший город. "+
+			"Точные координаты не сохраняются.\n\n/location on - учитывать город в ответах\n/location off - не учитывать\n"+
+			"/location clear - забыть часовой пояс и город")
+	}
+	if err := b.setUserLocationContext(userID, enabled); err != nil {
+		b.reply(message, "Не удалось сохранить настройку, попробуй позже.")
+		return err
+	}
+	if !enabled {
+		return b.reply(message, "Город больше не подставляется в ответы.")
+	}
+	if _, city, err := b.getUserLocationContext(userID); err == nil && city == "" {
+		return b.reply(message, "Включено. Теперь пришли геопозицию, чтобы я знал, где ты примерно находишься.")
+	}
+	return b.reply(message, "📍 Буду учитывать, в каком ты городе.")
+}
+
+// locationInstruction - строка системного промпта с городом пользователя (только при /location on)
+func (b *Bot) locationInstruction(userID int64) string {
+	useCity, city, err := b.getUserLocationContext(userID)
+	if err != nil {
+		log.Printf("Ошибка получения города пользователя: %v", err)
+	}
+	if !useCity || city == "" {
+		return ""
+	}
+	return "Пользователь находится примерно в городе " + city + "."
+}
+
+// setUserPlace сохраняет часовую зону и город пользователя
+func (b *Bot) setUserPlace(userID int64, timezone, city string) error {
+	if _, err := b.db.Exec("INSERT OR IGNORE INTO users (user_id) VALUES (?)", userID); err != nil {
+		return fmt.Errorf("ошибка при вставке пользователя: %w", err)
+	}
+	if _, err := b.db.Exec("UPDATE users SET timezone = ?, city = ? WHERE user_id = ?", timezone, city, userID); err != nil {
+		return fmt.Errorf("ошибка при обновлении часового пояса: %w", err)
+	}
+	return nil
+}
+
+// setUserLocationContext включает подстановку города в системный промпт
+func (b *Bot) setUserLocationContext(userID int64, enabled bool) error {
+	if _, err := b.db.Exec("INSERT OR IGNORE INTO users (user_id) VALUES (?)", userID); err != nil {
+		return fmt.Errorf("ошибка при вставке пользователя: %w", err)
+	}
+	if _, err := b.db.Exec("UPDATE users SET location_context = ? WHERE user_id = ?", enabled, userID); err != nil {
+		return fmt.Errorf("ошибка при обновлении настройки /location: %w", err)
+	}
+	return nil
+}
+
+// getUserLocationContext возвращает, включена ли подстановка города, и сам город
+func (b *Bot) getUserLocationContext(userID int64) (bool, string, error) {
+	var enabled bool
+	var city string
+	err := b.db.QueryRow("SELECT COALESCE(location_context, 0), COALESCE(city, '') FROM users WHERE user_id = ?", userID).
+		Scan(&enabled, &city)
+	if err == sql.ErrNoRows {
+		return false, "", nil
+	}
+	if err != nil {
+		return false, "", fmt.Errorf("ошибка при получении настройки /location: %w", err)
+	}
+	return enabled, city, nil
+}
@@ -2,19 +2,29 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"database/sql" // Добавлено для работы с БД
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/joho/godotenv"
 	_ "github.com/mattn/go-sqlite3" // Импорт драйвера SQLite
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -28,14 +38,87 @@ const (
 
 // Config хранит токены API
 type Config struct {
-	TelegramBotToken    string
-	HuggingFaceAPIToken string // Переименовано для ясности
+	TelegramBotTokens   []string // Токены ботов (TELEGRAM_BOT_TOKENS через запятую, иначе TELEGRAM_BOT_TOKEN)
+	HuggingFaceAPIToken string   // Переименовано для ясности
+	AdminIDs            []int64  // Telegram ID администраторов бота
+	AdminChatID         int64    // Чат для служебных уведомлений (0 - не отправлять)
+
+	AutoSummaryChannels []int64       // Каналы, под постами которых бот оставляет пересказ (AUTO_SUMMARY_CHANNELS)
+	PrivateOnly         bool          // Работать только в личных сообщениях (PRIVATE_ONLY)
+	InviteOnly          bool          // Пускать новых пользователей только по коду приглашения (INVITE_ONLY)
+	TrialMessages       int           // Сколько сообщений доступно без приглашения, 0 - сразу просить код (TRIAL_MESSAGES)
+	CombineWindow       time.Duration // Сколько ждать продолжения при /combine on (COMBINE_WINDOW)
+
+	DailyMessageLimits map[string]int // Ответов в день по тарифам, например free=50 (DAILY_MESSAGE_LIMITS)
+	DailyTokenLimits   map[string]int // Токенов в день по тарифам, например free=20000 (DAILY_TOKEN_LIMITS)
+
+	TimeInPrompt    bool           // Добавлять текущие дату и время в системный промпт (TIME_IN_PROMPT, по умолчанию да)
+	DefaultLocation *time.Location // Часовая зона для пользователей без своей (DEFAULT_TIMEZONE)
+
+	ReactionSuccess string // Реакция на сообщение, когда ответ готов (REACTION_SUCCESS)
+	ReactionFailure string // Реакция при ошибке (REACTION_FAILURE)
+	CooldownNotice  string // Как сообщать о паузе /cooldown в группе: reaction или reply (CHAT_COOLDOWN_NOTICE)
+
+	AITimeout        time.Duration // Общий таймаут запроса к AI (AI_TIMEOUT)
+	AIConnectTimeout time.Duration // Таймаут установки соединения с AI (AI_CONNECT_TIMEOUT)
+	TGPollTimeout    time.Duration // Таймаут long polling Telegram (TG_POLL_TIMEOUT)
+	ProbeInterval    time.Duration // Как часто проверять доступность модели в фоне, 0 - не проверять (PROBE_INTERVAL)
+
+	OTLPEndpoint     string  // Куда отправлять трейсы по OTLP/HTTP, пусто - трейсинг выключен (OTEL_EXPORTER_OTLP_ENDPOINT)
+	TraceSampleRatio float64 // Доля записываемых трейсов 0..1 (TRACE_SAMPLE_RATIO)
+
+	SkipPendingUpdates bool          // Отбросить накопившиеся за простой обновления при запуске (SKIP_PENDING_UPDATES)
+	MaxUpdateAge       time.Duration // Не отвечать на сообщения старше этого, 0 - отвечать на все (MAX_UPDATE_AGE)
+
+	TelegramProxy *url.URL // Прокси для Telegram (TELEGRAM_PROXY, иначе HTTPS_PROXY/ALL_PROXY)
+	AIProxy       *url.URL // Прокси для AI (AI_PROXY, иначе HTTPS_PROXY/ALL_PROXY)
+
+	TelegramAPIEndpoint string // Адрес собственного сервера Bot API, например http://localhost:8081 (пусто - api.telegram.org)
+
+	WebhookURL    string // Публичный адрес для вебхуков, например https://bot.example.com; пусто - long polling (WEBHOOK_URL)
+	WebhookListen string // Адрес, на котором слушает сервер вебхуков (WEBHOOK_LISTEN)
+	WebhookSecret string // Секрет для заголовка X-Telegram-Bot-Api-Secret-Token, пусто - случайный при запуске (WEBHOOK_SECRET)
+
+	MaintenanceHour      int // Час (0-23, локальное время), когда запускается чистка базы (MAINTENANCE_HOUR)
+	HistoryRetentionDays int // Сколько дней хранить историю, 0 - бессрочно (HISTORY_RETENTION_DAYS)
+	LogRetentionDays     int // Сколько дней хранить журналы, 0 - бессрочно; ошибки - не дольше 30 дней (LOG_RETENTION_DAYS)
+	BackupHour           int // Час ежедневного бэкапа в админский чат, -1 - выключено (BACKUP_HOUR)
+
+	BackupInterval   time.Duration // Как часто сохранять копию базы на диск, 0 - не сохранять (BACKUP_INTERVAL)
+	BackupRetain     int           // Сколько последних копий хранить (BACKUP_RETAIN)
+	BackupDir        string        // Каталог для копий (BACKUP_DIR)
+	BackupToTelegram bool          // Отправлять сохранённую копию в админский чат (BACKUP_TO_TELEGRAM)
+
+	EnableTools bool // Разрешить модели вызывать встроенные инструменты (ENABLE_TOOLS)
+
+	SystemPromptPrefix string // Общая основа системного промпта всех стилей; /prompt_prefix её переопределяет (SYSTEM_PROMPT_PREFIX)
+
+	CostPerMillionTokens float64 // Цена миллиона токенов в долларах для оценки расходов, 0 - не считать (COST_PER_1M_TOKENS)
+
+	Sampling SamplingParams // Параметры генерации по умолчанию (TOP_P, PRESENCE_PENALTY, FREQUENCY_PENALTY, STOP_SEQUENCES)
+
+	ModerationBlocklist  string        // Файл с регулярками запрещённого в ответах (MODERATION_BLOCKLIST)
+	ModerationURL        string        // OpenAI-совместимый эндпоинт модерации (MODERATION_URL)
+	ModerationTimeout    time.Duration // Сколько модерация может добавить к ответу (MODERATION_TIMEOUT)
+	ModerationFailClosed bool          // Блокировать ответ, если модерация недоступна (MODERATION_FAIL_CLOSED)
+
+	EmbeddingsURL   string // OpenAI-совместимый эндпоинт /embeddings для базы знаний, пусто - /kb выключена (EMBEDDINGS_URL)
+	EmbeddingsModel string // Модель эмбеддингов (EMBEDDINGS_MODEL)
+
+	STTURL              string        // OpenAI-совместимый эндпоинт /audio/transcriptions, пусто - голосовые не распознаются (STT_URL)
+	STTModel            string        // Модель распознавания речи (STT_MODEL)
+	AudioMaxDuration    time.Duration // Самая длинная запись, которую бот берётся расшифровать (AUDIO_MAX_DURATION)
+	AudioMaxSize        int           // Самый большой аудиофайл в байтах (AUDIO_MAX_SIZE_MB)
+	AudioCostMultiplier float64       // Во сколько раз токены расшифровки дороже обычных для дневного бюджета (AUDIO_COST_MULTIPLIER)
+	FFmpegPath          string        // Путь к ffmpeg для нарезки длинных записей, пусто - не резать (FFMPEG_PATH)
 }
 
 // ChatMessage представляет сообщение в диалоге (роль и содержимое)
 type ChatMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`   // Вызовы инструментов в ответе модели
+	ToolCallID string     `json:"tool_call_id,omitempty"` // Для role=tool: на какой вызов это результат
 }
 
 // OpenAIRequest - структура запроса, совместимая с OpenAI-подобными API
@@ -45,76 +128,650 @@ type OpenAIRequest struct {
 	Messages  []ChatMessage `json:"messages"`
 	Stream    bool          `json:"stream"`
 	MaxTokens int           `json:"max_tokens"`
+	Tools     []Tool        `json:"tools,omitempty"`
+	SamplingParams
+
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"` // {"type":"json_object"} для /json
 	// Temperature float64       `json:"temperature"` // Не все Hugging Face API поддерживают это напрямую в таком формате, но можно оставить
 }
 
 // Choice представляет один из вариантов ответа AI
 type Choice struct {
-	Message ChatMessage `json:"message"`
+	Message      ChatMessage `json:"message"`
+	FinishReason string      `json:"finish_reason"`
+}
+
+// Usage - статистика по токенам, которую возвращает API
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
 }
 
 // ChatResponse - структура ответа от AI
 type ChatResponse struct {
+	Model   string   `json:"model"`
 	Choices []Choice `json:"choices"`
+	Usage   Usage    `json:"usage"`
+}
+
+// AIResponse - результат запроса к AI вместе с данными о времени и токенах
+type AIResponse struct {
+	Content   string
+	ToolCalls []ToolCall // Модель просит вызвать инструменты вместо ответа
+	Model     string
+	Seed      *int64 // Seed, с которым выполнен запрос (nil - без seed)
+	Usage     Usage
+	Duration  time.Duration
+
+	RawRequest  []byte // Сериализованный OpenAIRequest (для режима отладки)
+	RawResponse []byte // Тело ответа API как есть
 }
 
 // Bot содержит конфигурацию, API-клиенты и соединение с БД
 type Bot struct {
-	config *Config
+	config atomic.Pointer[Config] // Текущая конфигурация; по SIGHUP подменяется целиком (см. cfg)
 	api    *tgbotapi.BotAPI
 	db     *sql.DB // Добавлено соединение с БД
+	botID  int64   // Разделитель данных в общей базе: 0 у основного бота, Telegram ID у остальных
+	name   string  // Username бота для логов и уведомлений
+
+	commands    map[string]*Command       // Реестр команд по имени
+	commandList []*Command                // Команды в порядке регистрации
+	callbacks   map[string]*CallbackRoute // Обработчики inline-кнопок по действию
+	handler     UpdateHandler             // Маршрутизатор, обёрнутый в middleware
+	queues      *userQueues               // Очереди обновлений по пользователям
+	aiClient    *http.Client              // Общий HTTP-клиент для запросов к AI
+
+	debugMu    sync.Mutex
+	debugUsers map[int64]bool // Админы с включённым /debug (только в памяти)
+
+	stmts           *statements      // Подготовленные запросы горячего пути
+	ftsEnabled      bool             // SQLite собран с FTS5, /search использует полнотекстовый индекс
+	pendingMemories *pendingMemories // Факты, ожидающие подтверждения "Сохранить в память?"
+	session         *sessionHistory  // История пользователей в строгом режиме приватности
+
+	tools map[string]*registeredTool // Инструменты, которые может вызвать модель (пусто - выключены)
+
+	blocklist []blockRule   // Правила модерации ответов из MODERATION_BLOCKLIST
+	metrics   *metrics      // Счётчики событий с момента запуска
+	today     *dailyMetrics // Счётчики за текущие сутки
+	startedAt time.Time     // Время запуска (для аптайма)
+
+	chatAdminCache *chatAdminCache  // Администраторы групп для команд с настройками чата
+	errorReporter  *errorReporter   // Ограничитель уведомлений об ошибках в админский чат
+	breaker        *circuitBreaker  // Перестаёт обращаться к модели после серии сбоев
+	probeState     *probeState      // Результат последней фоновой проверки модели
+	pendingMu      sync.Mutex       // Фоновый проход очереди и кнопка "Повторить" не должны ответить дважды
+	activity       *activityTracker // Активность пользователей, ещё не записанная в базу
+
+	templates       []*PromptTemplate // Библиотека шаблонов из templates.json
+	inspirations    []inspiration     // Встроенные идеи для /random из inspirations.json
+	templateDialogs *templateDialogs  // Незаконченные заполнения шаблонов
+	combiner        *inputCombiner    // Быстрые сообщения подряд, ждущие склейки (/combine)
+	kbUploads       *kbUploads        // Кто после /kb add присылает файлы в базу знаний
+	statusCooldown  *userCooldown     // Ограничитель частоты /status
+	chatCooldowns   *chatCooldowns    // Когда бот последний раз отвечал в группах с /cooldown
+	quotes          *quoteCache       // Цитаты из сырых обновлений, ждущие обработки
+	lastAnswers     *lastAnswers      // Последние ответы, которые можно переделать на месте
+	stopPolling     chan struct{}     // Закрывается при остановке long polling
+}
+
+// newBot создаёт бота, регистрирует команды и собирает цепочку middleware
+func newBot(config *Config, api *tgbotapi.BotAPI, db *sql.DB, aiClient *http.Client) (*Bot, error) {
+	stmts, err := prepareStatements(db)
+	if err != nil {
+		return nil, err
+	}
+	ftsEnabled, err := setupFullTextSearch(db)
+	if err != nil {
+		return nil, err
+	}
+	if !ftsEnabled {
+		log.Printf("SQLite собран без FTS5, /search будет искать через LIKE (соберите с -tags sqlite_fts5)")
+	}
+	templates, err := loadTemplates(templatesJSON)
+	if err != nil {
+		return nil, err
+	}
+	inspirations, err := loadInspirations(inspirationsJSON)
+	if err != nil {
+		return nil, err
+	}
+	var blocklist []blockRule
+	if config.ModerationBlocklist != "" {
+		if blocklist, err = loadBlocklist(config.ModerationBlocklist); err != nil {
+			return nil, err
+		}
+	}
+
+	b := &Bot{
+		api:   api,
+		db:    db,
+		stmts: stmts,
+
+		ftsEnabled: ftsEnabled,
+
+		aiClient:   aiClient,
+		debugUsers: make(map[int64]bool),
+
+		pendingMemories: &pendingMemories{facts: make(map[string]pendingMemory)},
+		session:         newSessionHistory(maxContextTurns * 2),
+
+		blocklist: blocklist,
+		metrics:   newMetrics(),
+		today:     newDailyMetrics(),
+		startedAt: time.Now(),
+
+		chatAdminCache: newChatAdminCache(),
+		errorReporter:  newErrorReporter(),
+		breaker:        &circuitBreaker{},
+		probeState:     &probeState{},
+		activity:       newActivityTracker(),
+
+		templates:       templates,
+		inspirations:    inspirations,
+		templateDialogs: newTemplateDialogs(),
+		combiner:        newInputCombiner(config.CombineWindow),
+		kbUploads:       newKBUploads(),
+		statusCooldown:  newUserCooldown(statusCooldown),
+		chatCooldowns:   newChatCooldowns(),
+		quotes:          newQuoteCache(),
+		lastAnswers:     newLastAnswers(),
+		stopPolling:     make(chan struct{}),
+	}
+	b.config.Store(config)
+	if api != nil {
+		b.name = api.Self.UserName
+	}
+	b.registerCommands()
+	b.registerCallbacks()
+	b.registerTools()
+	b.handler = chainMiddlewares(b.routeUpdate,
+		b.tracingMiddleware,
+		b.loggingMiddleware,
+		b.recoveryMiddleware,
+		b.staleUpdateMiddleware,
+		b.privateOnlyMiddleware,
+		b.trackUserMiddleware,
+		b.inviteMiddleware,
+	)
+	b.queues = newUserQueues(b.handleUpdate, userQueueSize, userQueueIdleTimeout)
+	b.queues.full = b.notifyQueueFull
+	return b, nil
 }
 
 func main() {
-	config := loadConfig()
+	replMode := flag.Bool("repl", false, "Локальный режим без Telegram: сообщения из stdin, ответы в stdout (или MODE=cli)")
+	flag.Parse()
+
+	config, err := loadConfig()
+	if err != nil {
+		log.Fatalf("Ошибка конфигурации: %v", err)
+	}
+
+	if *replMode || os.Getenv("MODE") == "cli" {
+		if err := runREPL(config, os.Stdin, os.Stdout); err != nil {
+			log.Fatalf("Ошибка REPL: %v", err)
+		}
+		return
+	}
+
+	if len(config.TelegramBotTokens) == 0 || config.HuggingFaceAPIToken == "" {
+		log.Fatal("Ошибка: Установите TELEGRAM_BOT_TOKEN (или TELEGRAM_BOT_TOKENS) и HF_API_TOKEN в файле .env")
+	}
 
-	if config.TelegramBotToken == "" || config.HuggingFaceAPIToken == "" {
-		log.Fatal("Ошибка: Установите TELEGRAM_BOT_TOKEN и HF_API_TOKEN в файле .env")
+	shutdownTracing, err := setupTracing(context.Background(), config)
+	if err != nil {
+		log.Fatalf("Ошибка настройки трейсинга: %v", err)
 	}
+	defer shutdownTracing(context.Background()) // Досылаем последние спаны при остановке
 
 	// Инициализация базы данных
 	db, err := initDB()
 	if err != nil {
 		log.Fatalf("Ошибка инициализации базы данных: %v", err)
 	}
-	defer db.Close() // Убедитесь, что соединение с базой данных закрыто
+	defer closeDB(db) // Перед закрытием переносим WAL в основной файл
 
-	// Инициализация бота Telegram
-	api, err := tgbotapi.NewBotAPI(config.TelegramBotToken)
+	// Инициализация бота Telegram. Таймаут клиента чуть больше long polling,
+	// чтобы getUpdates не обрывался раньше, чем ответит Telegram
+	tgClient, err := newHTTPClient(config.TGPollTimeout+10*time.Second, config.AIConnectTimeout, config.TelegramProxy)
+	if err != nil {
+		log.Fatalf("Ошибка создания HTTP-клиента Telegram: %v", err)
+	}
+	aiClient, err := newHTTPClient(config.AITimeout, config.AIConnectTimeout, config.AIProxy)
 	if err != nil {
-		log.Fatalf("Ошибка создания бота: %v", err)
+		log.Fatalf("Ошибка создания HTTP-клиента AI: %v", err)
 	}
+	log.Printf("Telegram: %s, AI: %s", describeProxy(config.TelegramProxy), describeProxy(config.AIProxy))
 
-	bot := &Bot{
-		config: config,
-		api:    api,
-		db:     db, // Присваиваем соединение с БД
+	if config.TelegramAPIEndpoint != "" {
+		log.Printf("Используется собственный сервер Bot API: %s", config.TelegramAPIEndpoint)
 	}
 
-	log.Printf("Бот запущен: @%s", api.Self.UserName)
+	// По боту на токен: база и AI-клиент общие, разговоры разделены по bot_id
+	var bots []*Bot
+	for i, token := range config.TelegramBotTokens {
+		api, err := tgbotapi.NewBotAPIWithClient(token, apiEndpointFormat(config.TelegramAPIEndpoint), tgClient)
+		if err != nil {
+			log.Fatalf("Ошибка создания бота №%d: %v", i+1, err)
+		}
+		bot, err := newBot(config, api, db, aiClient)
+		if err != nil {
+			log.Fatalf("Ошибка инициализации бота @%s: %v", api.Self.UserName, err)
+		}
+		// Первый бот остаётся основным: его разговоры лежат с bot_id = 0, как до появления нескольких ботов
+		if i > 0 {
+			bot.botID = api.Self.ID
+		}
+		bots = append(bots, bot)
+		log.Printf("Бот запущен: @%s, версия %s (%s)", api.Self.UserName, version, commit)
+	}
 
-	// Настройка обновлений
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
+	// Обслуживание и бэкапы касаются всей базы, поэтому их ведёт только основной бот
+	go bots[0].maintenanceLoop()
+	if config.BackupHour >= 0 {
+		go bots[0].backupLoop()
+	}
+	if config.BackupInterval > 0 {
+		go bots[0].scheduledBackupLoop()
+	}
+	for _, bot := range bots {
+		go bot.pendingLoop()
+		go bot.activityLoop()
+		go bot.schedulerLoop()
+	}
+	if bots[0].embeddingsEnabled() {
+		go bots[0].recallLoop() // История общая, векторизовать её достаточно одному боту
+	}
 
-	updates := api.GetUpdatesChan(u)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go reloadOnSIGHUP(ctx, bots)
 
-	// Обработка обновлений
-	for update := range updates {
-		bot.handleUpdate(update)
+	var wg sync.WaitGroup
+	for _, bot := range bots {
+		go bot.publishCommands()
+	}
+	if config.ProbeInterval > 0 {
+		// Модель у всех ботов общая, проверять её достаточно основному
+		go bots[0].probeLoop(ctx)
+	}
+	if config.WebhookURL != "" {
+		// Вебхуки: сервер сам завершается по отмене ctx
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := serveWebhooks(ctx, bots, config); err != nil {
+				log.Printf("Вебхуки остановлены с ошибкой: %v", err)
+				stop()
+			}
+		}()
+	} else {
+		for _, bot := range bots {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				bot.pollUpdates()
+			}()
+		}
+	}
+
+	// Общая остановка: по сигналу все боты перестают получать обновления, затем закрывается база
+	<-ctx.Done()
+	log.Printf("Получен сигнал остановки, завершаю работу...")
+	if config.WebhookURL == "" {
+		for _, bot := range bots {
+			close(bot.stopPolling)
+		}
+	}
+	wg.Wait()
+	for _, bot := range bots {
+		bot.flushAllInput()
+		bot.flushActivity(true)
+	}
+}
+
+// pollUpdates получает обновления через long polling и раскладывает их по очередям пользователей.
+// getUpdates вызывается напрямую, а не через GetUpdatesChan: из сырого ответа достаются поля,
+// которых нет в tgbotapi (цитаты). Возвращается после закрытия stopPolling.
+func (b *Bot) pollUpdates() {
+	// После работы на вебхуках getUpdates не работает, пока вебхук не снят
+	if info, err := b.api.GetWebhookInfo(); err == nil && info.IsSet() {
+		if _, err := b.api.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+			log.Printf("@%s: не удалось снять вебхук: %v", b.name, err)
+		}
+	}
+
+	offset := 0
+	if b.cfg().SkipPendingUpdates {
+		var err error
+		if offset, err = skipPendingUpdates(b.api); err != nil {
+			log.Printf("@%s: не удалось пропустить накопившиеся обновления: %v", b.name, err)
+		}
+	}
+	u := tgbotapi.NewUpdate(offset)
+	u.Timeout = int(b.cfg().TGPollTimeout.Seconds())
+
+	for {
+		select {
+		case <-b.stopPolling:
+			return
+		default:
+		}
+
+		resp, err := b.api.Request(u)
+		var updates []tgbotapi.Update
+		if err == nil {
+			err = json.Unmarshal(resp.Result, &updates)
+		}
+		if err != nil {
+			log.Printf("@%s: ошибка получения обновлений, повтор через 3 секунды: %v", b.name, err)
+			time.Sleep(3 * time.Second)
+			continue
+		}
+		b.quotes.addFromUpdates(resp.Result)
+
+		// Обработка обновлений: по очереди на пользователя, пользователи параллельно
+		for _, update := range updates {
+			if update.UpdateID >= u.Offset {
+				u.Offset = update.UpdateID + 1
+				b.queues.Push(updateQueueKey(update), update)
+			}
+		}
 	}
 }
 
 // loadConfig загружает конфигурацию из переменных окружения или .env файла
-func loadConfig() *Config {
-	err := godotenv.Load()
-	if err != nil {
+func loadConfig() (*Config, error) {
+	if err := godotenv.Load(); err != nil {
 		fmt.Println("Предупреждение: .env файл не найден, используя переменные окружения")
 	}
+	return parseConfig()
+}
 
-	return &Config{
-		TelegramBotToken:    os.Getenv("TELEGRAM_BOT_TOKEN"),
+// parseConfig собирает и проверяет конфигурацию из переменных окружения
+func parseConfig() (*Config, error) {
+	var err error
+	config := &Config{
+		TelegramBotTokens:   parseTokenList(os.Getenv("TELEGRAM_BOT_TOKENS"), os.Getenv("TELEGRAM_BOT_TOKEN")),
 		HuggingFaceAPIToken: os.Getenv("HF_API_TOKEN"), // Используем HF_API_TOKEN из .env
+		AdminIDs:            parseIDList(os.Getenv("ADMIN_IDS")),
+		AdminChatID:         parseAdminChatID(os.Getenv("ADMIN_CHAT_ID")),
+		TelegramAPIEndpoint: strings.TrimSpace(os.Getenv("TELEGRAM_API_ENDPOINT")),
+		AutoSummaryChannels: parseIDList(os.Getenv("AUTO_SUMMARY_CHANNELS")),
+		PrivateOnly:         boolEnv("PRIVATE_ONLY"),
+		InviteOnly:          boolEnv("INVITE_ONLY"),
+		EnableTools:         boolEnv("ENABLE_TOOLS"),
+		SystemPromptPrefix:  strings.TrimSpace(os.Getenv("SYSTEM_PROMPT_PREFIX")),
+		SkipPendingUpdates:  boolEnv("SKIP_PENDING_UPDATES"),
+		OTLPEndpoint:        strings.TrimSpace(os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")),
+
+		ModerationBlocklist:  strings.TrimSpace(os.Getenv("MODERATION_BLOCKLIST")),
+		ModerationURL:        strings.TrimSpace(os.Getenv("MODERATION_URL")),
+		ModerationFailClosed: boolEnv("MODERATION_FAIL_CLOSED"),
+		EmbeddingsURL:        strings.TrimSpace(os.Getenv("EMBEDDINGS_URL")),
+		WebhookURL:           strings.TrimSpace(os.Getenv("WEBHOOK_URL")),
+		WebhookListen:        envOrDefault("WEBHOOK_LISTEN", ":8443"),
+		WebhookSecret:        strings.TrimSpace(os.Getenv("WEBHOOK_SECRET")),
+		EmbeddingsModel:      envOrDefault("EMBEDDINGS_MODEL", "intfloat/multilingual-e5-large"),
+		STTURL:               strings.TrimSpace(os.Getenv("STT_URL")),
+		STTModel:             envOrDefault("STT_MODEL", "openai/whisper-large-v3"),
+		FFmpegPath:           strings.TrimSpace(os.Getenv("FFMPEG_PATH")),
+		ReactionSuccess:      envOrDefault("REACTION_SUCCESS", "👌"),
+		ReactionFailure:      envOrDefault("REACTION_FAILURE", "🤷"),
+		CooldownNotice:       envOrDefault("CHAT_COOLDOWN_NOTICE", cooldownNoticeReaction),
+	}
+
+	if config.AITimeout, err = durationEnv("AI_TIMEOUT", 90*time.Second); err != nil {
+		return nil, err
+	}
+	if config.AIConnectTimeout, err = durationEnv("AI_CONNECT_TIMEOUT", 10*time.Second); err != nil {
+		return nil, err
+	}
+	if config.TGPollTimeout, err = durationEnv("TG_POLL_TIMEOUT", 60*time.Second); err != nil {
+		return nil, err
+	}
+	if config.AIConnectTimeout > config.AITimeout {
+		return nil, fmt.Errorf("AI_CONNECT_TIMEOUT (%s) не может быть больше AI_TIMEOUT (%s)", config.AIConnectTimeout, config.AITimeout)
+	}
+	if config.TelegramProxy, err = proxyFromEnv("TELEGRAM_PROXY"); err != nil {
+		return nil, err
+	}
+	if config.AIProxy, err = proxyFromEnv("AI_PROXY"); err != nil {
+		return nil, err
+	}
+	if config.TelegramAPIEndpoint != "" {
+		endpoint, err := url.Parse(config.TelegramAPIEndpoint)
+		if err != nil || endpoint.Host == "" || (endpoint.Scheme != "http" && endpoint.Scheme != "https") {
+			return nil, fmt.Errorf("некорректный TELEGRAM_API_ENDPOINT=%q: ожидается адрес вида http://localhost:8081", config.TelegramAPIEndpoint)
+		}
+	}
+	if config.WebhookURL != "" && !strings.HasPrefix(config.WebhookURL, "https://") {
+		return nil, fmt.Errorf("WEBHOOK_URL должен начинаться с https://, получено %q", config.WebhookURL)
+	}
+	if !webhookSecretPattern.MatchString(config.WebhookSecret) {
+		return nil, fmt.Errorf("WEBHOOK_SECRET может содержать только A-Z, a-z, 0-9, _ и - (до 256 символов)")
+	}
+	if config.TGPollTimeout < time.Second {
+		return nil, fmt.Errorf("TG_POLL_TIMEOUT должен быть не меньше секунды, получено %s", config.TGPollTimeout)
+	}
+	if config.CooldownNotice != cooldownNoticeReaction && config.CooldownNotice != cooldownNoticeReply {
+		return nil, fmt.Errorf("CHAT_COOLDOWN_NOTICE должен быть reaction или reply, получено %q", config.CooldownNotice)
+	}
+	if config.MaintenanceHour, err = intEnv("MAINTENANCE_HOUR", 4, 0, 23); err != nil {
+		return nil, err
+	}
+	if config.HistoryRetentionDays, err = intEnv("HISTORY_RETENTION_DAYS", 180, 0, 36500); err != nil {
+		return nil, err
+	}
+	if config.LogRetentionDays, err = intEnv("LOG_RETENTION_DAYS", 30, 0, 36500); err != nil {
+		return nil, err
+	}
+	if config.TrialMessages, err = intEnv("TRIAL_MESSAGES", 5, 0, 1000); err != nil {
+		return nil, err
+	}
+	config.TimeInPrompt = os.Getenv("TIME_IN_PROMPT") == "" || boolEnv("TIME_IN_PROMPT")
+	timezone := envOrDefault("DEFAULT_TIMEZONE", "Europe/Moscow")
+	if config.DefaultLocation, err = time.LoadLocation(timezone); err != nil {
+		return nil, fmt.Errorf("некорректный DEFAULT_TIMEZONE=%q: %w", timezone, err)
+	}
+	if config.CombineWindow, err = durationEnv("COMBINE_WINDOW", 2500*time.Millisecond); err != nil {
+		return nil, err
+	}
+	if config.CombineWindow <= 0 || config.CombineWindow > 30*time.Second {
+		return nil, fmt.Errorf("COMBINE_WINDOW должен быть больше 0 и не больше 30s, получено %s", config.CombineWindow)
+	}
+	if config.MaxUpdateAge, err = durationEnv("MAX_UPDATE_AGE", 0); err != nil {
+		return nil, err
+	}
+	if config.ModerationTimeout, err = durationEnv("MODERATION_TIMEOUT", 2*time.Second); err != nil {
+		return nil, err
+	}
+	if config.Sampling, err = samplingFromEnv(); err != nil {
+		return nil, err
+	}
+	if config.TraceSampleRatio, err = traceSampleRatioFromEnv(); err != nil {
+		return nil, err
+	}
+	if config.CostPerMillionTokens, err = floatEnv("COST_PER_1M_TOKENS", 0, 0, 1000); err != nil {
+		return nil, err
+	}
+	if config.DailyMessageLimits, err = tierLimitsEnv("DAILY_MESSAGE_LIMITS"); err != nil {
+		return nil, err
+	}
+	if config.DailyTokenLimits, err = tierLimitsEnv("DAILY_TOKEN_LIMITS"); err != nil {
+		return nil, err
+	}
+	if config.AudioMaxDuration, err = durationEnv("AUDIO_MAX_DURATION", 2*time.Hour); err != nil {
+		return nil, err
+	}
+	audioMaxSizeMB, err := intEnv("AUDIO_MAX_SIZE_MB", 20, 1, 2000)
+	if err != nil {
+		return nil, err
+	}
+	config.AudioMaxSize = audioMaxSizeMB << 20
+	if config.AudioCostMultiplier, err = floatEnv("AUDIO_COST_MULTIPLIER", 1, 0, 100); err != nil {
+		return nil, err
+	}
+	if config.ProbeInterval, err = durationEnv("PROBE_INTERVAL", 5*time.Minute); err != nil {
+		return nil, err
+	}
+	if config.ProbeInterval != 0 && config.ProbeInterval < 30*time.Second {
+		return nil, fmt.Errorf("PROBE_INTERVAL должен быть 0 или не меньше 30s, получено %s", config.ProbeInterval)
+	}
+	if config.BackupHour, err = intEnv("BACKUP_HOUR", -1, -1, 23); err != nil {
+		return nil, err
+	}
+	if config.BackupHour >= 0 && config.AdminChatID == 0 {
+		return nil, fmt.Errorf("BACKUP_HOUR требует ADMIN_CHAT_ID: бэкапу некуда уходить")
+	}
+	if config.BackupInterval, err = durationEnv("BACKUP_INTERVAL", 0); err != nil {
+		return nil, err
+	}
+	if config.BackupInterval != 0 && config.BackupInterval < time.Minute {
+		return nil, fmt.Errorf("BACKUP_INTERVAL должен быть 0 или не меньше 1m, получено %s", config.BackupInterval)
+	}
+	if config.BackupRetain, err = intEnv("BACKUP_RETAIN", 7, 1, 1000); err != nil {
+		return nil, err
+	}
+	config.BackupDir = envOrDefault("BACKUP_DIR", "backups")
+	config.BackupToTelegram = boolEnv("BACKUP_TO_TELEGRAM")
+	if config.BackupToTelegram && config.AdminChatID == 0 {
+		return nil, fmt.Errorf("BACKUP_TO_TELEGRAM требует ADMIN_CHAT_ID: копии некуда уходить")
+	}
+
+	return config, nil
+}
+
+// envOrDefault возвращает значение переменной окружения или значение по умолчанию
+func envOrDefault(name, def string) string {
+	if value := strings.TrimSpace(os.Getenv(name)); value != "" {
+		return value
+	}
+	return def
+}
+
+// intEnv читает целое число из переменной окружения и проверяет, что оно в пределах [lo, hi]
+func intEnv(name string, def, lo, hi int) (int, error) {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("некорректное значение %s=%q: %w", name, value, err)
+	}
+	if n < lo || n > hi {
+		return 0, fmt.Errorf("%s должен быть от %d до %d, получено %d", name, lo, hi, n)
+	}
+	return n, nil
+}
+
+// floatEnv читает дробное число из переменной окружения и проверяет, что оно в пределах [lo, hi]
+func floatEnv(name string, def, lo, hi float64) (float64, error) {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("некорректное значение %s=%q: %w", name, value, err)
+	}
+	if n < lo || n > hi {
+		return 0, fmt.Errorf("%s должен быть от %g до %g, получено %g", name, lo, hi, n)
+	}
+	return n, nil
+}
+
+// boolEnv читает логический флаг из переменной окружения ("true", "1", "yes")
+func boolEnv(name string) bool {
+	value, err := strconv.ParseBool(strings.TrimSpace(os.Getenv(name)))
+	if err != nil {
+		return strings.EqualFold(strings.TrimSpace(os.Getenv(name)), "yes")
+	}
+	return value
+}
+
+// durationEnv читает длительность из переменной окружения ("90s", "2m"); пустое значение - значение по умолчанию
+func durationEnv(name string, def time.Duration) (time.Duration, error) {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("некорректное значение %s=%q: %w", name, value, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("%s должен быть положительным, получено %s", name, d)
+	}
+	return d, nil
+}
+
+// parseAdminChatID разбирает ADMIN_CHAT_ID; пустое или некорректное значение отключает уведомления
+func parseAdminChatID(value string) int64 {
+	ids := parseIDList(value)
+	if len(ids) == 0 {
+		return 0
+	}
+	return ids[0]
+}
+
+// parseIDList разбирает список ID через запятую, пропуская некорректные значения
+func parseIDList(value string) []int64 {
+	var ids []int64
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			log.Printf("Предупреждение: некорректный ID %q в списке, пропускаю", part)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// parseTokenList разбирает список токенов через запятую; если список пуст, используется одиночный токен
+func parseTokenList(list, single string) []string {
+	var tokens []string
+	for _, part := range strings.Split(list, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			tokens = append(tokens, part)
+		}
+	}
+	if len(tokens) == 0 && strings.TrimSpace(single) != "" {
+		tokens = append(tokens, strings.TrimSpace(single))
+	}
+	return tokens
+}
+
+// isAdmin проверяет, входит ли пользователь в список администраторов
+func (b *Bot) isAdmin(userID int64) bool {
+	for _, id := range b.cfg().AdminIDs {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// notifyAdmin отправляет служебное сообщение в админский чат, если он настроен
+func (b *Bot) notifyAdmin(text string) {
+	if b.cfg().AdminChatID == 0 {
+		return
+	}
+	if len(b.cfg().TelegramBotTokens) > 1 {
+		text = "@" + b.name + ": " + text
+	}
+	msg := tgbotapi.NewMessage(b.cfg().AdminChatID, text)
+	if _, err := b.api.Send(msg); err != nil {
+		log.Printf("Ошибка отправки уведомления администратору: %v", err)
 	}
 }
 
@@ -125,11 +782,28 @@ func initDB() (*sql.DB, error) {
 	if err != nil {
 		return nil, fmt.Errorf("ошибка создания папки базы данных: %w", err)
 	}
+	return openDB(DBPATH)
+}
 
-	db, err := sql.Open("sqlite3", DBPATH)
+// openDB открывает базу по пути path и доводит схему до текущей (тесты открывают так временную базу)
+func openDB(path string) (*sql.DB, error) {
+	// WAL позволяет читать во время записи, busy_timeout ждёт блокировку вместо "database is locked",
+	// а _txlock=immediate берёт блокировку на запись в начале транзакции, чтобы её не пришлось повышать
+	dsn := "file:" + path + "?_journal_mode=WAL&_busy_timeout=5000&_synchronous=NORMAL&_foreign_keys=on&_txlock=immediate"
+	db, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка открытия базы данных: %w", err)
 	}
+	// SQLite всё равно пишет в один поток; одно соединение исключает конкуренцию писателей
+	db.SetMaxOpenConns(1)
+
+	// Проверяем базу до миграций: на повреждённом файле они падают с непонятными ошибками
+	if problems, err := quickCheck(db); err != nil {
+		log.Printf("ВНИМАНИЕ: не удалось проверить целостность базы: %v", err)
+	} else if len(problems) > 0 {
+		log.Printf("ВНИМАНИЕ: база %s повреждена, восстановите её из резервной копии. PRAGMA quick_check:\n%s",
+			path, strings.Join(problems, "\n"))
+	}
 
 	_, err = db.Exec(`
 		CREATE TABLE IF NOT EXISTS users (
@@ -140,9 +814,418 @@ func initDB() (*sql.DB, error) {
 	if err != nil {
 		return nil, fmt.Errorf("ошибка создания таблицы пользователей: %w", err)
 	}
+
+	// Вопросы для кнопки "Повторить" переросли в очередь отложенных ответов
+	if err := renameTableIfExists(db, "retries", "pending_requests"); err != nil {
+		return nil, err
+	}
+	for _, stmt := range schema {
+		if _, err := db.Exec(stmt); err != nil {
+			return nil, fmt.Errorf("ошибка создания схемы базы данных: %w", err)
+		}
+	}
+
+	// Колонки, добавленные после создания таблиц (для уже существующих баз)
+	for _, c := range columnMigrations {
+		if err := addColumnIfMissing(db, c.table, c.column, c.definition); err != nil {
+			return nil, err
+		}
+	}
+	for _, stmt := range indexMigrations {
+		if _, err := db.Exec(stmt); err != nil {
+			return nil, fmt.Errorf("ошибка создания индекса: %w", err)
+		}
+	}
+
+	// Старая история без разговоров переезжает в разговор по умолчанию
+	if err := migrateHistoryToConversations(db); err != nil {
+		return nil, err
+	}
 	return db, nil
 }
 
+// quickCheckLimit - сколько проблем показывать из PRAGMA quick_check
+const quickCheckLimit = 20
+
+// quickCheck запускает PRAGMA quick_check и возвращает найденные проблемы (пусто - база цела)
+func quickCheck(db *sql.DB) ([]string, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA quick_check(%d)", quickCheckLimit))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка проверки целостности базы: %w", err)
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return nil, fmt.Errorf("ошибка чтения результата проверки базы: %w", err)
+		}
+		if line != "ok" {
+			problems = append(problems, line)
+		}
+	}
+	return problems, rows.Err()
+}
+
+// closeDB переносит WAL в основной файл и закрывает базу. После этого users.db можно
+// копировать без файла -wal: иначе свежие записи при переносе на другой хост теряются.
+func closeDB(db *sql.DB) {
+	backupMu.Lock() // Дожидаемся копии базы, если она как раз снимается
+	defer backupMu.Unlock()
+
+	var busy, walPages, checkpointed int
+	err := db.QueryRow("PRAGMA wal_checkpoint(TRUNCATE)").Scan(&busy, &walPages, &checkpointed)
+	switch {
+	case err != nil:
+		log.Printf("Ошибка переноса WAL в базу: %v", err)
+	case busy != 0:
+		log.Printf("WAL перенесён не полностью: база занята (%d из %d страниц)", checkpointed, walPages)
+	default:
+		log.Printf("WAL перенесён в базу и очищен")
+	}
+	if err := db.Close(); err != nil {
+		log.Printf("Ошибка закрытия базы: %v", err)
+	}
+}
+
+// schema - остальные таблицы базы данных
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS chats (
+		chat_id INTEGER PRIMARY KEY,
+		reactions INTEGER DEFAULT 1
+	)`,
+	`CREATE TABLE IF NOT EXISTS memories (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		fact TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_memories_user ON memories (user_id)`,
+	`CREATE TABLE IF NOT EXISTS history (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		role TEXT NOT NULL,
+		content TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_history_user ON history (user_id, id)`,
+	`CREATE TABLE IF NOT EXISTS conversations (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		title TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		active INTEGER NOT NULL DEFAULT 0
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_conversations_user ON conversations (user_id, active)`,
+	`CREATE TABLE IF NOT EXISTS flagged (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		chat_id INTEGER NOT NULL,
+		category TEXT NOT NULL,
+		question TEXT NOT NULL DEFAULT '',
+		answer TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE TABLE IF NOT EXISTS bans (
+		user_id INTEGER PRIMARY KEY,
+		reason TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE TABLE IF NOT EXISTS left_chats (
+		chat_id INTEGER PRIMARY KEY,
+		left_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE TABLE IF NOT EXISTS pending_requests (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		chat_id INTEGER NOT NULL,
+		message_id INTEGER NOT NULL,
+		prompt TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE TABLE IF NOT EXISTS dead_letters (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		bot_id INTEGER NOT NULL DEFAULT 0,
+		user_id INTEGER NOT NULL,
+		chat_id INTEGER NOT NULL,
+		message_id INTEGER NOT NULL,
+		request TEXT NOT NULL,
+		error TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 1,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		resolved_at DATETIME
+	)`,
+	`CREATE TABLE IF NOT EXISTS usage (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		bot_id INTEGER NOT NULL DEFAULT 0,
+		user_id INTEGER NOT NULL,
+		chat_id INTEGER NOT NULL,
+		model TEXT NOT NULL DEFAULT '',
+		style TEXT NOT NULL DEFAULT '',
+		prompt_tokens INTEGER NOT NULL DEFAULT 0,
+		completion_tokens INTEGER NOT NULL DEFAULT 0,
+		queue_ms INTEGER NOT NULL DEFAULT 0,
+		ai_ms INTEGER NOT NULL DEFAULT 0,
+		total_ms INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_usage_created ON usage (created_at)`,
+	`CREATE INDEX IF NOT EXISTS idx_usage_user ON usage (user_id, created_at)`,
+	// Покрывающий индекс для /top: группировка по пользователю за окно без чтения самих строк
+	`CREATE INDEX IF NOT EXISTS idx_usage_top ON usage (created_at, user_id, prompt_tokens, completion_tokens)`,
+	`CREATE TABLE IF NOT EXISTS invite_codes (
+		code TEXT PRIMARY KEY,
+		max_uses INTEGER NOT NULL DEFAULT 1,
+		uses INTEGER NOT NULL DEFAULT 0,
+		expires_at DATETIME,
+		created_by INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE TABLE IF NOT EXISTS saved_prompts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		prompt TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (user_id, name)
+	)`,
+	`CREATE TABLE IF NOT EXISTS answer_pages (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		bot_id INTEGER NOT NULL DEFAULT 0,
+		user_id INTEGER NOT NULL,
+		chat_id INTEGER NOT NULL,
+		pages TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE TABLE IF NOT EXISTS kb_chunks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		source TEXT NOT NULL,
+		chunk_index INTEGER NOT NULL,
+		content TEXT NOT NULL,
+		embedding BLOB NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_kb_chunks_user ON kb_chunks (user_id, source)`,
+	`CREATE TABLE IF NOT EXISTS history_vectors (
+		history_id INTEGER PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		embedding BLOB NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_history_vectors_user ON history_vectors (user_id)`,
+	`CREATE TABLE IF NOT EXISTS reminders (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		bot_id INTEGER NOT NULL DEFAULT 0,
+		user_id INTEGER NOT NULL,
+		chat_id INTEGER NOT NULL,
+		kind TEXT NOT NULL,
+		payload TEXT NOT NULL DEFAULT '',
+		due_at DATETIME NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		delivered_at DATETIME
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_reminders_due ON reminders (due_at) WHERE delivered_at IS NULL`,
+	`CREATE TABLE IF NOT EXISTS settings (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE TABLE IF NOT EXISTS shared_pages (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		bot_id INTEGER NOT NULL DEFAULT 0,
+		user_id INTEGER NOT NULL,
+		chat_id INTEGER NOT NULL,
+		message_id INTEGER NOT NULL,
+		title TEXT NOT NULL,
+		content TEXT NOT NULL,
+		url TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_shared_pages_message ON shared_pages (chat_id, message_id)`,
+	`CREATE TABLE IF NOT EXISTS inspirations (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		category TEXT NOT NULL,
+		prompt TEXT NOT NULL,
+		added_by INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE TABLE IF NOT EXISTS inspiration_stats (
+		key TEXT PRIMARY KEY,
+		shown INTEGER NOT NULL DEFAULT 0,
+		used INTEGER NOT NULL DEFAULT 0,
+		hidden INTEGER NOT NULL DEFAULT 0
+	)`,
+	`CREATE TABLE IF NOT EXISTS subscriptions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		bot_id INTEGER NOT NULL DEFAULT 0,
+		user_id INTEGER NOT NULL,
+		chat_id INTEGER NOT NULL,
+		topic TEXT NOT NULL,
+		period TEXT NOT NULL,
+		clock TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_subscriptions_user ON subscriptions (user_id)`,
+	`CREATE TABLE IF NOT EXISTS topic_posts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		bot_id INTEGER NOT NULL DEFAULT 0,
+		topic TEXT NOT NULL,
+		period TEXT NOT NULL,
+		content TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_topic_posts_topic ON topic_posts (topic, period, id)`,
+	`CREATE TABLE IF NOT EXISTS errors (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		signature TEXT NOT NULL UNIQUE,
+		message TEXT NOT NULL,
+		handler TEXT NOT NULL DEFAULT '',
+		user_id INTEGER NOT NULL DEFAULT 0,
+		chat_id INTEGER NOT NULL DEFAULT 0,
+		update_id INTEGER NOT NULL DEFAULT 0,
+		count INTEGER NOT NULL DEFAULT 1,
+		first_seen DATETIME DEFAULT CURRENT_TIMESTAMP,
+		last_seen DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`,
+}
+
+// columnMigrations - колонки, добавленные в существующие таблицы
+var columnMigrations = []struct {
+	table, column, definition string
+}{
+	{"users", "show_latency", "INTEGER DEFAULT 0"},
+	{"users", "reply_lang", "TEXT DEFAULT ''"},
+	{"users", "use_name", "INTEGER DEFAULT 1"},
+	{"users", "privacy", "TEXT DEFAULT 'normal'"},
+	{"users", "context_turns", "INTEGER DEFAULT 10"},
+	{"history", "model", "TEXT DEFAULT ''"},
+	{"history", "imported", "INTEGER DEFAULT 0"},
+	{"history", "conversation_id", "INTEGER NOT NULL DEFAULT 0"},
+	{"conversations", "system_prompt", "TEXT NOT NULL DEFAULT ''"},
+	{"conversations", "bot_id", "INTEGER NOT NULL DEFAULT 0"},
+	{"pending_requests", "bot_id", "INTEGER NOT NULL DEFAULT 0"},
+	{"pending_requests", "notice_id", "INTEGER NOT NULL DEFAULT 0"},
+	{"errors", "request_id", "TEXT NOT NULL DEFAULT ''"},
+	{"users", "sampling", "TEXT DEFAULT ''"},
+	{"users", "seed", "INTEGER"},
+	{"users", "username", "TEXT DEFAULT ''"},
+	{"users", "first_name", "TEXT DEFAULT ''"},
+	{"users", "last_active", "DATETIME"},
+	{"users", "messages_today", "INTEGER DEFAULT 0"},
+	{"users", "tier", "TEXT DEFAULT 'free'"},
+	{"users", "approved", "INTEGER DEFAULT 0"},
+	{"users", "invite_code", "TEXT DEFAULT ''"},
+	{"users", "trial_used", "INTEGER DEFAULT 0"},
+	{"users", "created_at", "DATETIME"},
+	{"users", "paged_answers", "INTEGER DEFAULT 0"},
+	{"users", "referred_by", "INTEGER DEFAULT 0"},
+	{"users", "combine_input", "INTEGER DEFAULT 0"},
+	{"users", "timezone", "TEXT DEFAULT ''"},
+	{"users", "kb_auto", "INTEGER DEFAULT 0"},
+	{"users", "recall", "INTEGER DEFAULT 0"},
+	{"users", "city", "TEXT DEFAULT ''"},
+	{"users", "location_context", "INTEGER DEFAULT 0"},
+	{"users", "digest_time", "TEXT DEFAULT ''"},
+	{"users", "plain_text", "INTEGER DEFAULT 0"},
+	{"chats", "cooldown", "INTEGER DEFAULT 0"},
+	{"users", "ephemeral_ttl", "INTEGER DEFAULT 0"},
+	{"users", "quiet_hours", "TEXT DEFAULT ''"},
+	{"users", "quiet_silent", "INTEGER DEFAULT 0"},
+	{"reminders", "quiet_until", "DATETIME"},
+	{"saved_prompts", "uses", "INTEGER DEFAULT 0"},
+	{"users", "prompt_keyboard", "INTEGER DEFAULT 0"},
+}
+
+// indexMigrations - индексы и триггеры по колонкам из columnMigrations (создаются после них)
+var indexMigrations = []string{
+	`CREATE INDEX IF NOT EXISTS idx_users_last_active ON users (last_active)`,
+	`CREATE INDEX IF NOT EXISTS idx_users_created ON users (created_at)`,
+	// ALTER TABLE не умеет DEFAULT CURRENT_TIMESTAMP, поэтому дату создания ставит триггер -
+	// так она появляется при любом INSERT OR IGNORE INTO users
+	`CREATE TRIGGER IF NOT EXISTS users_created_at AFTER INSERT ON users WHEN NEW.created_at IS NULL BEGIN
+		UPDATE users SET created_at = CURRENT_TIMESTAMP WHERE user_id = NEW.user_id;
+	END`,
+	// Пользователям, заведённым до появления колонки, - дата первого сообщения в истории или последней активности
+	`UPDATE users SET created_at = COALESCE(
+		(SELECT MIN(history.created_at) FROM history WHERE history.user_id = users.user_id), last_active, CURRENT_TIMESTAMP)
+	WHERE created_at IS NULL`,
+	`CREATE INDEX IF NOT EXISTS idx_conversations_bot_user ON conversations (bot_id, user_id, active)`,
+}
+
+// statements - подготовленные запросы, которые выполняются на каждое сообщение
+type statements struct {
+	userStyle   *sql.Stmt
+	historyTail *sql.Stmt
+}
+
+// prepareStatements готовит запросы горячего пути; вызывается после миграций схемы
+func prepareStatements(db *sql.DB) (*statements, error) {
+	var s statements
+	var err error
+	if s.userStyle, err = db.Prepare("SELECT style FROM users WHERE user_id = ?"); err != nil {
+		return nil, fmt.Errorf("ошибка подготовки запроса стиля: %w", err)
+	}
+	s.historyTail, err = db.Prepare(`
+		SELECT role, content FROM (
+			SELECT id, role, content FROM history WHERE user_id = ? AND conversation_id = ? ORDER BY id DESC LIMIT ?
+		) ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подготовки запроса истории: %w", err)
+	}
+	return &s, nil
+}
+
+// renameTableIfExists переименовывает таблицу, если она есть, а таблицы с новым именем ещё нет
+func renameTableIfExists(db *sql.DB, from, to string) error {
+	exists, err := tableExists(db, from)
+	if err != nil || !exists {
+		return err
+	}
+	if exists, err = tableExists(db, to); err != nil || exists {
+		return err
+	}
+	if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s RENAME TO %s", from, to)); err != nil {
+		return fmt.Errorf("ошибка переименования таблицы %s: %w", from, err)
+	}
+	return nil
+}
+
+// addColumnIfMissing добавляет колонку в таблицу, если её ещё нет
+func addColumnIfMissing(db *sql.DB, table, column, definition string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("ошибка чтения структуры таблицы %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name, typ  string
+			notNull    int
+			dfltValue  sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dfltValue, &primaryKey); err != nil {
+			return fmt.Errorf("ошибка чтения структуры таблицы %s: %w", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("ошибка чтения структуры таблицы %s: %w", table, err)
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	if err != nil {
+		return fmt.Errorf("ошибка добавления колонки %s.%s: %w", table, column, err)
+	}
+	return nil
+}
+
 // setUserStyle сохраняет или обновляет стиль пользователя в БД
 func (b *Bot) setUserStyle(userID int64, style string) error {
 	// Использование UPSERT (INSERT OR REPLACE или INSERT OR IGNORE + UPDATE)
@@ -161,7 +1244,7 @@ func (b *Bot) setUserStyle(userID int64, style string) error {
 // getUserStyle получает стиль пользователя из БД или возвращает 'friendly' по умолчанию
 func (b *Bot) getUserStyle(userID int64) (string, error) {
 	var style string
-	err := b.db.QueryRow("SELECT style FROM users WHERE user_id = ?", userID).Scan(&style)
+	err := b.stmts.userStyle.QueryRow(userID).Scan(&style)
 	if err == sql.ErrNoRows {
 		return "friendly", nil // Стиль по умолчанию, если пользователь не найден
 	}
@@ -171,60 +1254,86 @@ func (b *Bot) getUserStyle(userID int64) (string, error) {
 	return style, nil
 }
 
+// setUserShowLatency включает или выключает футер с задержкой для пользователя
+func (b *Bot) setUserShowLatency(userID int64, show bool) error {
+	_, err := b.db.Exec("INSERT OR IGNORE INTO users (user_id) VALUES (?)", userID)
+	if err != nil {
+		return fmt.Errorf("ошибка при вставке пользователя: %w", err)
+	}
+	_, err = b.db.Exec("UPDATE users SET show_latency = ? WHERE user_id = ?", show, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка при обновлении настройки задержки: %w", err)
+	}
+	return nil
+}
+
+// getUserShowLatency возвращает, нужно ли показывать пользователю футер с задержкой
+func (b *Bot) getUserShowLatency(userID int64) (bool, error) {
+	var show bool
+	err := b.db.QueryRow("SELECT show_latency FROM users WHERE user_id = ?", userID).Scan(&show)
+	if err == sql.ErrNoRows {
+		return false, nil // По умолчанию футер выключен
+	}
+	if err != nil {
+		return false, fmt.Errorf("ошибка при получении настройки задержки: %w", err)
+	}
+	return show, nil
+}
+
 // sendWelcome отправляет приветственное сообщение
-func (b *Bot) sendWelcome(message *tgbotapi.Message) {
+func (b *Bot) sendWelcome(message *tgbotapi.Message) error {
 	text := "👋 Привет! Я бот с искусственным интеллектом, использующий модель Mistral Small 3.2. Просто напиши мне любое сообщение, и я отвечу!\n\nЧтобы выбрать стиль общения, напиши /style"
 
+	return b.reply(message, text)
+}
+
+// reply отправляет текстовый ответ на сообщение пользователя
+func (b *Bot) reply(message *tgbotapi.Message, text string) error {
 	msg := tgbotapi.NewMessage(message.Chat.ID, text)
 	msg.ReplyToMessageID = message.MessageID
 
 	_, err := b.api.Send(msg)
 	if err != nil {
-		log.Printf("Ошибка отправки сообщения: %v", err)
+		return fmt.Errorf("ошибка отправки сообщения: %w", err)
 	}
+	return nil
 }
 
 // chooseStyle предлагает пользователю выбрать стиль общения через кнопки
-func (b *Bot) chooseStyle(message *tgbotapi.Message) {
-	keyboard := tgbotapi.NewReplyKeyboard(
-		tgbotapi.NewKeyboardButtonRow(
-			tgbotapi.NewKeyboardButton("Дружелюбный 😊"),
-			tgbotapi.NewKeyboardButton("Официальный 🧐"),
-		),
-		tgbotapi.NewKeyboardButtonRow(
-			tgbotapi.NewKeyboardButton("Мемный 🤪"),
-		),
-	)
-	keyboard.ResizeKeyboard = true // Делает клавиатуру компактной
+func (b *Bot) chooseStyle(message *tgbotapi.Message) error {
+	current, err := b.getUserStyle(senderID(message))
+	if err != nil {
+		log.Printf("Ошибка получения стиля: %v", err)
+	}
 
-	msg := tgbotapi.NewMessage(message.Chat.ID, "Выбери стиль общения:")
-	msg.ReplyMarkup = keyboard
+	msg := tgbotapi.NewMessage(message.Chat.ID, "Выбери стиль общения. «👀 Пример» покажет, как я отвечаю в этом стиле, ничего не меняя.")
+	msg.ReplyMarkup = styleKeyboard(current)
 	msg.ReplyToMessageID = message.MessageID
 
-	_, err := b.api.Send(msg)
+	_, err = b.api.Send(msg)
 	if err != nil {
-		log.Printf("Ошибка отправки сообщения: %v", err)
+		return fmt.Errorf("ошибка отправки сообщения: %w", err)
 	}
+	return nil
 }
 
-// setStyle устанавливает выбранный пользователем стиль
-func (b *Bot) setStyle(message *tgbotapi.Message) {
+// setStyle устанавливает выбранный пользователем стиль (кнопки клавиатуры из прежней версии /style)
+func (b *Bot) setStyle(message *tgbotapi.Message) error {
 	styleMapping := map[string]string{
 		"Дружелюбный 😊": "friendly",
 		"Официальный 🧐": "official",
-		"Мемный 🤪":     "meme",
+		"Мемный 🤪":      "meme",
 	}
 
 	selectedStyle, ok := styleMapping[message.Text]
 	if !ok {
 		// Если текст не соответствует известной кнопке стиля, ничего не делаем
-		return
+		return nil
 	}
 
-	err := b.setUserStyle(message.From.ID, selectedStyle)
+	err := b.setUserStyle(senderID(message), selectedStyle)
 	if err != nil {
-		log.Printf("Ошибка сохранения стиля: %v", err)
-		return
+		return fmt.Errorf("ошибка сохранения стиля: %w", err)
 	}
 
 	msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("Стиль общения установлен: %s", message.Text))
@@ -233,49 +1342,222 @@ func (b *Bot) setStyle(message *tgbotapi.Message) {
 
 	_, err = b.api.Send(msg)
 	if err != nil {
-		log.Printf("Ошибка отправки сообщения: %v", err)
+		return fmt.Errorf("ошибка отправки сообщения: %w", err)
+	}
+	return nil
+}
+
+// setLatency обрабатывает команду /latency on|off; администраторам доступна /latency stats
+func (b *Bot) setLatency(message *tgbotapi.Message) error {
+	arg := message.CommandArguments()
+	if arg == "stats" && b.isAdmin(senderID(message)) {
+		return b.latencyStats(message)
+	}
+
+	show, ok := parseToggle(arg)
+	if !ok {
+		usage := "Использование: /latency on или /latency off"
+		if b.isAdmin(senderID(message)) {
+			usage += "\nПерцентили задержек по моделям: /latency stats"
+		}
+		return b.reply(message, usage)
+	}
+
+	if err := b.setUserShowLatency(senderID(message), show); err != nil {
+		b.reply(message, "Не удалось сохранить настройку, попробуй позже.")
+		return fmt.Errorf("ошибка сохранения настройки задержки: %w", err)
+	}
+
+	if show {
+		return b.reply(message, "⏱ Теперь под ответами будет время генерации, модель и число токенов.")
+	}
+	return b.reply(message, "Футер с задержкой выключен.")
+}
+
+// setDebug обрабатывает команду /debug on|off (только для администраторов)
+func (b *Bot) setDebug(message *tgbotapi.Message) error {
+	enabled, ok := parseToggle(message.CommandArguments())
+	if !ok {
+		return b.reply(message, "Использование: /debug on или /debug off")
+	}
+
+	b.debugMu.Lock()
+	if enabled {
+		b.debugUsers[senderID(message)] = true
+	} else {
+		delete(b.debugUsers, senderID(message))
+	}
+	b.debugMu.Unlock()
+
+	if enabled {
+		return b.reply(message, "🐞 Режим отладки включён: после каждого ответа пришлю запрос и сырой ответ API. Сбрасывается при перезапуске.")
+	}
+	return b.reply(message, "Режим отладки выключен.")
+}
+
+// isDebugEnabled проверяет, включён ли режим отладки у администратора
+func (b *Bot) isDebugEnabled(userID int64) bool {
+	if !b.isAdmin(userID) {
+		return false
+	}
+	b.debugMu.Lock()
+	defer b.debugMu.Unlock()
+	return b.debugUsers[userID]
+}
+
+// sendDebugPayload отправляет сводку сборки контекста, запрос к модели и сырой ответ API.
+// Если текст не помещается в одно сообщение, он уходит .json документом, а сводка - отдельным сообщением.
+func (b *Bot) sendDebugPayload(chatID int64, resp *AIResponse, report contextReport) {
+	summary := "🐞 Контекст: " + report.String()
+	var request bytes.Buffer
+	if err := json.Indent(&request, resp.RawRequest, "", "  "); err != nil {
+		request.Write(resp.RawRequest)
+	}
+	text := b.redactSecrets(fmt.Sprintf("%s\n\n🐞 Запрос:\n%s\n\n🐞 Ответ:\n%s", summary, request.String(), resp.RawResponse))
+
+	var chattable tgbotapi.Chattable
+	if len([]rune(text)) <= 4096 {
+		chattable = tgbotapi.NewMessage(chatID, text)
+	} else {
+		payload, err := json.MarshalIndent(map[string]json.RawMessage{
+			"request":  resp.RawRequest,
+			"response": debugRawJSON(resp.RawResponse),
+		}, "", "  ")
+		if err != nil {
+			log.Printf("Ошибка сериализации отладочных данных: %v", err)
+			return
+		}
+		if _, err := b.api.Send(tgbotapi.NewMessage(chatID, summary)); err != nil {
+			log.Printf("Ошибка отправки отладочных данных: %v", err)
+		}
+		chattable = tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{
+			Name:  fmt.Sprintf("debug-%d.json", time.Now().Unix()),
+			Bytes: []byte(b.redactSecrets(string(payload))),
+		})
+	}
+
+	if _, err := b.api.Send(chattable); err != nil {
+		log.Printf("Ошибка отправки отладочных данных: %v", err)
 	}
 }
 
+// debugRawJSON возвращает тело ответа как JSON, а не-JSON оборачивает в строку
+func debugRawJSON(body []byte) json.RawMessage {
+	if json.Valid(body) {
+		return body
+	}
+	quoted, _ := json.Marshal(string(body))
+	return quoted
+}
+
+// redactSecrets вырезает токены бота и API из отладочного вывода
+func (b *Bot) redactSecrets(text string) string {
+	for _, secret := range append([]string{b.cfg().HuggingFaceAPIToken}, b.cfg().TelegramBotTokens...) {
+		if secret != "" {
+			text = strings.ReplaceAll(text, secret, "[REDACTED]")
+		}
+	}
+	return text
+}
+
+// parseToggle разбирает аргумент вида on/off (вкл/выкл)
+func parseToggle(arg string) (value bool, ok bool) {
+	switch strings.ToLower(strings.TrimSpace(arg)) {
+	case "on", "вкл", "1", "true":
+		return true, true
+	case "off", "выкл", "0", "false":
+		return false, true
+	}
+	return false, false
+}
+
+// latencyFooter формирует футер вида "⏱ 7.2s · mistral-small · 845 tok"
+func latencyFooter(resp *AIResponse) string {
+	parts := []string{fmt.Sprintf("⏱ %.1fs", resp.Duration.Seconds())}
+	if name := shortModelName(resp.Model); name != "" {
+		parts = append(parts, name)
+	}
+	if resp.Usage.TotalTokens > 0 {
+		parts = append(parts, fmt.Sprintf("%d tok", resp.Usage.TotalTokens))
+	}
+	if resp.Seed != nil {
+		parts = append(parts, fmt.Sprintf("seed %d", *resp.Seed))
+	}
+	return strings.Join(parts, " · ")
+}
+
+// shortModelName сокращает полное имя модели: "mistralai/Mistral-Small-3.2-24B-Instruct-2506" -> "mistral-small"
+func shortModelName(model string) string {
+	if i := strings.LastIndex(model, "/"); i >= 0 {
+		model = model[i+1:]
+	}
+	parts := strings.Split(strings.ToLower(model), "-")
+	if len(parts) > 2 {
+		parts = parts[:2]
+	}
+	return strings.Join(parts, "-")
+}
+
 // aiChat обрабатывает текстовые сообщения и отправляет их в ИИ
-func (b *Bot) aiChat(message *tgbotapi.Message) {
-	userPrompt := strings.TrimSpace(message.Text)
+func (b *Bot) aiChat(ctx context.Context, message *tgbotapi.Message) error {
+	// Промпт, подставленный кнопкой ✏️ из /saved, приходит с упоминанием бота в начале
+	userPrompt := strings.TrimSpace(strings.TrimPrefix(message.Text, "@"+b.name))
 
 	// Не реагируем на выбор стиля как на чат-запрос
 	styleButtons := []string{"Дружелюбный 😊", "Официальный 🧐", "Мемный 🤪"}
 	for _, btn := range styleButtons {
 		if userPrompt == btn {
-			b.setStyle(message) // Обрабатываем как выбор стиля
-			return
+			return b.setStyle(message) // Обрабатываем как выбор стиля
 		}
 	}
 
-	if userPrompt == "" {
-		msg := tgbotapi.NewMessage(message.Chat.ID, "Пожалуйста, напиши текстовое сообщение.")
-		msg.ReplyToMessageID = message.MessageID
-		_, err := b.api.Send(msg)
-		if err != nil {
-			log.Printf("Ошибка отправки сообщения: %v", err)
+	// Кнопка клавиатуры /kbd присылает подпись, а отвечать нужно на промпт целиком
+	if prompt, ok, err := b.expandKeyboardPrompt(senderID(message), userPrompt); err != nil {
+		return err
+	} else if ok {
+		if prompt == "" {
+			return b.reply(message, "Этого промпта больше нет. Обновить кнопки - /kbd on.")
 		}
-		return
+		userPrompt = prompt
 	}
 
-	// Получаем стиль пользователя из БД
-	style, err := b.getUserStyle(message.From.ID)
-	if err != nil {
-		log.Printf("Ошибка получения стиля пользователя: %v", err)
-		style = "friendly" // Возвращаемся к дружелюбному стилю по умолчанию
+	if userPrompt == "" {
+		return b.reply(message, "Пожалуйста, напиши текстовое сообщение.")
 	}
 
-	// Формируем системный промпт в зависимости от стиля
-	stylePrompts := map[string]string{
-		"friendly": "Ты дружелюбный и теплый ассистент, отвечаешь с использованием эмодзи.",
-		"official": "Ты официальный, строгий и вежливый ассистент. Отвечай без эмодзи.",
-		"meme":     "Ты ассистент, любящий юмор и мемы. Отвечай с забавными фразами и мемами.",
+	// Пауза между ответами в группе (/cooldown) - независимо от лимитов пользователя
+	if b.chatCoolingDown(message) {
+		return nil
 	}
-	systemPrompt, exists := stylePrompts[style]
-	if !exists {
-		systemPrompt = stylePrompts["friendly"] // По умолчанию дружелюбный
+
+	// "Запомни, что …" - предлагаем сохранить факт в долговременную память
+	if offered, err := b.offerRemember(message); offered {
+		return err
+	}
+
+	// Пронумерованный список вопросов: отвечаем на каждый отдельно, а не одной кашей
+	if questions := numberedQuestions(userPrompt); len(questions) >= batchMinQuestions && len(questions) <= batchMaxQuestions {
+		return b.answerBatch(ctx, message, questions)
+	}
+
+	// Короткая просьба вроде "сделай короче" сразу после ответа переделывает его на месте
+	if last, ok := b.lastAnswers.get(senderID(message), message.Chat.ID); ok && isReviseRequest(userPrompt) {
+		return b.reviseAnswer(ctx, message, last, userPrompt)
+	}
+
+	in := chatInputFrom(message, userPrompt)
+	info := updateInfoFrom(ctx)
+	in.RequestID, in.QueuedAt, in.QueueWait = info.RequestID, info.QueuedAt, info.QueueWait
+	in.Reply = replyInstruction(message, b.quotes.take(info.UpdateID))
+	// Исчезающие ответы по умолчанию (/ephemeral default)
+	ephemeral, err := b.getUserEphemeral(in.UserID)
+	if err != nil {
+		log.Printf("Ошибка получения срока жизни ответов: %v", err)
+	}
+	in.Ephemeral = ephemeral
+	turn := b.prepareChat(ctx, in)
+	if err := b.checkLimits(in, turn); err != nil {
+		return b.reply(message, err.Error())
 	}
 
 	// Отправляем сообщение о том, что думаем
@@ -283,119 +1565,281 @@ func (b *Bot) aiChat(message *tgbotapi.Message) {
 	thinkingMsg.ReplyToMessageID = message.MessageID
 	sentMsg, err := b.api.Send(thinkingMsg)
 	if err != nil {
-		log.Printf("Ошибка отправки сообщения: %v", err)
-		return
+		return fmt.Errorf("ошибка отправки сообщения: %w", err)
 	}
 
-	// Запрос к AI
-	aiResponse, err := b.makeAIRequest(systemPrompt, userPrompt)
+	aiResponse, err := b.completeChat(ctx, in, turn)
+	if err != nil && isBackendFailure(err) {
+		// Модель недоступна: отвечаем сами или предлагаем повторить позже
+		b.react(message, b.cfg().ReactionFailure)
+		if fallbackErr := b.sendFallback(message, sentMsg.MessageID, in, turn); fallbackErr != nil {
+			log.Printf("Ошибка ответа при недоступности ИИ: %v", fallbackErr)
+		}
+		return fmt.Errorf("ошибка запроса к AI: %w", err)
+	}
 	if err != nil {
-		// Удаляем сообщение "Думаю..."
-		deleteMsg := tgbotapi.NewDeleteMessage(message.Chat.ID, sentMsg.MessageID)
-		b.api.Send(deleteMsg) // Отправляем без проверки ошибки
+		// Повтор такого запроса без исправления не поможет - сохраняем его для разбора
+		b.recordDeadLetter(in, message.MessageID, turn, err)
 
-		errorMsg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("Ошибка при обращении к ИИ: %v", err))
-		errorMsg.ReplyToMessageID = message.MessageID
-		b.api.Send(errorMsg)
-		return
+		// Превращаем "Думаю..." в сообщение об ошибке
+		errorText := fmt.Sprintf("Ошибка при обращении к ИИ: %v\n\nКод ошибки: %s", err, in.RequestID)
+		if _, sendErr := b.api.Send(tgbotapi.NewEditMessageText(message.Chat.ID, sentMsg.MessageID, errorText)); sendErr != nil {
+			b.deleteMessage(message.Chat.ID, sentMsg.MessageID)
+			b.reply(message, errorText)
+		}
+		b.react(message, b.cfg().ReactionFailure)
+		return fmt.Errorf("ошибка запроса к AI: %w", err)
 	}
 
-	// Удаляем сообщение "Думаю..."
-	deleteMsg := tgbotapi.NewDeleteMessage(message.Chat.ID, sentMsg.MessageID)
-	b.api.Send(deleteMsg) // Отправляем без проверки ошибки
+	// Футер добавляется только к отправляемому тексту, сам ответ AI остаётся без изменений
+	answerText := aiResponse.Content
+	showLatency, err := b.getUserShowLatency(senderID(message))
+	if err != nil {
+		log.Printf("Ошибка получения настройки задержки: %v", err)
+	}
+	if showLatency || aiResponse.Seed != nil {
+		answerText += "\n\n" + latencyFooter(aiResponse)
+	}
+	if in.Ephemeral > 0 {
+		answerText += "\n\n" + ephemeralFooter(in.Ephemeral)
+	}
 
-	// Отправляем ответ AI
-	responseMsg := tgbotapi.NewMessage(message.Chat.ID, aiResponse)
-	responseMsg.ParseMode = tgbotapi.ModeMarkdown // Mistral часто возвращает Markdown
-	_, err = b.api.Send(responseMsg)
+	// Отправляем ответ AI на место плейсхолдера
+	_, span := tracer.Start(ctx, "telegram.send", trace.WithAttributes(attribute.Int("chars", len([]rune(answerText)))))
+	delivered, err := b.deliverUserAnswer(senderID(message), message.Chat.ID, sentMsg.MessageID, message.MessageID, answerText)
+	recordSpanError(span, err)
+	span.End()
 	if err != nil {
-		log.Printf("Ошибка отправки ответа AI: %v", err)
+		b.react(message, b.cfg().ReactionFailure)
+		return fmt.Errorf("ошибка отправки ответа AI: %w", err)
+	}
+	b.react(message, b.cfg().ReactionSuccess)
+	if in.Ephemeral > 0 {
+		b.scheduleAnswerDeletion(in, message.MessageID, sentMsg.MessageID, delivered)
+	} else if len(delivered) > 0 {
+		b.offerAnswerButtons(message.Chat.ID, delivered[0].MessageID)
 	}
+	b.rememberAnswer(senderID(message), message.Chat.ID, sentMsg.MessageID, message.MessageID, answerText)
+
+	// В историю попадает сам ответ модели, без футера
+	b.saveChat(in, turn, aiResponse)
+
+	if b.isDebugEnabled(senderID(message)) {
+		b.sendDebugPayload(message.Chat.ID, aiResponse, turn.Context)
+	}
+	return nil
 }
 
 // makeAIRequest отправляет запрос к Hugging Face Inference API для чат-моделей
-func (b *Bot) makeAIRequest(systemPrompt, userPrompt string) (string, error) {
+func (b *Bot) makeAIRequest(systemPrompt, userPrompt string) (*AIResponse, error) {
+	return b.makeChatRequest(context.Background(), []ChatMessage{
+		{Role: "system", Content: systemPrompt},
+		{Role: "user", Content: userPrompt},
+	}, b.cfg().Sampling)
+}
+
+// makeChatRequest отправляет в модель готовый список сообщений (системный промпт, история, вопрос)
+func (b *Bot) makeChatRequest(ctx context.Context, messages []ChatMessage, params SamplingParams) (*AIResponse, error) {
 	reqBody := OpenAIRequest{
-		Model: MODEL, // Используем константу MODEL
-		Messages: []ChatMessage{
-			{Role: "system", Content: systemPrompt},
-			{Role: "user", Content: userPrompt},
-		},
-		Stream:    false,
-		MaxTokens: 1024,
+		Model:          MODEL, // Используем константу MODEL
+		Messages:       messages,
+		Stream:         false,
+		MaxTokens:      1024,
+		SamplingParams: params,
 		// Temperature: 0.7, // Опционально, не все HF API поддерживают напрямую
 	}
+	if len(b.tools) > 0 {
+		return b.doChatRequestWithTools(ctx, reqBody)
+	}
+	return b.doChatRequest(ctx, reqBody)
+}
+
+// doChatRequest отправляет собранный запрос в модель и разбирает ответ
+func (b *Bot) doChatRequest(ctx context.Context, reqBody OpenAIRequest) (_ *AIResponse, err error) {
+	ctx, span := tracer.Start(ctx, "ai.request", trace.WithAttributes(
+		attribute.String("model", reqBody.Model),
+		attribute.Int("messages", len(reqBody.Messages)),
+	))
+	defer func() {
+		recordSpanError(span, err)
+		span.End()
+	}()
 
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
-		return "", fmt.Errorf("ошибка маршалинга запроса: %w", err)
+		return nil, fmt.Errorf("ошибка маршалинга запроса: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", APIURL, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", APIURL, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return "", fmt.Errorf("ошибка создания HTTP-запроса: %w", err)
+		return nil, fmt.Errorf("ошибка создания HTTP-запроса: %w", err)
 	}
-	req.Header.Set("Authorization", "Bearer "+b.config.HuggingFaceAPIToken)
+	req.Header.Set("Authorization", "Bearer "+b.cfg().HuggingFaceAPIToken)
 	req.Header.Set("Content-Type", "application/json") // Важно для JSON-тела
 
-	client := &http.Client{
-		Timeout: 90 * time.Second, // Увеличиваем таймаут для больших моделей
+	if !b.breaker.allow(time.Now()) {
+		return nil, errAIUnavailable
 	}
-	resp, err := client.Do(req)
+	b.metrics.inc("ai_requests")
+	b.today.inc("ai_requests", time.Now())
+	defer func() {
+		if err != nil {
+			b.metrics.inc("ai_errors")
+			b.today.inc("ai_errors", time.Now())
+		}
+	}()
+	startedAt := time.Now()
+	resp, err := b.aiClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("ошибка выполнения HTTP-запроса: %w", err)
+		b.breaker.record(err, time.Now())
+		return nil, fmt.Errorf("ошибка выполнения HTTP-запроса: %w", err)
 	}
 	defer resp.Body.Close()
+	span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("API вернул ошибку %d: %s", resp.StatusCode, string(body))
+		apiErr := &apiError{StatusCode: resp.StatusCode, Body: string(body)}
+		b.breaker.record(apiErr, time.Now())
+		return nil, apiErr
 	}
+	b.breaker.record(nil, time.Now())
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("ошибка чтения тела ответа: %w", err)
+		return nil, fmt.Errorf("ошибка чтения тела ответа: %w", err)
 	}
 
 	var chatResp ChatResponse
 	err = json.Unmarshal(body, &chatResp)
 	if err != nil {
-		return "", fmt.Errorf("ошибка демаршалинга ответа: %w", err)
+		return nil, fmt.Errorf("ошибка демаршалинга ответа: %w", err)
 	}
 
 	if len(chatResp.Choices) == 0 {
-		return "", fmt.Errorf("нет ответа от AI")
+		return nil, fmt.Errorf("нет ответа от AI")
+	}
+
+	content := sanitizeAnswer(chatResp.Choices[0].Message.Content)
+	if content == "" && len(chatResp.Choices[0].Message.ToolCalls) == 0 {
+		return nil, fmt.Errorf("пустой ответ от AI")
 	}
 
-	return chatResp.Choices[0].Message.Content, nil
+	model := chatResp.Model
+	if model == "" {
+		model = MODEL
+	}
+	span.SetAttributes(
+		attribute.Int("tokens.prompt", chatResp.Usage.PromptTokens),
+		attribute.Int("tokens.completion", chatResp.Usage.CompletionTokens),
+	)
+	return &AIResponse{
+		Content:   content,
+		ToolCalls: chatResp.Choices[0].Message.ToolCalls,
+		Model:     model,
+		Seed:      reqBody.Seed,
+		Usage:     chatResp.Usage,
+		Duration:  time.Since(startedAt),
+
+		RawRequest:  jsonData,
+		RawResponse: body,
+	}, nil
 }
 
 // handleUpdate обрабатывает входящие обновления от Telegram
-func (b *Bot) handleUpdate(update tgbotapi.Update) {
-	if update.Message == nil {
-		return
+func (b *Bot) handleUpdate(update tgbotapi.Update, queuedAt time.Time) {
+	info := newUpdateInfo(update)
+	info.QueuedAt, info.QueueWait = queuedAt, time.Since(queuedAt)
+	ctx := withUpdateInfo(context.Background(), info)
+	b.handler(ctx, update) // Ошибки уже залогированы middleware
+}
+
+// routeUpdate выбирает обработчик для обновления и запоминает его имя для логов
+func (b *Bot) routeUpdate(ctx context.Context, update tgbotapi.Update) error {
+	if update.CallbackQuery != nil {
+		updateInfoFrom(ctx).Handler = "callback"
+		return b.handleCallback(ctx, update.CallbackQuery)
 	}
 
 	message := update.Message
+	if message == nil {
+		message = update.ChannelPost // В каналах сообщения приходят как channel_post без From
+	}
+	if message == nil {
+		return nil
+	}
 
-	// Обработка команд
+	info := updateInfoFrom(ctx)
+
+	// Новый пост канала, автоматически пересланный в группу обсуждения
+	if message.IsAutomaticForward && message.SenderChat != nil {
+		if !b.isAutoSummaryChannel(message.SenderChat.ID) {
+			return nil
+		}
+		info.Handler = "autoSummary"
+		return b.autoSummary(message)
+	}
+
+	// Обработка команд; недописанный вопрос из /combine сначала получает ответ
 	if message.IsCommand() {
-		switch message.Command() {
-		case "start":
-			b.sendWelcome(message)
-		case "style":
-			b.chooseStyle(message)
-		default:
-			msg := tgbotapi.NewMessage(message.Chat.ID, "Неизвестная команда. Используйте /start или /style.")
-			msg.ReplyToMessageID = message.MessageID
-			b.api.Send(msg)
+		b.flushInput(senderID(message))
+		cmd, ok := b.lookupCommand(message.Command(), senderID(message))
+		if !ok {
+			info.Handler = "unknown_command"
+			return b.reply(message, b.unknownCommandText())
 		}
-	} else {
-		// Обработка обычных текстовых сообщений
-		if message.Text != "" {
-			b.aiChat(message) // Вызываем функцию для обработки чата
+		info.Handler = "/" + cmd.Name
+		return b.runCommand(cmd, message)
+	}
+
+	// Команда в подписи к файлу (например, документ с подписью /import)
+	if name := captionCommand(message); name != "" {
+		cmd, ok := b.lookupCommand(name, senderID(message))
+		if ok {
+			info.Handler = "/" + cmd.Name
+			return b.runCommand(cmd, message)
 		}
 	}
+
+	// Обычные посты канала не являются обращением к боту
+	if update.ChannelPost != nil {
+		return nil
+	}
+
+	// Файлы после /kb add идут в базу знаний
+	if message.Document != nil && b.kbUploads.active(senderID(message)) {
+		info.Handler = "kb"
+		return b.kbAddDocument(ctx, message)
+	}
+
+	// Ответ на вопрос шаблона из /templates
+	if handled, err := b.continueTemplate(ctx, message); handled {
+		info.Handler = "template"
+		return err
+	}
+
+	// Геопозиция в личке задаёт часовой пояс и город
+	if message.Location != nil && message.Chat.IsPrivate() {
+		info.Handler = "location"
+		return b.setLocation(message)
+	}
+
+	// Голосовые, кружочки, аудиофайлы и документы с аудио расшифровываются
+	if audio, ok := audioFrom(message); ok {
+		info.Handler = "transcribe"
+		return b.transcribeMessage(ctx, message, audio)
+	}
+
+	// Обработка обычных текстовых сообщений
+	if message.Text != "" {
+		if b.bufferInput(message) {
+			info.Handler = "combine"
+			return nil
+		}
+		info.Handler = "aiChat"
+		return b.aiChat(ctx, message) // Вызываем функцию для обработки чата
+	}
+	return nil
 }
 
 // min вспомогательная функция, которая теперь не нужна, но оставлена на всякий случай
@@ -404,4 +1848,4 @@ func min(a, b int) int {
 		return a
 	}
 	return b
-}
\ No newline at end of file
+}
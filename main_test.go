@@ -0,0 +1,102 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// newTestDB открывает пустую базу со всей схемой во временном каталоге теста
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := openDB(filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatalf("openDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// fakeTelegram - Bot API для тестов: на любой метод отвечает успехом и запоминает, что вызывали
+type fakeTelegram struct {
+	mu      sync.Mutex
+	methods []string
+	texts   []string // Тексты отправленных сообщений
+}
+
+// calls возвращает, сколько раз вызывали метод
+func (f *fakeTelegram) calls(method string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, m := range f.methods {
+		if m == method {
+			n++
+		}
+	}
+	return n
+}
+
+// lastText возвращает текст последнего отправленного сообщения
+func (f *fakeTelegram) lastText() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.texts) == 0 {
+		return ""
+	}
+	return f.texts[len(f.texts)-1]
+}
+
+// newTestBot собирает бота с временной базой и поддельным Bot API
+func newTestBot(t *testing.T) (*Bot, *fakeTelegram) {
+	t.Helper()
+	fake := &fakeTelegram{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method := path.Base(r.URL.Path)
+		fake.mu.Lock()
+		fake.methods = append(fake.methods, method)
+		if method == "sendMessage" {
+			fake.texts = append(fake.texts, r.FormValue("text"))
+		}
+		fake.mu.Unlock()
+
+		result := `{"message_id": 1, "date": 0, "chat": {"id": 1, "type": "private"}}`
+		if method == "getMe" {
+			result = `{"id": 1, "is_bot": true, "first_name": "Test", "username": "test_bot"}`
+		}
+		fmt.Fprintf(w, `{"ok": true, "result": %s}`, result)
+	}))
+	t.Cleanup(server.Close)
+
+	api, err := tgbotapi.NewBotAPIWithClient("1:TEST", server.URL+"/bot%s/%s", server.Client())
+	if err != nil {
+		t.Fatalf("NewBotAPIWithClient: %v", err)
+	}
+	config := &Config{DefaultLocation: time.UTC, CombineWindow: time.Second}
+	b, err := newBot(config, api, newTestDB(t), server.Client())
+	if err != nil {
+		t.Fatalf("newBot: %v", err)
+	}
+	return b, fake
+}
+
+// textUpdate - личное сообщение пользователя userID
+func textUpdate(updateID int, userID int64, text string) tgbotapi.Update {
+	return tgbotapi.Update{
+		UpdateID: updateID,
+		Message: &tgbotapi.Message{
+			MessageID: updateID,
+			From:      &tgbotapi.User{ID: userID, FirstName: "Test"},
+			Chat:      &tgbotapi.Chat{ID: userID, Type: "private"},
+			Text:      text,
+		},
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	reminderRetention      = 7 * 24 * time.Hour  // Сколько хранить уже отправленные напоминания
+	errorRetention         = 30 * 24 * time.Hour // Дольше журнал ошибок не хранится, даже при LOG_RETENTION_DAYS=0
+	vacuumThresholdPercent = 20                  // VACUUM, если удалено больше этой доли строк
+)
+
+// retentionRule описывает, какие строки таблицы считаются устаревшими
+type retentionRule struct {
+	table string
+	where string // Условие с одним параметром - границей по времени в формате SQLite
+	keep  time.Duration
+}
+
+// retentionRules собирает правила очистки из настроек; нулевой срок означает "хранить бессрочно"
+func (b *Bot) retentionRules() []retentionRule {
+	days := func(n int) time.Duration { return time.Duration(n) * 24 * time.Hour }
+
+	var rules []retentionRule
+	if b.cfg().HistoryRetentionDays > 0 {
+		rules = append(rules, retentionRule{"history", "created_at < ?", days(b.cfg().HistoryRetentionDays)})
+	}
+	// В журнале ошибок есть user_id и chat_id, поэтому бессрочно он не хранится
+	errorsKeep := errorRetention
+	if n := b.cfg().LogRetentionDays; n > 0 && days(n) < errorsKeep {
+		errorsKeep = days(n)
+	}
+	rules = append(rules, retentionRule{"errors", "last_seen < ?", errorsKeep})
+	if b.cfg().LogRetentionDays > 0 {
+		rules = append(rules, retentionRule{"dead_letters", "resolved_at IS NOT NULL AND resolved_at < ?", days(b.cfg().LogRetentionDays)})
+	}
+	rules = append(rules, retentionRule{"reminders", "delivered_at IS NOT NULL AND delivered_at < ?", reminderRetention})
+	rules = append(rules, retentionRule{"pending_requests", "created_at < ?", pendingMaxAge})
+	rules = append(rules, retentionRule{"answer_pages", "created_at < ?", answerPagesTTL})
+	rules = append(rules, retentionRule{"topic_posts", "created_at < ?", topicPostRetention})
+	return rules
+}
+
+// maintenanceResult - итог одной чистки базы
+type maintenanceResult struct {
+	Deleted  map[string]int64
+	Total    int64 // Строк в очищаемых таблицах до чистки
+	Vacuumed bool
+	Duration time.Duration
+}
+
+// runMaintenance удаляет устаревшие строки и при заметном удалении сжимает файл базы.
+// Таблицы, которых ещё нет, пропускаются.
+func (b *Bot) runMaintenance() (*maintenanceResult, error) {
+	startedAt := time.Now()
+	result := &maintenanceResult{Deleted: make(map[string]int64)}
+
+	for _, rule := range b.retentionRules() {
+		exists, err := tableExists(b.db, rule.table)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			continue
+		}
+
+		var total int64
+		if err := b.db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s", rule.table)).Scan(&total); err != nil {
+			return nil, fmt.Errorf("ошибка подсчёта строк в %s: %w", rule.table, err)
+		}
+		result.Total += total
+
+		cutoff := time.Now().Add(-rule.keep).UTC().Format("2006-01-02 15:04:05")
+		res, err := b.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s", rule.table, rule.where), cutoff)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка очистки %s: %w", rule.table, err)
+		}
+		deleted, _ := res.RowsAffected()
+		result.Deleted[rule.table] = deleted
+		slog.Info("очистка базы", "table", rule.table, "deleted", deleted, "total", total)
+	}
+
+	var deleted int64
+	for _, n := range result.Deleted {
+		deleted += n
+	}
+	if result.Total > 0 && deleted*100/result.Total >= vacuumThresholdPercent {
+		if _, err := b.db.Exec("VACUUM"); err != nil {
+			return nil, fmt.Errorf("ошибка VACUUM: %w", err)
+		}
+		result.Vacuumed = true
+	}
+
+	result.Duration = time.Since(startedAt)
+	return result, nil
+}
+
+// maintenanceLoop раз в сутки в MAINTENANCE_HOUR запускает чистку базы
+func (b *Bot) maintenanceLoop() {
+	for {
+		next := nextDailyRun(time.Now(), b.cfg().MaintenanceHour)
+		time.Sleep(time.Until(next))
+
+		result, err := b.runMaintenance()
+		if err != nil {
+			slog.Error("ошибка обслуживания базы", "error", err)
+			b.notifyAdmin("⚠️ Ошибка обслуживания базы: " + err.Error())
+			continue
+		}
+		slog.Info("обслуживание базы завершено", "vacuum", result.Vacuumed, "duration", result.Duration.Round(time.Millisecond))
+	}
+}
+
+// nextDailyRun возвращает ближайший момент после now, когда на часах hour:00
+func nextDailyRun(now time.Time, hour int) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// maintenance обрабатывает команду /maintenance: запускает чистку базы немедленно
+func (b *Bot) maintenance(message *tgbotapi.Message) error {
+	result, err := b.runMaintenance()
+	if err != nil {
+		b.reply(message, "❌ Ошибка обслуживания: "+err.Error())
+		return err
+	}
+	return b.reply(message, formatMaintenance(result))
+}
+
+// formatMaintenance собирает отчёт об очистке для администратора
+func formatMaintenance(result *maintenanceResult) string {
+	var sb strings.Builder
+	sb.WriteString("🧹 Обслуживание базы\n\n")
+	if len(result.Deleted) == 0 {
+		sb.WriteString("Очищать нечего.\n")
+	}
+	tables := make([]string, 0, len(result.Deleted))
+	for table := range result.Deleted {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	for _, table := range tables {
+		fmt.Fprintf(&sb, "%s: удалено %d\n", table, result.Deleted[table])
+	}
+	fmt.Fprintf(&sb, "VACUUM: %s\n", onOff(result.Vacuumed))
+	fmt.Fprintf(&sb, "Заняло: %s", result.Duration.Round(time.Millisecond))
+	return sb.String()
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// Правила для текста вне кода. Применяются к уже экранированному тексту: html.EscapeString
+// не трогает символы разметки, зато в ссылках & уже превращён в &amp;, как и нужно в href.
+var (
+	codeLangPattern    = regexp.MustCompile(`^[\w+#.-]+`)
+	inlineCodePattern  = regexp.MustCompile("`[^`\n]+`")
+	headingPattern     = regexp.MustCompile(`(?m)^#{1,6}[ \t]+(.+)$`)
+	boldPattern        = regexp.MustCompile(`\*\*([^*\n]+?)\*\*|__([^_\n]+?)__`)
+	italicPattern      = regexp.MustCompile(`(^|[\s(])\*([^*\s](?:[^*\n]*[^*\s])?)\*`)
+	strikePattern      = regexp.MustCompile(`~~([^~\n]+?)~~`)
+	linkPattern        = regexp.MustCompile(`\[([^\]\n]+)\]\((https?://[^)\s]+)\)`)
+	bulletPattern      = regexp.MustCompile(`(?m)^([ \t]*)\*[ \t]+`)
+	markdownPlainRules = []struct {
+		pattern     *regexp.Regexp
+		replacement string
+	}{
+		{bulletPattern, "$1• "},
+		{headingPattern, "<b>$1</b>"},
+		{boldPattern, "<b>$1$2</b>"},
+		{italicPattern, "$1<i>$2</i>"},
+		{strikePattern, "<s>$1</s>"},
+		{linkPattern, `<a href="$2">$1</a>`},
+	}
+)
+
+// markdownToHTML переводит Markdown из ответа модели в HTML для Telegram. Блоки кода становятся
+// <pre><code class="language-…">, чтобы клиент показал язык и кнопку копирования; содержимое кода
+// только экранируется. Незакрытый блок кода продолжается до конца текста.
+func markdownToHTML(text string) string {
+	var sb, plain, code strings.Builder
+	flushPlain := func() {
+		if plain.Len() > 0 {
+			sb.WriteString(inlineMarkdownToHTML(strings.TrimSuffix(plain.String(), "\n")))
+			sb.WriteString("\n")
+			plain.Reset()
+		}
+	}
+	flushCode := func(lang string) {
+		body := html.EscapeString(strings.TrimSuffix(code.String(), "\n"))
+		if lang != "" {
+			sb.WriteString(`<pre><code class="language-` + html.EscapeString(lang) + `">` + body + "</code></pre>\n")
+		} else {
+			sb.WriteString("<pre>" + body + "</pre>\n")
+		}
+		code.Reset()
+	}
+
+	inCode, lang := false, ""
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case !inCode && strings.HasPrefix(trimmed, "```"):
+			flushPlain()
+			inCode, lang = true, codeLangPattern.FindString(strings.TrimPrefix(trimmed, "```"))
+		case inCode && strings.HasPrefix(trimmed, "```"):
+			flushCode(lang)
+			inCode = false
+		case inCode:
+			code.WriteString(line + "\n")
+		default:
+			plain.WriteString(line + "\n")
+		}
+	}
+	if inCode {
+		flushCode(lang)
+	}
+	flushPlain()
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// inlineMarkdownToHTML обрабатывает текст вне блоков кода: `код` становится <code>,
+// остальное экранируется и размечается (жирный, курсив, ссылки, заголовки, списки)
+func inlineMarkdownToHTML(text string) string {
+	var sb strings.Builder
+	last := 0
+	for _, loc := range inlineCodePattern.FindAllStringIndex(text, -1) {
+		sb.WriteString(formatPlainMarkdown(text[last:loc[0]]))
+		sb.WriteString("<code>" + html.EscapeString(text[loc[0]+1:loc[1]-1]) + "</code>")
+		last = loc[1]
+	}
+	sb.WriteString(formatPlainMarkdown(text[last:]))
+	return sb.String()
+}
+
+// formatPlainMarkdown экранирует текст и применяет к нему markdownPlainRules
+func formatPlainMarkdown(text string) string {
+	text = html.EscapeString(text)
+	for _, rule := range markdownPlainRules {
+		text = rule.pattern.ReplaceAllString(text, rule.replacement)
+	}
+	return text
+}
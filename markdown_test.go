@@ -0,0 +1,62 @@
+package main
+
+import "testing"
+
+func TestMarkdownToHTMLCode(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "блок кода с < и &",
+			in:   "```go\nif a < b && c > 0 {\n}\n```",
+			want: `<pre><code class="language-go">if a &lt; b &amp;&amp; c &gt; 0 {` + "\n}</code></pre>",
+		},
+		{
+			name: "обратные кавычки внутри блока",
+			in:   "```go\ns := `raw`\nq := \"``\"\n```",
+			want: `<pre><code class="language-go">s := ` + "`raw`\nq := &#34;``&#34;</code></pre>",
+		},
+		{
+			name: "разметка внутри блока не применяется",
+			in:   "```\n**не жирный** и [ссылка](https://example.com)\n```",
+			want: "<pre>**не жирный** и [ссылка](https://example.com)</pre>",
+		},
+		{
+			name: "экранирование языка",
+			in:   "```c++\nint x = a<b;\n```",
+			want: `<pre><code class="language-c++">int x = a&lt;b;</code></pre>`,
+		},
+		{
+			name: "незакрытый блок",
+			in:   "Код:\n```sh\necho a && echo b",
+			want: "Код:\n" + `<pre><code class="language-sh">echo a &amp;&amp; echo b</code></pre>`,
+		},
+		{
+			name: "инлайн-код с < и &",
+			in:   "Сравни `a<b && c` и a<b",
+			want: "Сравни <code>a&lt;b &amp;&amp; c</code> и a&lt;b",
+		},
+		{
+			name: "разметка внутри инлайн-кода не применяется",
+			in:   "Вызови `**kwargs` и **жирное**",
+			want: "Вызови <code>**kwargs</code> и <b>жирное</b>",
+		},
+		{
+			name: "одиночная обратная кавычка",
+			in:   "Символ ` и <тег>",
+			want: "Символ ` и &lt;тег&gt;",
+		},
+		{
+			name: "ссылка с & в адресе",
+			in:   "[поиск](https://example.com/?a=1&b=2)",
+			want: `<a href="https://example.com/?a=1&amp;b=2">поиск</a>`,
+		},
+	}
+	for _, tt := range tests {
+		if got := markdownToHTML(tt.in); got != tt.want {
+			t.Errorf("%s:\n вход:     %q\n получено: %q\n ожидалось: %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
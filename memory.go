@@ -0,0 +1,309 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	maxMemories      = 20               // Сколько фактов можно хранить на пользователя
+	maxMemoryLength  = 300              // Максимальная длина одного факта
+	pendingMemoryTTL = 10 * time.Minute // Сколько живёт предложение "Сохранить в память?"
+)
+
+// rememberPattern ловит в обычных сообщениях фразы вида "запомни, что я вегетарианец"
+var rememberPattern = regexp.MustCompile(`(?is)^\s*запомни[,:]?\s+(?:что\s+)?(.+)$`)
+
+// Memory - факт о пользователе, который всегда попадает в системный промпт
+type Memory struct {
+	ID   int64
+	Fact string
+}
+
+// pendingMemory - факт, ожидающий подтверждения кнопкой
+type pendingMemory struct {
+	userID    int64
+	fact      string
+	createdAt time.Time
+}
+
+// pendingMemories хранит предложенные к сохранению факты до нажатия кнопки
+type pendingMemories struct {
+	mu    sync.Mutex
+	facts map[string]pendingMemory
+}
+
+// add сохраняет факт и возвращает токен для callback-данных
+func (p *pendingMemories) add(userID int64, fact string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for token, pending := range p.facts {
+		if time.Since(pending.createdAt) > pendingMemoryTTL {
+			delete(p.facts, token)
+		}
+	}
+
+	token := randomToken(4)
+	p.facts[token] = pendingMemory{userID: userID, fact: fact, createdAt: time.Now()}
+	return token
+}
+
+// take достаёт и удаляет факт по токену. Чужое нажатие факт не сбрасывает:
+// found сообщает, что предложение ещё живо, owner - что нажал его автор.
+func (p *pendingMemories) take(token string, userID int64) (fact string, found, owner bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pending, ok := p.facts[token]
+	if !ok || time.Since(pending.createdAt) > pendingMemoryTTL {
+		delete(p.facts, token)
+		return "", false, false
+	}
+	if pending.userID != userID {
+		return "", true, false
+	}
+	delete(p.facts, token)
+	return pending.fact, true, true
+}
+
+// forget удаляет все неподтверждённые факты пользователя (/forgetme)
+func (p *pendingMemories) forget(userID int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for token, pending := range p.facts {
+		if pending.userID == userID {
+			delete(p.facts, token)
+		}
+	}
+}
+
+// randomToken возвращает случайную hex-строку из n байт
+func randomToken(n int) string {
+	buf := make([]byte, n)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// remember обрабатывает команду /remember <факт>
+func (b *Bot) remember(message *tgbotapi.Message) error {
+	fact := strings.TrimSpace(message.CommandArguments())
+	if fact == "" {
+		return b.reply(message, "Использование: /remember <факт>, например: /remember я вегетарианец")
+	}
+	return b.reply(message, b.saveMemoryWithReply(senderID(message), fact))
+}
+
+// saveMemoryWithReply сохраняет факт и возвращает текст для пользователя
+func (b *Bot) saveMemoryWithReply(userID int64, fact string) string {
+	if len([]rune(fact)) > maxMemoryLength {
+		return fmt.Sprintf("Слишком длинный факт: максимум %d символов.", maxMemoryLength)
+	}
+
+	count, err := b.countMemories(userID)
+	if err != nil {
+		return "Не удалось сохранить, попробуй позже."
+	}
+	if count >= maxMemories {
+		return fmt.Sprintf("Память заполнена (%d фактов). Удали лишнее через /memory.", maxMemories)
+	}
+
+	if err := b.addMemory(userID, fact); err != nil {
+		return "Не удалось сохранить, попробуй позже."
+	}
+	return "🧠 Запомнил: " + fact
+}
+
+// showMemory обрабатывает команду /memory: список фактов с кнопками удаления
+func (b *Bot) showMemory(message *tgbotapi.Message) error {
+	memories, err := b.getMemories(senderID(message))
+	if err != nil {
+		b.reply(message, "Не удалось получить список, попробуй позже.")
+		return err
+	}
+
+	text, keyboard := renderMemories(memories)
+	msg := tgbotapi.NewMessage(message.Chat.ID, text)
+	msg.ReplyToMessageID = message.MessageID
+	if keyboard != nil {
+		msg.ReplyMarkup = *keyboard
+	}
+	if _, err := b.api.Send(msg); err != nil {
+		return fmt.Errorf("ошибка отправки сообщения: %w", err)
+	}
+	return nil
+}
+
+// renderMemories формирует список фактов и клавиатуру с кнопками удаления
+func renderMemories(memories []Memory) (string, *tgbotapi.InlineKeyboardMarkup) {
+	if len(memories) == 0 {
+		return "Я пока ничего о тебе не помню. Добавь факт: /remember <факт>", nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString("🧠 Что я о тебе помню:\n")
+	var rows [][]tgbotapi.InlineKeyboardButton
+	var row []tgbotapi.InlineKeyboardButton
+	for i, memory := range memories {
+		fmt.Fprintf(&sb, "%d. %s\n", i+1, memory.Fact)
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(
+			fmt.Sprintf("🗑 %d", i+1), "mem_del:"+strconv.FormatInt(memory.ID, 10)))
+		if len(row) == 5 {
+			rows = append(rows, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return sb.String(), &keyboard
+}
+
+// memoryInstruction формирует блок системного промпта с фактами о пользователе
+func memoryInstruction(memories []Memory) string {
+	if len(memories) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("Что известно о пользователе:")
+	for _, memory := range memories {
+		sb.WriteString("\n- " + memory.Fact)
+	}
+	return sb.String()
+}
+
+// offerRemember предлагает сохранить факт из фразы "запомни, что …".
+// Возвращает false, если сообщение на такую фразу не похоже.
+func (b *Bot) offerRemember(message *tgbotapi.Message) (bool, error) {
+	match := rememberPattern.FindStringSubmatch(message.Text)
+	if match == nil {
+		return false, nil
+	}
+	fact := strings.TrimSpace(match[1])
+	if fact == "" || len([]rune(fact)) > maxMemoryLength {
+		return false, nil
+	}
+
+	token := b.pendingMemories.add(senderID(message), fact)
+	msg := tgbotapi.NewMessage(message.Chat.ID, "Сохранить в память?\n«"+fact+"»")
+	msg.ReplyToMessageID = message.MessageID
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("✅ Сохранить", "mem_save:"+token),
+		tgbotapi.NewInlineKeyboardButtonData("Не надо", "mem_skip:"+token),
+	))
+	if _, err := b.api.Send(msg); err != nil {
+		return true, fmt.Errorf("ошибка отправки сообщения: %w", err)
+	}
+	return true, nil
+}
+
+// handleMemoryDelete обрабатывает кнопку удаления факта в списке /memory
+func (b *Bot) handleMemoryDelete(query *tgbotapi.CallbackQuery, payload string) (string, error) {
+	id, err := strconv.ParseInt(payload, 10, 64)
+	if err != nil {
+		return "Некорректная кнопка", nil
+	}
+	deleted, err := b.deleteMemory(query.From.ID, id)
+	if err != nil {
+		return "Не удалось удалить", err
+	}
+	if !deleted {
+		// Чужой список или факт уже удалён - не показываем свои факты в чужом сообщении
+		return "Этот факт уже удалён или принадлежит другому пользователю", nil
+	}
+	memories, err := b.getMemories(query.From.ID)
+	if err != nil {
+		return "", err
+	}
+	text, keyboard := renderMemories(memories)
+	edit := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, text)
+	edit.ReplyMarkup = keyboard
+	if _, err := b.api.Send(edit); err != nil {
+		return "", fmt.Errorf("ошибка обновления списка фактов: %w", err)
+	}
+	return "Удалено", nil
+}
+
+// memorySuggestionHandler возвращает обработчик кнопок "Сохранить"/"Не надо" под предложением запомнить факт
+func (b *Bot) memorySuggestionHandler(save bool) func(*tgbotapi.CallbackQuery, string) (string, error) {
+	return func(query *tgbotapi.CallbackQuery, payload string) (string, error) {
+		fact, found, owner := b.pendingMemories.take(payload, query.From.ID)
+		if !found {
+			return "Предложение устарело", nil
+		}
+		if !owner {
+			return "Это предложение не для тебя", nil
+		}
+
+		text := "Хорошо, не сохраняю."
+		if save {
+			text = b.saveMemoryWithReply(query.From.ID, fact)
+		}
+		edit := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, text)
+		if _, err := b.api.Send(edit); err != nil {
+			return "", fmt.Errorf("ошибка обновления сообщения: %w", err)
+		}
+		return "", nil
+	}
+}
+
+// addMemory сохраняет факт о пользователе
+func (b *Bot) addMemory(userID int64, fact string) error {
+	_, err := b.db.Exec("INSERT INTO memories (user_id, fact) VALUES (?, ?)", userID, fact)
+	if err != nil {
+		return fmt.Errorf("ошибка при сохранении факта: %w", err)
+	}
+	return nil
+}
+
+// countMemories возвращает число сохранённых фактов пользователя
+func (b *Bot) countMemories(userID int64) (int, error) {
+	var count int
+	err := b.db.QueryRow("SELECT COUNT(*) FROM memories WHERE user_id = ?", userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка при подсчёте фактов: %w", err)
+	}
+	return count, nil
+}
+
+// getMemories возвращает факты пользователя в порядке добавления
+func (b *Bot) getMemories(userID int64) ([]Memory, error) {
+	rows, err := b.db.Query("SELECT id, fact FROM memories WHERE user_id = ? ORDER BY id", userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении фактов: %w", err)
+	}
+	defer rows.Close()
+
+	var memories []Memory
+	for rows.Next() {
+		var memory Memory
+		if err := rows.Scan(&memory.ID, &memory.Fact); err != nil {
+			return nil, fmt.Errorf("ошибка при чтении факта: %w", err)
+		}
+		memories = append(memories, memory)
+	}
+	return memories, rows.Err()
+}
+
+// deleteMemory удаляет факт, только если он принадлежит пользователю
+func (b *Bot) deleteMemory(userID, id int64) (bool, error) {
+	res, err := b.db.Exec("DELETE FROM memories WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return false, fmt.Errorf("ошибка при удалении факта: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("ошибка при удалении факта: %w", err)
+	}
+	return affected > 0, nil
+}
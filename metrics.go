@@ -0,0 +1,70 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// metrics - простые счётчики событий в памяти (сбрасываются при перезапуске)
+type metrics struct {
+	mu       sync.Mutex
+	counters map[string]int64
+}
+
+func newMetrics() *metrics {
+	return &metrics{counters: make(map[string]int64)}
+}
+
+// inc увеличивает счётчик name на единицу
+func (m *metrics) inc(name string) {
+	m.add(name, 1)
+}
+
+// add увеличивает счётчик name на delta
+func (m *metrics) add(name string, delta int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters[name] += delta
+}
+
+// get возвращает текущее значение счётчика
+func (m *metrics) get(name string) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.counters[name]
+}
+
+// dailyMetrics - счётчики за текущие сутки: при смене даты обнуляются
+type dailyMetrics struct {
+	mu       sync.Mutex
+	day      string
+	counters map[string]int64
+}
+
+func newDailyMetrics() *dailyMetrics {
+	return &dailyMetrics{counters: make(map[string]int64)}
+}
+
+// inc увеличивает счётчик name за сутки, к которым относится now
+func (m *dailyMetrics) inc(name string, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rollover(now)
+	m.counters[name]++
+}
+
+// get возвращает значение счётчика за сутки, к которым относится now
+func (m *dailyMetrics) get(name string, now time.Time) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rollover(now)
+	return m.counters[name]
+}
+
+// rollover обнуляет счётчики, если наступили новые сутки (вызывается под mu)
+func (m *dailyMetrics) rollover(now time.Time) {
+	if day := now.Format("2006-01-02"); day != m.day {
+		m.day = day
+		m.counters = make(map[string]int64)
+	}
+}
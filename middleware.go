@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// UpdateHandler обрабатывает одно обновление от Telegram
+type UpdateHandler func(ctx context.Context, update tgbotapi.Update) error
+
+// Middleware оборачивает обработчик обновлений (логирование, авторизация, лимиты и т.д.)
+type Middleware func(next UpdateHandler) UpdateHandler
+
+// chainMiddlewares собирает цепочку: первый middleware в списке вызывается первым
+func chainMiddlewares(handler UpdateHandler, middlewares ...Middleware) UpdateHandler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// updateInfo хранит сведения об обрабатываемом обновлении.
+// Заполняется при получении, а имя обработчика проставляет маршрутизатор.
+type updateInfo struct {
+	RequestID string // Короткий код для поиска в логах; показывается пользователю в сообщениях об ошибках
+	UpdateID  int
+	ChatID    int64
+	UserID    int64
+	Kind      string
+	Handler   string
+	Reported  bool // Администратор уже получил уведомление (например, о панике со стеком)
+
+	QueuedAt  time.Time     // Когда обновление попало в очередь пользователя
+	QueueWait time.Duration // Сколько обновление ждало в очереди до начала обработки
+}
+
+type updateInfoKey struct{}
+
+// withUpdateInfo кладёт сведения об обновлении в контекст
+func withUpdateInfo(ctx context.Context, info *updateInfo) context.Context {
+	return context.WithValue(ctx, updateInfoKey{}, info)
+}
+
+// updateInfoFrom достаёт сведения об обновлении из контекста (никогда не nil)
+func updateInfoFrom(ctx context.Context) *updateInfo {
+	if info, ok := ctx.Value(updateInfoKey{}).(*updateInfo); ok {
+		return info
+	}
+	return &updateInfo{}
+}
+
+// newUpdateInfo собирает сведения об обновлении
+func newUpdateInfo(update tgbotapi.Update) *updateInfo {
+	info := &updateInfo{
+		RequestID: newRequestID(),
+		UpdateID:  update.UpdateID,
+		Kind:      updateKind(update),
+		Handler:   "none",
+	}
+	if chat := updateChat(update); chat != nil {
+		info.ChatID = chat.ID
+	}
+	if user := update.SentFrom(); user != nil {
+		info.UserID = user.ID
+	} else if update.MyChatMember != nil {
+		info.UserID = update.MyChatMember.From.ID
+	}
+	return info
+}
+
+// newRequestID генерирует код запроса из 8 символов base32 (например, 7HQ2KX9A)
+func newRequestID() string {
+	buf := make([]byte, 5)
+	rand.Read(buf)
+	return base32.StdEncoding.EncodeToString(buf)
+}
+
+// updateChat возвращает чат обновления или nil, если чата нет (например, inline-запрос)
+func updateChat(update tgbotapi.Update) *tgbotapi.Chat {
+	switch {
+	case update.Message != nil:
+		return update.Message.Chat
+	case update.EditedMessage != nil:
+		return update.EditedMessage.Chat
+	case update.ChannelPost != nil:
+		return update.ChannelPost.Chat
+	case update.EditedChannelPost != nil:
+		return update.EditedChannelPost.Chat
+	case update.CallbackQuery != nil && update.CallbackQuery.Message != nil:
+		return update.CallbackQuery.Message.Chat
+	case update.MyChatMember != nil:
+		return &update.MyChatMember.Chat
+	}
+	return nil
+}
+
+// updateKind определяет тип содержимого обновления для логов
+func updateKind(update tgbotapi.Update) string {
+	switch {
+	case update.Message != nil:
+		return messageKind(update.Message)
+	case update.CallbackQuery != nil:
+		return "callback"
+	case update.EditedMessage != nil:
+		return "edited_message"
+	case update.ChannelPost != nil:
+		return "channel_post"
+	case update.EditedChannelPost != nil:
+		return "edited_channel_post"
+	case update.InlineQuery != nil:
+		return "inline_query"
+	case update.MyChatMember != nil:
+		return "my_chat_member"
+	}
+	return "other"
+}
+
+// messageKind определяет тип содержимого сообщения
+func messageKind(message *tgbotapi.Message) string {
+	switch {
+	case message.IsCommand():
+		return "command"
+	case message.Text != "":
+		return "text"
+	case message.Voice != nil:
+		return "voice"
+	case message.Audio != nil:
+		return "audio"
+	case message.VideoNote != nil:
+		return "video_note"
+	case message.Document != nil:
+		return "document"
+	case len(message.Photo) > 0:
+		return "photo"
+	case message.Location != nil:
+		return "location"
+	case message.Sticker != nil:
+		return "sticker"
+	}
+	return "message"
+}
+
+// loggingMiddleware пишет одну структурированную запись на каждое обновление
+func (b *Bot) loggingMiddleware(next UpdateHandler) UpdateHandler {
+	return func(ctx context.Context, update tgbotapi.Update) error {
+		startedAt := time.Now()
+		err := next(ctx, update)
+
+		info := updateInfoFrom(ctx)
+		attrs := []any{
+			"bot", b.name,
+			"request_id", info.RequestID,
+			"update_id", info.UpdateID,
+			"chat_id", info.ChatID,
+			"user_id", info.UserID,
+			"kind", info.Kind,
+			"handler", info.Handler,
+			"duration", time.Since(startedAt).Round(time.Millisecond),
+		}
+		if err != nil {
+			slog.Error("update", append(attrs, "error", err)...)
+			if !info.Reported {
+				b.reportError(info, err)
+			}
+		} else {
+			slog.Info("update", attrs...)
+		}
+		return err
+	}
+}
+
+// recoveryMiddleware перехватывает панику в обработчике, чтобы одно обновление не роняло бота.
+// Стек пишется в лог, сокращённая версия уходит в админский чат, пользователь получает извинение.
+func (b *Bot) recoveryMiddleware(next UpdateHandler) UpdateHandler {
+	return func(ctx context.Context, update tgbotapi.Update) (err error) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+
+			info := updateInfoFrom(ctx)
+			stack := string(debug.Stack())
+			slog.Error("panic", "bot", b.name, "request_id", info.RequestID, "update_id", info.UpdateID, "handler", info.Handler, "panic", recovered, "stack", stack)
+
+			b.notifyAdmin(fmt.Sprintf("💥 Паника при обработке update %d (%s, chat %d, user %d), код %s: %v\n\n%s",
+				info.UpdateID, info.Handler, info.ChatID, info.UserID, info.RequestID, recovered, trimStack(stack, 3000)))
+			info.Reported = true
+
+			if info.ChatID != 0 {
+				msg := tgbotapi.NewMessage(info.ChatID, "😔 Что-то пошло не так при обработке сообщения. Попробуй ещё раз чуть позже.\n\n"+
+					"Код ошибки: "+info.RequestID)
+				if _, sendErr := b.api.Send(msg); sendErr != nil {
+					slog.Error("не удалось отправить извинение", "update_id", info.UpdateID, "error", sendErr)
+				}
+			}
+
+			err = fmt.Errorf("паника в обработчике: %v", recovered)
+		}()
+		return next(ctx, update)
+	}
+}
+
+// trimStack обрезает стек до limit байт, чтобы он поместился в сообщение Telegram
+func trimStack(stack string, limit int) string {
+	if len(stack) <= limit {
+		return stack
+	}
+	return stack[:limit] + "\n…"
+}
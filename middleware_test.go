@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestRecoveryMiddlewareKeepsProcessing(t *testing.T) {
+	b, fake := newTestBot(t)
+
+	var mu sync.Mutex
+	var handled []int
+	done := make(chan struct{})
+	b.handler = chainMiddlewares(func(ctx context.Context, update tgbotapi.Update) error {
+		if update.Message.Text == "panic" {
+			panic("обработчик сломался")
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		handled = append(handled, update.UpdateID)
+		if len(handled) == 2 {
+			close(done)
+		}
+		return nil
+	}, b.recoveryMiddleware)
+	b.queues = newUserQueues(b.handleUpdate, userQueueSize, time.Minute)
+
+	// Паника в одном обновлении не должна останавливать ни очередь этого пользователя, ни других
+	b.queues.Push(1, textUpdate(1, 1, "panic"))
+	b.queues.Push(1, textUpdate(2, 1, "после паники"))
+	b.queues.Push(2, textUpdate(3, 2, "другой пользователь"))
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("обновления после паники не обработаны, обработаны: %v", handled)
+	}
+	if n := fake.calls("sendMessage"); n != 1 {
+		t.Errorf("извинений отправлено %d, ожидалось 1", n)
+	}
+}
+
+func TestRecoveryMiddlewareReturnsError(t *testing.T) {
+	b, _ := newTestBot(t)
+	handler := b.recoveryMiddleware(func(ctx context.Context, update tgbotapi.Update) error {
+		panic("сбой")
+	})
+
+	update := textUpdate(1, 1, "привет")
+	info := newUpdateInfo(update)
+	err := handler(withUpdateInfo(context.Background(), info), update)
+	if err == nil {
+		t.Fatal("паника должна превращаться в ошибку")
+	}
+	if !info.Reported {
+		t.Error("паника должна помечаться как уже отправленная админам")
+	}
+}
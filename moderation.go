@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const moderationRefusal = "🙅 Не могу показать этот ответ. Попробуй переформулировать вопрос."
+
+// blockRule - регулярное выражение из списка запрещённого с категорией
+type blockRule struct {
+	category string
+	pattern  *regexp.Regexp
+}
+
+// loadBlocklist читает файл правил: по одному на строку, "категория: регулярка" или просто регулярка.
+// Пустые строки и строки с # пропускаются; регистр не учитывается.
+func loadBlocklist(path string) ([]blockRule, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия списка модерации: %w", err)
+	}
+	defer file.Close()
+
+	var rules []blockRule
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		category, expr, ok := strings.Cut(text, ": ")
+		if !ok {
+			category, expr = "blocklist", text
+		}
+		pattern, err := regexp.Compile("(?i)" + expr)
+		if err != nil {
+			return nil, fmt.Errorf("список модерации, строка %d: %w", line, err)
+		}
+		rules = append(rules, blockRule{category: strings.TrimSpace(category), pattern: pattern})
+	}
+	return rules, scanner.Err()
+}
+
+// moderationVerdict - решение модерации по одному ответу
+type moderationVerdict struct {
+	Flagged  bool
+	Category string
+}
+
+// moderationEnabled сообщает, включена ли проверка ответов
+func (b *Bot) moderationEnabled() bool {
+	return len(b.blocklist) > 0 || b.cfg().ModerationURL != ""
+}
+
+// moderate проверяет ответ модели: сначала локальным списком, потом внешним сервисом.
+// Сервис ограничен MODERATION_TIMEOUT; если он не ответил, решение зависит от MODERATION_FAIL_CLOSED.
+func (b *Bot) moderate(text string) moderationVerdict {
+	for _, rule := range b.blocklist {
+		if rule.pattern.MatchString(text) {
+			return moderationVerdict{Flagged: true, Category: rule.category}
+		}
+	}
+	if b.cfg().ModerationURL == "" {
+		return moderationVerdict{}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), b.cfg().ModerationTimeout)
+	defer cancel()
+	verdict, err := b.moderationRequest(ctx, text)
+	if err != nil {
+		b.metrics.inc("moderation_errors")
+		slog.Warn("сервис модерации недоступен", "error", err, "fail_closed", b.cfg().ModerationFailClosed)
+		if b.cfg().ModerationFailClosed {
+			return moderationVerdict{Flagged: true, Category: "unavailable"}
+		}
+		return moderationVerdict{}
+	}
+	return verdict
+}
+
+// moderationRequest обращается к OpenAI-совместимому эндпоинту модерации
+func (b *Bot) moderationRequest(ctx context.Context, text string) (moderationVerdict, error) {
+	body, err := json.Marshal(map[string]string{"input": text})
+	if err != nil {
+		return moderationVerdict{}, fmt.Errorf("ошибка маршалинга запроса модерации: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.cfg().ModerationURL, bytes.NewReader(body))
+	if err != nil {
+		return moderationVerdict{}, fmt.Errorf("ошибка создания запроса модерации: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+b.cfg().HuggingFaceAPIToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := b.aiClient.Do(req)
+	if err != nil {
+		return moderationVerdict{}, fmt.Errorf("ошибка запроса модерации: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return moderationVerdict{}, fmt.Errorf("сервис модерации вернул %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Results []struct {
+			Flagged    bool            `json:"flagged"`
+			Categories map[string]bool `json:"categories"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return moderationVerdict{}, fmt.Errorf("ошибка разбора ответа модерации: %w", err)
+	}
+	for _, r := range result.Results {
+		if !r.Flagged {
+			continue
+		}
+		var categories []string
+		for name, hit := range r.Categories {
+			if hit {
+				categories = append(categories, name)
+			}
+		}
+		return moderationVerdict{Flagged: true, Category: strings.Join(categories, ",")}, nil
+	}
+	return moderationVerdict{}, nil
+}
+
+// recordFlagged сохраняет заблокированный ответ для /flagged.
+// В строгом режиме приватности текст не сохраняется - только факт и категория.
+func (b *Bot) recordFlagged(userID, chatID int64, privacy, category, question, answer string) {
+	b.metrics.inc("moderation_flagged")
+	slog.Warn("ответ заблокирован модерацией", "user_id", userID, "chat_id", chatID, "category", category)
+
+	if privacy == privacyStrict {
+		question, answer = "", ""
+	}
+	_, err := b.db.Exec("INSERT INTO flagged (user_id, chat_id, category, question, answer) VALUES (?, ?, ?, ?, ?)",
+		userID, chatID, category, question, answer)
+	if err != nil {
+		slog.Error("не удалось сохранить заблокированный ответ", "error", err)
+	}
+}
+
+// flagged обрабатывает команду /flagged: последние заблокированные ответы для проверки администратором
+func (b *Bot) flagged(message *tgbotapi.Message) error {
+	rows, err := b.db.Query("SELECT user_id, category, question, answer, created_at FROM flagged ORDER BY id DESC LIMIT 10")
+	if err != nil {
+		return fmt.Errorf("ошибка получения заблокированных ответов: %w", err)
+	}
+	defer rows.Close()
+
+	var sb strings.Builder
+	for rows.Next() {
+		var userID int64
+		var category, question, answer string
+		var createdAt time.Time
+		if err := rows.Scan(&userID, &category, &question, &answer, &createdAt); err != nil {
+			return fmt.Errorf("ошибка чтения заблокированных ответов: %w", err)
+		}
+		fmt.Fprintf(&sb, "\n— %s · user %d · %s\n", createdAt.Format("02.01 15:04"), userID, category)
+		if question != "" {
+			fmt.Fprintf(&sb, "❓ %s\n🤖 %s\n", truncateRunes(question, 200), truncateRunes(answer, 300))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("ошибка чтения заблокированных ответов: %w", err)
+	}
+	if sb.Len() == 0 {
+		return b.reply(message, "Заблокированных ответов нет.")
+	}
+	return b.reply(message, truncateRunes(fmt.Sprintf("🚩 Заблокировано всего с запуска: %d\n%s", b.metrics.get("moderation_flagged"), sb.String()), messageTextLimit))
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	answerPageLimit = 3500           // Символов на странице: запас под закрытие блока кода и номер страницы
+	answerPagesTTL  = 48 * time.Hour // Сколько хранятся страницы; потом кнопки перестают работать
+)
+
+// paginateAnswer делит длинный ответ на страницы по границам абзацев. Абзац длиннее страницы
+// режется как обычное сообщение. Если страница кончается внутри блока кода, блок закрывается
+// и открывается заново (с тем же языком) в начале следующей страницы.
+func paginateAnswer(text string, limit int) []string {
+	var blocks []string
+	for _, paragraph := range strings.Split(text, "\n\n") {
+		blocks = append(blocks, splitMessage(paragraph, limit-100)...)
+	}
+
+	var pages []string
+	var page strings.Builder
+	fence := "" // Строка, открывшая незакрытый блок кода, или пустая
+	for _, block := range blocks {
+		size := utf8.RuneCountInString(page.String()) + utf8.RuneCountInString(block) + len("\n\n\n```")
+		if page.Len() > 0 && size > limit {
+			if fence != "" {
+				page.WriteString("\n```")
+			}
+			pages = append(pages, page.String())
+			page.Reset()
+			if fence != "" {
+				page.WriteString(fence + "\n")
+			}
+		} else if page.Len() > 0 {
+			page.WriteString("\n\n")
+		}
+		page.WriteString(block)
+		fence = fenceAfter(fence, block)
+	}
+	if page.Len() > 0 || len(pages) == 0 {
+		pages = append(pages, page.String())
+	}
+	return pages
+}
+
+// fenceAfter возвращает строку, открывшую блок кода, который остаётся незакрытым после text
+func fenceAfter(open, text string) string {
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "```") {
+			continue
+		}
+		if open == "" {
+			open = line
+		} else {
+			open = ""
+		}
+	}
+	return open
+}
+
+// deliverUserAnswer доставляет ответ так, как выбрал пользователь: длинный ответ - страницами
+// с кнопками (/pages on) или несколькими сообщениями подряд. Возвращает отправленные сообщения;
+// для ответа страницами - пустой список: у него уже своя клавиатура.
+func (b *Bot) deliverUserAnswer(userID, chatID int64, placeholderID, replyTo int, text string) ([]tgbotapi.Message, error) {
+	plain, err := b.getUserPlain(userID)
+	if err != nil {
+		log.Printf("Ошибка получения режима простого текста: %v", err)
+	}
+	if plain {
+		text = stripMarkdown(renderTablesWith(text, formatTableList)) // Страницы тоже без разметки
+	}
+	if utf8.RuneCountInString(text) > messageTextLimit {
+		paged, err := b.getUserPagedAnswers(userID)
+		if err != nil {
+			log.Printf("Ошибка получения настройки страниц: %v", err)
+		}
+		if paged {
+			return nil, b.deliverPaged(userID, chatID, placeholderID, replyTo, text)
+		}
+	}
+	return b.deliverAnswerMode(chatID, placeholderID, replyTo, text, plain)
+}
+
+// deliverPaged сохраняет страницы ответа и показывает первую на месте плейсхолдера
+func (b *Bot) deliverPaged(userID, chatID int64, placeholderID, replyTo int, text string) error {
+	pages := paginateAnswer(renderTables(text), answerPageLimit)
+	if len(pages) == 1 {
+		_, err := b.deliverAnswer(chatID, placeholderID, replyTo, text)
+		return err
+	}
+
+	data, err := json.Marshal(pages)
+	if err != nil {
+		return fmt.Errorf("ошибка маршалинга страниц: %w", err)
+	}
+	res, err := b.db.Exec("INSERT INTO answer_pages (bot_id, user_id, chat_id, pages) VALUES (?, ?, ?, ?)",
+		b.botID, userID, chatID, string(data))
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения страниц: %w", err)
+	}
+	id, _ := res.LastInsertId()
+
+	text, keyboard := renderAnswerPage(id, pages, 0)
+	_, err = b.sendFormatted(text, func(text, parseMode string) tgbotapi.Chattable {
+		edit := tgbotapi.NewEditMessageText(chatID, placeholderID, text)
+		edit.ParseMode = parseMode
+		edit.ReplyMarkup = &keyboard
+		return edit
+	})
+	if err == nil {
+		return nil
+	}
+	// Плейсхолдер могли удалить - тогда отправляем первую страницу обычным сообщением
+	log.Printf("Ошибка редактирования плейсхолдера, отправляю новым сообщением: %v", err)
+	b.deleteMessage(chatID, placeholderID)
+	_, err = b.sendFormatted(text, func(text, parseMode string) tgbotapi.Chattable {
+		msg := tgbotapi.NewMessage(chatID, text)
+		msg.ParseMode = parseMode
+		msg.ReplyToMessageID = replyTo
+		msg.ReplyMarkup = keyboard
+		return msg
+	})
+	if err != nil {
+		return fmt.Errorf("ошибка отправки первой страницы: %w", err)
+	}
+	return nil
+}
+
+// renderAnswerPage собирает текст страницы с номером и кнопки ◀️▶️
+func renderAnswerPage(id int64, pages []string, page int) (string, tgbotapi.InlineKeyboardMarkup) {
+	text := fmt.Sprintf("%s\n\n📄 стр. %d/%d", pages[page], page+1, len(pages))
+	var row []tgbotapi.InlineKeyboardButton
+	if page > 0 {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData("◀️", fmt.Sprintf("page:%d:%d", id, page-1)))
+	}
+	if page < len(pages)-1 {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData("▶️", fmt.Sprintf("page:%d:%d", id, page+1)))
+	}
+	return text, tgbotapi.NewInlineKeyboardMarkup(row)
+}
+
+// handleAnswerPage показывает запрошенную страницу ответа; payload - "id:страница".
+// Листать может любой, кто видит сообщение: страницы - это уже отправленный в чат ответ.
+func (b *Bot) handleAnswerPage(query *tgbotapi.CallbackQuery, payload string) (string, error) {
+	idText, pageText, _ := strings.Cut(payload, ":")
+	id, err := strconv.ParseInt(idText, 10, 64)
+	page, pageErr := strconv.Atoi(pageText)
+	if err != nil || pageErr != nil {
+		return "Некорректная кнопка", nil
+	}
+
+	chatID, messageID := query.Message.Chat.ID, query.Message.MessageID
+	cutoff := time.Now().Add(-answerPagesTTL).UTC().Format("2006-01-02 15:04:05")
+	var data string
+	err = b.db.QueryRow("SELECT pages FROM answer_pages WHERE id = ? AND chat_id = ? AND created_at >= ?", id, chatID, cutoff).Scan(&data)
+	if err == sql.ErrNoRows {
+		// Страницы устарели: убираем кнопки, текущая страница остаётся как есть
+		empty := tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}
+		if _, err := b.api.Request(tgbotapi.NewEditMessageReplyMarkup(chatID, messageID, empty)); err != nil {
+			log.Printf("Ошибка удаления кнопок страниц: %v", err)
+		}
+		return "Страницы этого ответа уже удалены - спроси заново", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("ошибка получения страниц: %w", err)
+	}
+	var pages []string
+	if err := json.Unmarshal([]byte(data), &pages); err != nil {
+		return "", fmt.Errorf("ошибка разбора страниц: %w", err)
+	}
+	if page < 0 || page >= len(pages) {
+		return "Некорректная кнопка", nil
+	}
+
+	text, keyboard := renderAnswerPage(id, pages, page)
+	_, err = b.sendFormatted(text, func(text, parseMode string) tgbotapi.Chattable {
+		edit := tgbotapi.NewEditMessageText(chatID, messageID, text)
+		edit.ParseMode = parseMode
+		edit.ReplyMarkup = &keyboard
+		return edit
+	})
+	if err != nil && !isNotModified(err) {
+		return "", fmt.Errorf("ошибка показа страницы: %w", err)
+	}
+	return "", nil
+}
+
+// setPagedAnswers обрабатывает команду /pages on|off: длинные ответы страницами вместо нескольких сообщений
+func (b *Bot) setPagedAnswers(message *tgbotapi.Message) error {
+	paged, ok := parseToggle(message.CommandArguments())
+	if !ok {
+		return b.reply(message, "Использование: /pages on - длинные ответы одним сообщением со страницами, "+
+			"/pages off - несколькими сообщениями подряд")
+	}
+	if err := b.setUserPagedAnswers(senderID(message), paged); err != nil {
+		b.reply(message, "Не удалось сохранить настройку, попробуй позже.")
+		return err
+	}
+	if paged {
+		return b.reply(message, fmt.Sprintf("📄 Длинные ответы буду присылать одним сообщением со страницами ◀️▶️. "+
+			"Листать можно %d часов.", int(answerPagesTTL.Hours())))
+	}
+	return b.reply(message, "Длинные ответы снова приходят несколькими сообщениями.")
+}
+
+// setUserPagedAnswers сохраняет настройку постраничных ответов
+func (b *Bot) setUserPagedAnswers(userID int64, paged bool) error {
+	if _, err := b.db.Exec("INSERT OR IGNORE INTO users (user_id) VALUES (?)", userID); err != nil {
+		return fmt.Errorf("ошибка при вставке пользователя: %w", err)
+	}
+	if _, err := b.db.Exec("UPDATE users SET paged_answers = ? WHERE user_id = ?", paged, userID); err != nil {
+		return fmt.Errorf("ошибка при обновлении настройки страниц: %w", err)
+	}
+	return nil
+}
+
+// getUserPagedAnswers возвращает, присылать ли пользователю длинные ответы страницами
+func (b *Bot) getUserPagedAnswers(userID int64) (bool, error) {
+	var paged bool
+	err := b.db.QueryRow("SELECT COALESCE(paged_answers, 0) FROM users WHERE user_id = ?", userID).Scan(&paged)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("ошибка при получении настройки страниц: %w", err)
+	}
+	return paged, nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	maxPendingPerUser    = 3                // Сколько вопросов одного пользователя может ждать в очереди
+	pendingMaxAge        = 3 * time.Hour    // Более старые вопросы не отвечаются: они уже неактуальны
+	pendingProbeInterval = 30 * time.Second // Как часто проверять, вернулась ли модель
+	pendingBatchSize     = 20               // Сколько вопросов разбирать за один проход
+)
+
+// pendingRequest - вопрос, оставшийся без ответа из-за недоступности модели
+type pendingRequest struct {
+	ID        int64
+	UserID    int64
+	ChatID    int64
+	MessageID int // Исходное сообщение пользователя
+	NoticeID  int // Сообщение бота с извинением и кнопкой "Повторить"
+	Prompt    string
+	CreatedAt time.Time
+}
+
+// savePending ставит вопрос в очередь отложенных ответов
+func (b *Bot) savePending(in chatInput, messageID int) (int64, error) {
+	res, err := b.db.Exec("INSERT INTO pending_requests (bot_id, user_id, chat_id, message_id, prompt) VALUES (?, ?, ?, ?, ?)",
+		b.botID, in.UserID, in.ChatID, messageID, in.Prompt)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка сохранения вопроса в очередь: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("ошибка сохранения вопроса в очередь: %w", err)
+	}
+	return id, nil
+}
+
+// countPending возвращает число вопросов пользователя в очереди
+func (b *Bot) countPending(userID int64) (int, error) {
+	var count int
+	err := b.db.QueryRow("SELECT COUNT(*) FROM pending_requests WHERE bot_id = ? AND user_id = ?", b.botID, userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка подсчёта вопросов в очереди: %w", err)
+	}
+	return count, nil
+}
+
+// loadPending читает вопросы бота из очереди, старые первыми
+func (b *Bot) loadPending(limit int) ([]pendingRequest, error) {
+	rows, err := b.db.Query(`SELECT id, user_id, chat_id, message_id, notice_id, prompt, created_at
+		FROM pending_requests WHERE bot_id = ? ORDER BY id LIMIT ?`, b.botID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения очереди вопросов: %w", err)
+	}
+	defer rows.Close()
+
+	var requests []pendingRequest
+	for rows.Next() {
+		var r pendingRequest
+		if err := rows.Scan(&r.ID, &r.UserID, &r.ChatID, &r.MessageID, &r.NoticeID, &r.Prompt, &r.CreatedAt); err != nil {
+			return nil, fmt.Errorf("ошибка чтения очереди вопросов: %w", err)
+		}
+		requests = append(requests, r)
+	}
+	return requests, rows.Err()
+}
+
+// deletePending убирает вопрос из очереди
+func (b *Bot) deletePending(id int64) error {
+	if _, err := b.db.Exec("DELETE FROM pending_requests WHERE id = ?", id); err != nil {
+		return fmt.Errorf("ошибка удаления вопроса из очереди: %w", err)
+	}
+	return nil
+}
+
+// pendingLoop периодически проверяет, вернулась ли модель, и отвечает на накопившиеся вопросы
+func (b *Bot) pendingLoop() {
+	ticker := time.NewTicker(pendingProbeInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := b.processPending(); err != nil {
+			slog.Warn("не удалось разобрать очередь вопросов", "bot", b.name, "error", err)
+		}
+	}
+}
+
+// processPending отвечает на вопросы из очереди, пока модель отвечает. Пока цепь разомкнута,
+// ничего не делает; первый же сбой останавливает проход до следующей проверки.
+func (b *Bot) processPending() error {
+	if b.breaker.open(time.Now()) {
+		return nil
+	}
+	b.pendingMu.Lock()
+	defer b.pendingMu.Unlock()
+
+	requests, err := b.loadPending(pendingBatchSize)
+	if err != nil {
+		return err
+	}
+	for _, r := range requests {
+		if time.Since(r.CreatedAt) > pendingMaxAge {
+			b.expirePending(r)
+			continue
+		}
+		if err := b.answerPending(r, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// answerPending отвечает на вопрос из очереди ответом на исходное сообщение и убирает извинение.
+// firstName нужен для обращения по имени; из фонового прохода его нет.
+func (b *Bot) answerPending(r pendingRequest, firstName string) error {
+	in := chatInput{UserID: r.UserID, ChatID: r.ChatID, FirstName: firstName, Prompt: r.Prompt}
+	turn := b.prepareChat(context.Background(), in)
+	aiResponse, err := b.completeChat(context.Background(), in, turn)
+	if err != nil {
+		return err
+	}
+
+	text := fmt.Sprintf("Отвечаю на твой вопрос от %s:\n\n%s", r.CreatedAt.Local().Format("15:04"), aiResponse.Content)
+	placeholder := tgbotapi.NewMessage(r.ChatID, "⌛ Думаю...")
+	placeholder.ReplyToMessageID = r.MessageID
+	placeholder.AllowSendingWithoutReply = true // Исходное сообщение могли удалить
+	sent, err := b.api.Send(placeholder)
+	if err != nil {
+		return fmt.Errorf("ошибка отправки отложенного ответа: %w", err)
+	}
+	if _, err := b.deliverAnswerFor(r.UserID, r.ChatID, sent.MessageID, r.MessageID, text); err != nil {
+		return fmt.Errorf("ошибка отправки отложенного ответа: %w", err)
+	}
+	if r.NoticeID != 0 {
+		b.deleteMessage(r.ChatID, r.NoticeID)
+	}
+	b.saveChat(in, turn, aiResponse)
+	return b.deletePending(r.ID)
+}
+
+// expirePending снимает с очереди слишком старый вопрос и просит задать его заново
+func (b *Bot) expirePending(r pendingRequest) {
+	if r.NoticeID != 0 {
+		edit := tgbotapi.NewEditMessageText(r.ChatID, r.NoticeID, "😴 ИИ долго был недоступен, и вопрос устарел. Задай его заново, пожалуйста.")
+		if _, err := b.api.Send(edit); err != nil {
+			slog.Warn("не удалось обновить устаревший вопрос", "chat_id", r.ChatID, "error", err)
+		}
+	}
+	if err := b.deletePending(r.ID); err != nil {
+		slog.Warn("не удалось удалить устаревший вопрос", "id", r.ID, "error", err)
+	}
+}
+
+// handleRetry обрабатывает кнопку "Повторить": отвечает на вопрос из очереди, не дожидаясь фонового прохода
+func (b *Bot) handleRetry(query *tgbotapi.CallbackQuery, payload string) (string, error) {
+	id, err := strconv.ParseInt(payload, 10, 64)
+	if err != nil {
+		return "Некорректная кнопка", nil
+	}
+	b.pendingMu.Lock()
+	defer b.pendingMu.Unlock()
+
+	var r pendingRequest
+	err = b.db.QueryRow(`SELECT id, user_id, chat_id, message_id, notice_id, prompt, created_at
+		FROM pending_requests WHERE id = ? AND user_id = ?`, id, query.From.ID).
+		Scan(&r.ID, &r.UserID, &r.ChatID, &r.MessageID, &r.NoticeID, &r.Prompt, &r.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "На этот вопрос я уже ответил или он устарел", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("ошибка получения вопроса из очереди: %w", err)
+	}
+	if b.breaker.open(time.Now()) {
+		return "ИИ всё ещё недоступен, отвечу, как только он вернётся", nil
+	}
+
+	if err := b.answerPending(r, query.From.FirstName); err != nil {
+		if isBackendFailure(err) {
+			return "ИИ всё ещё недоступен, отвечу, как только он вернётся", nil
+		}
+		return "", err
+	}
+	return "", nil
+}
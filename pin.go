@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// offerAnswerButtons добавляет под ответом кнопки 📌 и 📤. Кнопка 📌 в личке есть всегда, в группе - только если
+// бот может закреплять сообщения: иначе кнопка лишь обещала бы то, чего бот сделать не сможет.
+func (b *Bot) offerAnswerButtons(chatID int64, messageID int) {
+	canPin := true
+	if chatID < 0 { // Отрицательные ID - группы и каналы
+		var err error
+		if canPin, err = b.botCanPin(chatID); err != nil {
+			log.Printf("Ошибка проверки права закреплять сообщения: %v", err)
+		}
+	}
+	if _, err := b.api.Request(tgbotapi.NewEditMessageReplyMarkup(chatID, messageID, answerButtons(canPin))); err != nil {
+		log.Printf("Ошибка добавления кнопок под ответом: %v", err)
+	}
+}
+
+// answerButtons - клавиатура под ответом: 📌 закрепить (если можно) и 📤 поделиться
+func answerButtons(withPin bool) tgbotapi.InlineKeyboardMarkup {
+	var row []tgbotapi.InlineKeyboardButton
+	if withPin {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData("📌", "pin:"))
+	}
+	row = append(row, tgbotapi.NewInlineKeyboardButtonData("📤 Поделиться", "share:"))
+	return tgbotapi.NewInlineKeyboardMarkup(row)
+}
+
+// handlePin закрепляет ответ без уведомления. В группе кнопку может нажать только администратор чата.
+func (b *Bot) handlePin(query *tgbotapi.CallbackQuery, _ string) (string, error) {
+	chat := query.Message.Chat
+	if !chat.IsPrivate() {
+		admins, err := b.chatAdmins(chat.ID)
+		if err != nil {
+			return "Не удалось проверить права, попробуй позже", err
+		}
+		if !admins[query.From.ID] {
+			return "Закреплять ответы могут только администраторы чата", nil
+		}
+	}
+
+	pin := tgbotapi.PinChatMessageConfig{ChatID: chat.ID, MessageID: query.Message.MessageID, DisableNotification: true}
+	if _, err := b.api.Request(pin); err != nil {
+		if isNoRightsError(err) {
+			// Права отобрали после того, как кнопка появилась: перечитаем список при следующем ответе
+			b.chatAdminCache.mu.Lock()
+			delete(b.chatAdminCache.entries, chat.ID)
+			b.chatAdminCache.mu.Unlock()
+			return "У бота нет права закреплять сообщения - выдай его в настройках администраторов чата", nil
+		}
+		return "Не удалось закрепить сообщение", err
+	}
+
+	// Закреплённому ответу кнопка 📌 больше не нужна, 📤 остаётся
+	if _, err := b.api.Request(tgbotapi.NewEditMessageReplyMarkup(chat.ID, query.Message.MessageID, answerButtons(false))); err != nil {
+		log.Printf("Ошибка удаления кнопки закрепления: %v", err)
+	}
+	return "📌 Закреплено", nil
+}
+
+// isNoRightsError - отказ Telegram из-за недостатка прав бота в чате
+func isNoRightsError(err error) bool {
+	var apiErr *tgbotapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	text := strings.ToLower(apiErr.Message)
+	return strings.Contains(text, "not enough rights") || strings.Contains(text, "chat_admin_required")
+}
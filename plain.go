@@ -0,0 +1,90 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// plainInstruction - строка системного промпта для /plain on: ответ будут слушать через экранный диктор
+const plainInstruction = "Пользователь слушает ответы через экранный диктор. Не используй эмодзи, Markdown " +
+	"и декоративное оформление (звёздочки, решётки, таблицы, разделители); списки пиши простыми строками."
+
+var (
+	plainQuotePattern = regexp.MustCompile(`(?m)^[ \t]*>[ \t]?`)
+	plainRulePattern  = regexp.MustCompile(`(?m)^[ \t]*([-*_][ \t]*){3,}$\n?`)
+	plainLinkPattern  = regexp.MustCompile(`\[([^\]\n]+)\]\((https?://[^)\s]+)\)`)
+)
+
+// stripMarkdown убирает из ответа разметку Markdown, которую модель всё же добавила: диктор читает
+// звёздочки и решётки вслух. Текст внутри блоков кода сохраняется, пропадают только ограждения ```.
+func stripMarkdown(text string) string {
+	var out []string
+	inCode := false
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			out = append(out, line)
+			continue
+		}
+		line = headingPattern.ReplaceAllString(line, "$1")
+		line = bulletPattern.ReplaceAllString(line, "$1- ")
+		line = boldPattern.ReplaceAllString(line, "$1$2")
+		line = italicPattern.ReplaceAllString(line, "$1$2")
+		line = strikePattern.ReplaceAllString(line, "$1")
+		line = plainLinkPattern.ReplaceAllString(line, "$1 ($2)")
+		line = strings.ReplaceAll(line, "`", "")
+		out = append(out, line)
+	}
+	text = strings.Join(out, "\n")
+	text = plainRulePattern.ReplaceAllString(text, "")
+	return plainQuotePattern.ReplaceAllString(text, "")
+}
+
+// setPlain обрабатывает команду /plain on|off: ответы без эмодзи и разметки для экранного диктора
+func (b *Bot) setPlain(message *tgbotapi.Message) error {
+	plain, ok := parseToggle(message.CommandArguments())
+	if !ok {
+		return b.reply(message, "Использование: /plain on или /plain off\n\n"+
+			"Когда включено, я отвечаю простым текстом: без эмодзи, звёздочек и прочего оформления. "+
+			"Удобно, если ответы читает экранный диктор. Работает с любым стилем.")
+	}
+	if err := b.setUserPlain(senderID(message), plain); err != nil {
+		b.reply(message, "Не удалось сохранить настройку, попробуй позже.")
+		return err
+	}
+	if plain {
+		return b.reply(message, "Готово: отвечаю простым текстом, без эмодзи и разметки.")
+	}
+	return b.reply(message, "Готово: ответы снова с оформлением.")
+}
+
+// setUserPlain сохраняет режим простого текста
+func (b *Bot) setUserPlain(userID int64, plain bool) error {
+	if _, err := b.db.Exec("INSERT OR IGNORE INTO users (user_id) VALUES (?)", userID); err != nil {
+		return fmt.Errorf("ошибка при вставке пользователя: %w", err)
+	}
+	if _, err := b.db.Exec("UPDATE users SET plain_text = ? WHERE user_id = ?", plain, userID); err != nil {
+		return fmt.Errorf("ошибка при обновлении режима простого текста: %w", err)
+	}
+	return nil
+}
+
+// getUserPlain возвращает, отвечать ли пользователю простым текстом
+func (b *Bot) getUserPlain(userID int64) (bool, error) {
+	var plain bool
+	err := b.db.QueryRow("SELECT COALESCE(plain_text, 0) FROM users WHERE user_id = ?", userID).Scan(&plain)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("ошибка при получении режима простого текста: %w", err)
+	}
+	return plain, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const privateOnlyText = "Я работаю только в личных сообщениях"
+
+// privateOnlyMiddleware при PRIVATE_ONLY=true выходит из любых групп и каналов.
+// Предупреждение отправляется один раз на чат, повторные добавления обходятся без сообщения.
+func (b *Bot) privateOnlyMiddleware(next UpdateHandler) UpdateHandler {
+	return func(ctx context.Context, update tgbotapi.Update) error {
+		if !b.cfg().PrivateOnly {
+			return next(ctx, update)
+		}
+
+		chat := updateChat(update)
+		if chat == nil || chat.IsPrivate() {
+			return next(ctx, update)
+		}
+
+		// Событие о нашем собственном выходе или удалении из чата
+		if member := update.MyChatMember; member != nil &&
+			(member.NewChatMember.HasLeft() || member.NewChatMember.WasKicked()) {
+			return nil
+		}
+
+		updateInfoFrom(ctx).Handler = "privateOnly"
+		return b.leaveGroup(chat)
+	}
+}
+
+// leaveGroup предупреждает чат (если ещё не предупреждали) и покидает его
+func (b *Bot) leaveGroup(chat *tgbotapi.Chat) error {
+	notified, err := b.wasLeftChat(chat.ID)
+	if err != nil {
+		return err
+	}
+
+	if !notified && !chat.IsChannel() {
+		if _, err := b.api.Send(tgbotapi.NewMessage(chat.ID, privateOnlyText)); err != nil {
+			slog.Warn("не удалось отправить предупреждение перед выходом из чата", "chat_id", chat.ID, "error", err)
+		}
+	}
+
+	if err := b.recordLeftChat(chat.ID); err != nil {
+		return err
+	}
+
+	if _, err := b.api.Request(tgbotapi.LeaveChatConfig{ChatID: chat.ID}); err != nil {
+		return fmt.Errorf("ошибка выхода из чата %d: %w", chat.ID, err)
+	}
+	return nil
+}
+
+// recordLeftChat запоминает чат, из которого бот вышел в режиме PRIVATE_ONLY
+func (b *Bot) recordLeftChat(chatID int64) error {
+	_, err := b.db.Exec("INSERT OR IGNORE INTO left_chats (chat_id) VALUES (?)", chatID)
+	if err != nil {
+		return fmt.Errorf("ошибка при сохранении покинутого чата: %w", err)
+	}
+	return nil
+}
+
+// wasLeftChat проверяет, выходил ли бот из этого чата раньше
+func (b *Bot) wasLeftChat(chatID int64) (bool, error) {
+	var id int64
+	err := b.db.QueryRow("SELECT chat_id FROM left_chats WHERE chat_id = ?", chatID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("ошибка при проверке покинутого чата: %w", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// probeState - результат последней фоновой проверки модели (в памяти)
+type probeState struct {
+	mu      sync.Mutex
+	checked bool // Была ли хотя бы одна проверка
+	healthy bool
+	latency time.Duration
+	at      time.Time
+}
+
+// record запоминает результат проверки и сообщает, сменилось ли состояние модели
+func (p *probeState) record(healthy bool, latency time.Duration, now time.Time) (changed bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Первая проверка не считается переходом: прежнее состояние неизвестно
+	changed = p.checked && p.healthy != healthy
+	p.checked, p.healthy, p.latency, p.at = true, healthy, latency, now
+	return changed
+}
+
+// describe описывает последнюю проверку для /status
+func (p *probeState) describe(now time.Time) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch {
+	case !p.checked:
+		return "ещё не было"
+	case p.healthy:
+		return fmt.Sprintf("успешна за %s, %s назад", p.latency.Round(time.Millisecond), now.Sub(p.at).Round(time.Second))
+	}
+	return fmt.Sprintf("неудачна, %s назад", now.Sub(p.at).Round(time.Second))
+}
+
+// probeLoop раз в PROBE_INTERVAL проверяет доступность модели коротким запросом,
+// чтобы узнавать о сбоях раньше пользователей. Запрос никому не засчитывается,
+// а его результат попадает в автомат цепи, как у обычных запросов.
+func (b *Bot) probeLoop(ctx context.Context) {
+	ticker := time.NewTicker(b.cfg().ProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			b.probe(ctx)
+		}
+	}
+}
+
+// probe выполняет одну проверку, если живой трафик ещё не показал, что модель работает
+func (b *Bot) probe(ctx context.Context) {
+	now := time.Now()
+	// Недавний успешный ответ пользователю и так доказывает, что модель доступна
+	if last := b.breaker.lastSuccessAt(); now.Sub(last) < b.cfg().ProbeInterval {
+		return
+	}
+	// Пока цепь разомкнута, пробный запрос всё равно не пройдёт - ждём, когда автомат его пропустит
+	if b.breaker.open(now) {
+		return
+	}
+
+	startedAt := time.Now()
+	_, err := b.doChatRequest(ctx, OpenAIRequest{
+		Model:     MODEL,
+		Messages:  []ChatMessage{{Role: "user", Content: "ping"}},
+		MaxTokens: 1,
+	})
+	if errors.Is(err, context.Canceled) {
+		return // Остановка бота - не сбой модели
+	}
+	latency := time.Since(startedAt)
+	healthy := err == nil || !isBackendFailure(err)
+	if healthy {
+		b.metrics.inc("probe_ok")
+	} else {
+		b.metrics.inc("probe_failed")
+		slog.Warn("фоновая проверка модели не прошла", "error", err, "latency", latency.Round(time.Millisecond))
+	}
+
+	if b.probeState.record(healthy, latency, time.Now()) {
+		if healthy {
+			b.notifyAdmin(fmt.Sprintf("✅ Модель снова отвечает (проверка за %s)", latency.Round(time.Millisecond)))
+		} else {
+			b.notifyAdmin("❌ Модель перестала отвечать: " + err.Error())
+		}
+	}
+}
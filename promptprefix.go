@@ -0,0 +1,93 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// settingPromptPrefix - ключ общего префикса в таблице settings
+const settingPromptPrefix = "system_prompt_prefix"
+
+// getSetting читает глобальную настройку из таблицы settings; ok=false - строки нет
+func (b *Bot) getSetting(key string) (value string, ok bool, err error) {
+	err = b.db.QueryRow("SELECT value FROM settings WHERE key = ?", key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("ошибка получения настройки %s: %w", key, err)
+	}
+	return value, true, nil
+}
+
+// setSetting сохраняет глобальную настройку
+func (b *Bot) setSetting(key, value string) error {
+	_, err := b.db.Exec(`INSERT INTO settings (key, value) VALUES (?, ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value, updated_at = CURRENT_TIMESTAMP`, key, value)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения настройки %s: %w", key, err)
+	}
+	return nil
+}
+
+// deleteSetting удаляет глобальную настройку: снова действует значение из окружения
+func (b *Bot) deleteSetting(key string) error {
+	if _, err := b.db.Exec("DELETE FROM settings WHERE key = ?", key); err != nil {
+		return fmt.Errorf("ошибка удаления настройки %s: %w", key, err)
+	}
+	return nil
+}
+
+// systemPromptPrefix возвращает общий префикс: заданный командой /prompt_prefix (в том числе пустой),
+// а если его нет - SYSTEM_PROMPT_PREFIX
+func (b *Bot) systemPromptPrefix() string {
+	prefix, ok, err := b.getSetting(settingPromptPrefix)
+	if err != nil {
+		log.Printf("Ошибка получения префикса промпта: %v", err)
+	}
+	if ok {
+		return prefix
+	}
+	return b.cfg().SystemPromptPrefix
+}
+
+// promptPrefix обрабатывает команду /prompt_prefix (только для администраторов): показывает и меняет
+// общий префикс системного промпта. Изменение действует со следующего ответа, без перезапуска.
+func (b *Bot) promptPrefix(message *tgbotapi.Message) error {
+	arg := strings.TrimSpace(message.CommandArguments())
+	switch arg {
+	case "":
+		prefix, ok, err := b.getSetting(settingPromptPrefix)
+		if err != nil {
+			return err
+		}
+		source := "задан командой"
+		if !ok {
+			prefix, source = b.cfg().SystemPromptPrefix, "из SYSTEM_PROMPT_PREFIX"
+		}
+		if prefix == "" {
+			prefix = "(пусто)"
+		}
+		return b.reply(message, fmt.Sprintf("Префикс системного промпта (%s):\n\n%s\n\n"+
+			"/prompt_prefix <текст> - задать, /prompt_prefix off - без префикса, /prompt_prefix reset - вернуть SYSTEM_PROMPT_PREFIX",
+			source, prefix))
+	case "reset":
+		if err := b.deleteSetting(settingPromptPrefix); err != nil {
+			return err
+		}
+		return b.reply(message, "Префикс снова берётся из SYSTEM_PROMPT_PREFIX.")
+	case "off":
+		arg = ""
+	}
+	if err := b.setSetting(settingPromptPrefix, arg); err != nil {
+		return err
+	}
+	if arg == "" {
+		return b.reply(message, "Префикс отключён: промпт начинается со стиля.")
+	}
+	return b.reply(message, "✅ Префикс сохранён, действует со следующего ответа.")
+}
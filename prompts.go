@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	maxSavedPrompts     = 20  // Сколько промптов может сохранить один пользователь
+	maxPromptNameLength = 32  // Длина имени промпта в символах
+	inlineQueryLimit    = 256 // Длиннее Telegram не подставит промпт в поле ввода
+)
+
+// SavedPrompt - промпт, сохранённый пользователем через /save
+type SavedPrompt struct {
+	ID     int64
+	Name   string
+	Prompt string
+}
+
+// save обрабатывает команду /save <имя>: сохраняет текст своего сообщения, на которое отвечает команда
+func (b *Bot) save(message *tgbotapi.Message) error {
+	userID := senderID(message)
+	name := strings.TrimSpace(message.CommandArguments())
+	original := message.ReplyToMessage
+	if name == "" || original == nil {
+		return b.reply(message, "Ответь командой /save <имя> на своё сообщение с промптом, чтобы сохранить его. "+
+			"Список сохранённых - /saved.")
+	}
+	if original.From == nil || original.From.ID != userID {
+		return b.reply(message, "Сохранить можно только своё сообщение.")
+	}
+	prompt := strings.TrimSpace(original.Text)
+	if prompt == "" {
+		prompt = strings.TrimSpace(original.Caption)
+	}
+	if prompt == "" {
+		return b.reply(message, "В этом сообщении нет текста.")
+	}
+	if utf8.RuneCountInString(name) > maxPromptNameLength || strings.ContainsAny(name, "\n:") {
+		return b.reply(message, fmt.Sprintf("Имя должно быть в одну строку, без двоеточий и не длиннее %d символов.", maxPromptNameLength))
+	}
+
+	saved, err := b.savePrompt(userID, name, prompt)
+	if errors.Is(err, errTooManyPrompts) {
+		return b.reply(message, fmt.Sprintf("Сохранено уже %d промптов - это максимум. Удали ненужные в /saved.", maxSavedPrompts))
+	}
+	if err != nil {
+		b.reply(message, "Не удалось сохранить промпт, попробуй позже.")
+		return err
+	}
+	if saved != name {
+		return b.reply(message, fmt.Sprintf("💾 Имя «%s» уже занято, сохранил как «%s». Список - /saved.", name, saved))
+	}
+	return b.reply(message, fmt.Sprintf("💾 Сохранил промпт «%s». Список - /saved.", saved))
+}
+
+// errTooManyPrompts - у пользователя уже maxSavedPrompts промптов
+var errTooManyPrompts = errors.New("слишком много сохранённых промптов")
+
+// savePrompt сохраняет промпт и возвращает итоговое имя: при совпадении к нему добавляется номер ("имя-2")
+func (b *Bot) savePrompt(userID int64, name, prompt string) (string, error) {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return "", fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT name FROM saved_prompts WHERE user_id = ?", userID)
+	if err != nil {
+		return "", fmt.Errorf("ошибка получения сохранённых промптов: %w", err)
+	}
+	taken := make(map[string]bool)
+	for rows.Next() {
+		var existing string
+		if err := rows.Scan(&existing); err != nil {
+			rows.Close()
+			return "", fmt.Errorf("ошибка чтения сохранённых промптов: %w", err)
+		}
+		taken[strings.ToLower(existing)] = true
+	}
+	rows.Close()
+	if len(taken) >= maxSavedPrompts {
+		return "", errTooManyPrompts
+	}
+
+	unique := name
+	for i := 2; taken[strings.ToLower(unique)]; i++ {
+		unique = fmt.Sprintf("%s-%d", name, i)
+	}
+	if _, err := tx.Exec("INSERT INTO saved_prompts (user_id, name, prompt) VALUES (?, ?, ?)", userID, unique, prompt); err != nil {
+		return "", fmt.Errorf("ошибка сохранения промпта: %w", err)
+	}
+	return unique, tx.Commit()
+}
+
+// getSavedPrompts возвращает промпты пользователя по имени
+func (b *Bot) getSavedPrompts(userID int64) ([]SavedPrompt, error) {
+	rows, err := b.db.Query("SELECT id, name, prompt FROM saved_prompts WHERE user_id = ? ORDER BY name COLLATE NOCASE", userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения сохранённых промптов: %w", err)
+	}
+	defer rows.Close()
+
+	var prompts []SavedPrompt
+	for rows.Next() {
+		var p SavedPrompt
+		if err := rows.Scan(&p.ID, &p.Name, &p.Prompt); err != nil {
+			return nil, fmt.Errorf("ошибка чтения сохранённых промптов: %w", err)
+		}
+		prompts = append(prompts, p)
+	}
+	return prompts, rows.Err()
+}
+
+// getSavedPrompt возвращает промпт пользователя по id; nil - промпта нет (удалён или чужой)
+func (b *Bot) getSavedPrompt(userID, id int64) (*SavedPrompt, error) {
+	var p SavedPrompt
+	err := b.db.QueryRow("SELECT id, name, prompt FROM saved_prompts WHERE id = ? AND user_id = ?", id, userID).
+		Scan(&p.ID, &p.Name, &p.Prompt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения промпта: %w", err)
+	}
+	return &p, nil
+}
+
+// saved обрабатывает команду /saved: список сохранённых промптов с кнопками
+func (b *Bot) saved(message *tgbotapi.Message) error {
+	prompts, err := b.getSavedPrompts(senderID(message))
+	if err != nil {
+		return err
+	}
+	text, keyboard := renderSavedPrompts(prompts, b.api.Self.SupportsInlineQueries)
+	msg := tgbotapi.NewMessage(message.Chat.ID, text)
+	msg.ReplyToMessageID = message.MessageID
+	if keyboard != nil {
+		msg.ReplyMarkup = *keyboard
+	}
+	if _, err := b.api.Send(msg); err != nil {
+		return fmt.Errorf("ошибка отправки списка промптов: %w", err)
+	}
+	return nil
+}
+
+// renderSavedPrompts собирает список промптов: ▶️ отправляет промпт модели, ✏️ подставляет его в поле ввода
+// (только если у бота включён inline-режим и промпт достаточно короткий), 🗑 удаляет
+func renderSavedPrompts(prompts []SavedPrompt, inlineEdit bool) (string, *tgbotapi.InlineKeyboardMarkup) {
+	if len(prompts) == 0 {
+		return "Сохранённых промптов нет. Ответь командой /save <имя> на своё сообщение, чтобы сохранить его.", nil
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, p := range prompts {
+		row := []tgbotapi.InlineKeyboardButton{tgbotapi.NewInlineKeyboardButtonData("▶️ "+p.Name, fmt.Sprintf("prompt_run:%d", p.ID))}
+		if inlineEdit && utf8.RuneCountInString(p.Prompt) <= inlineQueryLimit {
+			row = append(row, tgbotapi.InlineKeyboardButton{Text: "✏️", SwitchInlineQueryCurrentChat: &p.Prompt})
+		}
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData("🗑", fmt.Sprintf("prompt_del:%d", p.ID)))
+		rows = append(rows, row)
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return fmt.Sprintf("💾 Сохранённые промпты (%d/%d):", len(prompts), maxSavedPrompts), &keyboard
+}
+
+// handlePromptRun отправляет сохранённый промпт модели: сначала сам промпт, затем ответ на него
+func (b *Bot) handlePromptRun(query *tgbotapi.CallbackQuery, payload string) (string, error) {
+	id, err := strconv.ParseInt(payload, 10, 64)
+	if err != nil {
+		return "Некорректная кнопка", nil
+	}
+	p, err := b.getSavedPrompt(query.From.ID, id)
+	if err != nil {
+		return "", err
+	}
+	if p == nil {
+		return "Этого промпта больше нет", nil
+	}
+	b.countPromptUse(p.ID)
+
+	chatID := query.Message.Chat.ID
+	echo, err := b.api.Send(tgbotapi.NewMessage(chatID, truncateRunes("▶️ "+p.Name+"\n\n"+p.Prompt, messageTextLimit)))
+	if err != nil {
+		return "", fmt.Errorf("ошибка отправки промпта: %w", err)
+	}
+	in := chatInput{UserID: query.From.ID, ChatID: chatID, FirstName: query.From.FirstName, Prompt: p.Prompt}
+	return "", b.answerPrompt(context.Background(), in, echo.MessageID)
+}
+
+// handlePromptDelete удаляет сохранённый промпт и обновляет список
+func (b *Bot) handlePromptDelete(query *tgbotapi.CallbackQuery, payload string) (string, error) {
+	id, err := strconv.ParseInt(payload, 10, 64)
+	if err != nil {
+		return "Некорректная кнопка", nil
+	}
+	userID := query.From.ID
+	if _, err := b.db.Exec("DELETE FROM saved_prompts WHERE id = ? AND user_id = ?", id, userID); err != nil {
+		return "", fmt.Errorf("ошибка удаления промпта: %w", err)
+	}
+
+	prompts, err := b.getSavedPrompts(userID)
+	if err != nil {
+		return "", err
+	}
+	text, keyboard := renderSavedPrompts(prompts, b.api.Self.SupportsInlineQueries)
+	edit := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, text)
+	edit.ReplyMarkup = keyboard
+	if _, err := b.api.Send(edit); err != nil {
+		return "", fmt.Errorf("ошибка обновления списка промптов: %w", err)
+	}
+	return "Промпт удалён", nil
+}
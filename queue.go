@@ -0,0 +1,203 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	userQueueSize        = 16              // Сколько обновлений одного пользователя может ждать обработки
+	userQueueIdleTimeout = 5 * time.Minute // Через сколько простоя горутина пользователя завершается
+)
+
+// errQueueFull - очередь пользователя переполнена, работа в неё не принята
+var errQueueFull = errors.New("очередь пользователя переполнена")
+
+// queuedUpdate - обновление вместе с моментом постановки в очередь
+type queuedUpdate struct {
+	update   tgbotapi.Update
+	queuedAt time.Time
+	run      func() // Вместо обновления - отложенная работа, которая должна идти по порядку с сообщениями
+}
+
+// userQueue - очередь обновлений одного пользователя
+type userQueue struct {
+	updates  chan queuedUpdate
+	pending  int  // Принятые, но ещё не обработанные обновления (под mu в userQueues)
+	overflow bool // Пользователя уже предупредили о переполнении; сбрасывается, когда очередь опустеет
+}
+
+// userQueues раздаёт обновления по очередям: сообщения одного пользователя
+// обрабатываются строго по порядку, разные пользователи - параллельно.
+// Горутина очереди создаётся при первом сообщении и завершается после простоя.
+type userQueues struct {
+	mu     sync.Mutex
+	queues map[int64]*userQueue
+	handle func(update tgbotapi.Update, queuedAt time.Time)
+	size   int
+	idle   time.Duration
+
+	// full вызывается для обновления, не поместившегося в очередь, - один раз, пока очередь не опустеет.
+	// Смещение getUpdates уже ушло дальше, так что это последняя возможность сказать пользователю о потере.
+	full func(update tgbotapi.Update)
+}
+
+// newUserQueues создаёт диспетчер очередей с обработчиком handle
+func newUserQueues(handle func(update tgbotapi.Update, queuedAt time.Time), size int, idle time.Duration) *userQueues {
+	return &userQueues{
+		queues: make(map[int64]*userQueue),
+		handle: handle,
+		size:   size,
+		idle:   idle,
+	}
+}
+
+// Push ставит обновление в очередь пользователя key.
+// Если очередь переполнена, обновление отбрасывается, чтобы не блокировать остальных, а пользователь
+// получает предупреждение через full.
+func (q *userQueues) Push(key int64, update tgbotapi.Update) {
+	accepted, notify := q.enqueue(key, queuedUpdate{update: update, queuedAt: time.Now()})
+	if !accepted && notify && q.full != nil {
+		q.full(update) // Вне mu: это запрос к Telegram
+	}
+}
+
+// Run ставит в очередь пользователя key функцию: она выполнится после уже принятых обновлений.
+// false - очередь переполнена, и функция не будет выполнена.
+func (q *userQueues) Run(key int64, run func()) bool {
+	accepted, _ := q.enqueue(key, queuedUpdate{queuedAt: time.Now(), run: run})
+	return accepted
+}
+
+// RunWait выполняет run в очереди пользователя key и ждёт результата. Так фоновая работа над разговором
+// (отложенный ответ) не перемешивается с живыми сообщениями того же пользователя.
+func (q *userQueues) RunWait(key int64, run func() error) error {
+	done := make(chan error, 1)
+	accepted := q.Run(key, func() {
+		err := errors.New("паника при выполнении в очереди пользователя")
+		defer func() { done <- err }() // Сработает и при панике: её перехватит process
+		err = run()
+	})
+	if !accepted {
+		return errQueueFull
+	}
+	return <-done
+}
+
+// enqueue кладёт элемент в очередь key, при необходимости запуская её горутину.
+// accepted=false - очередь переполнена; notify - о переполнении ещё не предупреждали.
+func (q *userQueues) enqueue(key int64, item queuedUpdate) (accepted, notify bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	queue, ok := q.queues[key]
+	if !ok {
+		queue = &userQueue{updates: make(chan queuedUpdate, q.size)}
+		q.queues[key] = queue
+		go q.worker(key, queue)
+	}
+
+	select {
+	case queue.updates <- item:
+		queue.pending++
+		return true, false
+	default:
+		slog.Warn("очередь пользователя переполнена, обновление пропущено", "key", key, "update_id", item.update.UpdateID)
+		notify = !queue.overflow
+		queue.overflow = true
+		return false, notify
+	}
+}
+
+// Pending возвращает, сколько обновлений всех пользователей ждут обработки
+func (q *userQueues) Pending() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	total := 0
+	for _, queue := range q.queues {
+		total += queue.pending
+	}
+	return total
+}
+
+// worker обрабатывает очередь одного пользователя, пока она не простаивает дольше idle
+func (q *userQueues) worker(key int64, queue *userQueue) {
+	timer := time.NewTimer(q.idle)
+	defer timer.Stop()
+
+	for {
+		select {
+		case item := <-queue.updates:
+			q.process(key, item)
+
+			q.mu.Lock()
+			queue.pending--
+			if queue.pending == 0 {
+				queue.overflow = false
+			}
+			q.mu.Unlock()
+
+			// Лишнее срабатывание таймера безопасно: перед выходом проверяется pending
+			timer.Reset(q.idle)
+		case <-timer.C:
+			q.mu.Lock()
+			if queue.pending == 0 {
+				delete(q.queues, key)
+				q.mu.Unlock()
+				return
+			}
+			q.mu.Unlock()
+			timer.Reset(q.idle)
+		}
+	}
+}
+
+// process обрабатывает один элемент очереди. Обновления защищены recoveryMiddleware, но отложенная
+// работа (Run) идёт мимо цепочки: паника в ней не должна ронять весь процесс.
+func (q *userQueues) process(key int64, item queuedUpdate) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			slog.Error("panic", "key", key, "update_id", item.update.UpdateID, "panic", recovered, "stack", string(debug.Stack()))
+		}
+	}()
+	if item.run != nil {
+		item.run()
+		return
+	}
+	q.handle(item.update, item.queuedAt)
+}
+
+// notifyQueueFull предупреждает пользователя, что его сообщение не поместилось в очередь и пропало
+func (b *Bot) notifyQueueFull(update tgbotapi.Update) {
+	const text = "⏳ Слишком много сообщений подряд, я не успеваю. Подожди ответа на предыдущие и повтори последнее."
+	var err error
+	switch {
+	case update.Message != nil:
+		err = b.reply(update.Message, text)
+	case update.CallbackQuery != nil:
+		_, err = b.api.Request(tgbotapi.NewCallbackWithAlert(update.CallbackQuery.ID, text))
+		if err != nil {
+			err = fmt.Errorf("ошибка ответа на нажатие: %w", err)
+		}
+	}
+	if err != nil {
+		slog.Warn("не удалось предупредить о переполнении очереди", "bot", b.name, "update_id", update.UpdateID, "error", err)
+	}
+}
+
+// updateQueueKey выбирает ключ очереди: пользователь, а если его нет (каналы) - чат
+func updateQueueKey(update tgbotapi.Update) int64 {
+	if user := update.SentFrom(); user != nil {
+		return user.ID
+	}
+	if chat := updateChat(update); chat != nil {
+		return chat.ID
+	}
+	return 0
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestUserQueuesKeepOrderPerUser(t *testing.T) {
+	const perUser = 200
+	users := []int64{1, 2}
+
+	var mu sync.Mutex
+	seen := make(map[int64][]int)
+	var wg sync.WaitGroup
+	wg.Add(perUser * len(users))
+	queues := newUserQueues(func(update tgbotapi.Update, _ time.Time) {
+		defer wg.Done()
+		userID := update.Message.From.ID
+		mu.Lock()
+		seen[userID] = append(seen[userID], update.UpdateID)
+		mu.Unlock()
+	}, perUser, time.Minute)
+
+	// Оба пользователя пишут одновременно: между собой их обновления перемешиваются,
+	// но у каждого должны остаться в исходном порядке
+	var push sync.WaitGroup
+	for _, userID := range users {
+		push.Add(1)
+		go func() {
+			defer push.Done()
+			for i := 1; i <= perUser; i++ {
+				queues.Push(userID, textUpdate(i, userID, "сообщение"))
+			}
+		}()
+	}
+	push.Wait()
+
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("очереди не обработали все обновления")
+	}
+
+	for _, userID := range users {
+		got := seen[userID]
+		if len(got) != perUser {
+			t.Fatalf("пользователь %d: обработано %d обновлений из %d", userID, len(got), perUser)
+		}
+		for i, id := range got {
+			if id != i+1 {
+				t.Fatalf("пользователь %d: на месте %d обновление %d, порядок нарушен", userID, i, id)
+			}
+		}
+	}
+	if n := queues.Pending(); n != 0 {
+		t.Errorf("после обработки в очередях осталось %d обновлений", n)
+	}
+}
+
+func TestUserQueuesRunKeepsOrderWithUpdates(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	wg.Add(3)
+	queues := newUserQueues(func(update tgbotapi.Update, _ time.Time) {
+		defer wg.Done()
+		mu.Lock()
+		order = append(order, update.Message.Text)
+		mu.Unlock()
+	}, userQueueSize, time.Minute)
+
+	queues.Push(1, textUpdate(1, 1, "первое"))
+	queues.Run(1, func() {
+		defer wg.Done()
+		mu.Lock()
+		order = append(order, "работа")
+		mu.Unlock()
+	})
+	queues.Push(1, textUpdate(2, 1, "второе"))
+	wg.Wait()
+
+	want := []string{"первое", "работа", "второе"}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("порядок %v, ожидался %v", order, want)
+		}
+	}
+}
+
+func TestUserQueuesFullNotifiesOnce(t *testing.T) {
+	const size = 2
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var handled, dropped []int
+	queues := newUserQueues(func(update tgbotapi.Update, _ time.Time) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+		mu.Lock()
+		handled = append(handled, update.UpdateID)
+		mu.Unlock()
+	}, size, time.Minute)
+	queues.full = func(update tgbotapi.Update) {
+		mu.Lock()
+		dropped = append(dropped, update.UpdateID)
+		mu.Unlock()
+	}
+
+	// Первое обновление занимает обработчик, ещё size ждут в очереди, остальные не помещаются
+	queues.Push(1, textUpdate(1, 1, "1"))
+	<-started
+	for id := 2; id <= size+4; id++ {
+		queues.Push(1, textUpdate(id, 1, "сообщение"))
+	}
+	queues.Push(2, textUpdate(100, 2, "другой пользователь")) // Чужая очередь не переполнена
+	mu.Lock()
+	if len(dropped) != 1 || dropped[0] != size+2 {
+		t.Errorf("предупреждения %v, ожидалось одно для обновления %d", dropped, size+2)
+	}
+	mu.Unlock()
+
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	for queues.Pending() > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	mu.Lock()
+	if len(handled) != size+2 { // size+1 от первого пользователя и одно от второго
+		t.Errorf("обработано %v, ожидалось %d обновлений", handled, size+2)
+	}
+	mu.Unlock()
+
+	// Очередь опустела - о следующем переполнении снова предупредим
+	queues.mu.Lock()
+	if queue := queues.queues[1]; queue != nil && queue.overflow {
+		t.Error("пометка о переполнении не сброшена после того, как очередь опустела")
+	}
+	queues.mu.Unlock()
+}
+
+func TestNotifyQueueFull(t *testing.T) {
+	b, fake := newTestBot(t)
+	b.notifyQueueFull(textUpdate(1, 1, "сообщение"))
+	if got := fake.lastText(); !strings.Contains(got, "Слишком много сообщений") {
+		t.Errorf("отправлено %q, ожидалось предупреждение о переполнении", got)
+	}
+}
+
+func TestUserQueuesRunWait(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	release := make(chan struct{})
+	queues := newUserQueues(func(update tgbotapi.Update, _ time.Time) {
+		<-release
+		mu.Lock()
+		order = append(order, update.Message.Text)
+		mu.Unlock()
+	}, userQueueSize, time.Minute)
+
+	// Фоновая работа ждёт уже принятого сообщения пользователя, а не идёт параллельно с ним
+	queues.Push(1, textUpdate(1, 1, "сообщение"))
+	jobErr := errors.New("ошибка задания")
+	result := make(chan error, 1)
+	go func() {
+		result <- queues.RunWait(1, func() error {
+			mu.Lock()
+			order = append(order, "задание")
+			mu.Unlock()
+			return jobErr
+		})
+	}()
+	close(release)
+	if err := <-result; err != jobErr {
+		t.Errorf("RunWait вернул %v, ожидалась ошибка задания", err)
+	}
+	if len(order) != 2 || order[0] != "сообщение" {
+		t.Errorf("порядок %v, задание должно идти после сообщения", order)
+	}
+
+	if err := queues.RunWait(1, func() error { panic("сбой") }); err == nil {
+		t.Error("паника в задании не вернула ошибку")
+	}
+}
+
+func TestUserQueuesRunWaitFull(t *testing.T) {
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	defer close(release)
+	queues := newUserQueues(func(tgbotapi.Update, time.Time) {
+		started <- struct{}{}
+		<-release
+	}, 1, time.Minute)
+
+	queues.Push(1, textUpdate(1, 1, "занимает обработчик"))
+	<-started
+	queues.Push(1, textUpdate(2, 1, "занимает очередь"))
+	if err := queues.RunWait(1, func() error { return nil }); err != errQueueFull {
+		t.Errorf("RunWait в переполненную очередь вернул %v, ожидалось errQueueFull", err)
+	}
+}
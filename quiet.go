@@ -0,0 +1,187 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const quietUsage = "Использование:\n" +
+	"/quiet 23:00-08:00 - тихие часы в твоём часовом поясе (/location)\n" +
+	"/quiet queue - в тихие часы сообщения ждут их окончания (по умолчанию)\n" +
+	"/quiet silent - в тихие часы сообщения приходят без звука\n" +
+	"/quiet off - отключить\n\n" +
+	"Касается того, что бот присылает сам: отложенных ответов, сводок и постов по подпискам. " +
+	"Ответы на твои сообщения приходят как обычно."
+
+// quietExemptJobs - задания, которые ничего не присылают пользователю, поэтому тихие часы их не задерживают
+var quietExemptJobs = map[string]bool{jobDelete: true}
+
+// parseQuietHours разбирает окно тихих часов "ЧЧ:ММ-ЧЧ:ММ"; окно может переходить через полночь
+func parseQuietHours(window string) (from, to time.Time, err error) {
+	start, end, ok := strings.Cut(strings.TrimSpace(window), "-")
+	if !ok {
+		return from, to, fmt.Errorf("нужно окно вида 23:00-08:00")
+	}
+	if from, err = time.Parse("15:04", strings.TrimSpace(start)); err != nil {
+		return from, to, fmt.Errorf("некорректное начало %q, нужно ЧЧ:ММ", start)
+	}
+	if to, err = time.Parse("15:04", strings.TrimSpace(end)); err != nil {
+		return from, to, fmt.Errorf("некорректный конец %q, нужно ЧЧ:ММ", end)
+	}
+	if from.Equal(to) {
+		return from, to, fmt.Errorf("начало и конец тихих часов совпадают")
+	}
+	return from, to, nil
+}
+
+// quietEnd возвращает конец тихих часов, если now попадает в окно from-to; false - сейчас не тихие часы
+func quietEnd(now, from, to time.Time) (time.Time, bool) {
+	minutes := func(t time.Time) int { return t.Hour()*60 + t.Minute() }
+	m, f, t := minutes(now), minutes(from), minutes(to)
+	inside := m >= f && m < t
+	if f > t {
+		inside = m >= f || m < t // Окно через полночь
+	}
+	if !inside {
+		return time.Time{}, false
+	}
+	end := time.Date(now.Year(), now.Month(), now.Day(), to.Hour(), to.Minute(), 0, 0, now.Location())
+	if !end.After(now) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return end, true
+}
+
+// setUserQuietHours сохраняет окно тихих часов ("" - отключены)
+func (b *Bot) setUserQuietHours(userID int64, window string) error {
+	if _, err := b.db.Exec("INSERT OR IGNORE INTO users (user_id) VALUES (?)", userID); err != nil {
+		return fmt.Errorf("ошибка при вставке пользователя: %w", err)
+	}
+	if _, err := b.db.Exec("UPDATE users SET quiet_hours = ? WHERE user_id = ?", window, userID); err != nil {
+		return fmt.Errorf("ошибка при обновлении тихих часов: %w", err)
+	}
+	return nil
+}
+
+// setUserQuietSilent выбирает, что делать с сообщениями в тихие часы: true - слать без звука, false - придержать
+func (b *Bot) setUserQuietSilent(userID int64, silent bool) error {
+	if _, err := b.db.Exec("INSERT OR IGNORE INTO users (user_id) VALUES (?)", userID); err != nil {
+		return fmt.Errorf("ошибка при вставке пользователя: %w", err)
+	}
+	if _, err := b.db.Exec("UPDATE users SET quiet_silent = ? WHERE user_id = ?", silent, userID); err != nil {
+		return fmt.Errorf("ошибка при обновлении режима тихих часов: %w", err)
+	}
+	return nil
+}
+
+// getUserQuietHours возвращает окно тихих часов ("" - отключены) и режим без звука
+func (b *Bot) getUserQuietHours(userID int64) (window string, silent bool, err error) {
+	err = b.db.QueryRow("SELECT COALESCE(quiet_hours, ''), COALESCE(quiet_silent, 0) FROM users WHERE user_id = ?", userID).
+		Scan(&window, &silent)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("ошибка при получении тихих часов: %w", err)
+	}
+	return window, silent, nil
+}
+
+// quietUntil проверяет, идут ли у пользователя тихие часы. Возвращает их конец (нулевое время - не идут)
+// и режим: silent - сообщение можно отправить без звука, иначе его нужно придержать до конца окна.
+func (b *Bot) quietUntil(userID int64, now time.Time) (until time.Time, silent bool, err error) {
+	window, silent, err := b.getUserQuietHours(userID)
+	if err != nil || window == "" {
+		return time.Time{}, false, err
+	}
+	from, to, err := parseQuietHours(window)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("некорректные тихие часы %q: %w", window, err)
+	}
+	loc, err := b.userLocation(userID)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	end, ok := quietEnd(now.In(loc), from, to)
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	return end, silent, nil
+}
+
+// applyQuietHours сверяет задание с тихими часами получателя: в режиме без звука помечает его Silent,
+// иначе откладывает до конца окна. true - задание отложено и сейчас не выполняется.
+func (b *Bot) applyQuietHours(job *scheduledJob, now time.Time) (bool, error) {
+	if quietExemptJobs[job.Kind] {
+		return false, nil
+	}
+	until, silent, err := b.quietUntil(job.UserID, now)
+	if err != nil || until.IsZero() {
+		return false, err
+	}
+	if silent {
+		job.Silent = true
+		return false, nil
+	}
+	if _, err := b.db.Exec("UPDATE reminders SET quiet_until = ? WHERE id = ?", until.UTC().Format(sqliteTimeLayout), job.ID); err != nil {
+		return false, fmt.Errorf("ошибка переноса задания на конец тихих часов: %w", err)
+	}
+	return true, nil
+}
+
+// quiet обрабатывает команду /quiet: тихие часы для сообщений, которые бот присылает сам
+func (b *Bot) quiet(message *tgbotapi.Message) error {
+	userID := senderID(message)
+	arg := strings.ToLower(strings.TrimSpace(message.CommandArguments()))
+	switch arg {
+	case "":
+		window, silent, err := b.getUserQuietHours(userID)
+		if err != nil {
+			return err
+		}
+		return b.reply(message, "🌙 Тихие часы: "+formatQuietHours(window, silent)+"\n\n"+quietUsage)
+	case "off":
+		if err := b.setUserQuietHours(userID, ""); err != nil {
+			return err
+		}
+		return b.reply(message, "🌙 Тихие часы отключены.")
+	case "queue", "silent":
+		if err := b.setUserQuietSilent(userID, arg == "silent"); err != nil {
+			return err
+		}
+		window, silent, err := b.getUserQuietHours(userID)
+		if err != nil {
+			return err
+		}
+		return b.reply(message, "🌙 Тихие часы: "+formatQuietHours(window, silent))
+	}
+
+	from, to, err := parseQuietHours(arg)
+	if err != nil {
+		return b.reply(message, err.Error()+"\n\n"+quietUsage)
+	}
+	window := from.Format("15:04") + "-" + to.Format("15:04")
+	if err := b.setUserQuietHours(userID, window); err != nil {
+		return err
+	}
+	_, silent, err := b.getUserQuietHours(userID)
+	if err != nil {
+		return err
+	}
+	return b.reply(message, "🌙 Тихие часы: "+formatQuietHours(window, silent))
+}
+
+// formatQuietHours описывает тихие часы для /quiet и /settings
+func formatQuietHours(window string, silent bool) string {
+	if window == "" {
+		return "выкл"
+	}
+	if silent {
+		return window + ", без звука"
+	}
+	return window + ", сообщения ждут их окончания"
+}
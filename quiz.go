@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	quizMaxCount       = 10              // Сколько вопросов можно заказать за раз
+	quizOptions        = 4               // Вариантов ответа в каждом вопросе
+	quizInterval       = 3 * time.Second // Пауза между вопросами серии
+	quizTokensEstimate = 200             // Оценка токенов на один вопрос для дневного бюджета
+
+	// Ограничения Telegram для опросов
+	pollQuestionLimit    = 300
+	pollOptionLimit      = 100
+	pollExplanationLimit = 200
+)
+
+// quizQuestion - вопрос викторины в том виде, в каком его возвращает модель
+type quizQuestion struct {
+	Question    string   `json:"question"`
+	Options     []string `json:"options"`
+	Correct     int      `json:"correct"`
+	Explanation string   `json:"explanation"`
+}
+
+// validate проверяет, что вопрос можно отправить опросом-викториной
+func (q *quizQuestion) validate() error {
+	q.Question = strings.TrimSpace(q.Question)
+	if q.Question == "" || utf8.RuneCountInString(q.Question) > pollQuestionLimit {
+		return fmt.Errorf("вопрос пустой или длиннее %d символов", pollQuestionLimit)
+	}
+	if len(q.Options) != quizOptions {
+		return fmt.Errorf("вариантов %d вместо %d", len(q.Options), quizOptions)
+	}
+	seen := make(map[string]bool, len(q.Options))
+	for i, option := range q.Options {
+		option = strings.TrimSpace(option)
+		if option == "" || utf8.RuneCountInString(option) > pollOptionLimit {
+			return fmt.Errorf("вариант %d пустой или длиннее %d символов", i+1, pollOptionLimit)
+		}
+		if seen[strings.ToLower(option)] {
+			return fmt.Errorf("вариант %q повторяется", option)
+		}
+		seen[strings.ToLower(option)] = true
+		q.Options[i] = option
+	}
+	if q.Correct < 0 || q.Correct >= quizOptions {
+		return fmt.Errorf("номер правильного ответа %d вне диапазона", q.Correct)
+	}
+	q.Explanation = truncateRunes(strings.TrimSpace(q.Explanation), pollExplanationLimit)
+	return nil
+}
+
+// shuffle перемешивает варианты: модели любят ставить правильный ответ первым
+func (q *quizQuestion) shuffle() {
+	correct := q.Options[q.Correct]
+	rand.Shuffle(len(q.Options), func(i, j int) { q.Options[i], q.Options[j] = q.Options[j], q.Options[i] })
+	for i, option := range q.Options {
+		if option == correct {
+			q.Correct = i
+		}
+	}
+}
+
+// parseQuizArgs разбирает "<тема> [число]": число в конце - сколько вопросов
+func parseQuizArgs(args string) (topic string, count int) {
+	fields := strings.Fields(args)
+	count = 1
+	if len(fields) > 1 {
+		if n, err := strconv.Atoi(fields[len(fields)-1]); err == nil {
+			count, fields = n, fields[:len(fields)-1]
+		}
+	}
+	return strings.Join(fields, " "), count
+}
+
+// generateQuiz просит модель в режиме JSON придумать count вопросов по теме.
+// Если ответ не проходит проверку, модель переспрашивается один раз.
+func (b *Bot) generateQuiz(topic string, count int) ([]quizQuestion, error) {
+	prompt := fmt.Sprintf("Придумай %d вопросов викторины на тему «%s» на языке темы. Верни JSON вида "+
+		`{"questions": [{"question": "...", "options": ["...", "...", "...", "..."], "correct": 0, "explanation": "..."}]}`+
+		", где options - ровно %d разных варианта ответа (каждый не длиннее %d символов), correct - индекс правильного "+
+		"варианта с нуля, explanation - короткое пояснение (до %d символов). Вопросы не должны повторяться.",
+		count, topic, quizOptions, pollOptionLimit, pollExplanationLimit)
+
+	var lastErr error
+	for attempt := 0; attempt < 2; attempt++ {
+		content, err := b.requestJSON(prompt)
+		if err != nil {
+			return nil, err
+		}
+		questions, err := parseQuiz(content, count)
+		if err == nil {
+			return questions, nil
+		}
+		lastErr = err
+	}
+	return nil, fmt.Errorf("модель дважды вернула некорректную викторину: %w", lastErr)
+}
+
+// parseQuiz разбирает и проверяет ответ модели; лишние вопросы отбрасываются
+func parseQuiz(content string, count int) ([]quizQuestion, error) {
+	var result struct {
+		Questions []quizQuestion `json:"questions"`
+	}
+	if err := json.Unmarshal([]byte(content), &result); err != nil {
+		return nil, fmt.Errorf("ошибка разбора викторины: %w", err)
+	}
+	if len(result.Questions) < count {
+		return nil, fmt.Errorf("вопросов %d вместо %d", len(result.Questions), count)
+	}
+	questions := result.Questions[:count]
+	for i := range questions {
+		if err := questions[i].validate(); err != nil {
+			return nil, fmt.Errorf("вопрос %d: %w", i+1, err)
+		}
+		questions[i].shuffle()
+	}
+	return questions, nil
+}
+
+// quiz обрабатывает команду /quiz <тема> [число]: присылает викторину опросами Telegram
+func (b *Bot) quiz(message *tgbotapi.Message) error {
+	topic, count := parseQuizArgs(message.CommandArguments())
+	if topic == "" || count < 1 || count > quizMaxCount {
+		return b.reply(message, fmt.Sprintf("Использование: /quiz <тема> [число вопросов до %d], например: /quiz история России 5",
+			quizMaxCount))
+	}
+	if err := b.checkBudget(senderID(message), int64(count*quizTokensEstimate)); err != nil {
+		return b.reply(message, err.Error())
+	}
+
+	status := tgbotapi.NewMessage(message.Chat.ID, "🎲 Придумываю вопросы...")
+	status.ReplyToMessageID = message.MessageID
+	sent, err := b.api.Send(status)
+	if err != nil {
+		return fmt.Errorf("ошибка отправки сообщения: %w", err)
+	}
+	questions, err := b.generateQuiz(topic, count)
+	if err != nil {
+		b.api.Send(tgbotapi.NewEditMessageText(message.Chat.ID, sent.MessageID, "😔 Не получилось придумать викторину, попробуй ещё раз."))
+		return fmt.Errorf("ошибка генерации викторины: %w", err)
+	}
+	b.deleteMessage(message.Chat.ID, sent.MessageID)
+
+	for i, q := range questions {
+		if i > 0 {
+			time.Sleep(quizInterval)
+		}
+		poll := tgbotapi.NewPoll(message.Chat.ID, q.Question, q.Options...)
+		poll.Type = "quiz"
+		poll.CorrectOptionID = int64(q.Correct)
+		poll.Explanation = q.Explanation
+		if _, err := b.api.Send(poll); err != nil {
+			return fmt.Errorf("ошибка отправки вопроса викторины: %w", err)
+		}
+	}
+	return nil
+}
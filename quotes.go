@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	quoteCacheTTL      = 10 * time.Minute // Сколько цитата ждёт обработки своего обновления
+	quotePromptRunes   = 1000             // До скольких символов сокращается цитата в промпте
+	repliedPromptRunes = 1500             // До скольких символов сокращается сообщение, на которое ответили
+)
+
+// rawQuoteUpdate - поля обновления, которых нет в tgbotapi v5.5.1: частичная цитата (message.quote)
+type rawQuoteUpdate struct {
+	UpdateID int `json:"update_id"`
+	Message  *struct {
+		Quote *struct {
+			Text string `json:"text"`
+		} `json:"quote"`
+	} `json:"message"`
+}
+
+// quoteCache хранит цитаты из сырого JSON обновлений до того, как обновление дойдёт до обработчика
+type quoteCache struct {
+	mu    sync.Mutex
+	items map[int]cachedQuote
+}
+
+type cachedQuote struct {
+	text  string
+	added time.Time
+}
+
+func newQuoteCache() *quoteCache {
+	return &quoteCache{items: make(map[int]cachedQuote)}
+}
+
+// addFromUpdates запоминает цитаты из ответа getUpdates (массив обновлений)
+func (c *quoteCache) addFromUpdates(raw json.RawMessage) {
+	var updates []rawQuoteUpdate
+	if err := json.Unmarshal(raw, &updates); err != nil {
+		return // Сами обновления разбираются отдельно, цитата необязательна
+	}
+	for _, u := range updates {
+		c.add(u)
+	}
+}
+
+// addFromUpdate запоминает цитату из одного обновления (тело запроса вебхука)
+func (c *quoteCache) addFromUpdate(raw []byte) {
+	var u rawQuoteUpdate
+	if json.Unmarshal(raw, &u) == nil {
+		c.add(u)
+	}
+}
+
+// add запоминает цитату обновления, если она есть, и заодно выбрасывает устаревшие
+func (c *quoteCache) add(u rawQuoteUpdate) {
+	if u.Message == nil || u.Message.Quote == nil || u.Message.Quote.Text == "" {
+		return
+	}
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, q := range c.items {
+		if now.Sub(q.added) > quoteCacheTTL {
+			delete(c.items, id)
+		}
+	}
+	c.items[u.UpdateID] = cachedQuote{text: u.Message.Quote.Text, added: now}
+}
+
+// take возвращает цитату обновления и забывает её
+func (c *quoteCache) take(updateID int) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	q := c.items[updateID]
+	delete(c.items, updateID)
+	return q.text
+}
+
+// replyInstruction - строка системного промпта о том, на что отвечает пользователь: процитированный
+// фрагмент, если он выделен, иначе всё сообщение. Так "это" в вопросе указывает на нужное место.
+func replyInstruction(message *tgbotapi.Message, quote string) string {
+	if quote != "" {
+		return "Пользователь цитирует: «" + truncateRunes(quote, quotePromptRunes) + "». Вопрос относится к этому фрагменту."
+	}
+	if message.ReplyToMessage == nil {
+		return ""
+	}
+	replied := messageContent(message.ReplyToMessage)
+	if replied == "" {
+		return ""
+	}
+	return "Пользователь отвечает на сообщение: «" + truncateRunes(replied, repliedPromptRunes) + "»"
+}
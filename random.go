@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// inspirationsJSON - встроенные идеи для /random; дополнительные администраторы добавляют командой /inspirations
+//
+//go:embed inspirations.json
+var inspirationsJSON []byte
+
+const inspirationsUsage = "Использование:\n" +
+	"/inspirations - идеи со статистикой, реже всего спрашивают первыми\n" +
+	"/inspirations add <категория>: <текст> - добавить идею\n" +
+	"/inspirations del <ключ> - убрать идею из /random"
+
+// inspiration - идея вопроса для /random. Ключ "f:<id>" у встроенных идей, "t:<номер>" - у добавленных в таблицу.
+type inspiration struct {
+	Key      string
+	Category string
+	Prompt   string
+}
+
+// loadInspirations разбирает встроенный набор идей
+func loadInspirations(data []byte) ([]inspiration, error) {
+	var entries []struct {
+		ID       string `json:"id"`
+		Category string `json:"category"`
+		Prompt   string `json:"prompt"`
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("ошибка разбора inspirations.json: %w", err)
+	}
+	ids := make(map[string]bool)
+	items := make([]inspiration, 0, len(entries))
+	for _, e := range entries {
+		if e.ID == "" || strings.ContainsAny(e.ID, ":|") || ids[e.ID] || e.Prompt == "" {
+			return nil, fmt.Errorf("inspirations.json: пустой, повторяющийся или некорректный id %q", e.ID)
+		}
+		ids[e.ID] = true
+		items = append(items, inspiration{Key: "f:" + e.ID, Category: e.Category, Prompt: e.Prompt})
+	}
+	return items, nil
+}
+
+// inspirationPool возвращает все идеи, кроме убранных администратором: встроенные и из таблицы
+func (b *Bot) inspirationPool() ([]inspiration, error) {
+	hidden := make(map[string]bool)
+	rows, err := b.db.Query("SELECT key FROM inspiration_stats WHERE hidden = 1")
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения статистики идей: %w", err)
+	}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("ошибка чтения статистики идей: %w", err)
+		}
+		hidden[key] = true
+	}
+	rows.Close()
+
+	var pool []inspiration
+	for _, item := range b.inspirations {
+		if !hidden[item.Key] {
+			pool = append(pool, item)
+		}
+	}
+	rows, err = b.db.Query("SELECT id, category, prompt FROM inspirations ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения идей: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var item inspiration
+		if err := rows.Scan(&id, &item.Category, &item.Prompt); err != nil {
+			return nil, fmt.Errorf("ошибка чтения идей: %w", err)
+		}
+		item.Key = "t:" + strconv.FormatInt(id, 10)
+		pool = append(pool, item)
+	}
+	return pool, rows.Err()
+}
+
+// pickInspiration выбирает случайную идею категории category (пустая - любой), по возможности не except
+func (b *Bot) pickInspiration(category, except string) (*inspiration, error) {
+	pool, err := b.inspirationPool()
+	if err != nil {
+		return nil, err
+	}
+	var candidates []inspiration
+	for _, item := range pool {
+		if category == "" || strings.EqualFold(item.Category, category) {
+			candidates = append(candidates, item)
+		}
+	}
+	if len(candidates) > 1 {
+		for i, item := range candidates {
+			if item.Key == except {
+				candidates = append(candidates[:i], candidates[i+1:]...)
+				break
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+	return &candidates[rand.Intn(len(candidates))], nil
+}
+
+// findInspiration ищет идею по ключу; nil - такой больше нет
+func (b *Bot) findInspiration(key string) (*inspiration, error) {
+	pool, err := b.inspirationPool()
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range pool {
+		if item.Key == key {
+			return &item, nil
+		}
+	}
+	return nil, nil
+}
+
+// countInspiration увеличивает счётчик показов или использований идеи
+func (b *Bot) countInspiration(key string, used bool) error {
+	column := "shown"
+	if used {
+		column = "used"
+	}
+	_, err := b.db.Exec(`INSERT INTO inspiration_stats (key, `+column+`) VALUES (?, 1)
+		ON CONFLICT (key) DO UPDATE SET `+column+` = `+column+` + 1`, key)
+	if err != nil {
+		return fmt.Errorf("ошибка обновления статистики идеи: %w", err)
+	}
+	return nil
+}
+
+// inspirationView - текст и кнопки предложения. Категория запроса сохраняется в кнопке 🎲,
+// если помещается в 64 байта данных кнопки.
+func inspirationView(item *inspiration, category string) (string, tgbotapi.InlineKeyboardMarkup) {
+	next := "rnd_next:" + item.Key
+	if category != "" && len(next)+1+len(category) <= 64 {
+		next += "|" + category
+	}
+	text := fmt.Sprintf("🎲 Идея для вопроса (#%s):\n\n%s", item.Category, item.Prompt)
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🚀 Спросить", "rnd_ask:"+item.Key),
+		tgbotapi.NewInlineKeyboardButtonData("🎲 Другой", next),
+	))
+	return text, keyboard
+}
+
+// random обрабатывает команду /random [категория]: случайная идея вопроса с кнопками
+func (b *Bot) random(message *tgbotapi.Message) error {
+	category := strings.TrimPrefix(strings.TrimSpace(message.CommandArguments()), "#")
+	item, err := b.pickInspiration(category, "")
+	if err != nil {
+		return err
+	}
+	if item == nil {
+		return b.reply(message, "В этой категории идей нет. Попробуй просто /random")
+	}
+	if err := b.countInspiration(item.Key, false); err != nil {
+		return err
+	}
+	text, keyboard := inspirationView(item, category)
+	msg := tgbotapi.NewMessage(message.Chat.ID, text)
+	msg.ReplyToMessageID = message.MessageID
+	msg.ReplyMarkup = keyboard
+	if _, err := b.api.Send(msg); err != nil {
+		return fmt.Errorf("ошибка отправки идеи: %w", err)
+	}
+	return nil
+}
+
+// handleRandomNext меняет идею на другую, редактируя то же сообщение
+func (b *Bot) handleRandomNext(query *tgbotapi.CallbackQuery, payload string) (string, error) {
+	except, category, _ := strings.Cut(payload, "|")
+	item, err := b.pickInspiration(category, except)
+	if err != nil {
+		return "", err
+	}
+	if item == nil {
+		return "Идеи закончились", nil
+	}
+	if err := b.countInspiration(item.Key, false); err != nil {
+		return "", err
+	}
+	text, keyboard := inspirationView(item, category)
+	edit := tgbotapi.NewEditMessageTextAndMarkup(query.Message.Chat.ID, query.Message.MessageID, text, keyboard)
+	if _, err := b.api.Send(edit); err != nil {
+		return "", fmt.Errorf("ошибка обновления идеи: %w", err)
+	}
+	return "", nil
+}
+
+// handleRandomAsk отправляет идею модели как обычный вопрос пользователя
+func (b *Bot) handleRandomAsk(query *tgbotapi.CallbackQuery, key string) (string, error) {
+	item, err := b.findInspiration(key)
+	if err != nil {
+		return "", err
+	}
+	if item == nil {
+		return "Эту идею убрали, попробуй другую", nil
+	}
+	if err := b.countInspiration(item.Key, true); err != nil {
+		return "", err
+	}
+	// Кнопки убираем, чтобы один и тот же вопрос не ушёл дважды
+	chatID := query.Message.Chat.ID
+	if _, err := b.api.Send(tgbotapi.NewEditMessageText(chatID, query.Message.MessageID, "🚀 "+item.Prompt)); err != nil {
+		return "", fmt.Errorf("ошибка обновления идеи: %w", err)
+	}
+	in := chatInput{UserID: query.From.ID, ChatID: chatID, FirstName: query.From.FirstName, Prompt: item.Prompt}
+	return "", b.answerPrompt(context.Background(), in, query.Message.MessageID)
+}
+
+// inspirationStat - идея со счётчиками для /inspirations
+type inspirationStat struct {
+	inspiration
+	Shown, Used int
+}
+
+// inspirationsAdmin обрабатывает команду /inspirations (только для администраторов):
+// статистика идей, добавление и удаление
+func (b *Bot) inspirationsAdmin(message *tgbotapi.Message) error {
+	action, rest, _ := strings.Cut(strings.TrimSpace(message.CommandArguments()), " ")
+	rest = strings.TrimSpace(rest)
+	switch action {
+	case "":
+		return b.listInspirations(message)
+	case "add":
+		category, prompt, ok := strings.Cut(rest, ":")
+		category, prompt = strings.TrimPrefix(strings.TrimSpace(category), "#"), strings.TrimSpace(prompt)
+		if !ok || category == "" || prompt == "" {
+			return b.reply(message, inspirationsUsage)
+		}
+		res, err := b.db.Exec("INSERT INTO inspirations (category, prompt, added_by) VALUES (?, ?, ?)",
+			category, prompt, senderID(message))
+		if err != nil {
+			return fmt.Errorf("ошибка сохранения идеи: %w", err)
+		}
+		id, _ := res.LastInsertId()
+		return b.reply(message, fmt.Sprintf("✅ Идея t:%d добавлена в #%s.", id, category))
+	case "del":
+		return b.deleteInspiration(message, rest)
+	}
+	return b.reply(message, inspirationsUsage)
+}
+
+// deleteInspiration убирает идею из /random: добавленную - удаляет, встроенную - скрывает
+func (b *Bot) deleteInspiration(message *tgbotapi.Message, key string) error {
+	item, err := b.findInspiration(key)
+	if err != nil {
+		return err
+	}
+	if item == nil {
+		return b.reply(message, "Идеи с таким ключом нет. Ключи показывает /inspirations")
+	}
+	if id, ok := strings.CutPrefix(key, "t:"); ok {
+		if _, err := b.db.Exec("DELETE FROM inspirations WHERE id = ?", id); err != nil {
+			return fmt.Errorf("ошибка удаления идеи: %w", err)
+		}
+		if _, err := b.db.Exec("DELETE FROM inspiration_stats WHERE key = ?", key); err != nil {
+			return fmt.Errorf("ошибка удаления статистики идеи: %w", err)
+		}
+	} else {
+		_, err := b.db.Exec(`INSERT INTO inspiration_stats (key, hidden) VALUES (?, 1)
+			ON CONFLICT (key) DO UPDATE SET hidden = 1`, key)
+		if err != nil {
+			return fmt.Errorf("ошибка скрытия идеи: %w", err)
+		}
+	}
+	return b.reply(message, "🗑 Идея убрана из /random.")
+}
+
+// listInspirations показывает идеи со счётчиками: сначала те, что показывают, но не спрашивают
+func (b *Bot) listInspirations(message *tgbotapi.Message) error {
+	pool, err := b.inspirationPool()
+	if err != nil {
+		return err
+	}
+	counts := make(map[string][2]int)
+	rows, err := b.db.Query("SELECT key, shown, used FROM inspiration_stats")
+	if err != nil {
+		return fmt.Errorf("ошибка чтения статистики идей: %w", err)
+	}
+	for rows.Next() {
+		var key string
+		var shown, used int
+		if err := rows.Scan(&key, &shown, &used); err != nil {
+			rows.Close()
+			return fmt.Errorf("ошибка чтения статистики идей: %w", err)
+		}
+		counts[key] = [2]int{shown, used}
+	}
+	rows.Close()
+
+	stats := make([]inspirationStat, 0, len(pool))
+	for _, item := range pool {
+		c := counts[item.Key]
+		stats = append(stats, inspirationStat{inspiration: item, Shown: c[0], Used: c[1]})
+	}
+	// Доля использований по возрастанию; при равной доле выше те, что показывали чаще
+	sort.SliceStable(stats, func(i, j int) bool {
+		ri, rj := useRate(stats[i]), useRate(stats[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return stats[i].Shown > stats[j].Shown
+	})
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "🎲 Идеи для /random (%d), реже всего спрашивают первыми:\n\n", len(stats))
+	for _, s := range stats {
+		fmt.Fprintf(&sb, "%s #%s - показов %d, спросили %d\n%s\n\n", s.Key, s.Category, s.Shown, s.Used,
+			truncateRunes(s.Prompt, laterListRunes))
+	}
+	sb.WriteString(inspirationsUsage)
+	for _, part := range splitMessage(sb.String(), messageTextLimit) {
+		if err := b.reply(message, part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// useRate - доля показов идеи, после которых её спросили; непоказанные идеи - в конце списка
+func useRate(s inspirationStat) float64 {
+	if s.Shown == 0 {
+		return 2
+	}
+	return float64(s.Used) / float64(s.Shown)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// reactionParams - параметры метода setMessageReaction.
+// В текущей версии tgbotapi обёртки для него нет, поэтому запрос собирается вручную.
+// Telegram принимает только эмодзи из списка стандартных реакций (✅ и ⚠️ среди них нет).
+type reactionParams struct {
+	ChatID    int64
+	MessageID int
+	Emoji     string
+}
+
+type reactionType struct {
+	Type  string `json:"type"`
+	Emoji string `json:"emoji"`
+}
+
+func (p reactionParams) params() (tgbotapi.Params, error) {
+	params := make(tgbotapi.Params)
+	params.AddNonZero64("chat_id", p.ChatID)
+	params.AddNonZero("message_id", p.MessageID)
+	err := params.AddInterface("reaction", []reactionType{{Type: "emoji", Emoji: p.Emoji}})
+	return params, err
+}
+
+// react ставит реакцию на сообщение пользователя, если реакции включены в этом чате
+func (b *Bot) react(message *tgbotapi.Message, emoji string) {
+	if emoji == "" {
+		return
+	}
+	enabled, err := b.getChatReactions(message.Chat.ID)
+	if err != nil {
+		log.Printf("Ошибка получения настройки реакций: %v", err)
+		return
+	}
+	if !enabled {
+		return
+	}
+
+	params, err := reactionParams{ChatID: message.Chat.ID, MessageID: message.MessageID, Emoji: emoji}.params()
+	if err != nil {
+		log.Printf("Ошибка подготовки реакции: %v", err)
+		return
+	}
+	if _, err := b.api.MakeRequest("setMessageReaction", params); err != nil {
+		log.Printf("Ошибка установки реакции: %v", err)
+	}
+}
+
+// setReactions обрабатывает команду /reactions on|off для текущего чата
+func (b *Bot) setReactions(message *tgbotapi.Message) error {
+	enabled, ok := parseToggle(message.CommandArguments())
+	if !ok {
+		return b.reply(message, "Использование: /reactions on или /reactions off")
+	}
+
+	if err := b.setChatReactions(message.Chat.ID, enabled); err != nil {
+		b.reply(message, "Не удалось сохранить настройку, попробуй позже.")
+		return fmt.Errorf("ошибка сохранения настройки реакций: %w", err)
+	}
+
+	if enabled {
+		return b.reply(message, "Буду отмечать реакцией сообщения, на которые ответил.")
+	}
+	return b.reply(message, "Реакции на сообщения выключены.")
+}
+
+// setChatReactions сохраняет настройку реакций для чата
+func (b *Bot) setChatReactions(chatID int64, enabled bool) error {
+	_, err := b.db.Exec("INSERT OR IGNORE INTO chats (chat_id) VALUES (?)", chatID)
+	if err != nil {
+		return fmt.Errorf("ошибка при вставке чата: %w", err)
+	}
+	_, err = b.db.Exec("UPDATE chats SET reactions = ? WHERE chat_id = ?", enabled, chatID)
+	if err != nil {
+		return fmt.Errorf("ошибка при обновлении настройки реакций: %w", err)
+	}
+	return nil
+}
+
+// getChatReactions возвращает, включены ли реакции в чате (по умолчанию включены)
+func (b *Bot) getChatReactions(chatID int64) (bool, error) {
+	var enabled bool
+	err := b.db.QueryRow("SELECT reactions FROM chats WHERE chat_id = ?", chatID).Scan(&enabled)
+	if err == sql.ErrNoRows {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("ошибка при получении настройки реакций: %w", err)
+	}
+	return enabled, nil
+}
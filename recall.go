@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	recallInterval      = time.Minute // Как часто фоновая задача ищет обмены без векторов
+	recallBatchSize     = 32          // Сколько обменов векторизуется за один проход
+	recallTopK          = 3           // Сколько прошлых обменов попадает в промпт
+	recallMinSimilarity = 0.3         // Менее похожие обмены не подставляются
+	recallEmbedRunes    = 2000        // До скольких символов сокращается обмен перед векторизацией
+	recallPromptRunes   = 500         // До скольких символов сокращается обмен в промпте
+)
+
+// recallExchange - прошлый обмен из истории, похожий на текущий вопрос
+type recallExchange struct {
+	Question  string
+	Answer    string
+	CreatedAt string
+	Score     float64
+}
+
+// recallLoop векторизует новые обмены пользователей с включённым /recall.
+// Запускается одним ботом: история общая для всех ботов процесса.
+func (b *Bot) recallLoop() {
+	ticker := time.NewTicker(recallInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := b.embedNewExchanges(context.Background()); err != nil {
+			slog.Warn("не удалось векторизовать историю", "error", err)
+		}
+	}
+}
+
+// embedNewExchanges векторизует порцию обменов без векторов и удаляет векторы удалённых обменов
+func (b *Bot) embedNewExchanges(ctx context.Context) error {
+	if _, err := b.db.Exec("DELETE FROM history_vectors WHERE history_id NOT IN (SELECT id FROM history)"); err != nil {
+		return fmt.Errorf("ошибка удаления устаревших векторов: %w", err)
+	}
+
+	// Вопрос и ответ на него - соседние строки: ответ - ближайшая следующая строка ассистента
+	rows, err := b.db.Query(`
+		SELECT q.id, q.user_id, q.content, COALESCE((SELECT a.content FROM history a
+			WHERE a.user_id = q.user_id AND a.id > q.id AND a.role = 'assistant' ORDER BY a.id LIMIT 1), '')
+		FROM history q
+		JOIN users u ON u.user_id = q.user_id AND COALESCE(u.recall, 0) = 1
+		WHERE q.role = 'user' AND q.id NOT IN (SELECT history_id FROM history_vectors)
+		ORDER BY q.id LIMIT ?`, recallBatchSize)
+	if err != nil {
+		return fmt.Errorf("ошибка выборки истории для векторизации: %w", err)
+	}
+	var ids, userIDs []int64
+	var texts []string
+	for rows.Next() {
+		var id, userID int64
+		var question, answer string
+		if err := rows.Scan(&id, &userID, &question, &answer); err != nil {
+			rows.Close()
+			return fmt.Errorf("ошибка чтения истории для векторизации: %w", err)
+		}
+		ids, userIDs = append(ids, id), append(userIDs, userID)
+		texts = append(texts, truncateRunes("Вопрос: "+question+"\nОтвет: "+answer, recallEmbedRunes))
+	}
+	rows.Close()
+	if len(texts) == 0 {
+		return nil
+	}
+
+	vectors, err := b.embed(ctx, texts)
+	if err != nil {
+		return err
+	}
+	for i, id := range ids {
+		_, err := b.db.Exec("INSERT OR REPLACE INTO history_vectors (history_id, user_id, embedding) VALUES (?, ?, ?)",
+			id, userIDs[i], encodeVector(vectors[i]))
+		if err != nil {
+			return fmt.Errorf("ошибка сохранения вектора: %w", err)
+		}
+	}
+	return nil
+}
+
+// recallExchanges ищет среди векторизованных обменов пользователя самые похожие на вопрос,
+// кроме тех, что и так попадут в контекст (последние turns пар активного разговора)
+func (b *Bot) recallExchanges(ctx context.Context, userID int64, question string, turns int) ([]recallExchange, error) {
+	conversationID, err := b.activeConversation(userID)
+	if err != nil {
+		return nil, err
+	}
+	var windowStart sql.NullInt64
+	err = b.db.QueryRow(`SELECT MIN(id) FROM (SELECT id FROM history WHERE user_id = ? AND conversation_id = ?
+		ORDER BY id DESC LIMIT ?)`, userID, conversationID, turns*2).Scan(&windowStart)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения окна истории: %w", err)
+	}
+	if !windowStart.Valid {
+		windowStart.Int64 = 1<<63 - 1 // Окно пустое - исключать нечего
+	}
+
+	rows, err := b.db.Query(`
+		SELECT v.embedding, q.content, date(q.created_at, 'localtime'), COALESCE((SELECT a.content FROM history a
+			WHERE a.user_id = q.user_id AND a.id > q.id AND a.role = 'assistant' ORDER BY a.id LIMIT 1), '')
+		FROM history_vectors v JOIN history q ON q.id = v.history_id
+		WHERE v.user_id = ? AND NOT (q.conversation_id = ? AND q.id >= ?)`,
+		userID, conversationID, windowStart.Int64)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения векторов истории: %w", err)
+	}
+	var exchanges []recallExchange
+	var vectors [][]float32
+	for rows.Next() {
+		var e recallExchange
+		var blob []byte
+		if err := rows.Scan(&blob, &e.Question, &e.CreatedAt, &e.Answer); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("ошибка чтения векторов истории: %w", err)
+		}
+		exchanges = append(exchanges, e)
+		vectors = append(vectors, decodeVector(blob))
+	}
+	rows.Close()
+	if len(exchanges) == 0 {
+		return nil, nil
+	}
+
+	query, err := b.embed(ctx, []string{question})
+	if err != nil {
+		return nil, err
+	}
+	var found []recallExchange
+	for i := range exchanges {
+		if exchanges[i].Score = cosineSimilarity(query[0], vectors[i]); exchanges[i].Score >= recallMinSimilarity {
+			found = append(found, exchanges[i])
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Score > found[j].Score })
+	return found[:min(recallTopK, len(found))], nil
+}
+
+// recallInstruction - блок системного промпта с похожими прошлыми обменами (только при /recall on)
+func (b *Bot) recallInstruction(ctx context.Context, in chatInput, privacy string, turns int) string {
+	if !b.embeddingsEnabled() || privacy == privacyStrict {
+		return ""
+	}
+	recall, err := b.getUserRecall(in.UserID)
+	if err != nil {
+		log.Printf("Ошибка получения настройки /recall: %v", err)
+	}
+	if !recall {
+		return ""
+	}
+	exchanges, err := b.recallExchanges(ctx, in.UserID, in.Prompt, turns)
+	if err != nil {
+		log.Printf("Ошибка поиска по прошлым разговорам: %v", err)
+		return ""
+	}
+	if len(exchanges) == 0 {
+		return ""
+	}
+
+	lines := []string{"Ранее пользователь обсуждал (используй, если это относится к вопросу):"}
+	for _, e := range exchanges {
+		lines = append(lines, fmt.Sprintf("- %s. Вопрос: %s\n  Ответ: %s", e.CreatedAt,
+			oneLine(e.Question, recallPromptRunes), oneLine(e.Answer, recallPromptRunes)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// setRecall обрабатывает команду /recall on|off
+func (b *Bot) setRecall(message *tgbotapi.Message) error {
+	if !b.embeddingsEnabled() {
+		return b.reply(message, "Поиск по прошлым разговорам не настроен: администратору нужно задать EMBEDDINGS_URL.")
+	}
+	recall, ok := parseToggle(message.CommandArguments())
+	if !ok {
+		return b.reply(message, "Использование: /recall on или /recall off\n\n"+
+			"Когда включено, я нахожу в старых разговорах то, что похоже на твой вопрос, и учитываю это в ответе. "+
+			"Запросы при этом становятся длиннее.")
+	}
+	if err := b.setUserRecall(senderID(message), recall); err != nil {
+		b.reply(message, "Не удалось сохранить настройку, попробуй позже.")
+		return err
+	}
+	if recall {
+		return b.reply(message, "🧠 Буду вспоминать похожие прошлые разговоры. Старая история проиндексируется в течение нескольких минут.")
+	}
+	return b.reply(message, "Прошлые разговоры больше не подмешиваются в ответы.")
+}
+
+// setUserRecall включает поиск по прошлым разговорам
+func (b *Bot) setUserRecall(userID int64, recall bool) error {
+	if _, err := b.db.Exec("INSERT OR IGNORE INTO users (user_id) VALUES (?)", userID); err != nil {
+		return fmt.Errorf("ошибка при вставке пользователя: %w", err)
+	}
+	if _, err := b.db.Exec("UPDATE users SET recall = ? WHERE user_id = ?", recall, userID); err != nil {
+		return fmt.Errorf("ошибка при обновлении настройки /recall: %w", err)
+	}
+	return nil
+}
+
+// getUserRecall возвращает, включён ли поиск по прошлым разговорам
+func (b *Bot) getUserRecall(userID int64) (bool, error) {
+	var recall bool
+	err := b.db.QueryRow("SELECT COALESCE(recall, 0) FROM users WHERE user_id = ?", userID).Scan(&recall)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("ошибка при получении настройки /recall: %w", err)
+	}
+	return recall, nil
+}
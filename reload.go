@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"syscall"
+
+	"github.com/joho/godotenv"
+)
+
+// restartOnlyFields - поля Config, которые читаются только при запуске: из них собраны HTTP-клиенты,
+// сервер вебхуков, трейсинг, правила модерации и фоновые задачи. При перечитывании они не меняются.
+// Путь к базе (DBPATH) - константа и в конфигурацию не входит.
+var restartOnlyFields = map[string]bool{
+	"TelegramBotTokens":   true,
+	"TelegramAPIEndpoint": true,
+	"TelegramProxy":       true,
+	"AIProxy":             true,
+	"AITimeout":           true,
+	"AIConnectTimeout":    true,
+	"TGPollTimeout":       true,
+	"WebhookURL":          true,
+	"WebhookListen":       true,
+	"WebhookSecret":       true,
+	"SkipPendingUpdates":  true,
+	"OTLPEndpoint":        true,
+	"TraceSampleRatio":    true,
+	"EnableTools":         true,
+	"ModerationBlocklist": true,
+	"CombineWindow":       true,
+	"EmbeddingsURL":       true,
+	"ProbeInterval":       true,
+	"BackupHour":          true,
+	"BackupInterval":      true,
+}
+
+// secretFields - поля, значения которых не попадают в лог изменений
+var secretFields = map[string]bool{
+	"TelegramBotTokens":   true,
+	"HuggingFaceAPIToken": true,
+	"WebhookSecret":       true,
+}
+
+// cfg возвращает текущую конфигурацию. Значение не меняется после подмены: кто взял
+// конфигурацию в начале обработки, дорабатывает с ней, даже если по SIGHUP пришла новая.
+func (b *Bot) cfg() *Config {
+	return b.config.Load()
+}
+
+// reloadOnSIGHUP перечитывает конфигурацию по каждому SIGHUP до отмены ctx
+func reloadOnSIGHUP(ctx context.Context, bots []*Bot) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			if err := reloadConfig(bots); err != nil {
+				log.Printf("Конфигурация не перечитана, работаю со старой: %v", err)
+			}
+		}
+	}
+}
+
+// reloadConfig заново читает .env и переменные окружения, проверяет их и подменяет конфигурацию у всех ботов.
+// Поля, которые нельзя поменять на ходу, остаются прежними с предупреждением в логе.
+func reloadConfig(bots []*Bot) error {
+	// Overload, а не Load: значения из прошлого чтения .env уже в окружении, и Load их не перезаписал бы
+	if err := godotenv.Overload(); err != nil {
+		log.Printf("Предупреждение: .env файл не найден, перечитываю только переменные окружения")
+	}
+	next, err := parseConfig()
+	if err != nil {
+		return err
+	}
+
+	current := bots[0].cfg()
+	changes, ignored := diffConfig(current, next)
+	for _, line := range ignored {
+		log.Printf("Предупреждение: %s меняется только перезапуском, изменение проигнорировано", line)
+	}
+	if len(changes) == 0 {
+		log.Printf("Конфигурация перечитана: изменений нет")
+		return nil
+	}
+	for _, b := range bots {
+		b.config.Store(next)
+	}
+	log.Printf("Конфигурация перечитана, изменено: %s", strings.Join(changes, "; "))
+	return nil
+}
+
+// diffConfig сравнивает конфигурации по полям. Изменения полей из restartOnlyFields
+// откатываются в next к текущим значениям и возвращаются отдельно.
+func diffConfig(current, next *Config) (changes, ignored []string) {
+	cur, nxt := reflect.ValueOf(current).Elem(), reflect.ValueOf(next).Elem()
+	for i := 0; i < cur.NumField(); i++ {
+		name := cur.Type().Field(i).Name
+		before, after := configValue(cur.Field(i)), configValue(nxt.Field(i))
+		if before == after {
+			continue
+		}
+		if restartOnlyFields[name] {
+			nxt.Field(i).Set(cur.Field(i))
+			ignored = append(ignored, name)
+			continue
+		}
+		if secretFields[name] {
+			changes = append(changes, name+": (скрыто)")
+		} else {
+			changes = append(changes, fmt.Sprintf("%s: %s → %s", name, before, after))
+		}
+	}
+	return changes, ignored
+}
+
+// configValue - значение поля для сравнения и лога. Адреса прокси выводятся без паролей,
+// часовые зоны - по имени: каждая загрузка создаёт новый *time.Location.
+func configValue(v reflect.Value) string {
+	switch value := v.Interface().(type) {
+	case *url.URL:
+		if value == nil {
+			return "-"
+		}
+		return value.Redacted()
+	case fmt.Stringer:
+		if v.Kind() == reflect.Pointer && v.IsNil() {
+			return "-"
+		}
+		return value.String()
+	}
+	// JSON разыменовывает указатели и сортирует ключи карт: одинаковые значения дают одинаковый текст
+	if data, err := json.Marshal(v.Interface()); err == nil {
+		return string(data)
+	}
+	return fmt.Sprintf("%v", v.Interface())
+}
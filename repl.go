@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// replUserID - пользователь, от имени которого REPL пишет в базу (реальные ID Telegram с ним не пересекаются)
+const replUserID int64 = 1
+
+// runREPL запускает бота без Telegram: строки из stdin проходят тот же путь, что и сообщения в aiChat
+// (стиль, сборка промпта, история, модерация), ответы печатаются в stdout.
+// Без HF_API_TOKEN вместо модели отвечает заглушка, повторяющая вопрос.
+func runREPL(config *Config, in io.Reader, out io.Writer) error {
+	db, err := initDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	aiClient, err := newHTTPClient(config.AITimeout, config.AIConnectTimeout, config.AIProxy)
+	if err != nil {
+		return err
+	}
+	if config.HuggingFaceAPIToken == "" {
+		aiClient.Transport = mockAITransport{}
+		fmt.Fprintln(out, "HF_API_TOKEN не задан - отвечает заглушка")
+	}
+
+	b, err := newBot(config, nil, db, aiClient)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out, "REPL: пиши сообщения, :help - команды, :quit - выход")
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	var lastTurn *chatTurn
+	for {
+		fmt.Fprint(out, "> ")
+		if !scanner.Scan() {
+			break
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, ":") {
+			quit, err := b.replCommand(line, lastTurn, out)
+			if err != nil {
+				fmt.Fprintf(out, "ошибка: %v\n", err)
+			}
+			if quit {
+				return nil
+			}
+			continue
+		}
+
+		input := chatInput{UserID: replUserID, ChatID: replUserID, FirstName: os.Getenv("USER"), Prompt: line}
+		lastTurn = b.prepareChat(context.Background(), input)
+		aiResponse, err := b.completeChat(context.Background(), input, lastTurn)
+		if err != nil {
+			fmt.Fprintf(out, "Ошибка при обращении к ИИ: %v\n", err)
+			continue
+		}
+		fmt.Fprintf(out, "%s\n(%s)\n", aiResponse.Content, latencyFooter(aiResponse))
+		b.saveChat(input, lastTurn, aiResponse)
+	}
+	return scanner.Err()
+}
+
+// replCommand выполняет мета-команду REPL; возвращает true, если пора выходить
+func (b *Bot) replCommand(line string, lastTurn *chatTurn, out io.Writer) (bool, error) {
+	name, arg, _ := strings.Cut(strings.TrimPrefix(line, ":"), " ")
+	arg = strings.TrimSpace(arg)
+
+	switch name {
+	case "quit", "q":
+		return true, nil
+	case "style":
+		if _, ok := stylePrompts[arg]; !ok {
+			fmt.Fprintln(out, "Стили: friendly, official, meme")
+			return false, nil
+		}
+		if err := b.setUserStyle(replUserID, arg); err != nil {
+			return false, err
+		}
+		fmt.Fprintf(out, "Стиль: %s\n", styleTitle(arg))
+	case "reset":
+		if err := b.clearActiveConversation(replUserID); err != nil {
+			return false, err
+		}
+		fmt.Fprintln(out, "История текущего разговора очищена")
+	case "new":
+		if _, err := createConversation(b.db, b.botID, replUserID, arg); err != nil {
+			return false, err
+		}
+		b.session.clear(replUserID)
+		fmt.Fprintln(out, "Начат новый разговор")
+	case "prompt":
+		if lastTurn == nil {
+			fmt.Fprintln(out, "Запросов ещё не было")
+			return false, nil
+		}
+		for _, msg := range lastTurn.Messages {
+			fmt.Fprintf(out, "[%s]\n%s\n\n", msg.Role, msg.Content)
+		}
+	default:
+		fmt.Fprintln(out, ":style friendly|official|meme - сменить стиль\n"+
+			":reset - очистить текущий разговор\n"+
+			":new [название] - начать новый разговор\n"+
+			":prompt - показать сообщения последнего запроса к модели\n"+
+			":quit - выход")
+	}
+	return false, nil
+}
+
+// mockAITransport отвечает на запросы к модели без сети: повторяет последнее сообщение пользователя
+type mockAITransport struct{}
+
+func (mockAITransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var request OpenAIRequest
+	if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+		return nil, fmt.Errorf("ошибка разбора запроса к заглушке: %w", err)
+	}
+	req.Body.Close()
+
+	question := ""
+	if n := len(request.Messages); n > 0 {
+		question = request.Messages[n-1].Content
+	}
+	time.Sleep(50 * time.Millisecond) // Чтобы футер с задержкой выглядел правдоподобно
+	body, err := json.Marshal(ChatResponse{
+		Model: "mock",
+		Choices: []Choice{{
+			Message:      ChatMessage{Role: "assistant", Content: "(заглушка) Ты написал: " + question},
+			FinishReason: "stop",
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader(body)),
+		Request:    req,
+	}, nil
+}
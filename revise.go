@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	reviseWindow       = 15 * time.Minute // Сколько после ответа короткая просьба считается правкой, а не новым вопросом
+	reviseMaxRunes     = 80               // Длиннее - это уже новый вопрос
+	reviseInstructions = "Перепиши свой предыдущий ответ по этой просьбе пользователя. " +
+		"Верни только новую версию ответа целиком, без вступлений и пояснений, что изменилось."
+)
+
+// revisePrefixes - начала просьб переделать предыдущий ответ ("сделай короче", "без эмодзи")
+var revisePrefixes = []string{
+	"сделай", "перепиши", "переформулируй", "сократи", "короче", "покороче", "подробнее", "длиннее",
+	"проще", "попроще", "исправь", "убери", "добавь", "без ", "формальнее", "неформальнее", "переведи",
+	"на английском", "по-английски",
+}
+
+// lastAnswer - последний ответ пользователю, который можно переделать на месте
+type lastAnswer struct {
+	ChatID    int64
+	MessageID int // Сообщение с ответом (его и редактируем)
+	ReplyTo   int // Вопрос, на который отвечали
+	Revision  int // Номер версии: 1 - исходный ответ
+	At        time.Time
+}
+
+// lastAnswers - последние ответы пользователей (только в памяти)
+type lastAnswers struct {
+	mu      sync.Mutex
+	answers map[int64]lastAnswer
+}
+
+func newLastAnswers() *lastAnswers {
+	return &lastAnswers{answers: make(map[int64]lastAnswer)}
+}
+
+// set запоминает ответ пользователю; устаревшие записи заодно выбрасываются
+func (l *lastAnswers) set(userID int64, answer lastAnswer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for id, a := range l.answers {
+		if time.Since(a.At) > reviseWindow {
+			delete(l.answers, id)
+		}
+	}
+	l.answers[userID] = answer
+}
+
+// get возвращает последний ответ пользователю в чате, если он ещё не устарел
+func (l *lastAnswers) get(userID, chatID int64) (lastAnswer, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	a, ok := l.answers[userID]
+	return a, ok && a.ChatID == chatID && time.Since(a.At) <= reviseWindow
+}
+
+// forget забывает последний ответ: после нового вопроса править старый уже нельзя
+func (l *lastAnswers) forget(userID int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.answers, userID)
+}
+
+// rememberAnswer запоминает ответ для правок на месте; ответы из нескольких сообщений не запоминаются
+func (b *Bot) rememberAnswer(userID, chatID int64, messageID, replyTo int, text string) {
+	if utf8.RuneCountInString(renderTables(text)) > messageTextLimit {
+		b.lastAnswers.forget(userID)
+		return
+	}
+	b.lastAnswers.set(userID, lastAnswer{ChatID: chatID, MessageID: messageID, ReplyTo: replyTo, Revision: 1, At: time.Now()})
+}
+
+// isReviseRequest - похоже ли сообщение на короткую просьбу переделать ответ, а не на новый вопрос
+func isReviseRequest(text string) bool {
+	text = strings.ToLower(strings.TrimSpace(text))
+	if text == "" || utf8.RuneCountInString(text) > reviseMaxRunes || strings.ContainsAny(text, "?\n") {
+		return false
+	}
+	for _, prefix := range revisePrefixes {
+		if strings.HasPrefix(text, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// editAnswer обрабатывает команду /edit <просьба>: переделывает последний ответ на месте
+func (b *Bot) editAnswer(message *tgbotapi.Message) error {
+	instruction := strings.TrimSpace(message.CommandArguments())
+	if instruction == "" {
+		return b.reply(message, "Использование: /edit <что поменять>, например: /edit сделай короче\n\n"+
+			"Короткие просьбы вроде «сделай короче» сразу после ответа работают и без команды.")
+	}
+	last, ok := b.lastAnswers.get(senderID(message), message.Chat.ID)
+	if !ok {
+		return b.reply(message, "Нечего править: переделать можно последний ответ в течение 15 минут, если он уместился в одно сообщение.")
+	}
+	return b.reviseAnswer(context.Background(), message, last, instruction)
+}
+
+// reviseAnswer переделывает последний ответ по просьбе и редактирует его сообщение с пометкой "изм. N".
+// В истории остаётся только итоговая версия, сама просьба туда не попадает.
+func (b *Bot) reviseAnswer(ctx context.Context, message *tgbotapi.Message, last lastAnswer, instruction string) error {
+	in := chatInputFrom(message, instruction+"\n\n"+reviseInstructions)
+	info := updateInfoFrom(ctx)
+	in.RequestID, in.QueuedAt, in.QueueWait = info.RequestID, info.QueuedAt, info.QueueWait
+	turn := b.prepareChat(ctx, in)
+	if err := b.checkLimits(in, turn); err != nil {
+		return b.reply(message, err.Error())
+	}
+
+	b.api.Request(tgbotapi.NewChatAction(message.Chat.ID, tgbotapi.ChatTyping))
+	aiResponse, err := b.completeChat(ctx, in, turn)
+	if err != nil {
+		b.reply(message, "😔 Не получилось переделать ответ, попробуй ещё раз.")
+		return fmt.Errorf("ошибка запроса к AI: %w", err)
+	}
+
+	last.Revision++
+	text := fmt.Sprintf("%s\n\n✏️ изм. %d", aiResponse.Content, last.Revision)
+	sent, err := b.deliverAnswerFor(in.UserID, message.Chat.ID, last.MessageID, last.ReplyTo, text)
+	if err != nil {
+		return fmt.Errorf("ошибка отправки исправленного ответа: %w", err)
+	}
+	b.deleteMessage(message.Chat.ID, message.MessageID)  // Просьба больше не нужна в чате
+	b.forgetSharedPages(message.Chat.ID, last.MessageID) // Прежняя страница - о старой версии ответа
+	if len(sent) > 0 {
+		b.offerAnswerButtons(message.Chat.ID, sent[0].MessageID) // Редактирование текста убрало кнопки
+	}
+
+	if len(sent) == 1 {
+		last.MessageID, last.At = sent[0].MessageID, time.Now()
+		b.lastAnswers.set(in.UserID, last)
+	} else {
+		b.lastAnswers.forget(in.UserID)
+	}
+	if err := b.recordUsage(in, turn, aiResponse); err != nil {
+		log.Printf("Ошибка записи статистики использования: %v", err)
+	}
+	if err := b.replaceLastAnswer(in.UserID, turn.Privacy, aiResponse.Content); err != nil {
+		log.Printf("Ошибка обновления истории: %v", err)
+	}
+	return nil
+}
+
+// replaceLastAnswer заменяет последний ответ активного разговора новой версией
+func (b *Bot) replaceLastAnswer(userID int64, privacy, content string) error {
+	if privacy == privacyStrict {
+		b.session.replaceLastAnswer(userID, content)
+		return nil
+	}
+	conversationID, err := b.activeConversation(userID)
+	if err != nil {
+		return err
+	}
+	_, err = b.db.Exec(`UPDATE history SET content = ? WHERE id = (SELECT MAX(id) FROM history
+		WHERE user_id = ? AND conversation_id = ? AND role = 'assistant')`, content, userID, conversationID)
+	if err != nil {
+		return fmt.Errorf("ошибка обновления ответа в истории: %w", err)
+	}
+	return nil
+}
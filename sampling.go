@@ -0,0 +1,267 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const maxStopSequences = 4 // Больше OpenAI-совместимые API обычно не принимают
+
+// SamplingParams - параметры генерации; нулевые значения не отправляются и оставляют умолчания провайдера
+type SamplingParams struct {
+	Stop             []string `json:"stop,omitempty"`
+	TopP             float64  `json:"top_p,omitempty"`
+	PresencePenalty  float64  `json:"presence_penalty,omitempty"`
+	FrequencyPenalty float64  `json:"frequency_penalty,omitempty"`
+	Seed             *int64   `json:"seed,omitempty"` // Фиксированный seed для воспроизводимых ответов (/seed)
+}
+
+// styleSampling - умолчания для стилей: мемному стилю полезно меньше повторяться
+var styleSampling = map[string]SamplingParams{
+	"official": {TopP: 0.9},
+	"meme":     {PresencePenalty: 0.6, FrequencyPenalty: 0.3},
+}
+
+// merge накладывает заданные поля override поверх p
+func (p SamplingParams) merge(override SamplingParams) SamplingParams {
+	if len(override.Stop) > 0 {
+		p.Stop = override.Stop
+	}
+	if override.TopP != 0 {
+		p.TopP = override.TopP
+	}
+	if override.PresencePenalty != 0 {
+		p.PresencePenalty = override.PresencePenalty
+	}
+	if override.FrequencyPenalty != 0 {
+		p.FrequencyPenalty = override.FrequencyPenalty
+	}
+	if override.Seed != nil {
+		p.Seed = override.Seed
+	}
+	return p
+}
+
+// validate проверяет диапазоны параметров
+func (p SamplingParams) validate() error {
+	if p.TopP < 0 || p.TopP > 1 {
+		return fmt.Errorf("top_p должен быть в диапазоне (0, 1], получено %g", p.TopP)
+	}
+	if p.PresencePenalty < -2 || p.PresencePenalty > 2 {
+		return fmt.Errorf("presence_penalty должен быть от -2 до 2, получено %g", p.PresencePenalty)
+	}
+	if p.FrequencyPenalty < -2 || p.FrequencyPenalty > 2 {
+		return fmt.Errorf("frequency_penalty должен быть от -2 до 2, получено %g", p.FrequencyPenalty)
+	}
+	if len(p.Stop) > maxStopSequences {
+		return fmt.Errorf("не больше %d стоп-последовательностей, получено %d", maxStopSequences, len(p.Stop))
+	}
+	return nil
+}
+
+// String показывает параметры в виде, который принимает /params
+func (p SamplingParams) String() string {
+	var parts []string
+	if p.TopP != 0 {
+		parts = append(parts, "top_p="+strconv.FormatFloat(p.TopP, 'g', -1, 64))
+	}
+	if p.PresencePenalty != 0 {
+		parts = append(parts, "presence="+strconv.FormatFloat(p.PresencePenalty, 'g', -1, 64))
+	}
+	if p.FrequencyPenalty != 0 {
+		parts = append(parts, "frequency="+strconv.FormatFloat(p.FrequencyPenalty, 'g', -1, 64))
+	}
+	if len(p.Stop) > 0 {
+		parts = append(parts, "stop="+strings.Join(p.Stop, "|"))
+	}
+	if p.Seed != nil {
+		parts = append(parts, "seed="+strconv.FormatInt(*p.Seed, 10))
+	}
+	if len(parts) == 0 {
+		return "умолчания провайдера"
+	}
+	return strings.Join(parts, " ")
+}
+
+// parseSamplingParams разбирает строку вида "top_p=0.9 presence=0.5 frequency=0.2 stop=###|END"
+func parseSamplingParams(text string) (SamplingParams, error) {
+	var p SamplingParams
+	for _, field := range strings.Fields(text) {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return p, fmt.Errorf("ожидается ключ=значение, получено %q", field)
+		}
+		if key == "stop" {
+			for _, s := range strings.Split(value, "|") {
+				if s != "" {
+					p.Stop = append(p.Stop, s)
+				}
+			}
+			continue
+		}
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return p, fmt.Errorf("некорректное число в %q", field)
+		}
+		switch key {
+		case "top_p":
+			p.TopP = number
+		case "presence", "presence_penalty":
+			p.PresencePenalty = number
+		case "frequency", "frequency_penalty":
+			p.FrequencyPenalty = number
+		default:
+			return p, fmt.Errorf("неизвестный параметр %q", key)
+		}
+	}
+	return p, p.validate()
+}
+
+// samplingFromEnv читает умолчания из TOP_P, PRESENCE_PENALTY, FREQUENCY_PENALTY и STOP_SEQUENCES (через |)
+func samplingFromEnv() (SamplingParams, error) {
+	var fields []string
+	for name, key := range map[string]string{"TOP_P": "top_p", "PRESENCE_PENALTY": "presence", "FREQUENCY_PENALTY": "frequency", "STOP_SEQUENCES": "stop"} {
+		if value := strings.TrimSpace(os.Getenv(name)); value != "" {
+			fields = append(fields, key+"="+value)
+		}
+	}
+	p, err := parseSamplingParams(strings.Join(fields, " "))
+	if err != nil {
+		return p, fmt.Errorf("некорректные параметры генерации в окружении: %w", err)
+	}
+	return p, nil
+}
+
+// samplingParams собирает действующие параметры: конфиг, затем стиль, затем личные настройки из /params
+func (b *Bot) samplingParams(userID int64, style string) SamplingParams {
+	params := b.cfg().Sampling.merge(styleSampling[style])
+	if user, err := b.getUserSampling(userID); err == nil {
+		params = params.merge(user)
+	}
+	if seed, err := b.getUserSeed(userID); err == nil && seed != nil {
+		params.Seed = seed
+	}
+	return params
+}
+
+// setParams обрабатывает команду /params: личные параметры генерации для экспериментов
+func (b *Bot) setParams(message *tgbotapi.Message) error {
+	userID := senderID(message)
+	arg := strings.TrimSpace(message.CommandArguments())
+	if arg == "" {
+		style, _ := b.getUserStyle(userID)
+		return b.reply(message, fmt.Sprintf("Сейчас действуют: %s\n\n"+
+			"Использование: /params top_p=0.9 presence=0.5 frequency=0.2 stop=###|END\n/params reset - сбросить",
+			b.samplingParams(userID, style)))
+	}
+
+	var params SamplingParams
+	if arg != "reset" {
+		var err error
+		if params, err = parseSamplingParams(arg); err != nil {
+			return b.reply(message, "❌ "+err.Error())
+		}
+	}
+	if err := b.setUserSampling(userID, params); err != nil {
+		b.reply(message, "Не удалось сохранить параметры, попробуй позже.")
+		return err
+	}
+	return b.reply(message, "🎛 Личные параметры генерации: "+params.String())
+}
+
+// setUserSampling сохраняет личные параметры генерации (пустые - сброс)
+func (b *Bot) setUserSampling(userID int64, params SamplingParams) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации параметров генерации: %w", err)
+	}
+	if _, err := b.db.Exec("INSERT OR IGNORE INTO users (user_id) VALUES (?)", userID); err != nil {
+		return fmt.Errorf("ошибка при вставке пользователя: %w", err)
+	}
+	if _, err := b.db.Exec("UPDATE users SET sampling = ? WHERE user_id = ?", string(data), userID); err != nil {
+		return fmt.Errorf("ошибка при обновлении параметров генерации: %w", err)
+	}
+	return nil
+}
+
+// getUserSampling возвращает личные параметры генерации пользователя
+func (b *Bot) getUserSampling(userID int64) (SamplingParams, error) {
+	var params SamplingParams
+	var data string
+	err := b.db.QueryRow("SELECT sampling FROM users WHERE user_id = ?", userID).Scan(&data)
+	if err == sql.ErrNoRows || data == "" {
+		return params, nil
+	}
+	if err != nil {
+		return params, fmt.Errorf("ошибка при получении параметров генерации: %w", err)
+	}
+	if err := json.Unmarshal([]byte(data), &params); err != nil {
+		return params, fmt.Errorf("ошибка разбора параметров генерации: %w", err)
+	}
+	return params, nil
+}
+
+// setSeed обрабатывает команду /seed <n>|off: закрепляет seed для воспроизводимых ответов
+func (b *Bot) setSeed(message *tgbotapi.Message) error {
+	userID := senderID(message)
+	arg := strings.TrimSpace(message.CommandArguments())
+	if arg == "" {
+		seed, err := b.getUserSeed(userID)
+		if err != nil {
+			return err
+		}
+		current := "не задан"
+		if seed != nil {
+			current = strconv.FormatInt(*seed, 10)
+		}
+		return b.reply(message, "Seed: "+current+"\n\nИспользование: /seed <число> или /seed off\n"+
+			"С одинаковым seed и вопросом модель отвечает одинаково, если провайдер это поддерживает.")
+	}
+
+	var seed *int64
+	if arg != "off" {
+		n, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return b.reply(message, "Seed должен быть целым числом, например: /seed 42")
+		}
+		seed = &n
+	}
+	if err := b.setUserSeed(userID, seed); err != nil {
+		b.reply(message, "Не удалось сохранить seed, попробуй позже.")
+		return err
+	}
+	if seed == nil {
+		return b.reply(message, "🎲 Seed сброшен, ответы снова случайные.")
+	}
+	return b.reply(message, fmt.Sprintf("🎲 Seed %d закреплён. Он будет виден в футере ответа.", *seed))
+}
+
+// setUserSeed сохраняет seed пользователя (nil - сброс)
+func (b *Bot) setUserSeed(userID int64, seed *int64) error {
+	if _, err := b.db.Exec("INSERT OR IGNORE INTO users (user_id) VALUES (?)", userID); err != nil {
+		return fmt.Errorf("ошибка при вставке пользователя: %w", err)
+	}
+	if _, err := b.db.Exec("UPDATE users SET seed = ? WHERE user_id = ?", seed, userID); err != nil {
+		return fmt.Errorf("ошибка при обновлении seed: %w", err)
+	}
+	return nil
+}
+
+// getUserSeed возвращает seed пользователя или nil, если он не задан
+func (b *Bot) getUserSeed(userID int64) (*int64, error) {
+	var seed sql.NullInt64
+	err := b.db.QueryRow("SELECT seed FROM users WHERE user_id = ?", userID).Scan(&seed)
+	if err == sql.ErrNoRows || (err == nil && !seed.Valid) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении seed: %w", err)
+	}
+	return &seed.Int64, nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// sanitizeRule - одно правило очистки ответа модели
+type sanitizeRule struct {
+	name        string
+	pattern     *regexp.Regexp
+	replacement string
+	proseOnly   bool // Не трогать блоки кода ```: в них пустые строки и отступы значимы
+}
+
+// codeFencePattern - блок кода ``` целиком; незакрытый блок продолжается до конца текста, как в markdownToHTML
+var codeFencePattern = regexp.MustCompile("(?ms)^[ \\t]*```.*?(?:^[ \\t]*```[^\\n]*$|\\z)")
+
+// sanitizeRules применяются по порядку к каждому ответу модели.
+// Новый артефакт - новая строка в таблице.
+var sanitizeRules = []sanitizeRule{
+	// Рассуждения reasoning-моделей: <think>…</think>, в том числе несколько блоков
+	{"think_blocks", regexp.MustCompile(`(?is)<(think|thinking|reasoning)>.*?</(think|thinking|reasoning)>`), "", false},
+	// Некоторые модели опускают открывающий тег, и ответ начинается с рассуждений до </think>
+	{"think_unopened", regexp.MustCompile(`(?is)^.*?</(think|thinking|reasoning)>`), "", false},
+	// Метка роли в начале: "assistant:", "Assistant:", "AI:", "Ассистент:"
+	{"role_prefix", regexp.MustCompile(`(?i)^\s*(assistant|ai|bot|ассистент|бот)\s*:\s*`), "", false},
+	// Вводная строка перед ответом: "Sure! Here's the answer:" / "Конечно! Вот ответ:"
+	{"sure_preamble", regexp.MustCompile(`(?i)^\s*(sure|certainly|конечно)[!,.]?\s+(here's|here is|вот)[^\n]*:\s*\n`), "", false},
+	// Три и более пустых строк подряд
+	{"blank_lines", regexp.MustCompile(`\n[ \t]*\n([ \t]*\n)+`), "\n\n", true},
+	// Пробелы в конце строк
+	{"trailing_spaces", regexp.MustCompile(`(?m)[ \t]+$`), "", false},
+}
+
+// sanitizeAnswer убирает из ответа модели служебные артефакты.
+// Если после очистки ничего не осталось (например, в ответе были одни рассуждения), возвращает
+// пустую строку: показывать пользователю сырые рассуждения нельзя, пустой ответ обрабатывает вызывающий.
+func sanitizeAnswer(text string) string {
+	for _, rule := range sanitizeRules {
+		if rule.proseOnly {
+			text = replaceOutsideCode(text, rule.pattern, rule.replacement)
+		} else {
+			text = rule.pattern.ReplaceAllString(text, rule.replacement)
+		}
+	}
+	return strings.TrimSpace(text)
+}
+
+// replaceOutsideCode применяет замену только к тексту между блоками кода ```
+func replaceOutsideCode(text string, pattern *regexp.Regexp, replacement string) string {
+	var sb strings.Builder
+	last := 0
+	for _, loc := range codeFencePattern.FindAllStringIndex(text, -1) {
+		sb.WriteString(pattern.ReplaceAllString(text[last:loc[0]], replacement))
+		sb.WriteString(text[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	sb.WriteString(pattern.ReplaceAllString(text[last:], replacement))
+	return sb.String()
+}
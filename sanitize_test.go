@@ -0,0 +1,59 @@
+package main
+
+import "testing"
+
+func TestSanitizeRules(t *testing.T) {
+	tests := []struct {
+		rule string // Правило из sanitizeRules, которое проверяет случай
+		in   string
+		want string
+	}{
+		{"think_blocks", "<think>считаю\nдолго</think>Ответ: 4", "Ответ: 4"},
+		{"think_blocks", "<Thinking>раз</Thinking>Первое. <reasoning>два</reasoning>Второе.", "Первое. Второе."},
+		{"think_unopened", "рассуждаю без открывающего тега\n</think>\nОтвет: 4", "Ответ: 4"},
+		{"role_prefix", "Assistant: Привет!", "Привет!"},
+		{"role_prefix", "  ассистент : Привет!", "Привет!"},
+		{"sure_preamble", "Sure! Here's the answer:\nОтвет: 4", "Ответ: 4"},
+		{"sure_preamble", "Конечно! Вот ответ:\nОтвет: 4", "Ответ: 4"},
+		{"blank_lines", "Абзац 1\n\n\n\nАбзац 2", "Абзац 1\n\nАбзац 2"},
+		{"blank_lines", "Абзац 1\n \n\t\n\nАбзац 2", "Абзац 1\n\nАбзац 2"},
+		{"blank_lines", "До\n\n\n```py\nx = 1\n\n\n\ny = 2\n```\n\n\nПосле", "До\n\n```py\nx = 1\n\n\n\ny = 2\n```\n\nПосле"},
+		{"blank_lines", "```\na\n\n\n\nb", "```\na\n\n\n\nb"}, // Незакрытый блок тоже код
+		{"trailing_spaces", "строка 1  \nстрока 2\t", "строка 1\nстрока 2"},
+	}
+
+	covered := make(map[string]bool)
+	for _, tt := range tests {
+		covered[tt.rule] = true
+		if got := sanitizeAnswer(tt.in); got != tt.want {
+			t.Errorf("%s: sanitizeAnswer(%q) = %q, ожидалось %q", tt.rule, tt.in, got, tt.want)
+		}
+	}
+	// Новое правило без своего случая здесь - ошибка теста, а не молчаливый пропуск
+	for _, rule := range sanitizeRules {
+		if !covered[rule.name] {
+			t.Errorf("для правила %s нет случая в тесте", rule.name)
+		}
+	}
+}
+
+func TestSanitizeAnswerKeepsOrdinaryText(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"обычный ответ", "Столица Франции - Париж.", "Столица Франции - Париж."},
+		{"роль не в начале", "Ответ бот: не метка роли", "Ответ бот: не метка роли"},
+		{"одна пустая строка", "Абзац 1\n\nАбзац 2", "Абзац 1\n\nАбзац 2"},
+		{"конечно без вводной", "Конечно, можно.", "Конечно, можно."},
+		{"отступы в коде", "```\n  код\n```", "```\n  код\n```"},
+		{"только рассуждения", "  <think>всё</think>  ", ""},
+		{"рассуждения без открывающего тега", "думаю...</think>\n\n", ""},
+	}
+	for _, tt := range tests {
+		if got := sanitizeAnswer(tt.in); got != tt.want {
+			t.Errorf("%s: sanitizeAnswer(%q) = %q, ожидалось %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	schedulerInterval  = 30 * time.Second // Как часто проверять, не пора ли выполнить задания
+	schedulerBatchSize = 20               // Сколько заданий выполнять за один проход
+	scheduledMaxDelay  = 3 * time.Hour    // Задание, которое не удалось выполнить за это время, снимается
+	sqliteTimeLayout   = "2006-01-02 15:04:05"
+)
+
+// Виды заданий планировщика: у каждого свой обработчик в jobRunners
+const (
+	jobLater  = "later"  // Отложенный ответ на вопрос (/later)
+	jobDigest = "digest" // Ежедневная сводка переписки (/digest_subscribe)
+	jobDelete = "delete" // Удаление исчезающего ответа (/ephemeral)
+	jobTopic  = "topic"  // Пост по теме подписки (/subscribe)
+)
+
+// jobRunners - обработчики заданий по видам. Ошибка, из-за которой модель недоступна,
+// оставляет задание в очереди до следующего прохода; любая другая снимает его.
+var jobRunners = map[string]func(b *Bot, job scheduledJob) error{
+	jobLater:  (*Bot).runLaterJob,
+	jobDigest: (*Bot).runDigestJob,
+	jobDelete: (*Bot).runDeleteJob,
+	jobTopic:  (*Bot).runTopicJob,
+}
+
+// offlineJobs - виды заданий, которым модель не нужна: они выполняются, даже когда цепь разомкнута
+var offlineJobs = []string{jobDelete}
+
+// scheduledJob - задание планировщика (таблица reminders)
+type scheduledJob struct {
+	ID      int64
+	UserID  int64
+	ChatID  int64
+	Kind    string
+	Payload string // Данные задания, смысл зависит от вида
+	DueAt   time.Time
+
+	QuietUntil time.Time // Задание отложено тихими часами до этого времени (нулевое - не откладывалось)
+	Silent     bool      // Идут тихие часы в режиме без звука: сообщения отправляются с disable_notification
+}
+
+// readyAt возвращает время, с которого задание можно выполнять: срок или конец тихих часов, если они его отложили
+func (j scheduledJob) readyAt() time.Time {
+	if j.QuietUntil.After(j.DueAt) {
+		return j.QuietUntil
+	}
+	return j.DueAt
+}
+
+// scheduleJob ставит задание на время dueAt
+func (b *Bot) scheduleJob(userID, chatID int64, kind, payload string, dueAt time.Time) (int64, error) {
+	res, err := b.db.Exec("INSERT INTO reminders (bot_id, user_id, chat_id, kind, payload, due_at) VALUES (?, ?, ?, ?, ?, ?)",
+		b.botID, userID, chatID, kind, payload, dueAt.UTC().Format(sqliteTimeLayout))
+	if err != nil {
+		return 0, fmt.Errorf("ошибка сохранения задания: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("ошибка сохранения задания: %w", err)
+	}
+	return id, nil
+}
+
+// userJobs возвращает невыполненные задания пользователя одного вида, ближайшие первыми
+func (b *Bot) userJobs(userID int64, kind string) ([]scheduledJob, error) {
+	rows, err := b.db.Query(`SELECT id, user_id, chat_id, kind, payload, due_at, quiet_until FROM reminders
+		WHERE bot_id = ? AND user_id = ? AND kind = ? AND delivered_at IS NULL ORDER BY due_at, id`, b.botID, userID, kind)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения заданий: %w", err)
+	}
+	return scanJobs(rows)
+}
+
+// cancelJob удаляет невыполненное задание пользователя; false - такого задания нет
+func (b *Bot) cancelJob(userID int64, kind string, id int64) (bool, error) {
+	res, err := b.db.Exec("DELETE FROM reminders WHERE id = ? AND user_id = ? AND kind = ? AND delivered_at IS NULL", id, userID, kind)
+	if err != nil {
+		return false, fmt.Errorf("ошибка отмены задания: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// dueJobs возвращает задания бота, время которых уже наступило. Если kinds не пуст - только этих видов.
+func (b *Bot) dueJobs(now time.Time, limit int, kinds ...string) ([]scheduledJob, error) {
+	query := `SELECT id, user_id, chat_id, kind, payload, due_at, quiet_until FROM reminders
+		WHERE bot_id = ? AND delivered_at IS NULL AND COALESCE(quiet_until, due_at) <= ?`
+	args := []any{b.botID, now.UTC().Format(sqliteTimeLayout)}
+	if len(kinds) > 0 {
+		query += " AND kind IN (?" + strings.Repeat(", ?", len(kinds)-1) + ")"
+		for _, kind := range kinds {
+			args = append(args, kind)
+		}
+	}
+	rows, err := b.db.Query(query+" ORDER BY due_at, id LIMIT ?", append(args, limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения заданий: %w", err)
+	}
+	return scanJobs(rows)
+}
+
+// scanJobs читает задания из результата запроса и закрывает его
+func scanJobs(rows *sql.Rows) ([]scheduledJob, error) {
+	defer rows.Close()
+	var jobs []scheduledJob
+	for rows.Next() {
+		var j scheduledJob
+		var quietUntil sql.NullTime
+		if err := rows.Scan(&j.ID, &j.UserID, &j.ChatID, &j.Kind, &j.Payload, &j.DueAt, &quietUntil); err != nil {
+			return nil, fmt.Errorf("ошибка чтения заданий: %w", err)
+		}
+		j.QuietUntil = quietUntil.Time
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// markJobDone отмечает задание выполненным; выполненные задания удаляет чистка базы
+func (b *Bot) markJobDone(id int64) error {
+	if _, err := b.db.Exec("UPDATE reminders SET delivered_at = CURRENT_TIMESTAMP WHERE id = ?", id); err != nil {
+		return fmt.Errorf("ошибка обновления задания: %w", err)
+	}
+	return nil
+}
+
+// schedulerLoop периодически выполняет задания, время которых наступило
+func (b *Bot) schedulerLoop() {
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := b.runDueJobs(time.Now()); err != nil {
+			slog.Warn("не удалось выполнить задания планировщика", "bot", b.name, "error", err)
+		}
+	}
+}
+
+// runDueJobs выполняет наступившие задания. Пока цепь разомкнута, выполняются только задания
+// из offlineJobs: остальные дождутся модели, но не дольше scheduledMaxDelay. Задания, попавшие
+// в тихие часы получателя, переносятся на их конец или выполняются без звука.
+func (b *Bot) runDueJobs(now time.Time) error {
+	var kinds []string
+	if b.breaker.open(now) {
+		kinds = offlineJobs
+	}
+	jobs, err := b.dueJobs(now, schedulerBatchSize, kinds...)
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		run, ok := jobRunners[job.Kind]
+		if !ok {
+			slog.Warn("неизвестный вид задания", "id", job.ID, "kind", job.Kind)
+			b.markJobDone(job.ID)
+			continue
+		}
+		if postponed, err := b.applyQuietHours(&job, now); err != nil {
+			slog.Warn("не удалось проверить тихие часы", "user_id", job.UserID, "error", err)
+		} else if postponed {
+			continue
+		}
+		err := run(b, job)
+		if err != nil && isBackendFailure(err) {
+			if now.Sub(job.readyAt()) > scheduledMaxDelay {
+				b.expireJob(job)
+				continue
+			}
+			return err // Модель недоступна - остальные задания подождут следующего прохода
+		}
+		if err != nil {
+			slog.Warn("ошибка выполнения задания", "id", job.ID, "kind", job.Kind, "error", err)
+		}
+		if err := b.markJobDone(job.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expireJob снимает задание, которое так и не удалось выполнить. О пропущенном отложенном вопросе
+// пользователь узнаёт; пропущенная сводка просто не приходит - следующая уже поставлена.
+func (b *Bot) expireJob(job scheduledJob) {
+	if job.Kind == jobLater {
+		msg := tgbotapi.NewMessage(job.ChatID, "😴 ИИ долго был недоступен, и отложенный вопрос остался без ответа. Задай его заново, пожалуйста.")
+		msg.DisableNotification = job.Silent
+		if _, err := b.api.Send(msg); err != nil {
+			slog.Warn("не удалось сообщить о снятом задании", "chat_id", job.ChatID, "error", err)
+		}
+	}
+	if err := b.markJobDone(job.ID); err != nil {
+		slog.Warn("не удалось снять задание", "id", job.ID, "error", err)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	searchResults = 5
+	snippetRadius = 60 // Сколько символов показывать вокруг найденного слова
+)
+
+// Полнотекстовый индекс истории. Таблица без собственного содержимого (content=”),
+// поэтому текст хранится только в history, а триггеры поддерживают индекс при вставке, изменении и удалении.
+// Удаление из такого индекса требует ровно того текста, что был проиндексирован: без триггера на UPDATE
+// правка ответа (/edit) оставила бы в индексе старый текст, а следующее удаление испортило бы индекс.
+var ftsSchema = []string{
+	`CREATE VIRTUAL TABLE IF NOT EXISTS history_fts USING fts5(content, content='', tokenize='unicode61 remove_diacritics 2')`,
+	`CREATE TRIGGER IF NOT EXISTS history_fts_insert AFTER INSERT ON history BEGIN
+		INSERT INTO history_fts (rowid, content) VALUES (new.id, new.content);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS history_fts_delete AFTER DELETE ON history BEGIN
+		INSERT INTO history_fts (history_fts, rowid, content) VALUES ('delete', old.id, old.content);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS history_fts_update AFTER UPDATE OF content ON history BEGIN
+		INSERT INTO history_fts (history_fts, rowid, content) VALUES ('delete', old.id, old.content);
+		INSERT INTO history_fts (rowid, content) VALUES (new.id, new.content);
+	END`,
+}
+
+// setupFullTextSearch создаёт индекс FTS5 и заполняет его уже существующей историей.
+// Если SQLite собран без FTS5 (go build без -tags sqlite_fts5), возвращает false - поиск работает через LIKE.
+func setupFullTextSearch(db *sql.DB) (bool, error) {
+	existed, err := tableExists(db, "history_fts")
+	if err != nil {
+		return false, err
+	}
+	if _, err := db.Exec(ftsSchema[0]); err != nil {
+		if strings.Contains(err.Error(), "no such module") {
+			return false, nil
+		}
+		return false, fmt.Errorf("ошибка создания полнотекстового индекса: %w", err)
+	}
+	for _, stmt := range ftsSchema[1:] {
+		if _, err := db.Exec(stmt); err != nil {
+			return false, fmt.Errorf("ошибка создания триггера полнотекстового индекса: %w", err)
+		}
+	}
+	if !existed {
+		if _, err := db.Exec("INSERT INTO history_fts (rowid, content) SELECT id, content FROM history"); err != nil {
+			return false, fmt.Errorf("ошибка заполнения полнотекстового индекса: %w", err)
+		}
+	}
+	return true, nil
+}
+
+// SearchResult - найденное сообщение истории
+type SearchResult struct {
+	ConversationID int64
+	Title          string
+	CreatedAt      time.Time
+	Content        string
+}
+
+// searchHistory ищет по истории пользователя: через FTS5, а без него - через LIKE
+func (b *Bot) searchHistory(userID int64, query string) ([]SearchResult, error) {
+	const columns = `SELECT h.conversation_id, COALESCE(c.title, ''), h.created_at, h.content FROM `
+
+	var rows *sql.Rows
+	var err error
+	if b.ftsEnabled {
+		rows, err = b.db.Query(columns+`history_fts f
+			JOIN history h ON h.id = f.rowid
+			LEFT JOIN conversations c ON c.id = h.conversation_id
+			WHERE history_fts MATCH ? AND h.user_id = ? AND COALESCE(c.bot_id, 0) = ?
+			ORDER BY f.rank LIMIT ?`, ftsQuery(query), userID, b.botID, searchResults)
+	} else {
+		rows, err = b.db.Query(columns+`history h
+			LEFT JOIN conversations c ON c.id = h.conversation_id
+			WHERE h.user_id = ? AND COALESCE(c.bot_id, 0) = ? AND h.content LIKE ? ESCAPE '\'
+			ORDER BY h.id DESC LIMIT ?`, userID, b.botID, "%"+escapeLike(query)+"%", searchResults)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка поиска по истории: %w", err)
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	for rows.Next() {
+		var r SearchResult
+		if err := rows.Scan(&r.ConversationID, &r.Title, &r.CreatedAt, &r.Content); err != nil {
+			return nil, fmt.Errorf("ошибка чтения результатов поиска: %w", err)
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// ftsQuery превращает запрос пользователя в запрос FTS5: каждое слово в кавычках,
+// чтобы операторы и спецсимволы не ломали синтаксис
+func ftsQuery(query string) string {
+	var terms []string
+	for _, word := range strings.Fields(query) {
+		terms = append(terms, `"`+strings.ReplaceAll(word, `"`, `""`)+`"`)
+	}
+	return strings.Join(terms, " ")
+}
+
+// escapeLike экранирует спецсимволы шаблона LIKE
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// snippet вырезает фрагмент текста вокруг первого найденного слова запроса
+func snippet(content, query string) string {
+	runes := []rune(content)
+	lower := []rune(strings.ToLower(content))
+	start := 0
+	for _, word := range strings.Fields(strings.ToLower(query)) {
+		if i := strings.Index(string(lower), word); i >= 0 {
+			start = utf8.RuneCountInString(string(lower)[:i])
+			break
+		}
+	}
+
+	from := max(start-snippetRadius, 0)
+	to := min(start+snippetRadius, len(runes))
+	text := strings.Join(strings.Fields(string(runes[from:to])), " ")
+	if from > 0 {
+		text = "…" + text
+	}
+	if to < len(runes) {
+		text += "…"
+	}
+	return text
+}
+
+// search обрабатывает команду /search <запрос>
+func (b *Bot) search(message *tgbotapi.Message) error {
+	query := strings.TrimSpace(message.CommandArguments())
+	if query == "" {
+		return b.reply(message, "Использование: /search <запрос>")
+	}
+
+	results, err := b.searchHistory(senderID(message), query)
+	if err != nil {
+		b.reply(message, "Не удалось выполнить поиск, попробуй позже.")
+		return err
+	}
+	if len(results) == 0 {
+		return b.reply(message, "🔍 Ничего не нашлось.")
+	}
+
+	var sb strings.Builder
+	var rows [][]tgbotapi.InlineKeyboardButton
+	sb.WriteString("🔍 Нашлось:\n")
+	for i, r := range results {
+		title := Conversation{ID: r.ConversationID, Title: r.Title}.displayTitle()
+		fmt.Fprintf(&sb, "\n%d. %s · %s\n%s\n", i+1, r.CreatedAt.Format("02.01.2006"), title, snippet(r.Content, query))
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%d. ↪ %s", i+1, title), fmt.Sprintf("conv_use:%d", r.ConversationID)),
+		))
+	}
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, sb.String())
+	msg.ReplyToMessageID = message.MessageID
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	if _, err := b.api.Send(msg); err != nil {
+		return fmt.Errorf("ошибка отправки результатов поиска: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+func TestSearchAfterRevisedAnswer(t *testing.T) {
+	b, _ := newTestBot(t)
+	if !b.ftsEnabled {
+		t.Skip("SQLite собран без FTS5 (go test -tags sqlite_fts5)")
+	}
+	const userID = 1
+	found := func(query string) bool {
+		t.Helper()
+		results, err := b.searchHistory(userID, query)
+		if err != nil {
+			t.Fatalf("searchHistory(%q): %v", query, err)
+		}
+		return len(results) > 0
+	}
+
+	if err := b.saveExchange(userID, privacyNormal, "как варить кофе", &AIResponse{Content: "турка и медленный огонь"}); err != nil {
+		t.Fatalf("saveExchange: %v", err)
+	}
+	if err := b.replaceLastAnswer(userID, privacyNormal, "френч-пресс и четыре минуты"); err != nil {
+		t.Fatalf("replaceLastAnswer: %v", err)
+	}
+	if found("турка") {
+		t.Error("поиск находит прежнюю версию ответа")
+	}
+	if !found("френч") {
+		t.Error("поиск не находит исправленный ответ")
+	}
+
+	// Удаление после правки должно убрать из индекса именно исправленный текст
+	if err := b.clearStoredHistory(userID); err != nil {
+		t.Fatalf("clearStoredHistory: %v", err)
+	}
+	if found("френч") || found("кофе") {
+		t.Error("после удаления истории поиск что-то находит")
+	}
+	if _, err := b.db.Exec("INSERT INTO history_fts (history_fts, rank) VALUES ('integrity-check', 0)"); err != nil {
+		t.Errorf("индекс повреждён: %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Лимит Telegram - 4096 UTF-16 символов; берём с запасом, чтобы эмодзи не вылезли за предел
+const messageTextLimit = 4000
+
+// deliverAnswer превращает плейсхолдер "Думаю..." в ответ.
+// Если ответ помещается в одно сообщение, плейсхолдер редактируется (без мигания и лишнего уведомления);
+// иначе плейсхолдер удаляется, а ответ отправляется частями. Markdown-таблицы перед отправкой переводятся
+// в вид, который Telegram может показать.
+func (b *Bot) deliverAnswer(chatID int64, placeholderID, replyTo int, text string) ([]tgbotapi.Message, error) {
+	return b.deliverAnswerMode(chatID, placeholderID, replyTo, text, false)
+}
+
+// deliverAnswerFor - deliverAnswer с учётом режима простого текста пользователя (/plain)
+func (b *Bot) deliverAnswerFor(userID, chatID int64, placeholderID, replyTo int, text string) ([]tgbotapi.Message, error) {
+	plain, err := b.getUserPlain(userID)
+	if err != nil {
+		log.Printf("Ошибка получения режима простого текста: %v", err)
+	}
+	return b.deliverAnswerMode(chatID, placeholderID, replyTo, text, plain)
+}
+
+// deliverAnswerMode доставляет ответ как deliverAnswer; в режиме plain разметка вырезается,
+// а сообщения уходят без ParseMode
+func (b *Bot) deliverAnswerMode(chatID int64, placeholderID, replyTo int, text string, plain bool) ([]tgbotapi.Message, error) {
+	if plain {
+		text = stripMarkdown(renderTablesWith(text, formatTableList))
+	} else {
+		text = renderTables(text)
+	}
+	parts := splitMessage(text, messageTextLimit)
+
+	if len(parts) == 1 {
+		sent, err := b.sendText(text, plain, func(text, parseMode string) tgbotapi.Chattable {
+			edit := tgbotapi.NewEditMessageText(chatID, placeholderID, text)
+			edit.ParseMode = parseMode
+			return edit
+		})
+		if err == nil {
+			return []tgbotapi.Message{sent}, nil
+		}
+		// Плейсхолдер могли удалить - тогда отправляем ответ обычным сообщением
+		log.Printf("Ошибка редактирования плейсхолдера, отправляю новым сообщением: %v", err)
+	}
+
+	b.deleteMessage(chatID, placeholderID)
+
+	var messages []tgbotapi.Message
+	for i, part := range parts {
+		sent, err := b.sendText(part, plain, func(text, parseMode string) tgbotapi.Chattable {
+			msg := tgbotapi.NewMessage(chatID, text)
+			msg.ParseMode = parseMode
+			if i == 0 {
+				msg.ReplyToMessageID = replyTo
+			}
+			return msg
+		})
+		if err != nil {
+			return messages, fmt.Errorf("ошибка отправки части %d/%d: %w", i+1, len(parts), err)
+		}
+		messages = append(messages, sent)
+	}
+	return messages, nil
+}
+
+// sendFormatted отправляет текст с Markdown (Mistral часто им отвечает), переведённым в HTML,
+// а если Telegram не смог разобрать разметку - повторяет отправку исходного текста без ParseMode.
+// build собирает сообщение из готового текста и режима разметки.
+func (b *Bot) sendFormatted(text string, build func(text, parseMode string) tgbotapi.Chattable) (tgbotapi.Message, error) {
+	sent, err := b.api.Send(build(markdownToHTML(text), tgbotapi.ModeHTML))
+	if err != nil && isParseError(err) {
+		sent, err = b.api.Send(build(text, ""))
+	}
+	return sent, err
+}
+
+// sendText отправляет текст через sendFormatted, а в режиме plain - как есть, без ParseMode
+func (b *Bot) sendText(text string, plain bool, build func(text, parseMode string) tgbotapi.Chattable) (tgbotapi.Message, error) {
+	if plain {
+		return b.api.Send(build(text, ""))
+	}
+	return b.sendFormatted(text, build)
+}
+
+// isParseError проверяет, что Telegram отклонил сообщение из-за некорректной разметки
+func isParseError(err error) bool {
+	return strings.Contains(err.Error(), "can't parse entities")
+}
+
+// deleteMessage удаляет сообщение, ошибку только логирует
+func (b *Bot) deleteMessage(chatID int64, messageID int) {
+	if _, err := b.api.Request(tgbotapi.NewDeleteMessage(chatID, messageID)); err != nil {
+		log.Printf("Ошибка удаления сообщения %d: %v", messageID, err)
+	}
+}
+
+// splitMessage делит текст на части не длиннее limit символов,
+// стараясь резать по абзацам, затем по строкам, затем по пробелам
+func splitMessage(text string, limit int) []string {
+	var parts []string
+	runes := []rune(text)
+	for len(runes) > limit {
+		chunk := string(runes[:limit])
+		cut := -1
+		for _, sep := range []string{"\n\n", "\n", " "} {
+			if i := strings.LastIndex(chunk, sep); i > 0 {
+				cut = len([]rune(chunk[:i]))
+				break
+			}
+		}
+		if cut <= 0 {
+			cut = limit
+		}
+		parts = append(parts, strings.TrimRight(string(runes[:cut]), " \n"))
+		runes = []rune(strings.TrimLeft(string(runes[cut:]), " \n"))
+	}
+	if len(runes) > 0 || len(parts) == 0 {
+		parts = append(parts, string(runes))
+	}
+	return parts
+}
+
+// replyMonospace отвечает текстом в моноширинном блоке (таблицы, отчёты)
+func (b *Bot) replyMonospace(message *tgbotapi.Message, text string) error {
+	msg := tgbotapi.NewMessage(message.Chat.ID, "<pre>"+html.EscapeString(text)+"</pre>")
+	msg.ReplyToMessageID = message.MessageID
+	msg.ParseMode = tgbotapi.ModeHTML
+
+	if _, err := b.api.Send(msg); err != nil {
+		return fmt.Errorf("ошибка отправки сообщения: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// validTiers - тарифы пользователей; всё, кроме free, считается премиумом в /users premium
+var validTiers = []string{"free", "plus", "premium"}
+
+// isValidTier проверяет, что тариф из списка validTiers
+func isValidTier(tier string) bool {
+	for _, t := range validTiers {
+		if t == tier {
+			return true
+		}
+	}
+	return false
+}
+
+// userSettingField - настройка, которую администратор может поменять через /setuser.
+// apply проверяет значение по тем же правилам, что и пользовательская команда, и сохраняет его.
+type userSettingField struct {
+	apply func(b *Bot, userID int64, value string) error
+	show  func(s UserSettings) string
+}
+
+var userSettingFields = map[string]userSettingField{
+	"style": {
+		apply: func(b *Bot, userID int64, value string) error {
+			if _, ok := map[string]bool{"friendly": true, "official": true, "meme": true}[value]; !ok {
+				return fmt.Errorf("style: ожидается friendly, official или meme")
+			}
+			return b.setUserStyle(userID, value)
+		},
+		show: func(s UserSettings) string { return s.Style },
+	},
+	"tier": {
+		apply: func(b *Bot, userID int64, value string) error {
+			if isValidTier(value) {
+				return b.setUserTier(userID, value)
+			}
+			return fmt.Errorf("tier: ожидается одно из %s", strings.Join(validTiers, ", "))
+		},
+		show: func(s UserSettings) string { return s.Tier },
+	},
+	"approved": {
+		apply: func(b *Bot, userID int64, value string) error {
+			approved, ok := parseToggle(value)
+			if !ok {
+				return fmt.Errorf("approved: ожидается on или off")
+			}
+			return b.setUserApproved(userID, approved)
+		},
+		show: func(s UserSettings) string { return onOff(s.Approved) },
+	},
+	"trial": {
+		apply: func(b *Bot, userID int64, value string) error {
+			used, err := strconv.Atoi(value)
+			if err != nil || used < 0 {
+				return fmt.Errorf("trial: ожидается число потраченных пробных сообщений (0 - сбросить)")
+			}
+			return b.setUserTrialUsed(userID, used)
+		},
+		show: func(s UserSettings) string { return strconv.Itoa(s.TrialUsed) },
+	},
+	"replylang": {
+		apply: func(b *Bot, userID int64, value string) error {
+			if value == "auto" {
+				value = ""
+			} else if _, ok := languageNames[value]; !ok {
+				return fmt.Errorf("replylang: ожидается auto или одно из %s", strings.Join(sortedLanguageCodes(), ", "))
+			}
+			return b.setUserReplyLang(userID, value)
+		},
+		show: func(s UserSettings) string {
+			if s.ReplyLang == "" {
+				return "auto"
+			}
+			return s.ReplyLang
+		},
+	},
+	"context": {
+		apply: func(b *Bot, userID int64, value string) error {
+			turns, err := strconv.Atoi(value)
+			if err != nil || turns < 0 || turns > maxContextTurns {
+				return fmt.Errorf("context: ожидается число от 0 до %d", maxContextTurns)
+			}
+			return b.setUserContextTurns(userID, turns)
+		},
+		show: func(s UserSettings) string { return strconv.Itoa(s.ContextTurns) },
+	},
+	"latency": {
+		apply: func(b *Bot, userID int64, value string) error {
+			enabled, ok := parseToggle(value)
+			if !ok {
+				return fmt.Errorf("latency: ожидается on или off")
+			}
+			return b.setUserShowLatency(userID, enabled)
+		},
+		show: func(s UserSettings) string { return onOff(s.ShowLatency) },
+	},
+	"name": {
+		apply: func(b *Bot, userID int64, value string) error {
+			enabled, ok := parseToggle(value)
+			if !ok {
+				return fmt.Errorf("name: ожидается on или off")
+			}
+			return b.setUserUseName(userID, enabled)
+		},
+		show: func(s UserSettings) string { return onOff(s.UseName) },
+	},
+	"privacy": {
+		apply: func(b *Bot, userID int64, value string) error {
+			if value != privacyStrict && value != privacyNormal {
+				return fmt.Errorf("privacy: ожидается strict или normal")
+			}
+			if err := b.setUserPrivacy(userID, value); err != nil {
+				return err
+			}
+			if value == privacyStrict {
+				return b.clearStoredHistory(userID) // Как и /privacy strict: сохранённая история не остаётся на диске
+			}
+			b.session.clear(userID)
+			return nil
+		},
+		show: func(s UserSettings) string { return s.Privacy },
+	},
+}
+
+// userSettingKeys возвращает допустимые ключи /setuser по алфавиту
+func userSettingKeys() []string {
+	keys := make([]string, 0, len(userSettingFields))
+	for key := range userSettingFields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// setUser обрабатывает команду /setuser <user_id> ключ=значение ...
+func (b *Bot) setUser(message *tgbotapi.Message) error {
+	usage := "Использование: /setuser <user_id> style=official tier=plus ...\nКлючи: " + strings.Join(userSettingKeys(), ", ")
+	args := strings.Fields(message.CommandArguments())
+	if len(args) < 2 {
+		return b.reply(message, usage)
+	}
+	userID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return b.reply(message, "Некорректный user_id.\n\n"+usage)
+	}
+
+	// Сначала разбираем всё целиком, чтобы не применить половину изменений
+	type change struct{ key, value string }
+	var changes []change
+	for _, arg := range args[1:] {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return b.reply(message, fmt.Sprintf("Ожидается ключ=значение, получено %q.\n\n%s", arg, usage))
+		}
+		key = strings.ToLower(key)
+		if _, ok := userSettingFields[key]; !ok {
+			return b.reply(message, fmt.Sprintf("Неизвестный ключ %q. Допустимые: %s", key, strings.Join(userSettingKeys(), ", ")))
+		}
+		changes = append(changes, change{key, strings.ToLower(value)})
+	}
+
+	before, err := b.getUserSettings(userID)
+	if err != nil {
+		return err
+	}
+	for _, c := range changes {
+		if err := userSettingFields[c.key].apply(b, userID, c.value); err != nil {
+			return b.reply(message, "❌ "+err.Error())
+		}
+	}
+	after, err := b.getUserSettings(userID)
+	if err != nil {
+		return err
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "✅ Настройки пользователя %d:\n", userID)
+	for _, c := range changes {
+		field := userSettingFields[c.key]
+		fmt.Fprintf(&sb, "%s: %s → %s\n", c.key, field.show(before), field.show(after))
+	}
+	return b.reply(message, sb.String())
+}
+
+// setUserTier сохраняет тариф пользователя
+func (b *Bot) setUserTier(userID int64, tier string) error {
+	_, err := b.db.Exec("INSERT OR IGNORE INTO users (user_id) VALUES (?)", userID)
+	if err != nil {
+		return fmt.Errorf("ошибка при вставке пользователя: %w", err)
+	}
+	_, err = b.db.Exec("UPDATE users SET tier = ? WHERE user_id = ?", tier, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка при обновлении тарифа: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const shareTimeout = 20 * time.Second // Сколько ждать Telegraph при публикации
+
+// sharedPage - ответ, подготовленный к публикации или уже опубликованный в Telegraph (таблица shared_pages)
+type sharedPage struct {
+	ID      int64
+	UserID  int64
+	Title   string
+	Content string // JSON-массив элементов Telegraph
+	URL     string // Пусто, пока публикация не подтверждена
+}
+
+// handleShare готовит публикацию ответа по кнопке 📤: собирает страницу из вопроса и ответа
+// и спрашивает подтверждение - страница будет публичной. Уже опубликованный ответ не публикуется
+// второй раз: бот присылает прежнюю ссылку.
+func (b *Bot) handleShare(query *tgbotapi.CallbackQuery, _ string) (string, error) {
+	answer := query.Message
+	page, err := b.sharedPageFor(answer.Chat.ID, answer.MessageID)
+	if err != nil {
+		return "", err
+	}
+	if page != nil && page.URL != "" {
+		return "", b.reply(answer, "📤 "+page.URL)
+	}
+	if page == nil {
+		if page, err = b.prepareSharedPage(query.From.ID, answer); err != nil {
+			return "", err
+		}
+	}
+
+	msg := tgbotapi.NewMessage(answer.Chat.ID, "📤 Опубликовать вопрос и ответ на telegra.ph?\n\n"+
+		"Страница будет публичной: её сможет открыть любой, у кого есть ссылка.")
+	msg.ReplyToMessageID = answer.MessageID
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("Опубликовать", fmt.Sprintf("share_ok:%d", page.ID)),
+		tgbotapi.NewInlineKeyboardButtonData("Отмена", fmt.Sprintf("share_no:%d", page.ID)),
+	))
+	if _, err := b.api.Send(msg); err != nil {
+		return "", fmt.Errorf("ошибка отправки сообщения: %w", err)
+	}
+	return "", nil
+}
+
+// shareConfirmHandler возвращает обработчик кнопок подтверждения публикации
+func (b *Bot) shareConfirmHandler(publish bool) func(*tgbotapi.CallbackQuery, string) (string, error) {
+	return func(query *tgbotapi.CallbackQuery, payload string) (string, error) {
+		id, err := strconv.ParseInt(payload, 10, 64)
+		if err != nil {
+			return "Кнопка больше не работает", nil
+		}
+		page, err := b.sharedPage(id)
+		if err != nil {
+			return "", err
+		}
+		if page == nil {
+			return "Публикация устарела", nil
+		}
+		if page.UserID != query.From.ID {
+			return "Эта кнопка не для тебя", nil
+		}
+
+		text := "Хорошо, не публикую."
+		switch {
+		case !publish && page.URL == "":
+			if err := b.deleteSharedPage(page.ID); err != nil {
+				return "", err
+			}
+		case page.URL != "":
+			text = "📤 " + page.URL // Уже опубликовано по другой кнопке
+		default:
+			url, err := b.publishSharedPage(page)
+			if err != nil {
+				return "Не удалось опубликовать, попробуй позже", err
+			}
+			text = "📤 " + url
+		}
+		edit := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, text)
+		if _, err := b.api.Send(edit); err != nil {
+			return "", fmt.Errorf("ошибка обновления сообщения: %w", err)
+		}
+		return "", nil
+	}
+}
+
+// prepareSharedPage собирает страницу из ответа бота и вопроса, на который он отвечал, и сохраняет её
+func (b *Bot) prepareSharedPage(userID int64, answer *tgbotapi.Message) (*sharedPage, error) {
+	title := "Ответ @" + b.name
+	var content []any
+	if question := answer.ReplyToMessage; question != nil && question.Text != "" {
+		title = truncateRunes(strings.Join(strings.Fields(question.Text), " "), telegraphTitleMax)
+		content = append(content, telegraphNode{Tag: "blockquote", Children: []any{question.Text}})
+	}
+	content = append(content, telegraphNodes(answer.Text, answer.Entities)...)
+	data, err := json.Marshal(content)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка маршалинга страницы: %w", err)
+	}
+
+	page := &sharedPage{UserID: userID, Title: title, Content: string(data)}
+	res, err := b.db.Exec(`INSERT INTO shared_pages (bot_id, user_id, chat_id, message_id, title, content)
+		VALUES (?, ?, ?, ?, ?, ?)`, b.botID, userID, answer.Chat.ID, answer.MessageID, page.Title, page.Content)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сохранения страницы: %w", err)
+	}
+	if page.ID, err = res.LastInsertId(); err != nil {
+		return nil, fmt.Errorf("ошибка сохранения страницы: %w", err)
+	}
+	return page, nil
+}
+
+// publishSharedPage публикует подготовленную страницу и запоминает её адрес
+func (b *Bot) publishSharedPage(page *sharedPage) (string, error) {
+	var content []any
+	if err := json.Unmarshal([]byte(page.Content), &content); err != nil {
+		return "", fmt.Errorf("ошибка разбора страницы: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shareTimeout)
+	defer cancel()
+	url, err := b.createTelegraphPage(ctx, page.Title, content)
+	if err != nil {
+		return "", err
+	}
+	if _, err := b.db.Exec("UPDATE shared_pages SET url = ? WHERE id = ?", url, page.ID); err != nil {
+		return "", fmt.Errorf("ошибка сохранения адреса страницы: %w", err)
+	}
+	return url, nil
+}
+
+// sharedPageFor возвращает страницу, подготовленную из сообщения с ответом; nil - такой нет
+func (b *Bot) sharedPageFor(chatID int64, messageID int) (*sharedPage, error) {
+	return scanSharedPage(b.db.QueryRow(`SELECT id, user_id, title, content, url FROM shared_pages
+		WHERE bot_id = ? AND chat_id = ? AND message_id = ?`, b.botID, chatID, messageID))
+}
+
+// sharedPage возвращает страницу по номеру; nil - такой нет
+func (b *Bot) sharedPage(id int64) (*sharedPage, error) {
+	return scanSharedPage(b.db.QueryRow("SELECT id, user_id, title, content, url FROM shared_pages WHERE id = ?", id))
+}
+
+func scanSharedPage(row *sql.Row) (*sharedPage, error) {
+	var page sharedPage
+	err := row.Scan(&page.ID, &page.UserID, &page.Title, &page.Content, &page.URL)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения страницы: %w", err)
+	}
+	return &page, nil
+}
+
+// deleteSharedPage удаляет неопубликованную страницу после отказа
+func (b *Bot) deleteSharedPage(id int64) error {
+	if _, err := b.db.Exec("DELETE FROM shared_pages WHERE id = ? AND url = ''", id); err != nil {
+		return fmt.Errorf("ошибка удаления страницы: %w", err)
+	}
+	return nil
+}
+
+// forgetSharedPages забывает страницы, собранные из сообщения: после правки ответа кнопка 📤
+// должна опубликовать новую версию. Уже опубликованные страницы в Telegraph остаются.
+func (b *Bot) forgetSharedPages(chatID int64, messageID int) {
+	if _, err := b.db.Exec("DELETE FROM shared_pages WHERE bot_id = ? AND chat_id = ? AND message_id = ?",
+		b.botID, chatID, messageID); err != nil {
+		log.Printf("Ошибка удаления страниц ответа: %v", err)
+	}
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// UserStats - личная статистика пользователя для /stats
+type UserStats struct {
+	Today         int
+	Week          int
+	AllTime       int
+	Tokens        int64
+	Streak        int
+	FavoriteStyle string
+	MessagesToday int // Все сообщения боту за сегодня, включая команды (из users.messages_today)
+	Tier          string
+
+	TokensToday  int64
+	MessageLimit int // Дневные лимиты тарифа, 0 - без ограничения
+	TokenLimit   int
+}
+
+// collectUserStats собирает статистику пользователя из таблицы usage.
+// Дни считаются по часовому поясу сервера - в нём же считается и сброс messages_today.
+func (b *Bot) collectUserStats(userID int64) (*UserStats, error) {
+	stats := &UserStats{}
+	err := b.db.QueryRow(`
+		SELECT
+			COUNT(CASE WHEN created_at >= datetime('now', 'localtime', 'start of day', 'utc') THEN 1 END),
+			COUNT(CASE WHEN created_at >= datetime('now', '-7 days') THEN 1 END),
+			COUNT(*),
+			COALESCE(SUM(prompt_tokens + completion_tokens), 0),
+			COALESCE(SUM(CASE WHEN created_at >= datetime('now', 'localtime', 'start of day', 'utc')
+				THEN prompt_tokens + completion_tokens END), 0)
+		FROM usage WHERE user_id = ?`, userID).
+		Scan(&stats.Today, &stats.Week, &stats.AllTime, &stats.Tokens, &stats.TokensToday)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подсчёта сообщений: %w", err)
+	}
+
+	err = b.db.QueryRow(`
+		SELECT style FROM usage WHERE user_id = ? AND style != ''
+		GROUP BY style ORDER BY COUNT(*) DESC, MAX(id) DESC LIMIT 1`, userID).Scan(&stats.FavoriteStyle)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("ошибка получения любимого стиля: %w", err)
+	}
+
+	err = b.db.QueryRow(`
+		SELECT CASE WHEN date(last_active) = date('now') THEN COALESCE(messages_today, 0) ELSE 0 END, COALESCE(tier, 'free')
+		FROM users WHERE user_id = ?`, userID).Scan(&stats.MessagesToday, &stats.Tier)
+	if err == sql.ErrNoRows {
+		stats.Tier = "free"
+	} else if err != nil {
+		return nil, fmt.Errorf("ошибка получения активности пользователя: %w", err)
+	}
+
+	stats.MessageLimit = b.cfg().DailyMessageLimits[stats.Tier]
+	stats.TokenLimit = b.cfg().DailyTokenLimits[stats.Tier]
+
+	days, err := b.activeDays(userID)
+	if err != nil {
+		return nil, err
+	}
+	stats.Streak = activityStreak(days, time.Now())
+	return stats, nil
+}
+
+// activeDays возвращает дни с ответами пользователю (YYYY-MM-DD по времени сервера), новые - первыми
+func (b *Bot) activeDays(userID int64) ([]string, error) {
+	rows, err := b.db.Query(`
+		SELECT DISTINCT date(created_at, 'localtime') AS day FROM usage
+		WHERE user_id = ? ORDER BY day DESC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения дней активности: %w", err)
+	}
+	defer rows.Close()
+
+	var days []string
+	for rows.Next() {
+		var day string
+		if err := rows.Scan(&day); err != nil {
+			return nil, fmt.Errorf("ошибка чтения дней активности: %w", err)
+		}
+		days = append(days, day)
+	}
+	return days, rows.Err()
+}
+
+// activityStreak считает серию дней подряд с активностью, заканчивающуюся сегодня.
+// Если сегодня сообщений ещё не было, серия считается от вчера: день ещё не закончился.
+// days - даты YYYY-MM-DD в часовом поясе now, отсортированные по убыванию.
+func activityStreak(days []string, now time.Time) int {
+	active := make(map[string]bool, len(days))
+	for _, day := range days {
+		active[day] = true
+	}
+
+	// Полдень не даёт переходу на летнее время сдвинуть дату при вычитании суток
+	day := time.Date(now.Year(), now.Month(), now.Day(), 12, 0, 0, 0, now.Location())
+	if !active[day.Format(time.DateOnly)] {
+		day = day.AddDate(0, 0, -1)
+	}
+	streak := 0
+	for active[day.Format(time.DateOnly)] {
+		streak++
+		day = day.AddDate(0, 0, -1)
+	}
+	return streak
+}
+
+// formatUserStats собирает компактную карточку статистики
+func formatUserStats(stats *UserStats) string {
+	var sb strings.Builder
+	sb.WriteString("📊 Твоя статистика\n\n")
+	fmt.Fprintf(&sb, "💬 Вопросов: сегодня %d · за неделю %d · всего %d\n", stats.Today, stats.Week, stats.AllTime)
+	fmt.Fprintf(&sb, "🔢 Токенов: %d\n", stats.Tokens)
+	fmt.Fprintf(&sb, "🔥 Серия: %d %s подряд\n", stats.Streak, pluralDays(stats.Streak))
+	if stats.FavoriteStyle != "" {
+		fmt.Fprintf(&sb, "🎭 Любимый стиль: %s\n", styleTitle(stats.FavoriteStyle))
+	}
+	if stats.MessageLimit == 0 && stats.TokenLimit == 0 {
+		fmt.Fprintf(&sb, "🎟 Тариф %s: сегодня %d сообщений, без ограничений", stats.Tier, stats.MessagesToday)
+		return sb.String()
+	}
+	fmt.Fprintf(&sb, "🎟 Тариф %s, сегодня:", stats.Tier)
+	if stats.MessageLimit > 0 {
+		fmt.Fprintf(&sb, " ответов %d из %d", stats.Today, stats.MessageLimit)
+	}
+	if stats.TokenLimit > 0 {
+		fmt.Fprintf(&sb, " · токенов %d из %d", stats.TokensToday, stats.TokenLimit)
+	}
+	return sb.String()
+}
+
+// pluralDays склоняет слово "день" по числу
+func pluralDays(n int) string {
+	switch {
+	case n%10 == 1 && n%100 != 11:
+		return "день"
+	case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+		return "дня"
+	}
+	return "дней"
+}
+
+// stats обрабатывает команду /stats; администраторам доступна сводка /stats global [csv]
+func (b *Bot) stats(message *tgbotapi.Message) error {
+	args := strings.Fields(message.CommandArguments())
+	if len(args) > 0 && args[0] == "global" && b.isAdmin(senderID(message)) {
+		return b.globalStats(message, len(args) > 1 && args[1] == "csv")
+	}
+
+	stats, err := b.collectUserStats(senderID(message))
+	if err != nil {
+		b.reply(message, "Не удалось посчитать статистику, попробуй позже.")
+		return err
+	}
+	return b.reply(message, formatUserStats(stats))
+}
+
+// namedCount - значение и сколько раз оно встретилось (для топов моделей и стилей)
+type namedCount struct {
+	Name  string
+	Count int
+}
+
+// GlobalStats - операционная сводка для /stats global
+type GlobalStats struct {
+	ActiveToday, Active7d, Active30d int
+	New7d, New30d                    int
+
+	Answers24h, Answers7d int
+	AvgAILatency          time.Duration // Среднее время ответа модели за 24 часа
+	Tokens30d             int64
+
+	RequestsSinceStart, ErrorsSinceStart int64 // Запросы к модели с момента запуска (из счётчиков в памяти)
+
+	TopModels, TopStyles []namedCount // За 30 дней
+	Breaker              string
+}
+
+// collectGlobalStats собирает сводку агрегирующими запросами и счётчиками с момента запуска
+func (b *Bot) collectGlobalStats() (*GlobalStats, error) {
+	stats := &GlobalStats{
+		RequestsSinceStart: b.metrics.get("ai_requests"),
+		ErrorsSinceStart:   b.metrics.get("ai_errors"),
+		Breaker:            b.breaker.describe(time.Now()),
+	}
+
+	err := b.db.QueryRow(`
+		SELECT
+			COUNT(CASE WHEN date(last_active) = date('now') THEN 1 END),
+			COUNT(CASE WHEN last_active >= datetime('now', '-7 days') THEN 1 END),
+			COUNT(CASE WHEN last_active >= datetime('now', '-30 days') THEN 1 END)
+		FROM users`).Scan(&stats.ActiveToday, &stats.Active7d, &stats.Active30d)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подсчёта активных пользователей: %w", err)
+	}
+
+	err = b.db.QueryRow(`
+		SELECT
+			COUNT(CASE WHEN created_at >= datetime('now', '-7 days') THEN 1 END),
+			COUNT(CASE WHEN created_at >= datetime('now', '-30 days') THEN 1 END)
+		FROM users`).Scan(&stats.New7d, &stats.New30d)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подсчёта новых пользователей: %w", err)
+	}
+
+	var avgMs float64
+	err = b.db.QueryRow(`
+		SELECT
+			COUNT(CASE WHEN created_at >= datetime('now', '-1 day') THEN 1 END),
+			COUNT(CASE WHEN created_at >= datetime('now', '-7 days') THEN 1 END),
+			COALESCE(AVG(CASE WHEN created_at >= datetime('now', '-1 day') THEN ai_ms END), 0),
+			COALESCE(SUM(prompt_tokens + completion_tokens), 0)
+		FROM usage WHERE created_at >= datetime('now', '-30 days')`).
+		Scan(&stats.Answers24h, &stats.Answers7d, &avgMs, &stats.Tokens30d)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подсчёта ответов: %w", err)
+	}
+	stats.AvgAILatency = time.Duration(avgMs) * time.Millisecond
+
+	if stats.TopModels, err = b.topUsage("model"); err != nil {
+		return nil, err
+	}
+	if stats.TopStyles, err = b.topUsage("style"); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// topUsage возвращает пять самых частых значений колонки usage за 30 дней
+func (b *Bot) topUsage(column string) ([]namedCount, error) {
+	rows, err := b.db.Query(fmt.Sprintf(`
+		SELECT %[1]s, COUNT(*) AS n FROM usage
+		WHERE created_at >= datetime('now', '-30 days') AND %[1]s != ''
+		GROUP BY %[1]s ORDER BY n DESC LIMIT 5`, column))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения топа %s: %w", column, err)
+	}
+	defer rows.Close()
+
+	var top []namedCount
+	for rows.Next() {
+		var item namedCount
+		if err := rows.Scan(&item.Name, &item.Count); err != nil {
+			return nil, fmt.Errorf("ошибка чтения топа %s: %w", column, err)
+		}
+		top = append(top, item)
+	}
+	return top, rows.Err()
+}
+
+// globalStatsRows раскладывает сводку в пары "показатель - значение" для таблицы и CSV
+func globalStatsRows(stats *GlobalStats, costPerMillion float64) [][2]string {
+	errorRate := 0.0
+	if stats.RequestsSinceStart > 0 {
+		errorRate = float64(stats.ErrorsSinceStart) / float64(stats.RequestsSinceStart) * 100
+	}
+	cost := "-"
+	if costPerMillion > 0 {
+		cost = fmt.Sprintf("$%.2f", float64(stats.Tokens30d)/1e6*costPerMillion)
+	}
+
+	rows := [][2]string{
+		{"Активных сегодня", fmt.Sprint(stats.ActiveToday)},
+		{"Активных за 7д", fmt.Sprint(stats.Active7d)},
+		{"Активных за 30д", fmt.Sprint(stats.Active30d)},
+		{"Новых за 7д", fmt.Sprint(stats.New7d)},
+		{"Новых за 30д", fmt.Sprint(stats.New30d)},
+		{"Ответов за 24ч", fmt.Sprint(stats.Answers24h)},
+		{"Ответов за 7д", fmt.Sprint(stats.Answers7d)},
+		{"Запросов с запуска", fmt.Sprint(stats.RequestsSinceStart)},
+		{"Ошибок с запуска", fmt.Sprintf("%d (%.1f%%)", stats.ErrorsSinceStart, errorRate)},
+		{"Средняя задержка ИИ", fmt.Sprintf("%.1fs", stats.AvgAILatency.Seconds())},
+		{"Токенов за 30д", fmt.Sprint(stats.Tokens30d)},
+		{"Расходы за 30д", cost},
+		{"Предохранитель", stats.Breaker},
+	}
+	for i, model := range stats.TopModels {
+		rows = append(rows, [2]string{fmt.Sprintf("Модель #%d", i+1), fmt.Sprintf("%s (%d)", shortModelName(model.Name), model.Count)})
+	}
+	for i, style := range stats.TopStyles {
+		rows = append(rows, [2]string{fmt.Sprintf("Стиль #%d", i+1), fmt.Sprintf("%s (%d)", style.Name, style.Count)})
+	}
+	return rows
+}
+
+// formatGlobalStats собирает моноширинную таблицу сводки
+func formatGlobalStats(rows [][2]string) string {
+	var sb strings.Builder
+	w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	for _, row := range rows {
+		fmt.Fprintf(w, "%s\t%s\n", row[0], row[1])
+	}
+	w.Flush()
+	return sb.String()
+}
+
+// globalStatsCSV выгружает сводку в CSV с колонками metric,value
+func globalStatsCSV(rows [][2]string) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"metric", "value"})
+	for _, row := range rows {
+		w.Write(row[:])
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, fmt.Errorf("ошибка записи CSV: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// globalStats обрабатывает команду /stats global [csv] (только для администраторов)
+func (b *Bot) globalStats(message *tgbotapi.Message, asCSV bool) error {
+	stats, err := b.collectGlobalStats()
+	if err != nil {
+		b.reply(message, "❌ "+err.Error())
+		return err
+	}
+	rows := globalStatsRows(stats, b.cfg().CostPerMillionTokens)
+	if !asCSV {
+		return b.replyMonospace(message, formatGlobalStats(rows))
+	}
+
+	data, err := globalStatsCSV(rows)
+	if err != nil {
+		return err
+	}
+	doc := tgbotapi.NewDocument(message.Chat.ID, tgbotapi.FileBytes{
+		Name:  fmt.Sprintf("stats-%s.csv", time.Now().Format("2006-01-02")),
+		Bytes: data,
+	})
+	doc.ReplyToMessageID = message.MessageID
+	if _, err := b.api.Send(doc); err != nil {
+		return fmt.Errorf("ошибка отправки статистики: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestActivityStreakTimezones(t *testing.T) {
+	load := func(name string) *time.Location {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			t.Skipf("нет данных о часовом поясе %s: %v", name, err)
+		}
+		return loc
+	}
+	tokyo := load("Asia/Tokyo")
+	newYork := load("America/New_York")
+	chatham := load("Pacific/Chatham") // Смещение +12:45/+13:45 ловит расчёты в целых часах
+
+	tests := []struct {
+		name string
+		days []string
+		now  time.Time
+		want int
+	}{
+		{
+			name: "сразу после полуночи: сегодня ещё пусто, серия со вчера",
+			days: []string{"2026-05-10", "2026-05-09"},
+			now:  time.Date(2026, 5, 11, 0, 1, 0, 0, tokyo),
+			want: 2,
+		},
+		{
+			name: "сразу после полуночи: по UTC ещё вчера, но считается местная дата",
+			days: []string{"2026-05-11", "2026-05-10"},
+			now:  time.Date(2026, 5, 11, 0, 1, 0, 0, tokyo), // 2026-05-10 15:01 UTC
+			want: 2,
+		},
+		{
+			name: "перед полуночью",
+			days: []string{"2026-05-10", "2026-05-09", "2026-05-08"},
+			now:  time.Date(2026, 5, 10, 23, 59, 59, 0, newYork),
+			want: 3,
+		},
+		{
+			name: "пропущен вчерашний день: серии нет",
+			days: []string{"2026-05-09", "2026-05-08"},
+			now:  time.Date(2026, 5, 11, 0, 1, 0, 0, tokyo),
+			want: 0,
+		},
+		{
+			name: "переход на летнее время",
+			days: []string{"2026-03-09", "2026-03-08", "2026-03-07"},
+			now:  time.Date(2026, 3, 9, 0, 30, 0, 0, newYork),
+			want: 3,
+		},
+		{
+			name: "переход на зимнее время",
+			days: []string{"2026-11-02", "2026-11-01", "2026-10-31"},
+			now:  time.Date(2026, 11, 2, 23, 30, 0, 0, newYork),
+			want: 3,
+		},
+		{
+			name: "через Новый год",
+			days: []string{"2027-01-01", "2026-12-31", "2026-12-30"},
+			now:  time.Date(2027, 1, 1, 0, 0, 0, 0, chatham),
+			want: 3,
+		},
+		{
+			name: "конец февраля високосного года",
+			days: []string{"2028-03-01", "2028-02-29", "2028-02-28"},
+			now:  time.Date(2028, 3, 1, 8, 0, 0, 0, time.UTC),
+			want: 3,
+		},
+		{
+			name: "нет активности",
+			days: nil,
+			now:  time.Date(2026, 5, 11, 12, 0, 0, 0, time.UTC),
+			want: 0,
+		},
+	}
+	for _, tt := range tests {
+		if got := activityStreak(tt.days, tt.now); got != tt.want {
+			t.Errorf("%s: activityStreak = %d, ожидалось %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+// Одни и те же дни дают разную серию в зависимости от того, в каком поясе сейчас "сегодня"
+func TestActivityStreakUsesLocationOfNow(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skipf("нет данных о часовом поясе: %v", err)
+	}
+	days := []string{"2026-05-11", "2026-05-10"}
+	instant := time.Date(2026, 5, 10, 20, 0, 0, 0, time.UTC) // В Токио уже 2026-05-11 05:00
+
+	if got := activityStreak(days, instant.In(tokyo)); got != 2 {
+		t.Errorf("в Токио серия %d, ожидалось 2", got)
+	}
+	// По UTC сегодня 2026-05-10: 11 мая ещё не наступило и в серию не входит
+	if got := activityStreak(days, instant); got != 1 {
+		t.Errorf("по UTC серия %d, ожидалось 1", got)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	statusCooldown  = 30 * time.Second // Не чаще одного /status от пользователя за этот период
+	statusDBTimeout = 2 * time.Second  // Дольше база считается недоступной
+)
+
+// userCooldown ограничивает частоту действия для каждого пользователя
+type userCooldown struct {
+	mu     sync.Mutex
+	window time.Duration
+	last   map[int64]time.Time
+}
+
+func newUserCooldown(window time.Duration) *userCooldown {
+	return &userCooldown{window: window, last: make(map[int64]time.Time)}
+}
+
+// allow разрешает действие, если с прошлого прошло не меньше window; иначе возвращает, сколько ждать
+func (c *userCooldown) allow(userID int64, now time.Time) (bool, time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if last, ok := c.last[userID]; ok && now.Sub(last) < c.window {
+		return false, c.window - now.Sub(last)
+	}
+	// Заодно выбрасываем устаревшие записи, чтобы карта не росла бесконечно
+	for id, last := range c.last {
+		if now.Sub(last) >= c.window {
+			delete(c.last, id)
+		}
+	}
+	c.last[userID] = now
+	return true, 0
+}
+
+// status обрабатывает команду /status: состояние базы, модели и очередей.
+// Всё берётся из счётчиков в памяти и одного лёгкого запроса к базе, поэтому
+// команда отвечает, даже когда модель недоступна.
+func (b *Bot) status(message *tgbotapi.Message) error {
+	if ok, wait := b.statusCooldown.allow(senderID(message), time.Now()); !ok {
+		return b.reply(message, fmt.Sprintf("Статус можно запрашивать раз в %d секунд, попробуй через %d с.",
+			int(statusCooldown.Seconds()), int(wait.Seconds())+1))
+	}
+	return b.reply(message, b.formatStatus(time.Now()))
+}
+
+// formatStatus собирает текст /status
+func (b *Bot) formatStatus(now time.Time) string {
+	var sb strings.Builder
+	sb.WriteString("✅ Telegram: работает\n")
+
+	ctx, cancel := context.WithTimeout(context.Background(), statusDBTimeout)
+	defer cancel()
+	startedAt := time.Now()
+	var one int
+	if err := b.db.QueryRowContext(ctx, "SELECT 1").Scan(&one); err != nil {
+		sb.WriteString("❌ База данных: недоступна\n")
+	} else {
+		fmt.Fprintf(&sb, "✅ База данных: %s\n", time.Since(startedAt).Round(time.Microsecond))
+	}
+
+	if b.breaker.open(now) {
+		fmt.Fprintf(&sb, "❌ Модель: недоступна (цепь %s)\n", b.breaker.describe(now))
+	} else {
+		fmt.Fprintf(&sb, "✅ Модель: доступна (цепь %s)\n", b.breaker.describe(now))
+	}
+	if last := b.breaker.lastSuccessAt(); !last.IsZero() {
+		fmt.Fprintf(&sb, "Последний успешный ответ: %s назад\n", now.Sub(last).Round(time.Second))
+	} else {
+		sb.WriteString("Последний успешный ответ: ещё не было\n")
+	}
+	if b.cfg().ProbeInterval > 0 && b.botID == 0 { // Проверку ведёт только основной бот
+		fmt.Fprintf(&sb, "Фоновая проверка: %s\n", b.probeState.describe(now))
+	}
+	fmt.Fprintf(&sb, "В очереди: %d\n", b.queues.Pending())
+
+	requests, failed := b.today.get("ai_requests", now), b.today.get("ai_errors", now)
+	if requests > 0 {
+		fmt.Fprintf(&sb, "Ошибки сегодня: %d из %d (%.1f%%)\n", failed, requests, float64(failed)/float64(requests)*100)
+	} else {
+		sb.WriteString("Ошибки сегодня: запросов к модели ещё не было\n")
+	}
+	fmt.Fprintf(&sb, "Аптайм: %s", formatUptime(now.Sub(b.startedAt)))
+	return sb.String()
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+// Стиль читается через подготовленный запрос, а пишется через b.db: под -race проверяем,
+// что параллельные чтения и записи разных пользователей не мешают друг другу
+func TestUserStyleConcurrentAccess(t *testing.T) {
+	b, _ := newTestBot(t)
+	styles := []string{"friendly", "official", "meme"}
+	const users, writes, readers = 4, 50, 4
+
+	var wg sync.WaitGroup
+	errs := make(chan error, users*(writes+readers*writes))
+	for userID := int64(1); userID <= users; userID++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < writes; i++ {
+				if err := b.setUserStyle(userID, styles[i%len(styles)]); err != nil {
+					errs <- err
+				}
+			}
+		}()
+		for r := 0; r < readers; r++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < writes; i++ {
+					style, err := b.getUserStyle(userID)
+					if err != nil {
+						errs <- err
+						continue
+					}
+					if _, ok := stylePrompts[style]; !ok {
+						t.Errorf("пользователь %d: прочитан неизвестный стиль %q", userID, style)
+					}
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	// После всех записей у каждого пользователя остаётся последний записанный стиль
+	want := styles[(writes-1)%len(styles)]
+	for userID := int64(1); userID <= users; userID++ {
+		if style, err := b.getUserStyle(userID); err != nil || style != want {
+			t.Errorf("пользователь %d: стиль %q (ошибка %v), ожидался %q", userID, style, err, want)
+		}
+	}
+}
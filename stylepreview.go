@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// styleOrder - стили в порядке показа в /style
+var styleOrder = []string{"friendly", "official", "meme"}
+
+// styleSampleQuestion - вопрос, на который отвечают примеры стилей
+const styleSampleQuestion = "Что такое чёрная дыра?"
+
+// styleSamples - готовые примеры ответа в каждом стиле. Они заранее написаны, а не генерируются:
+// просмотр примера ничего не стоит и мгновенно показывается во всплывающем уведомлении (до 200 символов).
+var styleSamples = map[string]string{
+	"friendly": "Это место, где гравитация такая сильная, что даже свет не может выбраться 🙂 Рассказать, как они появляются?",
+	"official": "Область пространства-времени, гравитационное притяжение которой не позволяет покинуть её даже свету.",
+	"meme":     "Это как холодильник ночью: что туда попало, обратно уже не вернётся 🕳️😅",
+}
+
+// styleKeyboard собирает выбор стилей: для каждого кнопка выбора и кнопка примера. Текущий стиль отмечен галочкой.
+func styleKeyboard(current string) tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, style := range styleOrder {
+		title := styleTitle(style)
+		if style == current {
+			title = "✅ " + title
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(title, "style_set:"+style),
+			tgbotapi.NewInlineKeyboardButtonData("👀 Пример", "style_preview:"+style),
+		))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// handleStylePreview показывает пример ответа в стиле, не меняя настройку пользователя
+func (b *Bot) handleStylePreview(_ *tgbotapi.CallbackQuery, style string) (string, error) {
+	sample, ok := styleSamples[style]
+	if !ok {
+		return "Такого стиля нет", nil
+	}
+	return fmt.Sprintf("%s\n«%s»\n%s", styleTitle(style), styleSampleQuestion, sample), nil
+}
+
+// handleStyleSet сохраняет выбранный стиль и убирает кнопки выбора
+func (b *Bot) handleStyleSet(query *tgbotapi.CallbackQuery, style string) (string, error) {
+	if _, ok := styleSamples[style]; !ok {
+		return "Такого стиля нет", nil
+	}
+	if err := b.setUserStyle(query.From.ID, style); err != nil {
+		return "", fmt.Errorf("ошибка сохранения стиля: %w", err)
+	}
+	edit := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID,
+		"Стиль общения установлен: "+styleTitle(style))
+	if _, err := b.api.Send(edit); err != nil {
+		log.Printf("Ошибка обновления выбора стиля: %v", err)
+	}
+	return "", nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const tableMonospaceWidth = 60 // Таблица шире этого в моноширинном блоке не влезает в экран телефона
+
+// tableSeparatorPattern - строка-разделитель под заголовком: |---|:---:|
+var tableSeparatorPattern = regexp.MustCompile(`^\|?\s*:?-{2,}:?\s*(\|\s*:?-{2,}:?\s*)*\|?$`)
+
+// renderTables заменяет Markdown-таблицы в ответе на то, что Telegram умеет показать:
+// узкие - выровненным моноширинным блоком, широкие - списком "колонка: значение" по строкам.
+// Таблицы внутри блоков кода не трогаются.
+func renderTables(text string) string {
+	return renderTablesWith(text, formatTable)
+}
+
+// renderTablesWith заменяет таблицы результатом format (для /plain - всегда списком: диктору так понятнее)
+func renderTablesWith(text string, format func(rows [][]string) string) string {
+	lines := strings.Split(text, "\n")
+	var out []string
+	fence := ""
+	for i := 0; i < len(lines); {
+		if fence != "" || strings.HasPrefix(strings.TrimSpace(lines[i]), "```") {
+			fence = fenceAfter(fence, lines[i])
+			out = append(out, lines[i])
+			i++
+			continue
+		}
+		end := i
+		for end < len(lines) && strings.Contains(lines[end], "|") && !strings.HasPrefix(strings.TrimSpace(lines[end]), "```") {
+			end++
+		}
+		if rows, ok := parseTable(lines[i:end]); ok {
+			out = append(out, format(rows))
+			i = end
+			continue
+		}
+		out = append(out, lines[i])
+		i++
+	}
+	return strings.Join(out, "\n")
+}
+
+// parseTable разбирает строки-кандидаты в ячейки; первая строка - заголовок.
+// Блок считается таблицей, если в нём есть разделитель под заголовком, все строки начинаются с "|"
+// или в трёх и более строках одинаковое число ячеек - иначе это просто текст с вертикальной чертой.
+func parseTable(lines []string) ([][]string, bool) {
+	if len(lines) < 2 {
+		return nil, false
+	}
+	separator, piped := false, true
+	var rows [][]string
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		piped = piped && strings.HasPrefix(line, "|")
+		if tableSeparatorPattern.MatchString(line) {
+			separator = true
+			continue
+		}
+		rows = append(rows, splitTableRow(line))
+	}
+	if len(rows) < 2 || !separator && !piped && !uniformRows(rows) {
+		return nil, false
+	}
+
+	// Строки разной длины дополняются пустыми ячейками до самой длинной
+	columns := 0
+	for _, row := range rows {
+		columns = max(columns, len(row))
+	}
+	for i, row := range rows {
+		for len(row) < columns {
+			row = append(row, "")
+		}
+		rows[i] = row
+	}
+	return rows, true
+}
+
+// uniformRows проверяет, что строк не меньше трёх и ячеек в них поровну
+func uniformRows(rows [][]string) bool {
+	if len(rows) < 3 {
+		return false
+	}
+	for _, row := range rows {
+		if len(row) != len(rows[0]) {
+			return false
+		}
+	}
+	return true
+}
+
+// splitTableRow делит строку таблицы на ячейки; экранированная \| остаётся внутри ячейки
+func splitTableRow(line string) []string {
+	line = strings.TrimSuffix(strings.TrimPrefix(line, "|"), "|")
+	cells := strings.Split(strings.ReplaceAll(line, `\|`, "\x00"), "|")
+	for i, cell := range cells {
+		// В моноширинном блоке и в списке разметка внутри ячейки не нужна
+		cell = strings.NewReplacer("\x00", "|", "**", "", "`", "").Replace(cell)
+		cells[i] = strings.TrimSpace(cell)
+	}
+	return cells
+}
+
+// formatTable выбирает вид таблицы по её ширине
+func formatTable(rows [][]string) string {
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+		}
+	}
+	total := 3 * (len(widths) - 1)
+	for _, w := range widths {
+		total += w
+	}
+	if total <= tableMonospaceWidth {
+		return formatTableMonospace(rows, widths)
+	}
+	return formatTableList(rows)
+}
+
+// formatTableMonospace выравнивает колонки пробелами внутри блока кода
+func formatTableMonospace(rows [][]string, widths []int) string {
+	var sb strings.Builder
+	sb.WriteString("```\n")
+	for r, row := range rows {
+		var line strings.Builder
+		for i, cell := range row {
+			if i > 0 {
+				line.WriteString(" | ")
+			}
+			line.WriteString(cell + strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell)))
+		}
+		sb.WriteString(strings.TrimRight(line.String(), " ") + "\n")
+		if r == 0 {
+			for i, w := range widths {
+				if i > 0 {
+					sb.WriteString("-+-")
+				}
+				sb.WriteString(strings.Repeat("-", w))
+			}
+			sb.WriteString("\n")
+		}
+	}
+	sb.WriteString("```")
+	return sb.String()
+}
+
+// formatTableList превращает каждую строку таблицы в блок "колонка: значение";
+// колонка без заголовка называется по номеру, пустые значения пропускаются
+func formatTableList(rows [][]string) string {
+	header := rows[0]
+	var blocks []string
+	for _, row := range rows[1:] {
+		var lines []string
+		for i, cell := range row {
+			if cell == "" {
+				continue
+			}
+			key := header[i]
+			if key == "" {
+				key = fmt.Sprintf("Колонка %d", i+1)
+			}
+			lines = append(lines, key+": "+cell)
+		}
+		if len(lines) > 0 {
+			blocks = append(blocks, strings.Join(lines, "\n"))
+		}
+	}
+	return strings.Join(blocks, "\n\n")
+}
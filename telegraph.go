@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	telegraphAPI        = "https://api.telegra.ph/"
+	telegraphTitleMax   = 80 // Заголовок страницы - начало вопроса
+	settingTelegraphKey = "telegraph_token"
+)
+
+// telegraphNode - элемент страницы Telegraph (Node в терминах API); дети - строки или другие элементы
+type telegraphNode struct {
+	Tag      string            `json:"tag"`
+	Attrs    map[string]string `json:"attrs,omitempty"`
+	Children []any             `json:"children,omitempty"`
+}
+
+// telegraphInlineTags - какими тегами Telegraph передаются сущности Telegram внутри абзаца
+var telegraphInlineTags = map[string]string{
+	"bold":          "b",
+	"italic":        "i",
+	"underline":     "u",
+	"strikethrough": "s",
+	"code":          "code",
+	"text_link":     "a",
+	"url":           "a",
+}
+
+// telegraphCall вызывает метод API Telegraph и разбирает поле result ответа
+func (b *Bot) telegraphCall(ctx context.Context, method string, form url.Values, result any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, telegraphAPI+method, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("ошибка создания запроса к Telegraph: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := b.aiClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("ошибка запроса к Telegraph: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Telegraph вернул %d", resp.StatusCode)
+	}
+	var body struct {
+		OK     bool            `json:"ok"`
+		Error  string          `json:"error"`
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("ошибка разбора ответа Telegraph: %w", err)
+	}
+	if !body.OK {
+		return fmt.Errorf("Telegraph отказал в %s: %s", method, body.Error)
+	}
+	if err := json.Unmarshal(body.Result, result); err != nil {
+		return fmt.Errorf("ошибка разбора ответа Telegraph: %w", err)
+	}
+	return nil
+}
+
+// telegraphToken возвращает токен аккаунта Telegraph. Аккаунт заводится при первой публикации,
+// токен хранится в таблице settings и переживает перезапуски.
+func (b *Bot) telegraphToken(ctx context.Context) (string, error) {
+	token, ok, err := b.getSetting(settingTelegraphKey)
+	if err != nil || ok {
+		return token, err
+	}
+	var account struct {
+		AccessToken string `json:"access_token"`
+	}
+	form := url.Values{"short_name": {b.name}, "author_name": {b.name}, "author_url": {"https://t.me/" + b.name}}
+	if err := b.telegraphCall(ctx, "createAccount", form, &account); err != nil {
+		return "", err
+	}
+	if err := b.setSetting(settingTelegraphKey, account.AccessToken); err != nil {
+		return "", err
+	}
+	return account.AccessToken, nil
+}
+
+// createTelegraphPage публикует страницу и возвращает её адрес
+func (b *Bot) createTelegraphPage(ctx context.Context, title string, content []any) (string, error) {
+	token, err := b.telegraphToken(ctx)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(content)
+	if err != nil {
+		return "", fmt.Errorf("ошибка маршалинга страницы Telegraph: %w", err)
+	}
+	var page struct {
+		URL string `json:"url"`
+	}
+	form := url.Values{
+		"access_token": {token},
+		"title":        {title},
+		"author_name":  {b.name},
+		"author_url":   {"https://t.me/" + b.name},
+		"content":      {string(data)},
+	}
+	if err := b.telegraphCall(ctx, "createPage", form, &page); err != nil {
+		return "", err
+	}
+	return page.URL, nil
+}
+
+// telegraphNodes переводит текст сообщения Telegram с сущностями в элементы Telegraph.
+// Блоки кода (pre) становятся отдельными <pre> с сохранёнными переносами, пустая строка
+// начинает новый абзац, одиночный перенос - <br>. Вложенные сущности упрощаются до внешней.
+func telegraphNodes(text string, entities []tgbotapi.MessageEntity) []any {
+	units := utf16.Encode([]rune(text))
+	slice := func(from, to int) string { return string(utf16.Decode(units[from:to])) }
+
+	sorted := append([]tgbotapi.MessageEntity(nil), entities...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Offset < sorted[j].Offset })
+
+	var blocks []any
+	var paragraph []any
+	flush := func() {
+		if len(paragraph) > 0 {
+			blocks = append(blocks, telegraphNode{Tag: "p", Children: paragraph})
+			paragraph = nil
+		}
+	}
+	addText := func(s string) {
+		for i, part := range strings.Split(s, "\n\n") {
+			if i > 0 {
+				flush()
+			}
+			for j, line := range strings.Split(part, "\n") {
+				if j > 0 {
+					paragraph = append(paragraph, telegraphNode{Tag: "br"})
+				}
+				if line != "" {
+					paragraph = append(paragraph, line)
+				}
+			}
+		}
+	}
+
+	pos := 0
+	for _, e := range sorted {
+		end := e.Offset + e.Length
+		if e.Offset < pos || end > len(units) {
+			continue // Вложенная или некорректная сущность
+		}
+		addText(slice(pos, e.Offset))
+		inner := slice(e.Offset, end)
+		switch tag, ok := telegraphInlineTags[e.Type]; {
+		case e.Type == "pre":
+			flush()
+			blocks = append(blocks, telegraphNode{Tag: "pre", Children: []any{inner}})
+		case ok && tag == "a":
+			href := e.URL
+			if e.Type == "url" {
+				href = inner
+			}
+			paragraph = append(paragraph, telegraphNode{Tag: tag, Attrs: map[string]string{"href": href}, Children: []any{inner}})
+		case ok:
+			paragraph = append(paragraph, telegraphNode{Tag: tag, Children: []any{inner}})
+		default:
+			addText(inner)
+		}
+		pos = end
+	}
+	addText(slice(pos, len(units)))
+	flush()
+	return blocks
+}
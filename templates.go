@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const templateDialogTTL = 5 * time.Minute // Сколько ждём ответа на вопрос шаблона
+
+// templatesJSON - библиотека шаблонов; чтобы добавить шаблон, достаточно дописать его в templates.json
+//
+//go:embed templates.json
+var templatesJSON []byte
+
+// placeholderPattern находит в шаблоне подстановки вида {тема}
+var placeholderPattern = regexp.MustCompile(`\{([^{}\n]+)\}`)
+
+// PromptTemplate - шаблон промпта с подстановками
+type PromptTemplate struct {
+	ID        string            `json:"id"`
+	Title     string            `json:"title"`
+	Prompt    string            `json:"prompt"`
+	Questions map[string]string `json:"questions"` // Вопрос для каждой подстановки; без него спрашиваем по имени
+}
+
+// placeholders возвращает имена подстановок в порядке первого появления
+func (t *PromptTemplate) placeholders() []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, match := range placeholderPattern.FindAllStringSubmatch(t.Prompt, -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			names = append(names, match[1])
+		}
+	}
+	return names
+}
+
+// question возвращает вопрос для подстановки name
+func (t *PromptTemplate) question(name string) string {
+	if q, ok := t.Questions[name]; ok {
+		return q
+	}
+	return fmt.Sprintf("Что подставить вместо «%s»?", name)
+}
+
+// fill собирает промпт из шаблона и ответов пользователя
+func (t *PromptTemplate) fill(values map[string]string) string {
+	return placeholderPattern.ReplaceAllStringFunc(t.Prompt, func(match string) string {
+		if value, ok := values[match[1:len(match)-1]]; ok {
+			return value
+		}
+		return match
+	})
+}
+
+// loadTemplates разбирает встроенную библиотеку шаблонов
+func loadTemplates(data []byte) ([]*PromptTemplate, error) {
+	var templates []*PromptTemplate
+	if err := json.Unmarshal(data, &templates); err != nil {
+		return nil, fmt.Errorf("ошибка разбора templates.json: %w", err)
+	}
+	ids := make(map[string]bool)
+	for _, t := range templates {
+		if t.ID == "" || strings.Contains(t.ID, ":") || ids[t.ID] {
+			return nil, fmt.Errorf("templates.json: пустой, повторяющийся или некорректный id %q", t.ID)
+		}
+		ids[t.ID] = true
+	}
+	return templates, nil
+}
+
+// templateDialog - заполнение шаблона: какие подстановки уже известны и на какой вопрос ждём ответ
+type templateDialog struct {
+	template   *PromptTemplate
+	values     map[string]string
+	pending    []string // Подстановки, которые ещё предстоит спросить; первая - текущий вопрос
+	questionID int      // Сообщение с текущим вопросом: ответ на него и есть значение подстановки
+	askedAt    time.Time
+}
+
+// templateDialogs хранит незаконченные заполнения шаблонов, по одному на пользователя.
+// Ответ узнаётся по reply на сообщение с вопросом, поэтому посторонние сообщения диалог не сбивают.
+type templateDialogs struct {
+	mu      sync.Mutex
+	dialogs map[int64]*templateDialog
+}
+
+func newTemplateDialogs() *templateDialogs {
+	return &templateDialogs{dialogs: make(map[int64]*templateDialog)}
+}
+
+// start начинает заполнение шаблона, заменяя прежнее незаконченное
+func (d *templateDialogs) start(userID int64, template *PromptTemplate) *templateDialog {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for id, dialog := range d.dialogs {
+		if time.Since(dialog.askedAt) > templateDialogTTL {
+			delete(d.dialogs, id)
+		}
+	}
+	dialog := &templateDialog{template: template, values: make(map[string]string), pending: template.placeholders()}
+	d.dialogs[userID] = dialog
+	return dialog
+}
+
+// asked запоминает сообщение с текущим вопросом
+func (d *templateDialogs) asked(userID int64, questionID int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if dialog, ok := d.dialogs[userID]; ok {
+		dialog.questionID, dialog.askedAt = questionID, time.Now()
+	}
+}
+
+// answer принимает ответ на вопрос questionID. found - это ответ на вопрос шаблона,
+// expired - вопрос устарел; done - все подстановки заполнены (диалог при этом удаляется).
+func (d *templateDialogs) answer(userID int64, questionID int, value string) (dialog *templateDialog, found, expired, done bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	dialog, ok := d.dialogs[userID]
+	if !ok || dialog.questionID != questionID {
+		return nil, false, false, false
+	}
+	if time.Since(dialog.askedAt) > templateDialogTTL {
+		delete(d.dialogs, userID)
+		return nil, true, true, false
+	}
+	dialog.values[dialog.pending[0]] = value
+	dialog.pending = dialog.pending[1:]
+	if len(dialog.pending) == 0 {
+		delete(d.dialogs, userID)
+		return dialog, true, false, true
+	}
+	return dialog, true, false, false
+}
+
+// forget прерывает незаконченное заполнение шаблона (/forgetme)
+func (d *templateDialogs) forget(userID int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.dialogs, userID)
+}
+
+// showTemplates обрабатывает команду /templates: список шаблонов кнопками
+func (b *Bot) showTemplates(message *tgbotapi.Message) error {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, t := range b.templates {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(t.Title, "tpl:"+t.ID)))
+	}
+	msg := tgbotapi.NewMessage(message.Chat.ID, "📋 Выбери шаблон - я спрошу, что в него подставить, и отправлю готовый запрос.")
+	msg.ReplyToMessageID = message.MessageID
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	if _, err := b.api.Send(msg); err != nil {
+		return fmt.Errorf("ошибка отправки списка шаблонов: %w", err)
+	}
+	return nil
+}
+
+// findTemplate ищет шаблон по id; nil - такого шаблона нет
+func (b *Bot) findTemplate(id string) *PromptTemplate {
+	for _, t := range b.templates {
+		if t.ID == id {
+			return t
+		}
+	}
+	return nil
+}
+
+// handleTemplateChoice начинает заполнение выбранного шаблона
+func (b *Bot) handleTemplateChoice(query *tgbotapi.CallbackQuery, payload string) (string, error) {
+	template := b.findTemplate(payload)
+	if template == nil {
+		return "Такого шаблона больше нет", nil
+	}
+	in := chatInput{UserID: query.From.ID, ChatID: query.Message.Chat.ID, FirstName: query.From.FirstName}
+	return "", b.startTemplate(context.Background(), in, template, query.Message.MessageID)
+}
+
+// startTemplate задаёт первый вопрос шаблона, а шаблон без подстановок сразу отправляет модели
+func (b *Bot) startTemplate(ctx context.Context, in chatInput, template *PromptTemplate, replyTo int) error {
+	dialog := b.templateDialogs.start(in.UserID, template)
+	if len(dialog.pending) == 0 {
+		in.Prompt = template.Prompt
+		return b.answerPrompt(ctx, in, replyTo)
+	}
+	return b.askTemplateQuestion(in.ChatID, in.UserID, dialog)
+}
+
+// askTemplateQuestion задаёт вопрос о текущей подстановке; ForceReply заставляет клиента ответить именно на него
+func (b *Bot) askTemplateQuestion(chatID, userID int64, dialog *templateDialog) error {
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("%s\n\n%s", dialog.template.Title, dialog.template.question(dialog.pending[0])))
+	msg.ReplyMarkup = tgbotapi.ForceReply{ForceReply: true, InputFieldPlaceholder: truncateRunes(dialog.pending[0], 63)}
+	sent, err := b.api.Send(msg)
+	if err != nil {
+		return fmt.Errorf("ошибка отправки вопроса шаблона: %w", err)
+	}
+	b.templateDialogs.asked(userID, sent.MessageID)
+	return nil
+}
+
+// continueTemplate принимает ответ на вопрос шаблона. handled=false - сообщение не относится к шаблону.
+func (b *Bot) continueTemplate(ctx context.Context, message *tgbotapi.Message) (handled bool, err error) {
+	if message.ReplyToMessage == nil || message.Text == "" {
+		return false, nil
+	}
+	in := chatInputFrom(message, "")
+	dialog, found, expired, done := b.templateDialogs.answer(in.UserID, message.ReplyToMessage.MessageID, strings.TrimSpace(message.Text))
+	switch {
+	case !found:
+		return false, nil
+	case expired:
+		return true, b.reply(message, "⌛ Этот шаблон ждал ответа дольше 5 минут. Выбери его заново: /templates")
+	case !done:
+		return true, b.askTemplateQuestion(message.Chat.ID, in.UserID, dialog)
+	}
+
+	in.Prompt = dialog.template.fill(dialog.values)
+	in.RequestID = updateInfoFrom(ctx).RequestID
+	return true, b.answerPrompt(ctx, in, message.MessageID)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	titleAfterMessages = 4  // Название придумывается после второго обмена репликами
+	titleMaxTokens     = 24 // Название короткое, длинный ответ не нужен
+)
+
+const titlePrompt = "Придумай название для этого разговора: не больше пяти слов, на языке разговора, " +
+	"без кавычек, точки в конце и пояснений. Ответь только названием."
+
+// maybeTitleConversation в фоне придумывает название активному разговору без названия.
+// Запрос служебный: ответ пользователю не задерживает и в его расход не засчитывается.
+func (b *Bot) maybeTitleConversation(userID int64) {
+	var id int64
+	var title string
+	var messages int
+	err := b.db.QueryRow(`
+		SELECT c.id, c.title, (SELECT COUNT(*) FROM history h WHERE h.conversation_id = c.id)
+		FROM conversations c WHERE c.bot_id = ? AND c.user_id = ? AND c.active = 1`, b.botID, userID).Scan(&id, &title, &messages)
+	if err != nil {
+		slog.Warn("не удалось проверить название разговора", "user_id", userID, "error", err)
+		return
+	}
+	if title != "" || messages != titleAfterMessages {
+		return
+	}
+
+	go func() {
+		if err := b.generateConversationTitle(userID, id); err != nil {
+			slog.Warn("не удалось придумать название разговора", "conversation_id", id, "error", err)
+		}
+	}()
+}
+
+// generateConversationTitle просит модель назвать разговор и сохраняет название,
+// если пользователь не успел задать его сам через /rename
+func (b *Bot) generateConversationTitle(userID, conversationID int64) error {
+	rows, err := b.db.Query("SELECT role, content FROM history WHERE conversation_id = ? ORDER BY id LIMIT ?",
+		conversationID, titleAfterMessages)
+	if err != nil {
+		return fmt.Errorf("ошибка получения истории разговора: %w", err)
+	}
+	messages := []ChatMessage{{Role: "system", Content: titlePrompt}}
+	var dialog strings.Builder
+	for rows.Next() {
+		var role, content string
+		if err := rows.Scan(&role, &content); err != nil {
+			rows.Close()
+			return fmt.Errorf("ошибка чтения истории разговора: %w", err)
+		}
+		fmt.Fprintf(&dialog, "%s: %s\n\n", role, truncateRunes(content, 500))
+	}
+	rows.Close()
+	messages = append(messages, ChatMessage{Role: "user", Content: dialog.String()})
+
+	resp, err := b.doChatRequest(context.Background(), OpenAIRequest{Model: MODEL, Messages: messages, MaxTokens: titleMaxTokens})
+	if err != nil {
+		return err
+	}
+	title := cleanTitle(resp.Content)
+	if title == "" {
+		return fmt.Errorf("модель вернула пустое название")
+	}
+
+	_, err = b.db.Exec("UPDATE conversations SET title = ? WHERE id = ? AND user_id = ? AND title = ''", title, conversationID, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения названия разговора: %w", err)
+	}
+	return nil
+}
+
+// cleanTitle убирает из ответа модели кавычки, точку и лишние строки
+func cleanTitle(text string) string {
+	title, _, _ := strings.Cut(strings.TrimSpace(text), "\n")
+	title = strings.Trim(title, " \"'«»*.")
+	return truncateRunes(title, maxConversationName)
+}
+
+// truncateRunes обрезает строку до limit символов
+func truncateRunes(text string, limit int) string {
+	if utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+	return string([]rune(text)[:limit]) + "…"
+}
+
+// renameConversation обрабатывает команду /rename <название>
+func (b *Bot) renameConversation(message *tgbotapi.Message) error {
+	userID := senderID(message)
+	title := strings.TrimSpace(message.CommandArguments())
+	if title == "" {
+		return b.reply(message, "Использование: /rename <название>")
+	}
+	if utf8.RuneCountInString(title) > maxConversationName {
+		return b.reply(message, fmt.Sprintf("Название слишком длинное (максимум %d символов).", maxConversationName))
+	}
+
+	id, err := b.activeConversation(userID)
+	if err != nil {
+		return err
+	}
+	if _, err := b.db.Exec("UPDATE conversations SET title = ? WHERE id = ? AND user_id = ?", title, id, userID); err != nil {
+		b.reply(message, "Не удалось переименовать, попробуй позже.")
+		return fmt.Errorf("ошибка переименования разговора: %w", err)
+	}
+	return b.reply(message, fmt.Sprintf("✏️ Текущий разговор теперь называется «%s».", title))
+}
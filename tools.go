@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"log/slog"
+	"math"
+	"strconv"
+	"time"
+)
+
+const maxToolHops = 3 // Сколько раз подряд модель может вызвать инструменты, прежде чем обязана ответить
+
+// Tool - описание инструмента для модели в формате OpenAI
+type Tool struct {
+	Type     string       `json:"type"`
+	Function ToolFunction `json:"function"`
+}
+
+// ToolFunction - имя, описание и JSON Schema параметров инструмента
+type ToolFunction struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Parameters  json.RawMessage `json:"parameters"`
+}
+
+// ToolCall - вызов инструмента, запрошенный моделью
+type ToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"` // JSON-строка с аргументами
+	} `json:"function"`
+}
+
+// registeredTool связывает описание инструмента с Go-обработчиком
+type registeredTool struct {
+	Tool
+	Handler func(args json.RawMessage) (string, error)
+}
+
+// registerTools подключает встроенные инструменты, если они включены (ENABLE_TOOLS)
+func (b *Bot) registerTools() {
+	b.tools = make(map[string]*registeredTool)
+	if !b.cfg().EnableTools {
+		return
+	}
+	for _, tool := range []*registeredTool{
+		{
+			Tool: newTool("current_time", "Текущие дата и время. Вызывай, когда вопрос зависит от сегодняшней даты или времени.",
+				`{"type":"object","properties":{"timezone":{"type":"string","description":"IANA-зона, например Europe/Moscow"}}}`),
+			Handler: currentTimeTool,
+		},
+		{
+			Tool: newTool("calculator", "Точно вычисляет арифметическое выражение: + - * / %, скобки, sqrt(x), pow(x, y), abs(x).",
+				`{"type":"object","properties":{"expression":{"type":"string"}},"required":["expression"]}`),
+			Handler: calculatorTool,
+		},
+	} {
+		b.tools[tool.Function.Name] = tool
+	}
+}
+
+// newTool собирает описание инструмента-функции
+func newTool(name, description, parameters string) Tool {
+	return Tool{Type: "function", Function: ToolFunction{Name: name, Description: description, Parameters: json.RawMessage(parameters)}}
+}
+
+// toolDefinitions возвращает описания всех подключённых инструментов для запроса
+func (b *Bot) toolDefinitions() []Tool {
+	tools := make([]Tool, 0, len(b.tools))
+	for _, tool := range b.tools {
+		tools = append(tools, tool.Tool)
+	}
+	return tools
+}
+
+// doChatRequestWithTools отправляет запрос с инструментами и выполняет их вызовы,
+// пока модель не даст обычный ответ. После maxToolHops инструменты убираются из запроса.
+// Токены и время всех шагов суммируются в итоговом ответе.
+func (b *Bot) doChatRequestWithTools(ctx context.Context, reqBody OpenAIRequest) (*AIResponse, error) {
+	var usage Usage
+	var duration time.Duration
+	for hop := 0; ; hop++ {
+		if hop < maxToolHops {
+			reqBody.Tools = b.toolDefinitions()
+		} else {
+			reqBody.Tools = nil
+		}
+
+		resp, err := b.doChatRequest(ctx, reqBody)
+		if err != nil {
+			return nil, err
+		}
+		usage.PromptTokens += resp.Usage.PromptTokens
+		usage.CompletionTokens += resp.Usage.CompletionTokens
+		usage.TotalTokens += resp.Usage.TotalTokens
+		duration += resp.Duration
+
+		if len(resp.ToolCalls) == 0 || reqBody.Tools == nil {
+			resp.Usage, resp.Duration = usage, duration
+			return resp, nil
+		}
+
+		reqBody.Messages = append(reqBody.Messages, ChatMessage{Role: "assistant", Content: resp.Content, ToolCalls: resp.ToolCalls})
+		for _, call := range resp.ToolCalls {
+			reqBody.Messages = append(reqBody.Messages, ChatMessage{
+				Role:       "tool",
+				Content:    b.runTool(call),
+				ToolCallID: call.ID,
+			})
+		}
+	}
+}
+
+// runTool выполняет вызов инструмента; ошибка возвращается модели текстом, чтобы она могла её учесть
+func (b *Bot) runTool(call ToolCall) string {
+	tool, ok := b.tools[call.Function.Name]
+	if !ok {
+		return fmt.Sprintf("ошибка: инструмент %q не существует", call.Function.Name)
+	}
+	args := json.RawMessage(call.Function.Arguments)
+	if len(args) == 0 {
+		args = json.RawMessage("{}")
+	}
+	result, err := tool.Handler(args)
+	slog.Info("вызов инструмента", "tool", call.Function.Name, "error", err)
+	if err != nil {
+		return "ошибка: " + err.Error()
+	}
+	return result
+}
+
+// currentTimeTool возвращает текущее время в указанной зоне (по умолчанию - зона сервера)
+func currentTimeTool(args json.RawMessage) (string, error) {
+	var params struct {
+		Timezone string `json:"timezone"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", fmt.Errorf("некорректные аргументы: %w", err)
+	}
+	loc := time.Local
+	if params.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(params.Timezone); err != nil {
+			return "", fmt.Errorf("неизвестная часовая зона %q", params.Timezone)
+		}
+	}
+	now := time.Now().In(loc)
+	return now.Format("2006-01-02 15:04:05 MST, Monday"), nil
+}
+
+// calculatorTool вычисляет арифметическое выражение
+func calculatorTool(args json.RawMessage) (string, error) {
+	var params struct {
+		Expression string `json:"expression"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", fmt.Errorf("некорректные аргументы: %w", err)
+	}
+	expr, err := parser.ParseExpr(params.Expression)
+	if err != nil {
+		return "", fmt.Errorf("не удалось разобрать выражение: %w", err)
+	}
+	value, err := evalExpr(expr)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64), nil
+}
+
+// evalExpr вычисляет дерево выражения Go, допуская только числа, арифметику и несколько функций
+func evalExpr(expr ast.Expr) (float64, error) {
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		if e.Kind != token.INT && e.Kind != token.FLOAT {
+			return 0, fmt.Errorf("ожидалось число, а не %s", e.Value)
+		}
+		return strconv.ParseFloat(e.Value, 64)
+	case *ast.ParenExpr:
+		return evalExpr(e.X)
+	case *ast.UnaryExpr:
+		x, err := evalExpr(e.X)
+		if err != nil {
+			return 0, err
+		}
+		switch e.Op {
+		case token.SUB:
+			return -x, nil
+		case token.ADD:
+			return x, nil
+		}
+	case *ast.BinaryExpr:
+		x, err := evalExpr(e.X)
+		if err != nil {
+			return 0, err
+		}
+		y, err := evalExpr(e.Y)
+		if err != nil {
+			return 0, err
+		}
+		switch e.Op {
+		case token.ADD:
+			return x + y, nil
+		case token.SUB:
+			return x - y, nil
+		case token.MUL:
+			return x * y, nil
+		case token.QUO:
+			if y == 0 {
+				return 0, fmt.Errorf("деление на ноль")
+			}
+			return x / y, nil
+		case token.REM:
+			if y == 0 {
+				return 0, fmt.Errorf("деление на ноль")
+			}
+			return math.Mod(x, y), nil
+		}
+	case *ast.CallExpr:
+		name, ok := e.Fun.(*ast.Ident)
+		if !ok {
+			break
+		}
+		var args []float64
+		for _, arg := range e.Args {
+			v, err := evalExpr(arg)
+			if err != nil {
+				return 0, err
+			}
+			args = append(args, v)
+		}
+		switch {
+		case name.Name == "sqrt" && len(args) == 1:
+			return math.Sqrt(args[0]), nil
+		case name.Name == "abs" && len(args) == 1:
+			return math.Abs(args[0]), nil
+		case name.Name == "pow" && len(args) == 2:
+			return math.Pow(args[0], args[1]), nil
+		}
+		return 0, fmt.Errorf("неизвестная функция %s/%d", name.Name, len(args))
+	}
+	return 0, fmt.Errorf("неподдерживаемое выражение")
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	topLimit       = 10  // Сколько пользователей в каждом рейтинге
+	topMaxDays     = 365 // Самое длинное окно /top
+	topNameRunes   = 16  // До скольких символов сокращается имя в таблице
+	topDefaultDays = 7   // Окно /top без аргумента
+)
+
+// topRow - строка рейтинга активности
+type topRow struct {
+	UserID   int64
+	Username string
+	Tier     string
+	Private  bool // Строгий режим приватности: пользователь в таблице не называется
+	Answers  int
+	Tokens   int64
+}
+
+// parseTopWindow разбирает окно рейтинга: "7d", "30d" или просто число дней
+func parseTopWindow(arg string) (int, bool) {
+	if arg == "" {
+		return topDefaultDays, true
+	}
+	days, err := strconv.Atoi(strings.TrimSuffix(strings.ToLower(arg), "d"))
+	if err != nil || days < 1 || days > topMaxDays {
+		return 0, false
+	}
+	return days, true
+}
+
+// loadTop возвращает самых активных пользователей за days дней по числу ответов или по токенам
+func (b *Bot) loadTop(days int, byTokens bool) ([]topRow, error) {
+	order := "answers DESC, tokens DESC"
+	if byTokens {
+		order = "tokens DESC, answers DESC"
+	}
+	rows, err := b.db.Query(`
+		SELECT s.user_id, COALESCE(u.username, ''), COALESCE(u.tier, 'free'), COALESCE(u.privacy, 'normal'), s.answers, s.tokens
+		FROM (SELECT user_id, COUNT(*) AS answers, SUM(prompt_tokens + completion_tokens) AS tokens
+			FROM usage WHERE created_at >= datetime('now', ?) GROUP BY user_id) s
+		LEFT JOIN users u ON u.user_id = s.user_id
+		ORDER BY `+order+` LIMIT ?`, fmt.Sprintf("-%d days", days), topLimit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения рейтинга: %w", err)
+	}
+	defer rows.Close()
+
+	var top []topRow
+	for rows.Next() {
+		var r topRow
+		var privacy string
+		if err := rows.Scan(&r.UserID, &r.Username, &r.Tier, &privacy, &r.Answers, &r.Tokens); err != nil {
+			return nil, fmt.Errorf("ошибка чтения рейтинга: %w", err)
+		}
+		r.Private = privacy == privacyStrict
+		top = append(top, r)
+	}
+	return top, rows.Err()
+}
+
+// topName - как показать пользователя в рейтинге
+func topName(r topRow) string {
+	switch {
+	case r.Private:
+		return "(скрыт)" // Строгая приватность: ни ID, ни имени
+	case r.Username != "":
+		return "@" + truncateRunes(r.Username, topNameRunes)
+	default:
+		return strconv.FormatInt(r.UserID, 10)
+	}
+}
+
+// formatTop собирает моноширинную таблицу одного рейтинга
+func formatTop(title string, top []topRow) string {
+	var sb strings.Builder
+	sb.WriteString(title + "\n")
+	if len(top) == 0 {
+		sb.WriteString("Запросов не было\n")
+		return sb.String()
+	}
+	w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "#\tПользователь\tТариф\tОтветов\tТокенов")
+	for i, r := range top {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%d\n", i+1, topName(r), r.Tier, r.Answers, r.Tokens)
+	}
+	w.Flush()
+	return sb.String()
+}
+
+// top обрабатывает команду /top [7d|30d]: самые активные пользователи за окно (только для администраторов)
+func (b *Bot) top(message *tgbotapi.Message) error {
+	days, ok := parseTopWindow(strings.TrimSpace(message.CommandArguments()))
+	if !ok {
+		return b.reply(message, fmt.Sprintf("Использование: /top [7d|30d] - окно от 1 до %d дней, по умолчанию %d", topMaxDays, topDefaultDays))
+	}
+
+	byAnswers, err := b.loadTop(days, false)
+	if err != nil {
+		return err
+	}
+	byTokens, err := b.loadTop(days, true)
+	if err != nil {
+		return err
+	}
+	return b.replyMonospace(message, formatTop(fmt.Sprintf("🏆 По ответам за %d дн.", days), byAnswers)+"\n"+
+		formatTop(fmt.Sprintf("🏆 По токенам за %d дн.", days), byTokens))
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	maxSubscriptions   = 5                   // Сколько тем может быть у одного пользователя
+	topicMaxRunes      = 60                  // Длиннее тема - это уже вопрос, а не тема
+	topicReuseWindow   = 3 * time.Hour       // Пост по теме, созданный за это время, рассылается без нового запроса к модели
+	topicRecentPosts   = 5                   // Со сколькими последними постами сравнивается новый
+	topicDupCosine     = 0.9                 // Порог похожести по эмбеддингам
+	topicDupJaccard    = 0.5                 // Порог похожести по словам, если эмбеддинги не настроены
+	topicPostRetention = 30 * 24 * time.Hour // Сколько хранить разосланные посты
+	topicPrompt        = "Ты пишешь короткие посты для рассылки по подписке. Напиши один пост на заданную тему: " +
+		"один полезный совет, приём или факт с примером, до 120 слов. Без вступлений, приветствий и хэштегов."
+)
+
+const subscribeUsage = "Использование: /subscribe <тема> daily|weekly ЧЧ:ММ\n" +
+	"Например: /subscribe советы_по_go daily 09:00\n\n" +
+	"Каждый день (daily) или раз в неделю (weekly) в это время пришлю свежий короткий пост на тему. " +
+	"Список и отписка: /subscriptions"
+
+// topicPeriods - периоды рассылки и шаг до следующего поста в днях
+var topicPeriods = map[string]int{"daily": 1, "weekly": 7}
+
+// subscription - подписка на посты по теме (таблица subscriptions)
+type subscription struct {
+	ID     int64
+	UserID int64
+	ChatID int64
+	Topic  string
+	Period string
+	Clock  string // "ЧЧ:ММ" в часовой зоне пользователя
+}
+
+// normalizeTopic приводит тему к виду для хранения и сравнения: "Советы_по_Go" - "советы по go"
+func normalizeTopic(topic string) string {
+	topic = strings.ReplaceAll(strings.ToLower(topic), "_", " ")
+	return strings.Join(strings.Fields(topic), " ")
+}
+
+// parseSubscribe разбирает аргументы /subscribe: тема, период и время в конце
+func parseSubscribe(args string) (topic, period, clock string, err error) {
+	fields := strings.Fields(args)
+	if len(fields) < 3 {
+		return "", "", "", fmt.Errorf("нужны тема, период и время")
+	}
+	at, err := time.Parse("15:04", fields[len(fields)-1])
+	if err != nil {
+		return "", "", "", fmt.Errorf("некорректное время %q, нужно ЧЧ:ММ", fields[len(fields)-1])
+	}
+	period = strings.ToLower(fields[len(fields)-2])
+	if _, ok := topicPeriods[period]; !ok {
+		return "", "", "", fmt.Errorf("период должен быть daily или weekly, получено %q", fields[len(fields)-2])
+	}
+	topic = normalizeTopic(strings.Join(fields[:len(fields)-2], " "))
+	if topic == "" || utf8.RuneCountInString(topic) > topicMaxRunes {
+		return "", "", "", fmt.Errorf("тема должна быть от 1 до %d символов", topicMaxRunes)
+	}
+	return topic, period, at.Format("15:04"), nil
+}
+
+// subscribe обрабатывает команду /subscribe <тема> daily|weekly ЧЧ:ММ
+func (b *Bot) subscribe(message *tgbotapi.Message) error {
+	topic, period, clock, err := parseSubscribe(message.CommandArguments())
+	if err != nil {
+		return b.reply(message, err.Error()+"\n\n"+subscribeUsage)
+	}
+	userID := senderID(message)
+	subs, err := b.userSubscriptions(userID)
+	if err != nil {
+		return err
+	}
+	if len(subs) >= maxSubscriptions {
+		return b.reply(message, fmt.Sprintf("Можно подписаться не больше чем на %d тем. Лишние отмени в /subscriptions", maxSubscriptions))
+	}
+
+	res, err := b.db.Exec("INSERT INTO subscriptions (bot_id, user_id, chat_id, topic, period, clock) VALUES (?, ?, ?, ?, ?, ?)",
+		b.botID, userID, message.Chat.ID, topic, period, clock)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения подписки: %w", err)
+	}
+	sub := &subscription{UserID: userID, ChatID: message.Chat.ID, Topic: topic, Period: period, Clock: clock}
+	if sub.ID, err = res.LastInsertId(); err != nil {
+		return fmt.Errorf("ошибка сохранения подписки: %w", err)
+	}
+	next, err := b.scheduleSubscription(sub, time.Time{}, 0)
+	if err != nil {
+		return err
+	}
+	every := "каждый день"
+	if period == "weekly" {
+		every = "раз в неделю"
+	}
+	return b.reply(message, fmt.Sprintf("📰 Готово: %s в %s пришлю пост на тему «%s». Первый - %s.\nСписок и отписка: /subscriptions",
+		every, clock, topic, formatJobTime(next, next.Location())))
+}
+
+// scheduleSubscription ставит следующий пост подписки взамен ещё не отправленных, кроме keepID.
+// after - время предыдущего поста (нулевое - первого ещё не было): следующий идёт через период
+// после него, а первый - в ближайшее время clock.
+func (b *Bot) scheduleSubscription(sub *subscription, after time.Time, keepID int64) (time.Time, error) {
+	at, err := time.Parse("15:04", sub.Clock)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("некорректное время подписки %q: %w", sub.Clock, err)
+	}
+	loc, err := b.userLocation(sub.UserID)
+	if err != nil {
+		log.Printf("Ошибка получения часовой зоны: %v", err)
+	}
+	payload := strconv.FormatInt(sub.ID, 10)
+	if _, err := b.db.Exec("DELETE FROM reminders WHERE kind = ? AND payload = ? AND delivered_at IS NULL AND id != ?",
+		jobTopic, payload, keepID); err != nil {
+		return time.Time{}, fmt.Errorf("ошибка отмены постов подписки: %w", err)
+	}
+	now := time.Now().In(loc)
+	next := nextDigestRun(now, at)
+	if !after.IsZero() {
+		// Шаг в календарных днях: так время на часах не сдвигается при переходе на летнее время
+		after = after.In(loc)
+		next = time.Date(after.Year(), after.Month(), after.Day(), at.Hour(), at.Minute(), 0, 0, loc)
+		for !next.After(now) {
+			next = next.AddDate(0, 0, topicPeriods[sub.Period])
+		}
+	}
+	if _, err := b.scheduleJob(sub.UserID, sub.ChatID, jobTopic, payload, next); err != nil {
+		return time.Time{}, err
+	}
+	return next, nil
+}
+
+// userSubscriptions возвращает подписки пользователя в порядке оформления
+func (b *Bot) userSubscriptions(userID int64) ([]subscription, error) {
+	rows, err := b.db.Query(`SELECT id, user_id, chat_id, topic, period, clock FROM subscriptions
+		WHERE bot_id = ? AND user_id = ? ORDER BY id`, b.botID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения подписок: %w", err)
+	}
+	defer rows.Close()
+	var subs []subscription
+	for rows.Next() {
+		var s subscription
+		if err := rows.Scan(&s.ID, &s.UserID, &s.ChatID, &s.Topic, &s.Period, &s.Clock); err != nil {
+			return nil, fmt.Errorf("ошибка чтения подписок: %w", err)
+		}
+		subs = append(subs, s)
+	}
+	return subs, rows.Err()
+}
+
+// getSubscription возвращает подписку по номеру; nil - её уже отменили
+func (b *Bot) getSubscription(id int64) (*subscription, error) {
+	var s subscription
+	err := b.db.QueryRow("SELECT id, user_id, chat_id, topic, period, clock FROM subscriptions WHERE id = ?", id).
+		Scan(&s.ID, &s.UserID, &s.ChatID, &s.Topic, &s.Period, &s.Clock)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ошибка получения подписки: %w", err)
+	}
+	return &s, nil
+}
+
+// subscriptionsView - список подписок с кнопками отписки
+func subscriptionsView(subs []subscription) (string, *tgbotapi.InlineKeyboardMarkup) {
+	if len(subs) == 0 {
+		return "Подписок нет.\n\n" + subscribeUsage, nil
+	}
+	var sb strings.Builder
+	sb.WriteString("📰 Подписки:\n\n")
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, s := range subs {
+		fmt.Fprintf(&sb, "• %s - %s в %s\n", s.Topic, s.Period, s.Clock)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("❌ "+truncateRunes(s.Topic, 30), fmt.Sprintf("sub_del:%d", s.ID))))
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return sb.String(), &keyboard
+}
+
+// subscriptions обрабатывает команду /subscriptions: список подписок с отменой кнопками
+func (b *Bot) subscriptions(message *tgbotapi.Message) error {
+	subs, err := b.userSubscriptions(senderID(message))
+	if err != nil {
+		return err
+	}
+	text, keyboard := subscriptionsView(subs)
+	msg := tgbotapi.NewMessage(message.Chat.ID, text)
+	msg.ReplyToMessageID = message.MessageID
+	if keyboard != nil {
+		msg.ReplyMarkup = keyboard
+	}
+	if _, err := b.api.Send(msg); err != nil {
+		return fmt.Errorf("ошибка отправки списка подписок: %w", err)
+	}
+	return nil
+}
+
+// handleSubscriptionDelete отменяет подписку и обновляет список
+func (b *Bot) handleSubscriptionDelete(query *tgbotapi.CallbackQuery, payload string) (string, error) {
+	id, err := strconv.ParseInt(payload, 10, 64)
+	if err != nil {
+		return "Некорректная кнопка", nil
+	}
+	res, err := b.db.Exec("DELETE FROM subscriptions WHERE id = ? AND user_id = ?", id, query.From.ID)
+	if err != nil {
+		return "", fmt.Errorf("ошибка удаления подписки: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return "Подписка уже отменена", nil
+	}
+	if _, err := b.db.Exec("DELETE FROM reminders WHERE kind = ? AND payload = ? AND delivered_at IS NULL", jobTopic, payload); err != nil {
+		return "", fmt.Errorf("ошибка отмены постов подписки: %w", err)
+	}
+
+	subs, err := b.userSubscriptions(query.From.ID)
+	if err != nil {
+		return "", err
+	}
+	text, keyboard := subscriptionsView(subs)
+	edit := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, text)
+	edit.ReplyMarkup = keyboard
+	if _, err := b.api.Send(edit); err != nil {
+		return "", fmt.Errorf("ошибка обновления списка подписок: %w", err)
+	}
+	return "Подписка отменена", nil
+}
+
+// runTopicJob присылает пост по подписке и сразу ставит следующий. Подписчики одной темы с тем же периодом
+// получают общий пост: кто первый в очереди, тот и генерирует, остальным он достаётся без запроса к модели.
+func (b *Bot) runTopicJob(job scheduledJob) error {
+	id, err := strconv.ParseInt(job.Payload, 10, 64)
+	if err != nil {
+		return nil // Испорченное задание просто снимается
+	}
+	sub, err := b.getSubscription(id)
+	if err != nil || sub == nil {
+		return err // Отписался - задание снимается
+	}
+	// Следующий пост ставится до запроса к модели: если сегодняшний не получится, подписка не прервётся
+	if _, err := b.scheduleSubscription(sub, job.DueAt, job.ID); err != nil {
+		return err
+	}
+
+	post, err := b.topicPost(sub, job)
+	if err != nil || post == "" {
+		return err
+	}
+	text := truncateRunes(fmt.Sprintf("📰 %s\n\n%s\n\nОтписаться: /subscriptions", sub.Topic, post), messageTextLimit)
+	_, err = b.sendFormatted(text, func(text, parseMode string) tgbotapi.Chattable {
+		msg := tgbotapi.NewMessage(sub.ChatID, text)
+		msg.ParseMode = parseMode
+		msg.DisableNotification = job.Silent
+		return msg
+	})
+	if err != nil {
+		return fmt.Errorf("ошибка отправки поста по подписке: %w", err)
+	}
+	return nil
+}
+
+// topicPost возвращает свежий пост по теме подписки: недавний общий или новый. Пустая строка без ошибки -
+// пост в этот раз не отправляется (исчерпан лимит или модель дважды повторила прежние посты).
+func (b *Bot) topicPost(sub *subscription, job scheduledJob) (string, error) {
+	var post string
+	err := b.db.QueryRow(`SELECT content FROM topic_posts WHERE bot_id = ? AND topic = ? AND period = ? AND created_at >= ?
+		ORDER BY id DESC LIMIT 1`, b.botID, sub.Topic, sub.Period, time.Now().Add(-topicReuseWindow).UTC().Format(sqliteTimeLayout)).Scan(&post)
+	if err == nil {
+		return post, nil
+	}
+
+	recent, err := b.recentTopicPosts(sub.Topic, sub.Period)
+	if err != nil {
+		return "", err
+	}
+	prompt := "Тема: " + sub.Topic
+	if len(recent) > 0 {
+		prompt += "\n\nПрошлые посты, их темы и примеры не повторяй:"
+		for _, r := range recent {
+			prompt += "\n- " + truncateRunes(strings.Join(strings.Fields(r), " "), 200)
+		}
+	}
+	if err := b.checkBudget(sub.UserID, int64(estimateTokens(topicPrompt+prompt)+completionReserve)); err != nil {
+		slog.Info("пост по подписке пропущен: исчерпан дневной лимит", "user_id", sub.UserID, "topic", sub.Topic)
+		return "", nil
+	}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		aiResponse, err := b.makeAIRequest(topicPrompt, prompt)
+		if err != nil {
+			return "", err
+		}
+		if err := b.recordTopicUsage(job, aiResponse); err != nil {
+			log.Printf("Ошибка записи статистики использования: %v", err)
+		}
+		if b.similarToAny(aiResponse.Content, recent) {
+			continue
+		}
+		if _, err := b.db.Exec("INSERT INTO topic_posts (bot_id, topic, period, content) VALUES (?, ?, ?, ?)",
+			b.botID, sub.Topic, sub.Period, aiResponse.Content); err != nil {
+			return "", fmt.Errorf("ошибка сохранения поста: %w", err)
+		}
+		return aiResponse.Content, nil
+	}
+	slog.Info("пост по подписке пропущен: модель повторяет прошлые посты", "topic", sub.Topic)
+	return "", nil
+}
+
+// recentTopicPosts возвращает последние посты по теме, новые первыми
+func (b *Bot) recentTopicPosts(topic, period string) ([]string, error) {
+	rows, err := b.db.Query("SELECT content FROM topic_posts WHERE bot_id = ? AND topic = ? AND period = ? ORDER BY id DESC LIMIT ?",
+		b.botID, topic, period, topicRecentPosts)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения прошлых постов: %w", err)
+	}
+	defer rows.Close()
+	var posts []string
+	for rows.Next() {
+		var post string
+		if err := rows.Scan(&post); err != nil {
+			return nil, fmt.Errorf("ошибка чтения прошлых постов: %w", err)
+		}
+		posts = append(posts, post)
+	}
+	return posts, rows.Err()
+}
+
+// similarToAny проверяет, не повторяет ли пост один из прошлых: по эмбеддингам, если они настроены,
+// иначе по доле общих слов
+func (b *Bot) similarToAny(post string, recent []string) bool {
+	if len(recent) == 0 {
+		return false
+	}
+	if b.embeddingsEnabled() {
+		vectors, err := b.embed(context.Background(), append([]string{post}, recent...))
+		if err == nil {
+			for _, v := range vectors[1:] {
+				if cosineSimilarity(vectors[0], v) >= topicDupCosine {
+					return true
+				}
+			}
+			return false
+		}
+		log.Printf("Ошибка сравнения поста по эмбеддингам, сравниваю по словам: %v", err)
+	}
+	for _, r := range recent {
+		if wordJaccard(post, r) >= topicDupJaccard {
+			return true
+		}
+	}
+	return false
+}
+
+// wordJaccard - доля общих слов двух текстов (мера Жаккара по множествам слов)
+func wordJaccard(a, b string) float64 {
+	words := func(text string) map[string]bool {
+		set := make(map[string]bool)
+		for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return !(r == '-' || r == '_' || 'a' <= r && r <= 'z' || 'а' <= r && r <= 'я' || r == 'ё' || '0' <= r && r <= '9')
+		}) {
+			set[w] = true
+		}
+		return set
+	}
+	wa, wb := words(a), words(b)
+	if len(wa) == 0 || len(wb) == 0 {
+		return 0
+	}
+	common := 0
+	for w := range wa {
+		if wb[w] {
+			common++
+		}
+	}
+	return float64(common) / float64(len(wa)+len(wb)-common)
+}
+
+// recordTopicUsage записывает расход на пост тому, чья подписка его сгенерировала
+func (b *Bot) recordTopicUsage(job scheduledJob, aiResponse *AIResponse) error {
+	_, err := b.db.Exec(`INSERT INTO usage (bot_id, user_id, chat_id, model, style, prompt_tokens, completion_tokens, queue_ms, ai_ms, total_ms)
+		VALUES (?, ?, ?, ?, '', ?, ?, 0, ?, 0)`,
+		b.botID, job.UserID, job.ChatID, aiResponse.Model, aiResponse.Usage.PromptTokens, aiResponse.Usage.CompletionTokens,
+		aiResponse.Duration.Milliseconds())
+	if err != nil {
+		return fmt.Errorf("ошибка записи статистики поста: %w", err)
+	}
+	return nil
+}
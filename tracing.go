@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer создаёт спаны пайплайна. Пока провайдер не настроен (OTEL_EXPORTER_OTLP_ENDPOINT пуст),
+// глобальный провайдер OpenTelemetry - no-op, и спаны ничего не стоят.
+var tracer = otel.Tracer("tg_bot")
+
+// setupTracing включает экспорт трейсов по OTLP/HTTP, если задан OTEL_EXPORTER_OTLP_ENDPOINT.
+// Возвращает функцию, которая досылает накопленные спаны при остановке.
+func setupTracing(ctx context.Context, config *Config) (func(context.Context) error, error) {
+	if config.OTLPEndpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(config.OTLPEndpoint))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания экспортёра трейсов: %w", err)
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName("tg_bot"),
+		semconv.ServiceVersion(version),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка описания ресурса трейсов: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.TraceSampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// traceSampleRatioFromEnv читает долю трейсов для записи (TRACE_SAMPLE_RATIO, 0..1, по умолчанию 1)
+func traceSampleRatioFromEnv() (float64, error) {
+	value := strings.TrimSpace(os.Getenv("TRACE_SAMPLE_RATIO"))
+	if value == "" {
+		return 1, nil
+	}
+	ratio, err := strconv.ParseFloat(value, 64)
+	if err != nil || ratio < 0 || ratio > 1 {
+		return 0, fmt.Errorf("TRACE_SAMPLE_RATIO должен быть числом от 0 до 1, получено %q", value)
+	}
+	return ratio, nil
+}
+
+// tracingMiddleware открывает корневой спан на каждое обновление; дочерние спаны
+// (сборка промпта, запрос к модели, отправка в Telegram) получают его через контекст
+func (b *Bot) tracingMiddleware(next UpdateHandler) UpdateHandler {
+	return func(ctx context.Context, update tgbotapi.Update) error {
+		info := updateInfoFrom(ctx)
+		ctx, span := tracer.Start(ctx, "update", trace.WithAttributes(
+			attribute.String("bot", b.name),
+			attribute.String("request_id", info.RequestID),
+			attribute.Int("update_id", info.UpdateID),
+			attribute.Int64("chat_id", info.ChatID),
+			attribute.Int64("user_id", info.UserID),
+			attribute.String("kind", info.Kind),
+		))
+		defer span.End()
+
+		err := next(ctx, update)
+		span.SetAttributes(attribute.String("handler", info.Handler))
+		recordSpanError(span, err)
+		return err
+	}
+}
+
+// recordSpanError отмечает спан ошибкой, если она есть
+func recordSpanError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
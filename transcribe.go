@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	sttMaxUpload          = 25 << 20 // Ограничение размера файла у Whisper-совместимых API
+	sttChunkSeconds       = 600      // Длина части при нарезке длинных записей
+	audioTokensPerSecond  = 4        // Оценка токенов расшифровки на секунду речи (для проверки бюджета заранее)
+	transcriptPromptRunes = 12000    // Сколько символов расшифровки уходит модели вместе с подписью
+)
+
+// errSTTDisabled - STT_URL не задан
+var errSTTDisabled = errors.New("распознавание речи не настроено")
+
+// audioFile - аудио из сообщения: голосовое, аудиофайл или документ с аудио
+type audioFile struct {
+	FileID   string
+	FileName string
+	Duration int // Секунды; у документов неизвестна (0)
+	FileSize int
+	Voice    bool // Голосовое или кружочек: это вопрос, на него нужно ответить
+	Video    bool // Кружочек: звук извлекается через ffmpeg
+}
+
+// audioFrom находит в сообщении аудио, которое можно расшифровать (включая звук кружочка)
+func audioFrom(message *tgbotapi.Message) (audioFile, bool) {
+	switch {
+	case message.VideoNote != nil:
+		return audioFile{FileID: message.VideoNote.FileID, FileName: "video_note.mp4", Duration: message.VideoNote.Duration,
+			FileSize: message.VideoNote.FileSize, Voice: true, Video: true}, true
+	case message.Voice != nil:
+		return audioFile{FileID: message.Voice.FileID, FileName: "voice.ogg", Duration: message.Voice.Duration,
+			FileSize: message.Voice.FileSize, Voice: true}, true
+	case message.Audio != nil:
+		return audioFile{FileID: message.Audio.FileID, FileName: audioFileName(message.Audio.FileName, message.Audio.MimeType),
+			Duration: message.Audio.Duration, FileSize: message.Audio.FileSize}, true
+	case message.Document != nil && strings.HasPrefix(message.Document.MimeType, "audio/"):
+		return audioFile{FileID: message.Document.FileID, FileName: audioFileName(message.Document.FileName, message.Document.MimeType),
+			FileSize: message.Document.FileSize}, true
+	}
+	return audioFile{}, false
+}
+
+// audioFileName возвращает имя файла с расширением: по нему STT-сервис определяет формат
+func audioFileName(name, mimeType string) string {
+	if filepath.Ext(name) != "" {
+		return name
+	}
+	ext := ".mp3"
+	switch mimeType {
+	case "audio/mp4", "audio/x-m4a", "audio/m4a":
+		ext = ".m4a"
+	case "audio/ogg":
+		ext = ".ogg"
+	case "audio/wav", "audio/x-wav":
+		ext = ".wav"
+	}
+	return "audio" + ext
+}
+
+// sttEnabled сообщает, настроено ли распознавание речи
+func (b *Bot) sttEnabled() bool {
+	return b.cfg().STTURL != ""
+}
+
+// transcribeMessage расшифровывает аудио из сообщения. Голосовое считается вопросом и получает ответ;
+// запись с подписью обрабатывается по подписи ("перескажи кратко"); без подписи расшифровка приходит файлом.
+func (b *Bot) transcribeMessage(ctx context.Context, message *tgbotapi.Message, audio audioFile) error {
+	if !b.sttEnabled() {
+		return b.reply(message, "Распознавание речи не настроено - пришли вопрос текстом.")
+	}
+	if audio.Video && b.cfg().FFmpegPath == "" {
+		return b.reply(message, "Кружочки я пока не слышу - пришли вопрос голосовым или текстом.")
+	}
+	if maxSeconds := int(b.cfg().AudioMaxDuration.Seconds()); audio.Duration > maxSeconds {
+		return b.reply(message, fmt.Sprintf("Запись длиннее %s - раздели её на части.", b.cfg().AudioMaxDuration))
+	}
+	if audio.FileSize > b.cfg().AudioMaxSize {
+		return b.reply(message, fmt.Sprintf("Файл больше %d МБ - раздели его на части.", b.cfg().AudioMaxSize>>20))
+	}
+	if audio.FileSize > sttMaxUpload && b.cfg().FFmpegPath == "" {
+		return b.reply(message, fmt.Sprintf("Файлы больше %d МБ я умею только нарезать на части, а для этого администратору "+
+			"нужно задать FFMPEG_PATH. Пришли запись покороче.", sttMaxUpload>>20))
+	}
+	estimate := int64(float64(audio.Duration*audioTokensPerSecond) * b.cfg().AudioCostMultiplier)
+	if err := b.checkBudget(senderID(message), estimate); err != nil {
+		return b.reply(message, err.Error())
+	}
+
+	progress := tgbotapi.NewMessage(message.Chat.ID, "🎧 Распознаю запись...")
+	progress.ReplyToMessageID = message.MessageID
+	sent, err := b.api.Send(progress)
+	if err != nil {
+		return fmt.Errorf("ошибка отправки сообщения: %w", err)
+	}
+
+	startedAt := time.Now()
+	transcript, err := b.transcribeAudio(ctx, audio, func(part, total int) {
+		edit := tgbotapi.NewEditMessageText(message.Chat.ID, sent.MessageID, fmt.Sprintf("🎧 Распознаю: часть %d/%d…", part, total))
+		b.api.Send(edit) // Прогресс необязателен, ошибку можно не проверять
+	})
+	if err != nil {
+		b.api.Send(tgbotapi.NewEditMessageText(message.Chat.ID, sent.MessageID, "😔 Не удалось распознать запись, попробуй позже."))
+		return err
+	}
+	if transcript == "" {
+		_, err := b.api.Send(tgbotapi.NewEditMessageText(message.Chat.ID, sent.MessageID, "В записи не слышно речи."))
+		return err
+	}
+	in := chatInputFrom(message, transcript)
+	in.RequestID = updateInfoFrom(ctx).RequestID
+	if err := b.recordTranscriptionUsage(in, transcript, time.Since(startedAt)); err != nil {
+		log.Printf("Ошибка записи статистики распознавания: %v", err)
+	}
+
+	caption := strings.TrimSpace(message.Caption)
+	switch {
+	case audio.Voice:
+		icon := "🎤 "
+		if audio.Video {
+			icon = "📹 "
+		}
+		b.api.Send(tgbotapi.NewEditMessageText(message.Chat.ID, sent.MessageID, icon+truncateRunes(transcript, messageTextLimit-10)))
+		return b.answerPrompt(ctx, in, message.MessageID)
+	case caption != "":
+		b.deleteMessage(message.Chat.ID, sent.MessageID)
+		in.Prompt = caption + "\n\nРасшифровка записи:\n" + truncateRunes(transcript, transcriptPromptRunes)
+		return b.answerPrompt(ctx, in, message.MessageID)
+	}
+
+	b.deleteMessage(message.Chat.ID, sent.MessageID)
+	doc := tgbotapi.NewDocument(message.Chat.ID, tgbotapi.FileBytes{
+		Name:  strings.TrimSuffix(audio.FileName, filepath.Ext(audio.FileName)) + ".txt",
+		Bytes: []byte(transcript),
+	})
+	doc.Caption = "📝 Расшифровка. Чтобы получить пересказ, пришли запись с подписью, например «перескажи кратко»."
+	doc.ReplyToMessageID = message.MessageID
+	if _, err := b.api.Send(doc); err != nil {
+		return fmt.Errorf("ошибка отправки расшифровки: %w", err)
+	}
+	return nil
+}
+
+// transcribeAudio скачивает аудио и расшифровывает его; длинные записи режутся на части через ffmpeg
+// и распознаются по очереди, progress вызывается перед каждой частью
+func (b *Bot) transcribeAudio(ctx context.Context, audio audioFile, progress func(part, total int)) (string, error) {
+	data, err := b.downloadFile(audio.FileID, b.cfg().AudioMaxSize)
+	if err != nil {
+		return "", err
+	}
+	// Короткую запись без ffmpeg отправляем целиком; из видео звук всегда извлекается через ffmpeg
+	if !audio.Video && (b.cfg().FFmpegPath == "" || (len(data) <= sttMaxUpload && audio.Duration > 0 && audio.Duration <= sttChunkSeconds)) {
+		return b.sttRequest(ctx, audio.FileName, data)
+	}
+
+	dir, err := os.MkdirTemp("", "tgbot-audio-")
+	if err != nil {
+		return "", fmt.Errorf("ошибка создания временного каталога: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	parts, err := b.splitAudio(ctx, dir, audio.FileName, data)
+	if err != nil {
+		return "", err
+	}
+
+	var texts []string
+	for i, part := range parts {
+		if len(parts) > 1 {
+			progress(i+1, len(parts))
+		}
+		chunk, err := os.ReadFile(part)
+		if err != nil {
+			return "", fmt.Errorf("ошибка чтения части записи: %w", err)
+		}
+		text, err := b.sttRequest(ctx, filepath.Base(part), chunk)
+		if err != nil {
+			return "", fmt.Errorf("часть %d/%d: %w", i+1, len(parts), err)
+		}
+		if text != "" {
+			texts = append(texts, text)
+		}
+	}
+	return strings.Join(texts, "\n\n"), nil
+}
+
+// splitAudio извлекает звук (видео отбрасывается), нарезает его на части по sttChunkSeconds
+// в моно mp3 и возвращает пути к ним по порядку
+func (b *Bot) splitAudio(ctx context.Context, dir, name string, data []byte) ([]string, error) {
+	input := filepath.Join(dir, "input"+filepath.Ext(name))
+	if err := os.WriteFile(input, data, 0o600); err != nil {
+		return nil, fmt.Errorf("ошибка записи временного файла: %w", err)
+	}
+	cmd := exec.CommandContext(ctx, b.cfg().FFmpegPath, "-hide_banner", "-loglevel", "error", "-i", input,
+		"-vn", "-ac", "1", "-ar", "16000", "-c:a", "libmp3lame", "-b:a", "48k",
+		"-f", "segment", "-segment_time", fmt.Sprint(sttChunkSeconds), filepath.Join(dir, "part%03d.mp3"))
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("ошибка ffmpeg: %w: %s", err, truncateRunes(strings.TrimSpace(string(output)), 300))
+	}
+	parts, err := filepath.Glob(filepath.Join(dir, "part*.mp3"))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка поиска частей записи: %w", err)
+	}
+	sort.Strings(parts)
+	return parts, nil
+}
+
+// sttRequest отправляет один файл в OpenAI-совместимый эндпоинт /audio/transcriptions
+func (b *Bot) sttRequest(ctx context.Context, name string, data []byte) (string, error) {
+	if !b.sttEnabled() {
+		return "", errSTTDisabled
+	}
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("model", b.cfg().STTModel)
+	form.WriteField("response_format", "json")
+	part, err := form.CreateFormFile("file", name)
+	if err != nil {
+		return "", fmt.Errorf("ошибка подготовки запроса распознавания: %w", err)
+	}
+	part.Write(data)
+	if err := form.Close(); err != nil {
+		return "", fmt.Errorf("ошибка подготовки запроса распознавания: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.cfg().STTURL, &body)
+	if err != nil {
+		return "", fmt.Errorf("ошибка создания запроса распознавания: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+b.cfg().HuggingFaceAPIToken)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	resp, err := b.aiClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("ошибка запроса распознавания: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		text, _ := io.ReadAll(io.LimitReader(resp.Body, 500))
+		return "", fmt.Errorf("сервис распознавания вернул %d: %s", resp.StatusCode, text)
+	}
+
+	var result struct {
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("ошибка разбора ответа распознавания: %w", err)
+	}
+	return strings.TrimSpace(result.Text), nil
+}
+
+// recordTranscriptionUsage засчитывает расшифровку в дневной бюджет: токены текста с множителем AUDIO_COST_MULTIPLIER
+func (b *Bot) recordTranscriptionUsage(in chatInput, transcript string, took time.Duration) error {
+	tokens := int64(float64(estimateTokens(transcript)) * b.cfg().AudioCostMultiplier)
+	_, err := b.db.Exec(`INSERT INTO usage (bot_id, user_id, chat_id, model, style, prompt_tokens, completion_tokens, queue_ms, ai_ms, total_ms)
+		VALUES (?, ?, ?, ?, '', 0, ?, 0, ?, 0)`,
+		b.botID, in.UserID, in.ChatID, b.cfg().STTModel, tokens, took.Milliseconds())
+	if err != nil {
+		return fmt.Errorf("ошибка записи статистики распознавания: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const maxUndoSteps = 10 // Сколько обменов можно убрать одной командой /undo
+
+// undoExchanges убирает из активного разговора последние n пар вопрос-ответ
+// и возвращает убранные вопросы от новых к старым
+func (b *Bot) undoExchanges(userID int64, privacy string, n int) ([]string, error) {
+	if privacy == privacyStrict {
+		return b.session.dropLast(userID, n), nil
+	}
+
+	conversationID, err := b.activeConversation(userID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := b.db.Query(`SELECT id, content FROM history
+		WHERE user_id = ? AND conversation_id = ? AND role = 'user' ORDER BY id DESC LIMIT ?`, userID, conversationID, n)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения истории: %w", err)
+	}
+	var removed []string
+	var fromID int64
+	for rows.Next() {
+		var question string
+		if err := rows.Scan(&fromID, &question); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("ошибка чтения истории: %w", err)
+		}
+		removed = append(removed, question)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка чтения истории: %w", err)
+	}
+	if len(removed) == 0 {
+		return nil, nil
+	}
+
+	// Вопрос удаляется вместе со всем, что идёт после него: ответом и более поздними обменами
+	_, err = b.db.Exec("DELETE FROM history WHERE user_id = ? AND conversation_id = ? AND id >= ?", userID, conversationID, fromID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка удаления из истории: %w", err)
+	}
+	return removed, nil
+}
+
+// undoExchangeAt убирает из активного разговора один обмен - k-й с конца; false - такого обмена нет
+func (b *Bot) undoExchangeAt(userID int64, privacy string, k int) (bool, error) {
+	if privacy == privacyStrict {
+		return b.session.dropAt(userID, k), nil
+	}
+
+	conversationID, err := b.activeConversation(userID)
+	if err != nil {
+		return false, err
+	}
+	// Границы обмена: его вопрос и следующий за ним вопрос (если есть)
+	var fromID int64
+	err = b.db.QueryRow(`SELECT id FROM history WHERE user_id = ? AND conversation_id = ? AND role = 'user'
+		ORDER BY id DESC LIMIT 1 OFFSET ?`, userID, conversationID, k-1).Scan(&fromID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("ошибка получения истории: %w", err)
+	}
+	_, err = b.db.Exec(`DELETE FROM history WHERE user_id = ? AND conversation_id = ? AND id >= ? AND id < COALESCE(
+			(SELECT MIN(id) FROM history WHERE user_id = ? AND conversation_id = ? AND role = 'user' AND id > ?), 9223372036854775807)`,
+		userID, conversationID, fromID, userID, conversationID, fromID)
+	if err != nil {
+		return false, fmt.Errorf("ошибка удаления из истории: %w", err)
+	}
+	return true, nil
+}
+
+// undo обрабатывает команду /undo [N]: убирает из контекста последние N обменов (по умолчанию один)
+func (b *Bot) undo(message *tgbotapi.Message) error {
+	steps := 1
+	if arg := strings.TrimSpace(message.CommandArguments()); arg != "" {
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 1 || n > maxUndoSteps {
+			return b.reply(message, fmt.Sprintf("Использование: /undo или /undo N, где N от 1 до %d - сколько последних вопросов с ответами забыть.", maxUndoSteps))
+		}
+		steps = n
+	}
+
+	userID := senderID(message)
+	privacy, err := b.getUserPrivacy(userID)
+	if err != nil {
+		return err
+	}
+	removed, err := b.undoExchanges(userID, privacy, steps)
+	if err != nil {
+		b.reply(message, "Не удалось изменить историю, попробуй позже.")
+		return err
+	}
+	return b.reply(message, formatUndo(removed))
+}
+
+// formatUndo перечисляет убранные вопросы их первыми словами
+func formatUndo(removed []string) string {
+	if len(removed) == 0 {
+		return "Убирать нечего: в текущем разговоре пока нет сообщений."
+	}
+	var sb strings.Builder
+	sb.WriteString("↩️ Забыл из текущего разговора:")
+	for _, question := range removed {
+		fmt.Fprintf(&sb, "\n• «%s»", firstWords(question, 8))
+	}
+	return sb.String()
+}
+
+// firstWords возвращает первые n слов текста, с многоточием, если слов больше
+func firstWords(text string, n int) string {
+	words := strings.Fields(text)
+	if len(words) <= n {
+		return strings.Join(words, " ")
+	}
+	return strings.Join(words[:n], " ") + "…"
+}
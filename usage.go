@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// maxLatencySample - сколько последних запросов за окно берётся для расчёта перцентилей
+const maxLatencySample = 5000
+
+// latencyWindows - окна, за которые /latency stats считает перцентили
+var latencyWindows = []struct {
+	title    string
+	modifier string // Модификатор для datetime('now', ...)
+}{
+	{"24ч", "-1 day"},
+	{"7д", "-7 days"},
+}
+
+// recordUsage сохраняет токены и тайминги одного ответа модели.
+// Время в очереди и полное время обработки известны только для сообщений из Telegram.
+func (b *Bot) recordUsage(in chatInput, turn *chatTurn, aiResponse *AIResponse) error {
+	var totalMs int64
+	if !in.QueuedAt.IsZero() {
+		totalMs = time.Since(in.QueuedAt).Milliseconds()
+	}
+	_, err := b.db.Exec(`INSERT INTO usage (bot_id, user_id, chat_id, model, style, prompt_tokens, completion_tokens, queue_ms, ai_ms, total_ms)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		b.botID, in.UserID, in.ChatID, aiResponse.Model, turn.Style, aiResponse.Usage.PromptTokens, aiResponse.Usage.CompletionTokens,
+		in.QueueWait.Milliseconds(), aiResponse.Duration.Milliseconds(), totalMs)
+	if err != nil {
+		return fmt.Errorf("ошибка записи статистики использования: %w", err)
+	}
+	return nil
+}
+
+// latencySample - задержки запросов одной модели в миллисекундах
+type latencySample struct {
+	Model string
+	Queue []int64
+	AI    []int64
+	Total []int64
+}
+
+// loadLatencySamples читает последние запросы за окно и раскладывает их по моделям
+func (b *Bot) loadLatencySamples(modifier string) ([]*latencySample, error) {
+	rows, err := b.db.Query(`SELECT model, queue_ms, ai_ms, total_ms FROM usage
+		WHERE created_at >= datetime('now', ?) ORDER BY id DESC LIMIT ?`, modifier, maxLatencySample)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения задержек: %w", err)
+	}
+	defer rows.Close()
+
+	byModel := make(map[string]*latencySample)
+	var samples []*latencySample
+	for rows.Next() {
+		var model string
+		var queueMs, aiMs, totalMs int64
+		if err := rows.Scan(&model, &queueMs, &aiMs, &totalMs); err != nil {
+			return nil, fmt.Errorf("ошибка чтения задержек: %w", err)
+		}
+		sample, ok := byModel[model]
+		if !ok {
+			sample = &latencySample{Model: model}
+			byModel[model] = sample
+			samples = append(samples, sample)
+		}
+		sample.Queue = append(sample.Queue, queueMs)
+		sample.AI = append(sample.AI, aiMs)
+		// Ответы из фоновой очереди не имеют полного времени обработки
+		if totalMs > 0 {
+			sample.Total = append(sample.Total, totalMs)
+		}
+	}
+	sort.Slice(samples, func(i, j int) bool { return len(samples[i].AI) > len(samples[j].AI) })
+	return samples, rows.Err()
+}
+
+// percentiles возвращает p50, p95 и p99 по методу ближайшего ранга (values сортируется на месте)
+func percentiles(values []int64) (p50, p95, p99 int64) {
+	if len(values) == 0 {
+		return 0, 0, 0
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	rank := func(p int) int64 {
+		i := (len(values)*p+99)/100 - 1
+		if i < 0 {
+			i = 0
+		}
+		return values[i]
+	}
+	return rank(50), rank(95), rank(99)
+}
+
+// formatPercentiles выводит перцентили в секундах: "1.2/3.4/5.6"
+func formatPercentiles(values []int64) string {
+	if len(values) == 0 {
+		return "-"
+	}
+	p50, p95, p99 := percentiles(values)
+	return fmt.Sprintf("%.1f/%.1f/%.1f", float64(p50)/1000, float64(p95)/1000, float64(p99)/1000)
+}
+
+// formatLatencyStats собирает моноширинную таблицу перцентилей по моделям для одного окна
+func formatLatencyStats(title string, samples []*latencySample) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "За %s, p50/p95/p99 в секундах\n", title)
+	if len(samples) == 0 {
+		sb.WriteString("Запросов не было\n")
+		return sb.String()
+	}
+	w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Модель\tN\tОчередь\tИИ\tВсего")
+	for _, sample := range samples {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", shortModelName(sample.Model), len(sample.AI),
+			formatPercentiles(sample.Queue), formatPercentiles(sample.AI), formatPercentiles(sample.Total))
+	}
+	w.Flush()
+	return sb.String()
+}
+
+// latencyStats обрабатывает команду /latency stats (только для администраторов)
+func (b *Bot) latencyStats(message *tgbotapi.Message) error {
+	var parts []string
+	for _, window := range latencyWindows {
+		samples, err := b.loadLatencySamples(window.modifier)
+		if err != nil {
+			b.reply(message, "❌ "+err.Error())
+			return err
+		}
+		parts = append(parts, formatLatencyStats(window.title, samples))
+	}
+	return b.replyMonospace(message, strings.Join(parts, "\n"))
+}
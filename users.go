@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	usersPageSize = 10
+
+	activityWriteInterval = time.Minute      // Активность пользователя пишется в базу не чаще раза в минуту
+	activityForgetAfter   = 10 * time.Minute // Через сколько простоя запись о пользователе убирается из памяти
+)
+
+// userFilters - фильтры /users и условия для них
+var userFilters = map[string]string{
+	"all":     "1 = 1",
+	"banned":  "user_id IN (SELECT user_id FROM bans)",
+	"premium": "COALESCE(tier, 'free') != 'free'",
+	"new":     "created_at >= datetime('now', '-7 days')",
+	"dormant": "COALESCE(last_active, created_at, '') < datetime('now', '-30 days')",
+}
+
+// trackUserMiddleware обновляет имя и время последней активности пользователя на каждое сообщение
+func (b *Bot) trackUserMiddleware(next UpdateHandler) UpdateHandler {
+	return func(ctx context.Context, update tgbotapi.Update) error {
+		if message := update.Message; message != nil && message.From != nil && message.SenderChat == nil {
+			if err := b.touchUser(message.From); err != nil {
+				slog.Warn("не удалось обновить активность пользователя", "user_id", message.From.ID, "error", err)
+			}
+		}
+		return next(ctx, update)
+	}
+}
+
+// userActivity - активность пользователя, накопленная с последней записи в базу
+type userActivity struct {
+	username  string
+	firstName string
+	pending   int       // Сообщения, ещё не учтённые в messages_today
+	written   time.Time // Когда активность последний раз записана в базу
+}
+
+// activityTracker копит активность пользователей в памяти, чтобы не писать в базу на каждое сообщение
+type activityTracker struct {
+	mu    sync.Mutex
+	users map[int64]*userActivity
+}
+
+func newActivityTracker() *activityTracker {
+	return &activityTracker{users: make(map[int64]*userActivity)}
+}
+
+// touchUser учитывает сообщение пользователя. Первое сообщение пишется сразу (чтобы появилась строка
+// в users), остальные - не чаще раза в activityWriteInterval; накопленное дописывает activityLoop.
+func (b *Bot) touchUser(user *tgbotapi.User) error {
+	now := time.Now()
+
+	b.activity.mu.Lock()
+	a, ok := b.activity.users[user.ID]
+	if !ok {
+		a = &userActivity{}
+		b.activity.users[user.ID] = a
+	}
+	a.username, a.firstName = user.UserName, user.FirstName
+	a.pending++
+	if now.Sub(a.written) < activityWriteInterval {
+		b.activity.mu.Unlock()
+		return nil
+	}
+	messages := a.pending
+	a.pending, a.written = 0, now
+	b.activity.mu.Unlock()
+
+	return b.writeActivity(user.ID, user.UserName, user.FirstName, messages)
+}
+
+// forgetActivity выбрасывает накопленную активность пользователя, не записывая её: после /forgetme
+// activityLoop иначе вернул бы в users его имя и username
+func (b *Bot) forgetActivity(userID int64) {
+	b.activity.mu.Lock()
+	defer b.activity.mu.Unlock()
+	delete(b.activity.users, userID)
+}
+
+// writeActivity сохраняет username и имя, отмечает активность и добавляет messages сообщений за сегодня
+func (b *Bot) writeActivity(userID int64, username, firstName string, messages int) error {
+	_, err := b.db.Exec("INSERT OR IGNORE INTO users (user_id) VALUES (?)", userID)
+	if err != nil {
+		return fmt.Errorf("ошибка при вставке пользователя: %w", err)
+	}
+	// В UPDATE все выражения видят старые значения, поэтому сравнение идёт с прошлой активностью
+	_, err = b.db.Exec(`
+		UPDATE users SET
+			username = ?,
+			first_name = ?,
+			messages_today = CASE WHEN date(last_active) = date('now') THEN COALESCE(messages_today, 0) + ? ELSE ? END,
+			last_active = CURRENT_TIMESTAMP
+		WHERE user_id = ?`, username, firstName, messages, messages, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка при обновлении активности пользователя: %w", err)
+	}
+	return nil
+}
+
+// activityLoop раз в activityWriteInterval дописывает накопленную активность
+func (b *Bot) activityLoop() {
+	ticker := time.NewTicker(activityWriteInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		b.flushActivity(false)
+	}
+}
+
+// flushActivity записывает накопленную активность: всю (при остановке) или только ту,
+// что ждёт дольше activityWriteInterval. Давно молчащие пользователи забываются.
+func (b *Bot) flushActivity(all bool) {
+	type pendingWrite struct {
+		userID              int64
+		username, firstName string
+		messages            int
+	}
+	now := time.Now()
+
+	var writes []pendingWrite
+	b.activity.mu.Lock()
+	for userID, a := range b.activity.users {
+		if a.pending > 0 && (all || now.Sub(a.written) >= activityWriteInterval) {
+			writes = append(writes, pendingWrite{userID, a.username, a.firstName, a.pending})
+			a.pending, a.written = 0, now
+		} else if a.pending == 0 && now.Sub(a.written) >= activityForgetAfter {
+			delete(b.activity.users, userID)
+		}
+	}
+	b.activity.mu.Unlock()
+
+	for _, w := range writes {
+		if err := b.writeActivity(w.userID, w.username, w.firstName, w.messages); err != nil {
+			slog.Warn("не удалось записать активность пользователя", "user_id", w.userID, "error", err)
+		}
+	}
+}
+
+// UserRow - строка списка /users
+type UserRow struct {
+	ID            int64
+	Username      string
+	Style         string
+	Tier          string
+	LastActive    string
+	MessagesToday int
+}
+
+// listUsers возвращает страницу пользователей по фильтру, самые активные недавно - сверху.
+// hasMore сообщает, есть ли следующая страница: для этого запрашивается на одну запись больше.
+func (b *Bot) listUsers(filter string, page int) (users []UserRow, hasMore bool, err error) {
+	where, ok := userFilters[filter]
+	if !ok {
+		return nil, false, fmt.Errorf("неизвестный фильтр %q", filter)
+	}
+	rows, err := b.db.Query(`
+		SELECT user_id, COALESCE(username, ''), COALESCE(style, 'friendly'), COALESCE(tier, 'free'),
+			COALESCE(last_active, ''),
+			CASE WHEN date(last_active) = date('now') THEN COALESCE(messages_today, 0) ELSE 0 END
+		FROM users WHERE `+where+`
+		ORDER BY last_active DESC, user_id LIMIT ? OFFSET ?`, usersPageSize+1, page*usersPageSize)
+	if err != nil {
+		return nil, false, fmt.Errorf("ошибка получения пользователей: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var u UserRow
+		if err := rows.Scan(&u.ID, &u.Username, &u.Style, &u.Tier, &u.LastActive, &u.MessagesToday); err != nil {
+			return nil, false, fmt.Errorf("ошибка чтения пользователей: %w", err)
+		}
+		users = append(users, u)
+	}
+	if len(users) > usersPageSize {
+		users, hasMore = users[:usersPageSize], true
+	}
+	return users, hasMore, rows.Err()
+}
+
+// renderUsers собирает страницу списка с кнопками навигации
+func renderUsers(filter string, page int, users []UserRow, hasMore bool) (string, *tgbotapi.InlineKeyboardMarkup) {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "👥 Пользователи (%s), страница %d\n", filter, page+1)
+	if len(users) == 0 {
+		sb.WriteString("\nНикого нет.")
+	}
+	for _, u := range users {
+		name := strconv.FormatInt(u.ID, 10)
+		if u.Username != "" {
+			name += " @" + u.Username
+		}
+		lastActive := u.LastActive
+		if lastActive == "" {
+			lastActive = "—"
+		}
+		fmt.Fprintf(&sb, "\n%s\n  %s · %s · был %s · сегодня %d", name, u.Style, u.Tier, lastActive, u.MessagesToday)
+	}
+
+	var buttons []tgbotapi.InlineKeyboardButton
+	if page > 0 {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData("◀️", fmt.Sprintf("users:%s:%d", filter, page-1)))
+	}
+	if hasMore {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData("▶️", fmt.Sprintf("users:%s:%d", filter, page+1)))
+	}
+	if len(buttons) == 0 {
+		return sb.String(), nil
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(buttons)
+	return sb.String(), &keyboard
+}
+
+// users обрабатывает команду /users [banned|premium|new|dormant] [страница]
+func (b *Bot) users(message *tgbotapi.Message) error {
+	filter, page := "all", 0
+	for _, arg := range strings.Fields(message.CommandArguments()) {
+		if n, err := strconv.Atoi(arg); err == nil && n > 0 {
+			page = n - 1
+		} else if _, ok := userFilters[arg]; ok {
+			filter = arg
+		} else {
+			return b.reply(message, "Использование: /users [banned|premium|new|dormant] [страница]\n"+
+				"new - появились за последние 7 дней, dormant - молчат больше 30 дней")
+		}
+	}
+
+	users, hasMore, err := b.listUsers(filter, page)
+	if err != nil {
+		return err
+	}
+	text, keyboard := renderUsers(filter, page, users, hasMore)
+	msg := tgbotapi.NewMessage(message.Chat.ID, text)
+	msg.ReplyToMessageID = message.MessageID
+	if keyboard != nil {
+		msg.ReplyMarkup = *keyboard
+	}
+	if _, err := b.api.Send(msg); err != nil {
+		return fmt.Errorf("ошибка отправки списка пользователей: %w", err)
+	}
+	return nil
+}
+
+// handleUsersCallback листает список /users; payload имеет вид "фильтр:страница"
+func (b *Bot) handleUsersCallback(query *tgbotapi.CallbackQuery, payload string) (string, error) {
+	filter, pageText, _ := strings.Cut(payload, ":")
+	page, err := strconv.Atoi(pageText)
+	if err != nil || page < 0 {
+		return "Некорректная кнопка", nil
+	}
+
+	users, hasMore, err := b.listUsers(filter, page)
+	if err != nil {
+		return "Не удалось загрузить список", err
+	}
+	text, keyboard := renderUsers(filter, page, users, hasMore)
+	edit := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, text)
+	edit.ReplyMarkup = keyboard
+	if _, err := b.api.Send(edit); err != nil {
+		return "", fmt.Errorf("ошибка обновления списка пользователей: %w", err)
+	}
+	return "", nil
+}
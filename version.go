@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Заполняются при сборке: go build -ldflags "-X main.version=... -X main.commit=... -X main.buildDate=..."
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildDate = "unknown"
+)
+
+const repoURL = "https://github.com/thebrnsnger/tg_bot"
+
+// versionInfo обрабатывает команду /version
+func (b *Bot) versionInfo(message *tgbotapi.Message) error {
+	return b.reply(message, fmt.Sprintf("Версия: %s\nКоммит: %s\nСобрано: %s\nGo: %s\nАптайм: %s",
+		version, commit, buildDate, runtime.Version(), formatUptime(time.Since(b.startedAt))))
+}
+
+// about обрабатывает команду /about
+func (b *Bot) about(message *tgbotapi.Message) error {
+	return b.reply(message, fmt.Sprintf("🤖 AI-ассистент в Telegram: отвечает на вопросы в выбранном стиле, "+
+		"помнит контекст разговора и факты о тебе, пересказывает посты каналов.\n\n"+
+		"Модель: %s\nВерсия: %s (%s)\nИсходный код: %s", MODEL, version, commit, repoURL))
+}
+
+// formatUptime показывает длительность в днях, часах и минутах
+func formatUptime(d time.Duration) string {
+	d = d.Round(time.Minute)
+	days := int(d.Hours()) / 24
+	hours := int(d.Hours()) % 24
+	minutes := int(d.Minutes()) % 60
+	if days > 0 {
+		return fmt.Sprintf("%dд %dч %dм", days, hours, minutes)
+	}
+	return fmt.Sprintf("%dч %dм", hours, minutes)
+}
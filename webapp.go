@@ -0,0 +1,317 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+//go:embed webapp.html
+var webAppHTML []byte
+
+const (
+	webAppInitDataHeader = "X-Telegram-Init-Data"
+	webAppAuthMaxAge     = 24 * time.Hour // Старше initData не принимается: панель открыта слишком давно
+	webAppMaxBody        = 4 << 10
+)
+
+// errWebAppAuth - initData не прошла проверку подписи или устарела
+var errWebAppAuth = errors.New("некорректные данные авторизации Mini App")
+
+// webAppPath - путь панели настроек бота; API настроек лежит под ним
+func (b *Bot) webAppPath() string {
+	return "/webapp/" + b.name + "/"
+}
+
+// setMenuButton делает кнопку меню бота кнопкой панели настроек.
+// setChatMenuButton в tgbotapi v5.5.1 не поддерживается, поэтому запрос собирается вручную.
+func (b *Bot) setMenuButton() error {
+	button := map[string]any{
+		"type":    "web_app",
+		"text":    "Настройки",
+		"web_app": map[string]string{"url": strings.TrimRight(b.cfg().WebhookURL, "/") + b.webAppPath()},
+	}
+	params := tgbotapi.Params{}
+	if err := params.AddInterface("menu_button", button); err != nil {
+		return fmt.Errorf("ошибка маршалинга кнопки меню: %w", err)
+	}
+	if _, err := b.api.MakeRequest("setChatMenuButton", params); err != nil {
+		return fmt.Errorf("ошибка установки кнопки меню: %w", err)
+	}
+	return nil
+}
+
+// validateInitData проверяет подпись initData из Telegram WebApp и возвращает id пользователя.
+// Ключ подписи - HMAC-SHA256 токена бота с ключом "WebAppData", подписывается строка из
+// отсортированных пар key=value без hash, разделённых переводом строки.
+func validateInitData(initData, token string, now time.Time) (int64, error) {
+	values, err := url.ParseQuery(initData)
+	if err != nil {
+		return 0, errWebAppAuth
+	}
+	hash := values.Get("hash")
+	values.Del("hash")
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = key + "=" + values.Get(key)
+	}
+
+	secret := hmac.New(sha256.New, []byte("WebAppData"))
+	secret.Write([]byte(token))
+	mac := hmac.New(sha256.New, secret.Sum(nil))
+	mac.Write([]byte(strings.Join(pairs, "\n")))
+	expected, err := hex.DecodeString(hash)
+	if err != nil || !hmac.Equal(mac.Sum(nil), expected) {
+		return 0, errWebAppAuth
+	}
+
+	authDate, err := strconv.ParseInt(values.Get("auth_date"), 10, 64)
+	if err != nil || now.Sub(time.Unix(authDate, 0)) > webAppAuthMaxAge {
+		return 0, errWebAppAuth
+	}
+	var user struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(values.Get("user")), &user); err != nil || user.ID == 0 {
+		return 0, errWebAppAuth
+	}
+	return user.ID, nil
+}
+
+// webAppSettings - настройки для панели: текущие значения и допустимые варианты
+type webAppSettings struct {
+	Style        string `json:"style"`
+	ReplyLang    string `json:"reply_lang"`
+	ContextTurns int    `json:"context_turns"`
+	UseName      bool   `json:"use_name"`
+	ShowLatency  bool   `json:"show_latency"`
+	PagedAnswers bool   `json:"paged_answers"`
+	CombineInput bool   `json:"combine_input"`
+	Plain        bool   `json:"plain"`
+	UseCity      bool   `json:"use_city"`
+	Privacy      string `json:"privacy"`
+	Ephemeral    string `json:"ephemeral"` // Срок вида 10m0s, пусто - ответы не удаляются
+	QuietHours   string `json:"quiet_hours"`
+	QuietSilent  bool   `json:"quiet_silent"`
+
+	// Только для показа: меняются командами в чате
+	Timezone   string `json:"timezone"`
+	City       string `json:"city"`
+	DigestTime string `json:"digest_time"`
+	Tier       string `json:"tier"`
+
+	Styles          map[string]string `json:"styles"`
+	Languages       map[string]string `json:"languages"`
+	MaxContextTurns int               `json:"max_context_turns"`
+}
+
+// webAppSettingsFor собирает настройки пользователя для панели
+func (b *Bot) webAppSettingsFor(userID int64) (*webAppSettings, error) {
+	s, err := b.getUserSettings(userID)
+	if err != nil {
+		return nil, err
+	}
+	ephemeral := ""
+	if s.Ephemeral > 0 {
+		ephemeral = (time.Duration(s.Ephemeral) * time.Second).String()
+	}
+	styles := make(map[string]string, len(stylePrompts))
+	for style := range stylePrompts {
+		styles[style] = styleTitle(style)
+	}
+	return &webAppSettings{
+		Style: s.Style, ReplyLang: s.ReplyLang, ContextTurns: s.ContextTurns, UseName: s.UseName,
+		ShowLatency: s.ShowLatency, PagedAnswers: s.PagedAnswers, CombineInput: s.CombineInput, Plain: s.Plain,
+		UseCity: s.UseCity, Privacy: s.Privacy, Ephemeral: ephemeral, QuietHours: s.QuietHours, QuietSilent: s.QuietSilent,
+		Timezone: s.Timezone, City: s.City, DigestTime: s.DigestTime, Tier: s.Tier,
+		Styles: styles, Languages: languageNames, MaxContextTurns: maxContextTurns,
+	}, nil
+}
+
+// webAppInputError - значение из панели не прошло проверку; текст показывается пользователю
+type webAppInputError struct{ msg string }
+
+func (e webAppInputError) Error() string { return e.msg }
+
+// applyWebAppSetting меняет одну настройку из панели теми же функциями, что и команды
+func (b *Bot) applyWebAppSetting(userID int64, field string, raw json.RawMessage) error {
+	var text string
+	var flag bool
+	var number int
+	decode := func(v any) error {
+		if err := json.Unmarshal(raw, v); err != nil {
+			return webAppInputError{fmt.Sprintf("некорректное значение для %s", field)}
+		}
+		return nil
+	}
+
+	switch field {
+	case "style":
+		if err := decode(&text); err != nil {
+			return err
+		}
+		if _, ok := stylePrompts[text]; !ok {
+			return webAppInputError{"неизвестный стиль"}
+		}
+		return b.setUserStyle(userID, text)
+	case "reply_lang":
+		if err := decode(&text); err != nil {
+			return err
+		}
+		if _, ok := languageNames[text]; text != "" && !ok {
+			return webAppInputError{"неизвестный язык"}
+		}
+		return b.setUserReplyLang(userID, text)
+	case "context_turns":
+		if err := decode(&number); err != nil {
+			return err
+		}
+		if number < 0 || number > maxContextTurns {
+			return webAppInputError{fmt.Sprintf("контекст - от 0 до %d пар сообщений", maxContextTurns)}
+		}
+		return b.setUserContextTurns(userID, number)
+	case "privacy":
+		if err := decode(&text); err != nil {
+			return err
+		}
+		if text != privacyStrict && text != privacyNormal {
+			return webAppInputError{"неизвестный режим приватности"}
+		}
+		if err := b.setUserPrivacy(userID, text); err != nil {
+			return err
+		}
+		// Как в /privacy: строгий режим стирает сохранённую историю, обычный начинает с чистого листа
+		if text == privacyStrict {
+			return b.clearStoredHistory(userID)
+		}
+		b.session.clear(userID)
+		return nil
+	case "ephemeral":
+		if err := decode(&text); err != nil {
+			return err
+		}
+		var ttl time.Duration
+		if text != "" {
+			parsed, err := parseEphemeralTTL(text)
+			if err != nil {
+				return webAppInputError{err.Error()}
+			}
+			ttl = parsed
+		}
+		return b.setUserEphemeral(userID, ttl)
+	case "quiet_hours":
+		if err := decode(&text); err != nil {
+			return err
+		}
+		if text != "" {
+			from, to, err := parseQuietHours(text)
+			if err != nil {
+				return webAppInputError{err.Error()}
+			}
+			text = from.Format("15:04") + "-" + to.Format("15:04")
+		}
+		return b.setUserQuietHours(userID, text)
+	}
+
+	setters := map[string]func(int64, bool) error{
+		"use_name":      b.setUserUseName,
+		"show_latency":  b.setUserShowLatency,
+		"paged_answers": b.setUserPagedAnswers,
+		"combine_input": b.setUserCombineInput,
+		"plain":         b.setUserPlain,
+		"use_city":      b.setUserLocationContext,
+		"quiet_silent":  b.setUserQuietSilent,
+	}
+	set, ok := setters[field]
+	if !ok {
+		return webAppInputError{fmt.Sprintf("настройку %s нельзя изменить", field)}
+	}
+	if err := decode(&flag); err != nil {
+		return err
+	}
+	return set(userID, flag)
+}
+
+// webAppHandler отдаёт панель настроек и её API:
+// GET api/settings - настройки пользователя, POST api/settings {"field", "value"} - изменить одну.
+// Пользователь определяется только по подписанной initData, присланной в заголовке.
+func (b *Bot) webAppHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch strings.TrimPrefix(r.URL.Path, b.webAppPath()) {
+		case "":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write(webAppHTML)
+			return
+		case "api/settings":
+		default:
+			http.NotFound(w, r)
+			return
+		}
+
+		userID, err := validateInitData(r.Header.Get(webAppInitDataHeader), b.api.Token, time.Now())
+		if err != nil {
+			b.metrics.inc("webapp_rejected")
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			var change struct {
+				Field string          `json:"field"`
+				Value json.RawMessage `json:"value"`
+			}
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, webAppMaxBody))
+			if err == nil {
+				err = json.Unmarshal(body, &change)
+			}
+			if err != nil {
+				http.Error(w, "bad request", http.StatusBadRequest)
+				return
+			}
+			if err := b.applyWebAppSetting(userID, change.Field, change.Value); err != nil {
+				var inputErr webAppInputError
+				if errors.As(err, &inputErr) {
+					http.Error(w, inputErr.msg, http.StatusBadRequest)
+					return
+				}
+				slog.Warn("не удалось сохранить настройку из Mini App", "bot", b.name, "user_id", userID, "field", change.Field, "error", err)
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		settings, err := b.webAppSettingsFor(userID)
+		if err != nil {
+			slog.Warn("не удалось прочитать настройки для Mini App", "bot", b.name, "user_id", userID, "error", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(settings)
+	}
+}
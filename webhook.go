@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	webhookMaxBody      = 1 << 20 // Обновление Telegram заведомо меньше мегабайта
+	webhookSecretHeader = "X-Telegram-Bot-Api-Secret-Token"
+)
+
+// webhookSecretPattern - допустимый secret_token по документации Bot API (пустой - сгенерировать)
+var webhookSecretPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{0,256}$`)
+
+// webhookPath - путь, на который Telegram присылает обновления бота; у каждого бота свой
+func (b *Bot) webhookPath() string {
+	return "/telegram/" + b.name
+}
+
+// setWebhook регистрирует вебхук с секретом: Telegram будет присылать его в заголовке каждого запроса.
+// secret_token в tgbotapi v5.5.1 не поддерживается, поэтому запрос собирается вручную.
+func (b *Bot) setWebhook(secret string) error {
+	params := tgbotapi.Params{
+		"url":          strings.TrimRight(b.cfg().WebhookURL, "/") + b.webhookPath(),
+		"secret_token": secret,
+	}
+	params.AddBool("drop_pending_updates", b.cfg().SkipPendingUpdates)
+	if _, err := b.api.MakeRequest("setWebhook", params); err != nil {
+		return fmt.Errorf("ошибка регистрации вебхука: %w", err)
+	}
+	return nil
+}
+
+// webhookHandler принимает обновления от Telegram. Запросы без правильного секрета отклоняются с 403:
+// адрес вебхука может утечь, а секрет знает только Telegram.
+func (b *Bot) webhookHandler(secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get(webhookSecretHeader)), []byte(secret)) != 1 {
+			b.metrics.inc("webhook_rejected")
+			slog.Warn("запрос на вебхук с неверным секретом", "bot", b.name, "remote", r.RemoteAddr)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		var update tgbotapi.Update
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, webhookMaxBody))
+		if err == nil {
+			err = json.Unmarshal(body, &update)
+		}
+		if err != nil || update.UpdateID == 0 {
+			b.metrics.inc("webhook_bad_request")
+			slog.Warn("некорректное тело запроса на вебхук", "bot", b.name, "error", err)
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		b.quotes.addFromUpdate(body)
+		b.queues.Push(updateQueueKey(update), update)
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// serveWebhooks регистрирует вебхуки всех ботов и принимает обновления, пока не отменён ctx.
+// Секрет берётся из WEBHOOK_SECRET, а если он не задан - генерируется при каждом запуске.
+// Тот же сервер отдаёт панели настроек ботов, открываемые кнопкой меню.
+func serveWebhooks(ctx context.Context, bots []*Bot, config *Config) error {
+	mux := http.NewServeMux()
+	for _, bot := range bots {
+		secret := config.WebhookSecret
+		if secret == "" {
+			secret = randomToken(32)
+		}
+		if err := bot.setWebhook(secret); err != nil {
+			return fmt.Errorf("@%s: %w", bot.name, err)
+		}
+		mux.Handle(bot.webhookPath(), bot.webhookHandler(secret))
+
+		// Панель настроек (Mini App) живёт на том же сервере: ей тоже нужен публичный https-адрес
+		mux.Handle(bot.webAppPath(), bot.webAppHandler())
+		if err := bot.setMenuButton(); err != nil {
+			log.Printf("@%s: %v", bot.name, err)
+		}
+	}
+
+	server := &http.Server{Addr: config.WebhookListen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+	log.Printf("Вебхуки слушают %s", config.WebhookListen)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("ошибка сервера вебхуков: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// UserSettings - все настройки пользователя из таблицы users (со значениями по умолчанию)
+type UserSettings struct {
+	Style        string
+	ShowLatency  bool
+	ReplyLang    string
+	UseName      bool
+	Privacy      string
+	ContextTurns int
+	Username     string
+	FirstName    string
+	Tier         string
+	Approved     bool
+	TrialUsed    int
+	PagedAnswers bool
+	CombineInput bool
+	Timezone     string
+	City         string
+	UseCity      bool
+	DigestTime   string
+	Plain        bool
+	Ephemeral    int // Срок жизни ответов в секундах, 0 - не удаляются
+	QuietHours   string
+	QuietSilent  bool
+	PromptKbd    bool
+}
+
+// getUserSettings читает строку пользователя целиком; если строки нет - возвращает значения по умолчанию
+func (b *Bot) getUserSettings(userID int64) (UserSettings, error) {
+	settings := UserSettings{Style: "friendly", UseName: true, Privacy: privacyNormal, ContextTurns: defaultContextTurns, Tier: "free"}
+	err := b.db.QueryRow(`
+		SELECT COALESCE(style, 'friendly'), COALESCE(show_latency, 0), COALESCE(reply_lang, ''), COALESCE(use_name, 1),
+			COALESCE(privacy, 'normal'), COALESCE(context_turns, 10),
+			COALESCE(username, ''), COALESCE(first_name, ''), COALESCE(tier, 'free'), COALESCE(approved, 0),
+			COALESCE(trial_used, 0), COALESCE(paged_answers, 0), COALESCE(combine_input, 0),
+			COALESCE(timezone, ''), COALESCE(city, ''), COALESCE(location_context, 0), COALESCE(digest_time, ''), COALESCE(plain_text, 0),
+			COALESCE(ephemeral_ttl, 0), COALESCE(quiet_hours, ''), COALESCE(quiet_silent, 0),
+			COALESCE(prompt_keyboard, 0)
+		FROM users WHERE user_id = ?`, userID).
+		Scan(&settings.Style, &settings.ShowLatency, &settings.ReplyLang, &settings.UseName, &settings.Privacy,
+			&settings.ContextTurns, &settings.Username, &settings.FirstName, &settings.Tier, &settings.Approved,
+			&settings.TrialUsed, &settings.PagedAnswers, &settings.CombineInput,
+			&settings.Timezone, &settings.City, &settings.UseCity, &settings.DigestTime, &settings.Plain,
+			&settings.Ephemeral, &settings.QuietHours, &settings.QuietSilent,
+			&settings.PromptKbd)
+	if err == sql.ErrNoRows {
+		return settings, nil
+	}
+	if err != nil {
+		return settings, fmt.Errorf("ошибка при получении настроек пользователя: %w", err)
+	}
+	return settings, nil
+}
+
+// countUserRows считает строки пользователя в таблице; отсутствующая таблица даёт 0
+func (b *Bot) countUserRows(table string, userID int64) (int, error) {
+	exists, err := tableExists(b.db, table)
+	if err != nil || !exists {
+		return 0, err
+	}
+
+	var count int
+	err = b.db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE user_id = ?", table), userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка подсчёта строк в %s: %w", table, err)
+	}
+	return count, nil
+}
+
+// whoami обрабатывает команду /whoami: показывает, что бот хранит о пользователе
+func (b *Bot) whoami(message *tgbotapi.Message) error {
+	userID := senderID(message)
+
+	settings, err := b.getUserSettings(userID)
+	if err != nil {
+		b.reply(message, "Не удалось получить данные, попробуй позже.")
+		return err
+	}
+	memories, err := b.countUserRows("memories", userID)
+	if err != nil {
+		return err
+	}
+	history, err := b.countUserRows("history", userID)
+	if err != nil {
+		return err
+	}
+
+	return b.reply(message, formatWhoami(userID, settings, history, memories))
+}
+
+// settings обрабатывает команду /settings: показывает текущие настройки и как их поменять
+func (b *Bot) settings(message *tgbotapi.Message) error {
+	settings, err := b.getUserSettings(senderID(message))
+	if err != nil {
+		b.reply(message, "Не удалось получить настройки, попробуй позже.")
+		return err
+	}
+	return b.reply(message, formatSettings(settings))
+}
+
+// formatSettings собирает список настроек с командами для их изменения
+func formatSettings(settings UserSettings) string {
+	replyLang := "авто"
+	if settings.ReplyLang != "" {
+		replyLang = settings.ReplyLang
+	}
+	contextTurns := "без истории"
+	if settings.ContextTurns > 0 {
+		contextTurns = fmt.Sprintf("%d пар сообщений", settings.ContextTurns)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("⚙️ Настройки\n\n")
+	fmt.Fprintf(&sb, "Стиль: %s - /style\n", styleTitle(settings.Style))
+	fmt.Fprintf(&sb, "Язык ответов: %s - /replylang\n", replyLang)
+	fmt.Fprintf(&sb, "Контекст: %s - /context\n", contextTurns)
+	fmt.Fprintf(&sb, "Обращение по имени: %s - /name\n", onOff(settings.UseName))
+	fmt.Fprintf(&sb, "Футер с задержкой: %s - /latency\n", onOff(settings.ShowLatency))
+	fmt.Fprintf(&sb, "Длинные ответы страницами: %s - /pages\n", onOff(settings.PagedAnswers))
+	fmt.Fprintf(&sb, "Склейка сообщений подряд: %s - /combine\n", onOff(settings.CombineInput))
+	fmt.Fprintf(&sb, "Простой текст: %s - /plain\n", onOff(settings.Plain))
+	fmt.Fprintf(&sb, "Клавиатура с промптами: %s - /kbd\n", onOff(settings.PromptKbd))
+	if settings.Ephemeral > 0 {
+		fmt.Fprintf(&sb, "Исчезающие ответы: через %s - /ephemeral\n", formatTTL(time.Duration(settings.Ephemeral)*time.Second))
+	} else {
+		sb.WriteString("Исчезающие ответы: выкл - /ephemeral\n")
+	}
+	fmt.Fprintf(&sb, "Город в ответах: %s - /location\n", onOff(settings.UseCity))
+	if settings.DigestTime != "" {
+		fmt.Fprintf(&sb, "Сводка за день: в %s - /digest_off\n", settings.DigestTime)
+	} else {
+		sb.WriteString("Сводка за день: выкл - /digest_subscribe\n")
+	}
+	fmt.Fprintf(&sb, "Тихие часы: %s - /quiet\n", formatQuietHours(settings.QuietHours, settings.QuietSilent))
+	fmt.Fprintf(&sb, "Приватность: %s - /privacy", settings.Privacy)
+	return sb.String()
+}
+
+// formatWhoami собирает читаемую карточку пользователя
+func formatWhoami(userID int64, settings UserSettings, history, memories int) string {
+	replyLang := "авто"
+	if settings.ReplyLang != "" {
+		replyLang = settings.ReplyLang
+	}
+
+	var sb strings.Builder
+	sb.WriteString("👤 Что я о тебе храню\n\n")
+	fmt.Fprintf(&sb, "Telegram ID: %d\n", userID)
+	if settings.Username != "" {
+		fmt.Fprintf(&sb, "Username: @%s\n", settings.Username)
+	}
+	if settings.FirstName != "" {
+		fmt.Fprintf(&sb, "Имя: %s\n", settings.FirstName)
+	}
+	fmt.Fprintf(&sb, "Стиль: %s\n", styleTitle(settings.Style))
+	fmt.Fprintf(&sb, "Модель: %s\n", shortModelName(MODEL))
+	fmt.Fprintf(&sb, "Язык ответов: %s\n", replyLang)
+	fmt.Fprintf(&sb, "Обращение по имени: %s\n", onOff(settings.UseName))
+	fmt.Fprintf(&sb, "Футер с задержкой: %s\n", onOff(settings.ShowLatency))
+	fmt.Fprintf(&sb, "Приватность: %s\n", settings.Privacy)
+	fmt.Fprintf(&sb, "Окно контекста: %d\n", settings.ContextTurns)
+	if settings.Timezone != "" {
+		fmt.Fprintf(&sb, "Часовой пояс: %s\n", settings.Timezone)
+	}
+	if settings.City != "" {
+		fmt.Fprintf(&sb, "Город: %s\n", settings.City)
+	}
+	fmt.Fprintf(&sb, "\nСообщений в истории: %d\n", history)
+	fmt.Fprintf(&sb, "Фактов в памяти: %d", memories)
+	return sb.String()
+}
+
+// styleTitle возвращает название стиля для показа пользователю
+func styleTitle(style string) string {
+	switch style {
+	case "official":
+		return "Официальный 🧐"
+	case "meme":
+		return "Мемный 🤪"
+	}
+	return "Дружелюбный 😊"
+}
+
+// onOff переводит флаг в "вкл"/"выкл"
+func onOff(value bool) string {
+	if value {
+		return "вкл"
+	}
+	return "выкл"
+}